@@ -735,6 +735,26 @@ func (m *mockChannelState) Received() uint64 {
 	return m.received
 }
 
+func (m *mockChannelState) TotalBlocks() uint64 {
+	panic("implement me")
+}
+
+func (m *mockChannelState) SentBlocks() uint64 {
+	panic("implement me")
+}
+
+func (m *mockChannelState) ReceivedBlocks() uint64 {
+	panic("implement me")
+}
+
+func (m *mockChannelState) QueuedBlocks() uint64 {
+	panic("implement me")
+}
+
+func (m *mockChannelState) Progress() datatransfer.ChannelProgress {
+	panic("implement me")
+}
+
 func (m *mockChannelState) ChannelID() datatransfer.ChannelID {
 	return m.chid
 }
@@ -813,3 +833,7 @@ func (m *mockChannelState) Stages() *datatransfer.ChannelStages {
 func (m *mockChannelState) ReceivedCids() []cid.Cid {
 	panic("implement me")
 }
+
+func (m *mockChannelState) ReceivedCidsIter(fn func(cid.Cid) error) error {
+	panic("implement me")
+}
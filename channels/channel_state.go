@@ -12,6 +12,7 @@ import (
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/channels/internal"
+	"github.com/filecoin-project/go-data-transfer/encoding"
 )
 
 // channelState is immutable channel data plus mutable state
@@ -30,6 +31,8 @@ type channelState struct {
 	recipient peer.ID
 	// expected amount of data to be transferred
 	totalSize uint64
+	// expected number of blocks to be transferred (0 if unknown)
+	totalBlocks uint64
 	// current status of this deal
 	status datatransfer.Status
 	// isPull indicates if this is a push or pull request
@@ -40,6 +43,12 @@ type channelState struct {
 	sent uint64
 	// total bytes received by this node (0 if sender)
 	received uint64
+	// number of distinct blocks queued for sending (0 if receiver)
+	queuedBlocks uint64
+	// number of distinct blocks sent from this node (0 if receiver)
+	sentBlocks uint64
+	// number of distinct blocks received by this node (0 if sender)
+	receivedBlocks uint64
 	// more informative status on a channel
 	message string
 	// additional vouchers
@@ -49,6 +58,8 @@ type channelState struct {
 	voucherResultDecoder DecoderByTypeFunc
 	voucherDecoder       DecoderByTypeFunc
 	channelCIDsReader    ChannelCIDsReader
+	channelCIDsIterator  ChannelCIDsIterator
+	progress             datatransfer.ChannelProgress
 
 	// stages tracks the timeline of events related to a data transfer, for
 	// traceability purposes.
@@ -81,7 +92,7 @@ func (c channelState) BaseCID() cid.Cid { return c.baseCid }
 func (c channelState) Selector() ipld.Node {
 	builder := basicnode.Prototype.Any.NewBuilder()
 	reader := bytes.NewReader(c.selector.Raw)
-	err := dagcbor.Decoder(builder, reader)
+	err := dagcbor.Decode(builder, reader)
 	if err != nil {
 		log.Error(err)
 	}
@@ -94,7 +105,7 @@ func (c channelState) Voucher() datatransfer.Voucher {
 		return nil
 	}
 	decoder, _ := c.voucherDecoder(c.vouchers[0].Type)
-	encodable, _ := decoder.DecodeFromCbor(c.vouchers[0].Voucher.Raw)
+	encodable, _ := encoding.DecodeItem(decoder, c.vouchers[0].Codec, c.vouchers[0].Voucher.Raw)
 	return encodable.(datatransfer.Voucher)
 }
 
@@ -107,6 +118,12 @@ func (c channelState) ReceivedCids() []cid.Cid {
 	return receivedCids
 }
 
+// ReceivedCidsIter calls fn with each cid received so far on this channel,
+// reading them from the channel's cid list as it goes
+func (c channelState) ReceivedCidsIter(fn func(cid.Cid) error) error {
+	return c.channelCIDsIterator(c.ChannelID(), fn)
+}
+
 // Sender returns the peer id for the node that is sending data
 func (c channelState) Sender() peer.ID { return c.sender }
 
@@ -116,6 +133,18 @@ func (c channelState) Recipient() peer.ID { return c.recipient }
 // TotalSize returns the total size for the data being transferred
 func (c channelState) TotalSize() uint64 { return c.totalSize }
 
+// TotalBlocks returns the number of blocks the sender expects to transfer
+func (c channelState) TotalBlocks() uint64 { return c.totalBlocks }
+
+// SentBlocks returns the number of distinct blocks sent
+func (c channelState) SentBlocks() uint64 { return c.sentBlocks }
+
+// ReceivedBlocks returns the number of distinct blocks received
+func (c channelState) ReceivedBlocks() uint64 { return c.receivedBlocks }
+
+// QueuedBlocks returns the number of distinct blocks queued for sending
+func (c channelState) QueuedBlocks() uint64 { return c.queuedBlocks }
+
 // IsPull returns whether this is a pull request based on who initiated it
 func (c channelState) IsPull() bool {
 	return c.isPull
@@ -136,7 +165,7 @@ func (c channelState) Vouchers() []datatransfer.Voucher {
 	vouchers := make([]datatransfer.Voucher, 0, len(c.vouchers))
 	for _, encoded := range c.vouchers {
 		decoder, _ := c.voucherDecoder(encoded.Type)
-		encodable, _ := decoder.DecodeFromCbor(encoded.Voucher.Raw)
+		encodable, _ := encoding.DecodeItem(decoder, encoded.Codec, encoded.Voucher.Raw)
 		vouchers = append(vouchers, encodable.(datatransfer.Voucher))
 	}
 	return vouchers
@@ -144,13 +173,13 @@ func (c channelState) Vouchers() []datatransfer.Voucher {
 
 func (c channelState) LastVoucher() datatransfer.Voucher {
 	decoder, _ := c.voucherDecoder(c.vouchers[len(c.vouchers)-1].Type)
-	encodable, _ := decoder.DecodeFromCbor(c.vouchers[len(c.vouchers)-1].Voucher.Raw)
+	encodable, _ := encoding.DecodeItem(decoder, c.vouchers[len(c.vouchers)-1].Codec, c.vouchers[len(c.vouchers)-1].Voucher.Raw)
 	return encodable.(datatransfer.Voucher)
 }
 
 func (c channelState) LastVoucherResult() datatransfer.VoucherResult {
 	decoder, _ := c.voucherResultDecoder(c.voucherResults[len(c.voucherResults)-1].Type)
-	encodable, _ := decoder.DecodeFromCbor(c.voucherResults[len(c.voucherResults)-1].VoucherResult.Raw)
+	encodable, _ := encoding.DecodeItem(decoder, c.voucherResults[len(c.voucherResults)-1].Codec, c.voucherResults[len(c.voucherResults)-1].VoucherResult.Raw)
 	return encodable.(datatransfer.VoucherResult)
 }
 
@@ -158,7 +187,7 @@ func (c channelState) VoucherResults() []datatransfer.VoucherResult {
 	voucherResults := make([]datatransfer.VoucherResult, 0, len(c.voucherResults))
 	for _, encoded := range c.voucherResults {
 		decoder, _ := c.voucherResultDecoder(encoded.Type)
-		encodable, _ := decoder.DecodeFromCbor(encoded.VoucherResult.Raw)
+		encodable, _ := encoding.DecodeItem(decoder, encoded.Codec, encoded.VoucherResult.Raw)
 		voucherResults = append(voucherResults, encodable.(datatransfer.VoucherResult))
 	}
 	return voucherResults
@@ -190,7 +219,17 @@ func (c channelState) Stages() *datatransfer.ChannelStages {
 	return c.stages
 }
 
-func fromInternalChannelState(c internal.ChannelState, voucherDecoder DecoderByTypeFunc, voucherResultDecoder DecoderByTypeFunc, channelCIDsReader ChannelCIDsReader) datatransfer.ChannelState {
+// Progress returns an estimate of how far along the transfer is
+func (c channelState) Progress() datatransfer.ChannelProgress {
+	return c.progress
+}
+
+func fromInternalChannelState(c internal.ChannelState, voucherDecoder DecoderByTypeFunc, voucherResultDecoder DecoderByTypeFunc, channelCIDsReader ChannelCIDsReader, channelCIDsIterator ChannelCIDsIterator, progress *progressTracker) datatransfer.ChannelState {
+	chid := datatransfer.ChannelID{Initiator: c.Initiator, Responder: c.Responder, ID: c.TransferID}
+	transferred, blocks := c.Received, c.ReceivedBlocks
+	if c.SelfPeer == c.Sender {
+		transferred, blocks = c.Sent, c.SentBlocks
+	}
 	return channelState{
 		selfPeer:             c.SelfPeer,
 		isPull:               c.Initiator == c.Recipient,
@@ -200,17 +239,23 @@ func fromInternalChannelState(c internal.ChannelState, voucherDecoder DecoderByT
 		sender:               c.Sender,
 		recipient:            c.Recipient,
 		totalSize:            c.TotalSize,
+		totalBlocks:          c.TotalBlocks,
 		status:               c.Status,
 		queued:               c.Queued,
 		sent:                 c.Sent,
 		received:             c.Received,
+		queuedBlocks:         c.QueuedBlocks,
+		sentBlocks:           c.SentBlocks,
+		receivedBlocks:       c.ReceivedBlocks,
 		message:              c.Message,
 		vouchers:             c.Vouchers,
 		voucherResults:       c.VoucherResults,
 		voucherResultDecoder: voucherResultDecoder,
 		voucherDecoder:       voucherDecoder,
 		channelCIDsReader:    channelCIDsReader,
+		channelCIDsIterator:  channelCIDsIterator,
 		stages:               c.Stages,
+		progress:             progress.progress(chid, transferred, blocks, c.TotalSize, c.TotalBlocks),
 	}
 }
 
@@ -3,6 +3,7 @@ package channels
 import (
 	"context"
 	"errors"
+	"os"
 	"time"
 
 	"github.com/ipfs/go-cid"
@@ -14,7 +15,7 @@ import (
 	"golang.org/x/xerrors"
 
 	versioning "github.com/filecoin-project/go-ds-versioning/pkg"
-	versionedfsm "github.com/filecoin-project/go-ds-versioning/pkg/fsm"
+	versionedds "github.com/filecoin-project/go-ds-versioning/pkg/datastore"
 	"github.com/filecoin-project/go-statemachine/fsm"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
@@ -29,6 +30,8 @@ type DecoderByTypeFunc func(identifier datatransfer.TypeIdentifier) (encoding.De
 
 type ChannelCIDsReader func(chid datatransfer.ChannelID) ([]cid.Cid, error)
 
+type ChannelCIDsIterator func(chid datatransfer.ChannelID, fn func(cid.Cid) error) error
+
 type Notifier func(datatransfer.Event, datatransfer.ChannelState)
 
 // ErrNotFound is returned when a channel cannot be found with a given channel ID
@@ -47,8 +50,13 @@ func NewErrNotFound(chid datatransfer.ChannelID) error {
 // ErrWrongType is returned when a caller attempts to change the type of implementation data after setting it
 var ErrWrongType = errors.New("Cannot change type of implementation specific data after setting it")
 
+// CurrentVersion is the version of the channel state records in the
+// datastore. Older records are migrated to it on Start.
+const CurrentVersion = versioning.VersionKey("3")
+
 // Channels is a thread safe list of channels
 type Channels struct {
+	store                ChannelStore
 	notifier             Notifier
 	voucherDecoder       DecoderByTypeFunc
 	voucherResultDecoder DecoderByTypeFunc
@@ -56,6 +64,7 @@ type Channels struct {
 	migrateStateMachines func(context.Context) error
 	cidLists             cidlists.CIDLists
 	seenCIDs             *cidsets.CIDSetManager
+	progress             *progressTracker
 }
 
 // ChannelEnvironment -- just a proxy for DTNetwork for now
@@ -73,21 +82,38 @@ func New(ds datastore.Batching,
 	voucherDecoder DecoderByTypeFunc,
 	voucherResultDecoder DecoderByTypeFunc,
 	env ChannelEnvironment,
-	selfPeer peer.ID) (*Channels, error) {
+	selfPeer peer.ID,
+	options ...Option) (*Channels, error) {
 
 	seenCIDsDS := namespace.Wrap(ds, datastore.NewKey("seencids"))
 	c := &Channels{
 		cidLists:             cidLists,
 		seenCIDs:             cidsets.NewCIDSetManager(seenCIDsDS),
+		progress:             newProgressTracker(),
 		notifier:             notifier,
 		voucherDecoder:       voucherDecoder,
 		voucherResultDecoder: voucherResultDecoder,
 	}
-	channelMigrations, err := migrations.GetChannelStateMigrations(selfPeer, cidLists)
-	if err != nil {
-		return nil, err
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.store == nil {
+		channelMigrations, err := migrations.GetChannelStateMigrations(selfPeer, cidLists, c.seenCIDs)
+		if err != nil {
+			return nil, err
+		}
+		// the versioned datastore fails every call until the migrations
+		// have run on Start
+		vds, migrate := versionedds.NewVersionedDatastore(ds, channelMigrations, CurrentVersion)
+		c.store = NewDatastoreChannelStore(vds)
+		c.migrateStateMachines = migrate
+	} else {
+		c.migrateStateMachines = func(context.Context) error { return nil }
 	}
-	c.stateMachines, c.migrateStateMachines, err = versionedfsm.NewVersionedFSM(ds, fsm.Parameters{
+
+	var err error
+	c.stateMachines, err = fsm.New(storeDatastore{c.store}, fsm.Parameters{
 		Environment:     env,
 		StateType:       internal.ChannelState{},
 		StateKeyField:   "Status",
@@ -95,16 +121,41 @@ func New(ds datastore.Batching,
 		StateEntryFuncs: ChannelStateEntryFuncs,
 		Notifier:        c.dispatch,
 		FinalityStates:  ChannelFinalityStates,
-	}, channelMigrations, versioning.VersionKey("2"))
+	})
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
-// Start migrates the channel data store as needed
+// Start migrates the channel data store as needed, then checks the records of
+// blocks seen on each channel agree with its data counts
 func (c *Channels) Start(ctx context.Context) error {
-	return c.migrateStateMachines(ctx)
+	if err := c.migrateStateMachines(ctx); err != nil {
+		return err
+	}
+	return c.reconcileSeenCIDs()
+}
+
+// Stop waits for events already sent to channels to be processed, stops the
+// channel state machines, and flushes the records of blocks seen on channels
+func (c *Channels) Stop(ctx context.Context) error {
+	if err := c.stateMachines.Stop(ctx); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+// Flush writes any buffered records of blocks seen on channels, and of cids
+// received on them, to the datastore. It should be called before shutting
+// down.
+func (c *Channels) Flush() error {
+	if flushable, ok := c.cidLists.(cidlists.FlushableCIDLists); ok {
+		if err := flushable.Flush(); err != nil {
+			return err
+		}
+	}
+	return c.seenCIDs.Flush()
 }
 
 func (c *Channels) dispatch(eventName fsm.EventName, channel fsm.StateType) {
@@ -122,7 +173,7 @@ func (c *Channels) dispatch(eventName fsm.EventName, channel fsm.StateType) {
 		Timestamp: time.Now(),
 	}
 
-	c.notifier(evt, fromInternalChannelState(realChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList))
+	c.notifier(evt, fromInternalChannelState(realChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList, c.cidLists.IterateList, c.progress))
 
 	// When the channel has been cleaned up, remove the caches of seen cids
 	if evt.Code == datatransfer.CleanupComplete {
@@ -131,6 +182,7 @@ func (c *Channels) dispatch(eventName fsm.EventName, channel fsm.StateType) {
 			Responder: realChannel.Responder,
 			ID:        realChannel.TransferID,
 		}
+		c.progress.remove(chid)
 		err := c.removeSeenCIDCaches(chid)
 		if err != nil {
 			log.Errorf("failed to clean up channel %s: %s", err)
@@ -148,7 +200,7 @@ func (c *Channels) CreateNew(selfPeer peer.ID, tid datatransfer.TransferID, base
 		responder = dataSender
 	}
 	chid := datatransfer.ChannelID{Initiator: initiator, Responder: responder, ID: tid}
-	voucherBytes, err := encoding.Encode(voucher)
+	voucherBytes, voucherCodec, err := encoding.EncodeItem(voucher)
 	if err != nil {
 		return datatransfer.ChannelID{}, err
 	}
@@ -172,6 +224,7 @@ func (c *Channels) CreateNew(selfPeer peer.ID, tid datatransfer.TransferID, base
 				Voucher: &cbg.Deferred{
 					Raw: voucherBytes,
 				},
+				Codec: voucherCodec,
 			},
 		},
 		Status: datatransfer.Requested,
@@ -196,7 +249,7 @@ func (c *Channels) InProgress() (map[datatransfer.ChannelID]datatransfer.Channel
 	channels := make(map[datatransfer.ChannelID]datatransfer.ChannelState, len(internalChannels))
 	for _, internalChannel := range internalChannels {
 		channels[datatransfer.ChannelID{ID: internalChannel.TransferID, Responder: internalChannel.Responder, Initiator: internalChannel.Initiator}] =
-			fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList)
+			fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList, c.cidLists.IterateList, c.progress)
 	}
 	return channels, nil
 }
@@ -209,7 +262,7 @@ func (c *Channels) GetByID(ctx context.Context, chid datatransfer.ChannelID) (da
 	if err != nil {
 		return nil, NewErrNotFound(chid)
 	}
-	return fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList), nil
+	return fromInternalChannelState(internalChannel, c.voucherDecoder, c.voucherResultDecoder, c.cidLists.ReadList, c.cidLists.IterateList, c.progress), nil
 }
 
 // Accept marks a data transfer as accepted
@@ -217,6 +270,12 @@ func (c *Channels) Accept(chid datatransfer.ChannelID) error {
 	return c.send(chid, datatransfer.Accept)
 }
 
+// BeginValidation marks a data transfer request as being validated
+// asynchronously
+func (c *Channels) BeginValidation(chid datatransfer.ChannelID) error {
+	return c.send(chid, datatransfer.BeginValidation)
+}
+
 // Restart marks a data transfer as restarted
 func (c *Channels) Restart(chid datatransfer.ChannelID) error {
 	return c.send(chid, datatransfer.Restart)
@@ -226,18 +285,24 @@ func (c *Channels) CompleteCleanupOnRestart(chid datatransfer.ChannelID) error {
 	return c.send(chid, datatransfer.CompleteCleanupOnRestart)
 }
 
-func (c *Channels) DataSent(chid datatransfer.ChannelID, k cid.Cid, delta uint64) error {
+// DataSent records a block sent on a channel, returning true if the block
+// had not been sent on it before and so was counted
+func (c *Channels) DataSent(chid datatransfer.ChannelID, k cid.Cid, delta uint64) (bool, error) {
 	return c.fireProgressEvent(chid, datatransfer.DataSent, datatransfer.DataSentProgress, k, delta)
 }
 
-func (c *Channels) DataQueued(chid datatransfer.ChannelID, k cid.Cid, delta uint64) error {
+// DataQueued records a block queued for sending on a channel, returning true
+// if the block had not been queued on it before and so was counted
+func (c *Channels) DataQueued(chid datatransfer.ChannelID, k cid.Cid, delta uint64) (bool, error) {
 	return c.fireProgressEvent(chid, datatransfer.DataQueued, datatransfer.DataQueuedProgress, k, delta)
 }
 
-func (c *Channels) DataReceived(chid datatransfer.ChannelID, k cid.Cid, delta uint64) error {
+// DataReceived records a block received on a channel, returning true if the
+// block had not been received on it before and so was counted
+func (c *Channels) DataReceived(chid datatransfer.ChannelID, k cid.Cid, delta uint64) (bool, error) {
 	err := c.cidLists.AppendList(chid, k)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	return c.fireProgressEvent(chid, datatransfer.DataReceived, datatransfer.DataReceivedProgress, k, delta)
@@ -265,20 +330,20 @@ func (c *Channels) ResumeResponder(chid datatransfer.ChannelID) error {
 
 // NewVoucher records a new voucher for this channel
 func (c *Channels) NewVoucher(chid datatransfer.ChannelID, voucher datatransfer.Voucher) error {
-	voucherBytes, err := encoding.Encode(voucher)
+	voucherBytes, voucherCodec, err := encoding.EncodeItem(voucher)
 	if err != nil {
 		return err
 	}
-	return c.send(chid, datatransfer.NewVoucher, voucher.Type(), voucherBytes)
+	return c.send(chid, datatransfer.NewVoucher, voucher.Type(), voucherCodec, voucherBytes)
 }
 
 // NewVoucherResult records a new voucher result for this channel
 func (c *Channels) NewVoucherResult(chid datatransfer.ChannelID, voucherResult datatransfer.VoucherResult) error {
-	voucherResultBytes, err := encoding.Encode(voucherResult)
+	voucherResultBytes, voucherResultCodec, err := encoding.EncodeItem(voucherResult)
 	if err != nil {
 		return err
 	}
-	return c.send(chid, datatransfer.NewVoucherResult, voucherResult.Type(), voucherResultBytes)
+	return c.send(chid, datatransfer.NewVoucherResult, voucherResult.Type(), voucherResultCodec, voucherResultBytes)
 }
 
 // Complete indicates responder has completed sending/receiving data
@@ -334,22 +399,55 @@ func (c *Channels) SendDataError(chid datatransfer.ChannelID, err error) error {
 	return c.send(chid, datatransfer.SendDataError, err)
 }
 
+// BlockRejected records that a block validator skipped a block or paused the
+// channel, and why
+func (c *Channels) BlockRejected(chid datatransfer.ChannelID, reason error) error {
+	return c.send(chid, datatransfer.BlockRejected, reason)
+}
+
+// TotalSizeKnown records the total number of blocks and bytes the sender
+// expects to transfer on the channel
+func (c *Channels) TotalSizeKnown(chid datatransfer.ChannelID, totalBlocks uint64, totalBytes uint64) error {
+	return c.send(chid, datatransfer.TotalSizeKnown, totalBlocks, totalBytes)
+}
+
 // HasChannel returns true if the given channel id is being tracked
 func (c *Channels) HasChannel(chid datatransfer.ChannelID) (bool, error) {
 	return c.stateMachines.Has(chid)
 }
 
+// Delete removes a channel along with its list of received cids and its
+// caches of seen blocks. It is meant for repairing a datastore while no
+// transfers are running: it fires no events, and does not stop a state
+// machine already running for the channel.
+func (c *Channels) Delete(chid datatransfer.ChannelID) error {
+	has, err := c.stateMachines.Has(chid)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return NewErrNotFound(chid)
+	}
+	if err := c.removeSeenCIDCaches(chid); err != nil {
+		return err
+	}
+	if err := c.cidLists.DeleteList(chid); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.progress.remove(chid)
+	return c.store.Delete(chid)
+}
+
 // removeSeenCIDCaches cleans up the caches of "seen" blocks, ie
 // blocks that have already been queued / sent / received
 func (c *Channels) removeSeenCIDCaches(chid datatransfer.ChannelID) error {
-	progressStates := []datatransfer.EventCode{
-		datatransfer.DataQueuedProgress,
-		datatransfer.DataSentProgress,
-		datatransfer.DataReceivedProgress,
-	}
-	for _, evt := range progressStates {
-		sid := cidsets.SetID(chid.String() + "/" + datatransfer.Events[evt])
-		err := c.seenCIDs.DeleteSet(sid)
+	dataEvents := []datatransfer.EventCode{
+		datatransfer.DataQueued,
+		datatransfer.DataSent,
+		datatransfer.DataReceived,
+	}
+	for _, evt := range dataEvents {
+		err := c.seenCIDs.DeleteSet(internal.SeenCIDsSetID(chid, evt))
 		if err != nil {
 			return err
 		}
@@ -361,27 +459,31 @@ func (c *Channels) removeSeenCIDCaches(chid datatransfer.ChannelID) error {
 // queuing / sending / receiving blocks.
 // These events are fired only for new blocks (not for example if
 // a block is resent)
-func (c *Channels) fireProgressEvent(chid datatransfer.ChannelID, evt datatransfer.EventCode, progressEvt datatransfer.EventCode, k cid.Cid, delta uint64) error {
+func (c *Channels) fireProgressEvent(chid datatransfer.ChannelID, evt datatransfer.EventCode, progressEvt datatransfer.EventCode, k cid.Cid, delta uint64) (bool, error) {
 	if err := c.checkChannelExists(chid, evt); err != nil {
-		return err
+		return false, err
 	}
 
 	// Check if the block has already been seen
-	sid := cidsets.SetID(chid.String() + "/" + datatransfer.Events[evt])
-	seen, err := c.seenCIDs.InsertSetCID(sid, k)
+	seen, err := c.seenCIDs.InsertSetCIDSize(internal.SeenCIDsSetID(chid, evt), k, delta)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// If the block has not been seen before, fire the progress event
 	if !seen {
+		// throughput is measured on the data that has actually left or
+		// arrived at this node, not on what is queued
+		if evt != datatransfer.DataQueued {
+			c.progress.record(chid, delta)
+		}
 		if err := c.stateMachines.Send(chid, progressEvt, delta); err != nil {
-			return err
+			return false, err
 		}
 	}
 
 	// Fire the regular event
-	return c.stateMachines.Send(chid, evt)
+	return !seen, c.stateMachines.Send(chid, evt)
 }
 
 func (c *Channels) send(chid datatransfer.ChannelID, code datatransfer.EventCode, args ...interface{}) error {
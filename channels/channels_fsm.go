@@ -8,6 +8,7 @@ import (
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/channels/internal"
+	"github.com/filecoin-project/go-data-transfer/encoding"
 )
 
 var log = logging.Logger("data-transfer")
@@ -29,8 +30,13 @@ var ChannelEvents = fsm.Events{
 		chst.AddLog("")
 		return nil
 	}),
+	// Responder has started validating the Open channel request asynchronously
+	fsm.Event(datatransfer.BeginValidation).From(datatransfer.Requested).To(datatransfer.Validating).Action(func(chst *internal.ChannelState) error {
+		chst.AddLog("")
+		return nil
+	}),
 	// Remote peer has accepted the Open channel request
-	fsm.Event(datatransfer.Accept).From(datatransfer.Requested).To(datatransfer.Ongoing).Action(func(chst *internal.ChannelState) error {
+	fsm.Event(datatransfer.Accept).FromMany(datatransfer.Requested, datatransfer.Validating).To(datatransfer.Ongoing).Action(func(chst *internal.ChannelState) error {
 		chst.AddLog("")
 		return nil
 	}),
@@ -50,6 +56,7 @@ var ChannelEvents = fsm.Events{
 	fsm.Event(datatransfer.DataReceivedProgress).FromMany(transferringStates...).ToNoChange().
 		Action(func(chst *internal.ChannelState, delta uint64) error {
 			chst.Received += delta
+			chst.ReceivedBlocks++
 			chst.AddLog("received data")
 			return nil
 		}),
@@ -60,6 +67,7 @@ var ChannelEvents = fsm.Events{
 	fsm.Event(datatransfer.DataSentProgress).FromMany(transferringStates...).ToNoChange().
 		Action(func(chst *internal.ChannelState, delta uint64) error {
 			chst.Sent += delta
+			chst.SentBlocks++
 			chst.AddLog("sending data")
 			return nil
 		}),
@@ -70,6 +78,7 @@ var ChannelEvents = fsm.Events{
 	fsm.Event(datatransfer.DataQueuedProgress).FromMany(transferringStates...).ToNoChange().
 		Action(func(chst *internal.ChannelState, delta uint64) error {
 			chst.Queued += delta
+			chst.QueuedBlocks++
 			chst.AddLog("")
 			return nil
 		}),
@@ -88,6 +97,30 @@ var ChannelEvents = fsm.Events{
 		chst.AddLog("data transfer request timed out: %s", chst.Message)
 		return nil
 	}),
+	fsm.Event(datatransfer.BlockRejected).FromAny().ToNoChange().Action(func(chst *internal.ChannelState, err error) error {
+		chst.Message = err.Error()
+		chst.AddLog("block rejected: %s", chst.Message)
+		return nil
+	}),
+	fsm.Event(datatransfer.TotalSizeKnown).FromAny().ToNoChange().Action(func(chst *internal.ChannelState, totalBlocks uint64, totalBytes uint64) error {
+		chst.TotalBlocks = totalBlocks
+		chst.TotalSize = totalBytes
+		chst.AddLog("total size known: %d blocks, %d bytes", totalBlocks, totalBytes)
+		return nil
+	}),
+	fsm.Event(datatransfer.DataCountsReconciled).FromAny().ToNoChange().
+		Action(func(chst *internal.ChannelState, evt datatransfer.EventCode, blocks uint64, bytes uint64) error {
+			switch evt {
+			case datatransfer.DataQueued:
+				chst.QueuedBlocks, chst.Queued = blocks, bytes
+			case datatransfer.DataSent:
+				chst.SentBlocks, chst.Sent = blocks, bytes
+			case datatransfer.DataReceived:
+				chst.ReceivedBlocks, chst.Received = blocks, bytes
+			}
+			chst.AddLog("%s count reconciled to %d blocks, %d bytes", datatransfer.Events[evt], blocks, bytes)
+			return nil
+		}),
 	fsm.Event(datatransfer.Error).FromAny().To(datatransfer.Failing).Action(func(chst *internal.ChannelState, err error) error {
 		chst.Message = err.Error()
 		chst.AddLog("data transfer erred: %s", chst.Message)
@@ -95,15 +128,15 @@ var ChannelEvents = fsm.Events{
 	}),
 
 	fsm.Event(datatransfer.NewVoucher).FromAny().ToNoChange().
-		Action(func(chst *internal.ChannelState, vtype datatransfer.TypeIdentifier, voucherBytes []byte) error {
-			chst.Vouchers = append(chst.Vouchers, internal.EncodedVoucher{Type: vtype, Voucher: &cbg.Deferred{Raw: voucherBytes}})
+		Action(func(chst *internal.ChannelState, vtype datatransfer.TypeIdentifier, codec encoding.Codec, voucherBytes []byte) error {
+			chst.Vouchers = append(chst.Vouchers, internal.EncodedVoucher{Type: vtype, Voucher: &cbg.Deferred{Raw: voucherBytes}, Codec: codec})
 			chst.AddLog("got new voucher")
 			return nil
 		}),
 	fsm.Event(datatransfer.NewVoucherResult).FromAny().ToNoChange().
-		Action(func(chst *internal.ChannelState, vtype datatransfer.TypeIdentifier, voucherResultBytes []byte) error {
+		Action(func(chst *internal.ChannelState, vtype datatransfer.TypeIdentifier, codec encoding.Codec, voucherResultBytes []byte) error {
 			chst.VoucherResults = append(chst.VoucherResults,
-				internal.EncodedVoucherResult{Type: vtype, VoucherResult: &cbg.Deferred{Raw: voucherResultBytes}})
+				internal.EncodedVoucherResult{Type: vtype, VoucherResult: &cbg.Deferred{Raw: voucherResultBytes}, Codec: codec})
 			chst.AddLog("got new voucher result")
 			return nil
 		}),
@@ -11,6 +11,7 @@ import (
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	dss "github.com/ipfs/go-datastore/sync"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	basicnode "github.com/ipld/go-ipld-prime/node/basic"
@@ -29,7 +30,9 @@ import (
 	"github.com/filecoin-project/go-data-transfer/channels/internal/migrations"
 	v0 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v0"
 	v1 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v1"
+	v2 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v2"
 	"github.com/filecoin-project/go-data-transfer/cidlists"
+	"github.com/filecoin-project/go-data-transfer/cidsets"
 	"github.com/filecoin-project/go-data-transfer/encoding"
 	"github.com/filecoin-project/go-data-transfer/testutil"
 )
@@ -145,7 +148,7 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, uint64(0), state.Sent())
 		require.Empty(t, state.ReceivedCids())
 
-		err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[0], 50)
+		_, err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[0], 50)
 		require.NoError(t, err)
 		_ = checkEvent(ctx, t, received, datatransfer.DataReceivedProgress)
 		state = checkEvent(ctx, t, received, datatransfer.DataReceived)
@@ -153,7 +156,7 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, uint64(0), state.Sent())
 		require.Equal(t, []cid.Cid{cids[0]}, state.ReceivedCids())
 
-		err = channelList.DataSent(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[1], 100)
+		_, err = channelList.DataSent(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[1], 100)
 		require.NoError(t, err)
 		_ = checkEvent(ctx, t, received, datatransfer.DataSentProgress)
 		state = checkEvent(ctx, t, received, datatransfer.DataSent)
@@ -162,13 +165,13 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, []cid.Cid{cids[0]}, state.ReceivedCids())
 
 		// errors if channel does not exist
-		err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[1], Responder: peers[0], ID: tid1}, cids[1], 200)
+		_, err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[1], Responder: peers[0], ID: tid1}, cids[1], 200)
 		require.True(t, xerrors.As(err, new(*channels.ErrNotFound)))
-		err = channelList.DataSent(datatransfer.ChannelID{Initiator: peers[1], Responder: peers[0], ID: tid1}, cids[1], 200)
+		_, err = channelList.DataSent(datatransfer.ChannelID{Initiator: peers[1], Responder: peers[0], ID: tid1}, cids[1], 200)
 		require.True(t, xerrors.As(err, new(*channels.ErrNotFound)))
 		require.Equal(t, []cid.Cid{cids[0]}, state.ReceivedCids())
 
-		err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[1], 50)
+		_, err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[1], 50)
 		require.NoError(t, err)
 		_ = checkEvent(ctx, t, received, datatransfer.DataReceivedProgress)
 		state = checkEvent(ctx, t, received, datatransfer.DataReceived)
@@ -176,19 +179,37 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, uint64(100), state.Sent())
 		require.Equal(t, []cid.Cid{cids[0], cids[1]}, state.ReceivedCids())
 
-		err = channelList.DataSent(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[1], 25)
+		_, err = channelList.DataSent(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[1], 25)
 		require.NoError(t, err)
 		state = checkEvent(ctx, t, received, datatransfer.DataSent)
 		require.Equal(t, uint64(100), state.Received())
 		require.Equal(t, uint64(100), state.Sent())
 		require.Equal(t, []cid.Cid{cids[0], cids[1]}, state.ReceivedCids())
 
-		err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[0], 50)
+		_, err = channelList.DataReceived(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, cids[0], 50)
 		require.NoError(t, err)
 		state = checkEvent(ctx, t, received, datatransfer.DataReceived)
 		require.Equal(t, uint64(100), state.Received())
 		require.Equal(t, uint64(100), state.Sent())
 		require.Equal(t, []cid.Cid{cids[0], cids[1], cids[0]}, state.ReceivedCids())
+		var iterated []cid.Cid
+		err = state.ReceivedCidsIter(func(c cid.Cid) error {
+			iterated = append(iterated, c)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, state.ReceivedCids(), iterated)
+		errStop := errors.New("stop")
+		iterated = nil
+		err = state.ReceivedCidsIter(func(c cid.Cid) error {
+			iterated = append(iterated, c)
+			return errStop
+		})
+		require.Equal(t, errStop, err)
+		require.Equal(t, []cid.Cid{cids[0]}, iterated)
+		require.Equal(t, uint64(2), state.ReceivedBlocks())
+		require.Equal(t, uint64(1), state.SentBlocks())
+		require.Equal(t, uint64(0), state.QueuedBlocks())
 	})
 
 	t.Run("pause/resume", func(t *testing.T) {
@@ -245,6 +266,28 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, fvr1, state.LastVoucherResult())
 	})
 
+	t.Run("vouchers & voucherResults encoded as DAG-JSON", func(t *testing.T) {
+		fv4 := testutil.NewFakeDagJSONType()
+		fvr2 := testutil.NewFakeDagJSONType()
+		state, err := channelList.GetByID(ctx, datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1})
+		require.NoError(t, err)
+		fv3 := state.LastVoucher()
+		fvr1 := state.LastVoucherResult()
+
+		err = channelList.NewVoucher(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, fv4)
+		require.NoError(t, err)
+		state = checkEvent(ctx, t, received, datatransfer.NewVoucher)
+		require.Equal(t, fv1, state.Voucher())
+		require.Equal(t, fv4, state.LastVoucher())
+		require.Equal(t, []datatransfer.Voucher{fv1, fv3, fv4}, state.Vouchers())
+
+		err = channelList.NewVoucherResult(datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1}, fvr2)
+		require.NoError(t, err)
+		state = checkEvent(ctx, t, received, datatransfer.NewVoucherResult)
+		require.Equal(t, fvr2, state.LastVoucherResult())
+		require.Equal(t, []datatransfer.VoucherResult{fvr1, fvr2}, state.VoucherResults())
+	})
+
 	t.Run("test finality", func(t *testing.T) {
 		state, err := channelList.GetByID(ctx, datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: tid1})
 		require.NoError(t, err)
@@ -284,6 +327,73 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, datatransfer.Cancelled, state.Status())
 	})
 
+	t.Run("test progress", func(t *testing.T) {
+		ds := dss.MutexWrap(datastore.NewMapDatastore())
+		received := make(chan event)
+		notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+			received <- event{evt, chst}
+		}
+		dir := os.TempDir()
+		cidLists, err := cidlists.NewCIDLists(dir)
+		require.NoError(t, err)
+		channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+		require.NoError(t, err)
+		err = channelList.Start(ctx)
+		require.NoError(t, err)
+
+		// receiving, with the sender as initiator
+		chid, err := channelList.CreateNew(peers[0], tid1, cids[0], selector, fv1, peers[3], peers[3], peers[0])
+		require.NoError(t, err)
+		state := checkEvent(ctx, t, received, datatransfer.Open)
+		require.Equal(t, datatransfer.ChannelProgress{}, state.Progress())
+
+		blocks := testutil.GenerateCids(3)
+		isNew, err := channelList.DataReceived(chid, blocks[0], 100)
+		require.NoError(t, err)
+		require.True(t, isNew)
+		_ = checkEvent(ctx, t, received, datatransfer.DataReceivedProgress)
+		state = checkEvent(ctx, t, received, datatransfer.DataReceived)
+		progress := state.Progress()
+		require.Equal(t, uint64(100), progress.Transferred)
+		require.Equal(t, uint64(1), progress.Blocks)
+		require.Zero(t, progress.PercentComplete)
+		require.Zero(t, progress.EstimatedTimeRemaining)
+
+		time.Sleep(10 * time.Millisecond)
+		_, err = channelList.DataReceived(chid, blocks[1], 100)
+		require.NoError(t, err)
+		_ = checkEvent(ctx, t, received, datatransfer.DataReceivedProgress)
+		state = checkEvent(ctx, t, received, datatransfer.DataReceived)
+		progress = state.Progress()
+		require.Equal(t, uint64(200), progress.Transferred)
+		require.Equal(t, uint64(2), progress.Blocks)
+		require.Greater(t, progress.Throughput, float64(0))
+		// percent complete and time remaining need the total size
+		require.Zero(t, progress.PercentComplete)
+		require.Zero(t, progress.EstimatedTimeRemaining)
+
+		err = channelList.TotalSizeKnown(chid, 4, 400)
+		require.NoError(t, err)
+		state = checkEvent(ctx, t, received, datatransfer.TotalSizeKnown)
+		progress = state.Progress()
+		require.Equal(t, uint64(400), progress.TotalSize)
+		require.Equal(t, uint64(4), progress.TotalBlocks)
+		require.Equal(t, float64(50), progress.PercentComplete)
+		require.True(t, progress.EstimatedTimeRemaining > 0)
+
+		// the same block received again does not count
+		isNew, err = channelList.DataReceived(chid, blocks[1], 100)
+		require.NoError(t, err)
+		require.False(t, isNew)
+		state = checkEvent(ctx, t, received, datatransfer.DataReceived)
+		require.Equal(t, uint64(2), state.Progress().Blocks)
+
+		state, err = channelList.GetByID(ctx, chid)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), state.Progress().Blocks)
+		require.Equal(t, float64(50), state.Progress().PercentComplete)
+	})
+
 	t.Run("test self peer and other peer", func(t *testing.T) {
 		// sender is self peer
 		chid, err := channelList.CreateNew(peers[1], tid1, cids[0], selector, fv1, peers[1], peers[1], peers[2])
@@ -328,6 +438,66 @@ func TestChannels(t *testing.T) {
 		require.Equal(t, disconnectErr.Error(), state.Message())
 	})
 
+	t.Run("test block rejected", func(t *testing.T) {
+		ds := dss.MutexWrap(datastore.NewMapDatastore())
+		received := make(chan event)
+		notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+			received <- event{evt, chst}
+		}
+		dir := os.TempDir()
+		cidLists, err := cidlists.NewCIDLists(dir)
+		require.NoError(t, err)
+		channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+		require.NoError(t, err)
+		err = channelList.Start(ctx)
+		require.NoError(t, err)
+
+		chid, err := channelList.CreateNew(peers[3], tid1, cids[0], selector, fv1, peers[3], peers[0], peers[3])
+		require.NoError(t, err)
+		state := checkEvent(ctx, t, received, datatransfer.Open)
+		require.Equal(t, datatransfer.Requested, state.Status())
+
+		rejectErr := xerrors.Errorf("blocklisted: %w", datatransfer.ErrSkipBlock)
+		err = channelList.BlockRejected(chid, rejectErr)
+		require.NoError(t, err)
+		state = checkEvent(ctx, t, received, datatransfer.BlockRejected)
+		require.Equal(t, datatransfer.Requested, state.Status())
+		require.Equal(t, rejectErr.Error(), state.Message())
+	})
+
+	t.Run("test total size known", func(t *testing.T) {
+		ds := dss.MutexWrap(datastore.NewMapDatastore())
+		received := make(chan event)
+		notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+			received <- event{evt, chst}
+		}
+		dir := os.TempDir()
+		cidLists, err := cidlists.NewCIDLists(dir)
+		require.NoError(t, err)
+		channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+		require.NoError(t, err)
+		err = channelList.Start(ctx)
+		require.NoError(t, err)
+
+		chid, err := channelList.CreateNew(peers[3], tid1, cids[0], selector, fv1, peers[3], peers[0], peers[3])
+		require.NoError(t, err)
+		state := checkEvent(ctx, t, received, datatransfer.Open)
+		require.Equal(t, uint64(0), state.TotalBlocks())
+		require.Equal(t, uint64(0), state.TotalSize())
+
+		err = channelList.TotalSizeKnown(chid, 12, 3456)
+		require.NoError(t, err)
+		state = checkEvent(ctx, t, received, datatransfer.TotalSizeKnown)
+		require.Equal(t, datatransfer.Requested, state.Status())
+		require.Equal(t, uint64(12), state.TotalBlocks())
+		require.Equal(t, uint64(3456), state.TotalSize())
+
+		state, err = channelList.GetByID(ctx, chid)
+		require.NoError(t, err)
+		require.Equal(t, uint64(12), state.TotalBlocks())
+		require.Equal(t, uint64(3456), state.TotalSize())
+	})
+
 	t.Run("test self peer and other peer", func(t *testing.T) {
 		peers := testutil.GeneratePeers(3)
 		// sender is self peer
@@ -386,7 +556,7 @@ func TestMigrationsV0(t *testing.T) {
 
 	allSelector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
 	allSelectorBuf := new(bytes.Buffer)
-	err := dagcbor.Encoder(allSelector, allSelectorBuf)
+	err := dagcbor.Encode(allSelector, allSelectorBuf)
 	require.NoError(t, err)
 	allSelectorBytes := allSelectorBuf.Bytes()
 
@@ -506,7 +676,7 @@ func TestMigrationsV1(t *testing.T) {
 	receivedCids := make([][]cid.Cid, numChannels)
 	allSelector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
 	allSelectorBuf := new(bytes.Buffer)
-	err := dagcbor.Encoder(allSelector, allSelectorBuf)
+	err := dagcbor.Encode(allSelector, allSelectorBuf)
 	require.NoError(t, err)
 	allSelectorBytes := allSelectorBuf.Bytes()
 	selfPeer := testutil.GeneratePeers(1)[0]
@@ -514,7 +684,8 @@ func TestMigrationsV1(t *testing.T) {
 	cidLists, err := cidlists.NewCIDLists(dir)
 	require.NoError(t, err)
 
-	list, err := migrations.GetChannelStateMigrations(selfPeer, cidLists)
+	seenCIDs := cidsets.NewCIDSetManager(namespace.Wrap(ds, datastore.NewKey("seencids")))
+	list, err := migrations.GetChannelStateMigrations(selfPeer, cidLists, seenCIDs)
 	require.NoError(t, err)
 	vds, up := versionedds.NewVersionedDatastore(ds, list, versioning.VersionKey("1"))
 	require.NoError(t, up(ctx))
@@ -610,11 +781,190 @@ func TestMigrationsV1(t *testing.T) {
 	}
 }
 
+func TestMigrationsV2(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	received := make(chan event)
+	notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {
+		received <- event{evt, chst}
+	}
+	numChannels := 5
+	chids := make([]datatransfer.ChannelID, numChannels)
+	sents := make([]uint64, numChannels)
+	receiveds := make([]uint64, numChannels)
+	sentBlocks := make([]int, numChannels)
+	receivedBlocks := make([]int, numChannels)
+	allSelector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	allSelectorBuf := new(bytes.Buffer)
+	err := dagcbor.Encode(allSelector, allSelectorBuf)
+	require.NoError(t, err)
+	selfPeer := testutil.GeneratePeers(1)[0]
+	dir := os.TempDir()
+	cidLists, err := cidlists.NewCIDLists(dir)
+	require.NoError(t, err)
+
+	seenCIDs := cidsets.NewCIDSetManager(namespace.Wrap(ds, datastore.NewKey("seencids")))
+	list, err := migrations.GetChannelStateMigrations(selfPeer, cidLists, seenCIDs)
+	require.NoError(t, err)
+	vds, up := versionedds.NewVersionedDatastore(ds, list, versioning.VersionKey("2"))
+	require.NoError(t, up(ctx))
+
+	for i := 0; i < numChannels; i++ {
+		chids[i] = datatransfer.ChannelID{
+			ID:        datatransfer.TransferID(rand.Uint64()),
+			Initiator: testutil.GeneratePeers(1)[0],
+			Responder: selfPeer,
+		}
+		sents[i] = rand.Uint64()
+		receiveds[i] = rand.Uint64()
+		sentBlocks[i] = rand.Intn(10)
+		receivedBlocks[i] = rand.Intn(10)
+		for _, c := range testutil.GenerateCids(sentBlocks[i]) {
+			_, err := seenCIDs.InsertSetCID(internal.SeenCIDsSetID(chids[i], datatransfer.DataSent), c)
+			require.NoError(t, err)
+		}
+		for _, c := range testutil.GenerateCids(receivedBlocks[i]) {
+			_, err := seenCIDs.InsertSetCID(internal.SeenCIDsSetID(chids[i], datatransfer.DataReceived), c)
+			require.NoError(t, err)
+		}
+		require.NoError(t, seenCIDs.Flush())
+		channel := v2.ChannelState{
+			SelfPeer:   selfPeer,
+			TransferID: chids[i].ID,
+			Initiator:  chids[i].Initiator,
+			Responder:  chids[i].Responder,
+			BaseCid:    testutil.GenerateCids(1)[0],
+			Selector: &cbg.Deferred{
+				Raw: allSelectorBuf.Bytes(),
+			},
+			Sender:      chids[i].Initiator,
+			Recipient:   chids[i].Responder,
+			TotalSize:   1000,
+			TotalBlocks: 10,
+			Status:      datatransfer.Ongoing,
+			Sent:        sents[i],
+			Received:    receiveds[i],
+		}
+		buf := new(bytes.Buffer)
+		err = channel.MarshalCBOR(buf)
+		require.NoError(t, err)
+		err = vds.Put(datastore.NewKey(chids[i].String()), buf.Bytes())
+		require.NoError(t, err)
+	}
+
+	channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, selfPeer)
+	require.NoError(t, err)
+	err = channelList.Start(ctx)
+	require.NoError(t, err)
+
+	for i := 0; i < numChannels; i++ {
+		channel, err := channelList.GetByID(ctx, chids[i])
+		require.NoError(t, err)
+		require.Equal(t, datatransfer.Ongoing, channel.Status())
+		require.Equal(t, uint64(1000), channel.TotalSize())
+		require.Equal(t, uint64(10), channel.TotalBlocks())
+		require.Equal(t, sents[i], channel.Sent())
+		require.Equal(t, receiveds[i], channel.Received())
+		require.Equal(t, uint64(sentBlocks[i]), channel.SentBlocks())
+		require.Equal(t, uint64(receivedBlocks[i]), channel.ReceivedBlocks())
+		require.Equal(t, uint64(0), channel.QueuedBlocks())
+		require.Equal(t, uint64(receivedBlocks[i]), channel.Progress().Blocks)
+	}
+}
+
 type event struct {
 	event datatransfer.Event
 	state datatransfer.ChannelState
 }
 
+func TestReconcileSeenCIDs(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	notifier := func(evt datatransfer.Event, chst datatransfer.ChannelState) {}
+	cidLists := cidlists.NewDatastoreCIDLists(namespace.Wrap(ds, datastore.NewKey("cidlists")), cidlists.FlushInterval(1))
+
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	peers := testutil.GeneratePeers(2)
+	cids := testutil.GenerateCids(4)
+
+	channelList, err := channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+	require.NoError(t, err)
+	require.NoError(t, channelList.Start(ctx))
+	chid, err := channelList.CreateNew(peers[0], datatransfer.TransferID(rand.Uint64()), cids[0], selector, &testutil.FakeDTType{}, peers[0], peers[0], peers[1])
+	require.NoError(t, err)
+	require.NoError(t, channelList.Accept(chid))
+	for _, c := range cids[:3] {
+		_, err = channelList.DataSent(chid, c, 100)
+		require.NoError(t, err)
+	}
+	for _, c := range cids[2:] {
+		_, err = channelList.DataReceived(chid, c, 50)
+		require.NoError(t, err)
+	}
+
+	// stopping cleanly writes out the seen sets, so the counts are kept and
+	// blocks already seen are not counted again
+	require.NoError(t, channelList.Stop(ctx))
+	channelList, err = channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+	require.NoError(t, err)
+	require.NoError(t, channelList.Start(ctx))
+	_, err = channelList.DataSent(chid, cids[0], 100)
+	require.NoError(t, err)
+	state, err := channelList.GetByID(ctx, chid)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), state.SentBlocks())
+	require.Equal(t, uint64(300), state.Sent())
+	require.Equal(t, uint64(2), state.ReceivedBlocks())
+	require.Equal(t, uint64(100), state.Received())
+
+	// blocks counted after that are lost from the seen sets when the process
+	// stops uncleanly, while the received block is kept in the cid list
+	_, err = channelList.DataSent(chid, cids[3], 150)
+	require.NoError(t, err)
+	_, err = channelList.DataReceived(chid, cids[0], 70)
+	require.NoError(t, err)
+	state, err = channelList.GetByID(ctx, chid)
+	require.NoError(t, err)
+	require.Equal(t, uint64(450), state.Sent())
+	require.Equal(t, uint64(170), state.Received())
+	received, err := cidLists.ReadList(chid)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{cids[2], cids[3], cids[0]}, received)
+
+	channelList, err = channels.New(ds, cidLists, notifier, decoderByType, decoderByType, &fakeEnv{}, peers[0])
+	require.NoError(t, err)
+	require.NoError(t, channelList.Start(ctx))
+
+	// the counts are reset to the blocks in the seen sets, and the received
+	// block missing from its set is dropped from the cid list, so it is
+	// requested and counted again
+	state, err = channelList.GetByID(ctx, chid)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), state.SentBlocks())
+	require.Equal(t, uint64(300), state.Sent())
+	require.Equal(t, uint64(2), state.ReceivedBlocks())
+	require.Equal(t, uint64(100), state.Received())
+	received, err = cidLists.ReadList(chid)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{cids[2], cids[3]}, received)
+
+	_, err = channelList.DataSent(chid, cids[3], 150)
+	require.NoError(t, err)
+	_, err = channelList.DataReceived(chid, cids[0], 70)
+	require.NoError(t, err)
+	state, err = channelList.GetByID(ctx, chid)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), state.SentBlocks())
+	require.Equal(t, uint64(450), state.Sent())
+	require.Equal(t, uint64(3), state.ReceivedBlocks())
+	require.Equal(t, uint64(170), state.Received())
+}
+
 func checkEvent(ctx context.Context, t *testing.T, received chan event, code datatransfer.EventCode) datatransfer.ChannelState {
 	var evt event
 	select {
@@ -651,5 +1001,12 @@ func decoderByType(identifier datatransfer.TypeIdentifier) (encoding.Decoder, bo
 		}
 		return decoder, true
 	}
+	if identifier == testutil.NewFakeDagJSONType().Type() {
+		decoder, err := encoding.NewDecoder(testutil.NewFakeDagJSONType())
+		if err != nil {
+			return nil, false
+		}
+		return decoder, true
+	}
 	return nil, false
 }
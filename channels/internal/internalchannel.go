@@ -8,6 +8,8 @@ import (
 	cbg "github.com/whyrusleeping/cbor-gen"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/cidsets"
+	"github.com/filecoin-project/go-data-transfer/encoding"
 )
 
 //go:generate cbor-gen-for --map-encoding ChannelState EncodedVoucher EncodedVoucherResult
@@ -18,6 +20,9 @@ type EncodedVoucher struct {
 	Type datatransfer.TypeIdentifier
 	// used to verify this channel
 	Voucher *cbg.Deferred
+	// Codec the voucher is encoded with, 0 for records written before
+	// codecs were recorded, which are dag-cbor
+	Codec encoding.Codec
 }
 
 // EncodedVoucherResult is how the voucher result is stored on disk
@@ -26,6 +31,9 @@ type EncodedVoucherResult struct {
 	Type datatransfer.TypeIdentifier
 	// used to verify this channel
 	VoucherResult *cbg.Deferred
+	// Codec the voucher result is encoded with, 0 for records written
+	// before codecs were recorded, which are dag-cbor
+	Codec encoding.Codec
 }
 
 // ChannelState is the internal representation on disk for the channel fsm
@@ -48,6 +56,8 @@ type ChannelState struct {
 	Recipient peer.ID
 	// expected amount of data to be transferred
 	TotalSize uint64
+	// expected number of blocks to be transferred (0 if unknown)
+	TotalBlocks uint64
 	// current status of this deal
 	Status datatransfer.Status
 	// total bytes read from this node and queued for sending (0 if receiver)
@@ -56,6 +66,12 @@ type ChannelState struct {
 	Sent uint64
 	// total bytes received by this node (0 if sender)
 	Received uint64
+	// number of distinct blocks queued for sending (0 if receiver)
+	QueuedBlocks uint64
+	// number of distinct blocks sent from this node (0 if receiver)
+	SentBlocks uint64
+	// number of distinct blocks received by this node (0 if sender)
+	ReceivedBlocks uint64
 	// more informative status on a channel
 	Message        string
 	Vouchers       []EncodedVoucher
@@ -80,3 +96,9 @@ func (cs *ChannelState) AddLog(msg string, a ...interface{}) {
 
 	cs.Stages.AddLog(stage, msg)
 }
+
+// SeenCIDsSetID is the ID of the set of CIDs already counted on a channel for
+// the given data event: DataQueued, DataSent or DataReceived
+func SeenCIDsSetID(chid datatransfer.ChannelID, evt datatransfer.EventCode) cidsets.SetID {
+	return cidsets.SetID(chid.String() + "/" + datatransfer.Events[evt])
+}
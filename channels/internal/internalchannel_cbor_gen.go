@@ -5,21 +5,26 @@ package internal
 import (
 	"fmt"
 	"io"
+	"sort"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
+	encoding "github.com/filecoin-project/go-data-transfer/encoding"
+	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	cbg "github.com/whyrusleeping/cbor-gen"
 	xerrors "golang.org/x/xerrors"
 )
 
 var _ = xerrors.Errorf
+var _ = cid.Undef
+var _ = sort.Sort
 
 func (t *ChannelState) MarshalCBOR(w io.Writer) error {
 	if t == nil {
 		_, err := w.Write(cbg.CborNull)
 		return err
 	}
-	if _, err := w.Write([]byte{177}); err != nil {
+	if _, err := w.Write([]byte{181}); err != nil {
 		return err
 	}
 
@@ -204,6 +209,22 @@ func (t *ChannelState) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.TotalBlocks (uint64) (uint64)
+	if len("TotalBlocks") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"TotalBlocks\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("TotalBlocks"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("TotalBlocks")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.TotalBlocks)); err != nil {
+		return err
+	}
+
 	// t.Status (datatransfer.Status) (uint64)
 	if len("Status") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"Status\" was too long")
@@ -268,6 +289,54 @@ func (t *ChannelState) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.QueuedBlocks (uint64) (uint64)
+	if len("QueuedBlocks") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"QueuedBlocks\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("QueuedBlocks"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("QueuedBlocks")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.QueuedBlocks)); err != nil {
+		return err
+	}
+
+	// t.SentBlocks (uint64) (uint64)
+	if len("SentBlocks") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"SentBlocks\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("SentBlocks"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("SentBlocks")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.SentBlocks)); err != nil {
+		return err
+	}
+
+	// t.ReceivedBlocks (uint64) (uint64)
+	if len("ReceivedBlocks") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"ReceivedBlocks\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("ReceivedBlocks"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("ReceivedBlocks")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.ReceivedBlocks)); err != nil {
+		return err
+	}
+
 	// t.Message (string) (string)
 	if len("Message") > cbg.MaxLength {
 		return xerrors.Errorf("Value in field \"Message\" was too long")
@@ -500,6 +569,21 @@ func (t *ChannelState) UnmarshalCBOR(r io.Reader) error {
 				}
 				t.TotalSize = uint64(extra)
 
+			}
+			// t.TotalBlocks (uint64) (uint64)
+		case "TotalBlocks":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.TotalBlocks = uint64(extra)
+
 			}
 			// t.Status (datatransfer.Status) (uint64)
 		case "Status":
@@ -560,6 +644,51 @@ func (t *ChannelState) UnmarshalCBOR(r io.Reader) error {
 				}
 				t.Received = uint64(extra)
 
+			}
+			// t.QueuedBlocks (uint64) (uint64)
+		case "QueuedBlocks":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.QueuedBlocks = uint64(extra)
+
+			}
+			// t.SentBlocks (uint64) (uint64)
+		case "SentBlocks":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.SentBlocks = uint64(extra)
+
+			}
+			// t.ReceivedBlocks (uint64) (uint64)
+		case "ReceivedBlocks":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.ReceivedBlocks = uint64(extra)
+
 			}
 			// t.Message (string) (string)
 		case "Message":
@@ -654,7 +783,8 @@ func (t *ChannelState) UnmarshalCBOR(r io.Reader) error {
 			}
 
 		default:
-			return fmt.Errorf("unknown struct field %d: '%s'", i, name)
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
 		}
 	}
 
@@ -665,7 +795,7 @@ func (t *EncodedVoucher) MarshalCBOR(w io.Writer) error {
 		_, err := w.Write(cbg.CborNull)
 		return err
 	}
-	if _, err := w.Write([]byte{162}); err != nil {
+	if _, err := w.Write([]byte{163}); err != nil {
 		return err
 	}
 
@@ -709,6 +839,23 @@ func (t *EncodedVoucher) MarshalCBOR(w io.Writer) error {
 	if err := t.Voucher.MarshalCBOR(w); err != nil {
 		return err
 	}
+
+	// t.Codec (encoding.Codec) (uint64)
+	if len("Codec") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Codec\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Codec"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Codec")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Codec)); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -767,9 +914,25 @@ func (t *EncodedVoucher) UnmarshalCBOR(r io.Reader) error {
 					return xerrors.Errorf("failed to read deferred field: %w", err)
 				}
 			}
+			// t.Codec (encoding.Codec) (uint64)
+		case "Codec":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Codec = encoding.Codec(extra)
+
+			}
 
 		default:
-			return fmt.Errorf("unknown struct field %d: '%s'", i, name)
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
 		}
 	}
 
@@ -780,7 +943,7 @@ func (t *EncodedVoucherResult) MarshalCBOR(w io.Writer) error {
 		_, err := w.Write(cbg.CborNull)
 		return err
 	}
-	if _, err := w.Write([]byte{162}); err != nil {
+	if _, err := w.Write([]byte{163}); err != nil {
 		return err
 	}
 
@@ -824,6 +987,23 @@ func (t *EncodedVoucherResult) MarshalCBOR(w io.Writer) error {
 	if err := t.VoucherResult.MarshalCBOR(w); err != nil {
 		return err
 	}
+
+	// t.Codec (encoding.Codec) (uint64)
+	if len("Codec") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Codec\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Codec"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Codec")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Codec)); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -882,9 +1062,25 @@ func (t *EncodedVoucherResult) UnmarshalCBOR(r io.Reader) error {
 					return xerrors.Errorf("failed to read deferred field: %w", err)
 				}
 			}
+			// t.Codec (encoding.Codec) (uint64)
+		case "Codec":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Codec = encoding.Codec(extra)
+
+			}
 
 		default:
-			return fmt.Errorf("unknown struct field %d: '%s'", i, name)
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
 		}
 	}
 
@@ -10,7 +10,9 @@ import (
 	"github.com/filecoin-project/go-data-transfer/channels/internal"
 	v0 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v0"
 	v1 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v1"
+	v2 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v2"
 	"github.com/filecoin-project/go-data-transfer/cidlists"
+	"github.com/filecoin-project/go-data-transfer/cidsets"
 )
 
 // MigrateEncodedVoucher0To1 converts a tuple encoded voucher to a map encoded voucher
@@ -62,12 +64,46 @@ func GetMigrateChannelState0To1(selfPeer peer.ID) func(*v0.ChannelState) (*v1.Ch
 }
 
 // GetMigrateChannelState1To2 returns a conversion function for migrating v1 channel state to v2 channel state
-func GetMigrateChannelState1To2(cidLists cidlists.CIDLists) func(*v1.ChannelState) (*internal.ChannelState, error) {
-	return func(oldCs *v1.ChannelState) (*internal.ChannelState, error) {
+func GetMigrateChannelState1To2(cidLists cidlists.CIDLists) func(*v1.ChannelState) (*v2.ChannelState, error) {
+	return func(oldCs *v1.ChannelState) (*v2.ChannelState, error) {
 		err := cidLists.CreateList(datatransfer.ChannelID{ID: oldCs.TransferID, Initiator: oldCs.Initiator, Responder: oldCs.Responder}, oldCs.ReceivedCids)
 		if err != nil {
 			return nil, err
 		}
+		return &v2.ChannelState{
+			SelfPeer:       oldCs.SelfPeer,
+			TransferID:     oldCs.TransferID,
+			Initiator:      oldCs.Initiator,
+			Responder:      oldCs.Responder,
+			BaseCid:        oldCs.BaseCid,
+			Selector:       oldCs.Selector,
+			Sender:         oldCs.Sender,
+			Recipient:      oldCs.Recipient,
+			TotalSize:      oldCs.TotalSize,
+			Status:         oldCs.Status,
+			Sent:           oldCs.Sent,
+			Received:       oldCs.Received,
+			Message:        oldCs.Message,
+			Vouchers:       oldCs.Vouchers,
+			VoucherResults: oldCs.VoucherResults,
+		}, nil
+	}
+}
+
+// GetMigrateChannelState2To3 returns a conversion function for migrating v2
+// channel state to v3 channel state, which counts blocks as well as bytes. The
+// block counts are taken from the sets of CIDs already seen on the channel.
+func GetMigrateChannelState2To3(seenCIDs *cidsets.CIDSetManager) func(*v2.ChannelState) (*internal.ChannelState, error) {
+	return func(oldCs *v2.ChannelState) (*internal.ChannelState, error) {
+		chid := datatransfer.ChannelID{ID: oldCs.TransferID, Initiator: oldCs.Initiator, Responder: oldCs.Responder}
+		var blockCounts [3]uint64
+		for i, evt := range []datatransfer.EventCode{datatransfer.DataQueued, datatransfer.DataSent, datatransfer.DataReceived} {
+			count, err := seenCIDs.Count(internal.SeenCIDsSetID(chid, evt))
+			if err != nil {
+				return nil, err
+			}
+			blockCounts[i] = uint64(count)
+		}
 		return &internal.ChannelState{
 			SelfPeer:       oldCs.SelfPeer,
 			TransferID:     oldCs.TransferID,
@@ -78,22 +114,30 @@ func GetMigrateChannelState1To2(cidLists cidlists.CIDLists) func(*v1.ChannelStat
 			Sender:         oldCs.Sender,
 			Recipient:      oldCs.Recipient,
 			TotalSize:      oldCs.TotalSize,
+			TotalBlocks:    oldCs.TotalBlocks,
 			Status:         oldCs.Status,
+			Queued:         oldCs.Queued,
 			Sent:           oldCs.Sent,
 			Received:       oldCs.Received,
+			QueuedBlocks:   blockCounts[0],
+			SentBlocks:     blockCounts[1],
+			ReceivedBlocks: blockCounts[2],
 			Message:        oldCs.Message,
 			Vouchers:       oldCs.Vouchers,
 			VoucherResults: oldCs.VoucherResults,
+			Stages:         oldCs.Stages,
 		}, nil
 	}
 }
 
 // GetChannelStateMigrations returns a migration list for the channel states
-func GetChannelStateMigrations(selfPeer peer.ID, cidLists cidlists.CIDLists) (versioning.VersionedMigrationList, error) {
+func GetChannelStateMigrations(selfPeer peer.ID, cidLists cidlists.CIDLists, seenCIDs *cidsets.CIDSetManager) (versioning.VersionedMigrationList, error) {
 	channelStateMigration0To1 := GetMigrateChannelState0To1(selfPeer)
 	channelStateMigration1To2 := GetMigrateChannelState1To2(cidLists)
+	channelStateMigration2To3 := GetMigrateChannelState2To3(seenCIDs)
 	return versioned.BuilderList{
 		versioned.NewVersionedBuilder(channelStateMigration0To1, versioning.VersionKey("1")),
 		versioned.NewVersionedBuilder(channelStateMigration1To2, versioning.VersionKey("2")).OldVersion("1"),
+		versioned.NewVersionedBuilder(channelStateMigration2To3, versioning.VersionKey("3")).OldVersion("2"),
 	}.Build()
 }
@@ -0,0 +1,403 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	versioning "github.com/filecoin-project/go-ds-versioning/pkg"
+	versionedds "github.com/filecoin-project/go-ds-versioning/pkg/datastore"
+
+	"github.com/filecoin-project/go-data-transfer/channels/internal"
+	"github.com/filecoin-project/go-data-transfer/channels/internal/migrations"
+	"github.com/filecoin-project/go-data-transfer/cidlists"
+	"github.com/filecoin-project/go-data-transfer/cidsets"
+)
+
+// versionKey is where go-ds-versioning records the version of the records in
+// a datastore
+var versionKey = datastore.NewKey("/versions/current")
+
+// MigrationReport describes a migration of the channel records in a datastore
+type MigrationReport struct {
+	// From is the version the records were at before migrating, or "" if they
+	// were not versioned
+	From versioning.VersionKey
+	// To is the version the records were migrated to
+	To versioning.VersionKey
+	// Channels is the number of channel records at the version migrated to
+	Channels int
+	// BackedUp is the number of keys copied to the backup datastore, if one
+	// was given
+	BackedUp int
+	// RolledBack is true if the migration failed and the datastore was
+	// restored from the backup
+	RolledBack bool
+	// Changes lists how each channel record would change. It is only filled
+	// in by DryRunMigration.
+	Changes []ChannelChange
+}
+
+// ChannelChange describes how migrating changes the record of one channel
+type ChannelChange struct {
+	// Key is the key of the channel's record, under the version's namespace
+	Key string
+	// Added lists fields that are new in the migrated record. Records from
+	// before channels were versioned are not keyed by field name, so every
+	// field of their migrated record is listed.
+	Added []string
+	// Removed lists fields that are only in the old record
+	Removed []string
+	// Changed lists fields whose value differs
+	Changed []string
+}
+
+// Migrated is true if the records were not already at the current version
+func (r MigrationReport) Migrated() bool {
+	return r.From != r.To
+}
+
+type migrateConfig struct {
+	backup datastore.Batching
+}
+
+// MigrateOption configures a migration
+type MigrateOption func(*migrateConfig)
+
+// BackupTo copies every key in the datastore to the given backup datastore
+// before migrating, and restores them from it if the migration or the check
+// of the migrated records fails. Anything already in the backup datastore is
+// replaced.
+//
+// The backup must not be stored under the namespace being migrated: records
+// from before channels were versioned are read from every key in it.
+func BackupTo(backup datastore.Batching) MigrateOption {
+	return func(cfg *migrateConfig) {
+		cfg.backup = backup
+	}
+}
+
+// DryRunMigration migrates an in memory copy of the channel records in ds and
+// checks the result, reporting what a migration would do to each channel
+// without changing ds. Cid lists created by the migration are discarded.
+func DryRunMigration(ctx context.Context, ds datastore.Batching, selfPeer peer.ID) (MigrationReport, error) {
+	copied := dssync.MutexWrap(datastore.NewMapDatastore())
+	if _, err := copyKeys(ds, copied); err != nil {
+		return MigrationReport{}, xerrors.Errorf("copying channel records: %w", err)
+	}
+	from, err := StoredVersion(copied)
+	if err != nil {
+		return MigrationReport{}, err
+	}
+	before, err := readRecords(copied, from)
+	if err != nil {
+		return MigrationReport{}, xerrors.Errorf("reading channel records: %w", err)
+	}
+
+	cidLists := cidlists.NewDatastoreCIDLists(datastore.NewMapDatastore())
+	report, err := Migrate(ctx, copied, cidLists, selfPeer)
+	if err != nil || !report.Migrated() {
+		return report, err
+	}
+	after, err := readRecords(copied, CurrentVersion)
+	if err != nil {
+		return report, xerrors.Errorf("reading migrated channel records: %w", err)
+	}
+	keys := make([]string, 0, len(after))
+	for key := range after {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		change, err := diffRecords(key, before[key], after[key])
+		if err != nil {
+			return report, xerrors.Errorf("comparing channel record %s: %w", key, err)
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	return report, nil
+}
+
+// readRecords returns the channel records at the given version, by key.
+// Records from before channels were versioned are every top level key.
+func readRecords(ds datastore.Batching, version versioning.VersionKey) (map[string][]byte, error) {
+	var results query.Results
+	var err error
+	if version == "" {
+		results, err = ds.Query(query.Query{})
+	} else {
+		results, err = namespace.Wrap(ds, datastore.NewKey(string(version))).Query(query.Query{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	records := make(map[string][]byte)
+	for result := range results.Next() {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		key := datastore.RawKey(result.Key)
+		if len(key.Namespaces()) != 1 {
+			continue
+		}
+		records[key.String()] = result.Value
+	}
+	return records, nil
+}
+
+// diffRecords compares the fields of a channel record before and after
+// migrating
+func diffRecords(key string, before []byte, after []byte) (ChannelChange, error) {
+	change := ChannelChange{Key: key}
+	newFields, err := decodeFields(after)
+	if err != nil {
+		return change, err
+	}
+	oldFields := map[string][]byte{}
+	if before != nil {
+		if oldFields, err = decodeFields(before); err != nil {
+			return change, err
+		}
+	}
+	for field, value := range newFields {
+		oldValue, ok := oldFields[field]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, field)
+		case !bytes.Equal(oldValue, value):
+			change.Changed = append(change.Changed, field)
+		}
+	}
+	for field := range oldFields {
+		if _, ok := newFields[field]; !ok {
+			change.Removed = append(change.Removed, field)
+		}
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	sort.Strings(change.Changed)
+	return change, nil
+}
+
+// decodeFields returns the encoded value of each field of a map encoded
+// record, or no fields if the record is tuple encoded
+func decodeFields(record []byte) (map[string][]byte, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, bytes.NewReader(record)); err != nil {
+		return nil, err
+	}
+	node := nb.Build()
+	fields := make(map[string][]byte)
+	if node.Kind() != ipld.Kind_Map {
+		return fields, nil
+	}
+	iter := node.MapIterator()
+	for !iter.Done() {
+		k, v, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		field, err := k.AsString()
+		if err != nil {
+			return nil, err
+		}
+		buf := new(bytes.Buffer)
+		if err := dagcbor.Encode(v, buf); err != nil {
+			return nil, err
+		}
+		fields[field] = buf.Bytes()
+	}
+	return fields, nil
+}
+
+// Migrate migrates the channel records in ds to CurrentVersion, then checks
+// every migrated record can be decoded. It is what Start does, but can be run
+// beforehand to back up the old records and roll back on failure.
+//
+// Only the datastore is backed up, so cid lists kept on disk that were
+// created by a failed migration are left in place. They are recreated when
+// the migration is run again.
+func Migrate(ctx context.Context, ds datastore.Batching, cidLists cidlists.CIDLists, selfPeer peer.ID, options ...MigrateOption) (MigrationReport, error) {
+	var cfg migrateConfig
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	from, err := StoredVersion(ds)
+	if err != nil {
+		return MigrationReport{}, err
+	}
+	report := MigrationReport{From: from, To: CurrentVersion}
+	if from != CurrentVersion {
+		if cfg.backup != nil {
+			if err := clearKeys(cfg.backup); err != nil {
+				return report, xerrors.Errorf("clearing backup: %w", err)
+			}
+			if report.BackedUp, err = copyKeys(ds, cfg.backup); err != nil {
+				return report, xerrors.Errorf("backing up channel records: %w", err)
+			}
+		}
+		err = runMigrations(ctx, ds, cidLists, selfPeer)
+	}
+	if err == nil {
+		report.Channels, err = verifyChannels(ds)
+	}
+	if err == nil || cfg.backup == nil || from == CurrentVersion {
+		return report, err
+	}
+
+	log.Errorf("migrating channel records from version %q: %s, rolling back", from, err)
+	if rollbackErr := RestoreBackup(ds, cfg.backup); rollbackErr != nil {
+		return report, xerrors.Errorf("migrating channel records: %s; rolling back: %w", err, rollbackErr)
+	}
+	report.RolledBack = true
+	return report, err
+}
+
+// RestoreBackup replaces the contents of ds with the keys in backup
+func RestoreBackup(ds datastore.Batching, backup datastore.Batching) error {
+	if err := clearKeys(ds); err != nil {
+		return err
+	}
+	_, err := copyKeys(backup, ds)
+	return err
+}
+
+// runMigrations runs the same migrations as Start
+func runMigrations(ctx context.Context, ds datastore.Batching, cidLists cidlists.CIDLists, selfPeer peer.ID) error {
+	seenCIDs := cidsets.NewCIDSetManager(namespace.Wrap(ds, datastore.NewKey("seencids")))
+	channelMigrations, err := migrations.GetChannelStateMigrations(selfPeer, cidLists, seenCIDs)
+	if err != nil {
+		return err
+	}
+	_, up := versionedds.NewVersionedDatastore(ds, channelMigrations, CurrentVersion)
+	if err := up(ctx); err != nil {
+		return err
+	}
+	if err := seenCIDs.Flush(); err != nil {
+		return err
+	}
+	if flushable, ok := cidLists.(cidlists.FlushableCIDLists); ok {
+		return flushable.Flush()
+	}
+	return nil
+}
+
+// verifyChannels checks the records are at the current version and decodes
+// every one of them, returning the number of channels
+func verifyChannels(ds datastore.Batching) (int, error) {
+	version, err := StoredVersion(ds)
+	if err != nil {
+		return 0, err
+	}
+	if version != CurrentVersion {
+		return 0, xerrors.Errorf("channel records are at version %q after migrating to %q", version, CurrentVersion)
+	}
+	results, err := namespace.Wrap(ds, datastore.NewKey(string(CurrentVersion))).Query(query.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+	count := 0
+	for result := range results.Next() {
+		if result.Error != nil {
+			return count, result.Error
+		}
+		var ch internal.ChannelState
+		if err := ch.UnmarshalCBOR(bytes.NewReader(result.Value)); err != nil {
+			return count, xerrors.Errorf("decoding migrated channel record %s: %w", result.Key, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// StoredVersion returns the version of the channel records in ds, or "" if
+// they are not versioned
+func StoredVersion(ds datastore.Batching) (versioning.VersionKey, error) {
+	version, err := ds.Get(versionKey)
+	if err == datastore.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", xerrors.Errorf("reading channel record version: %w", err)
+	}
+	return versioning.VersionKey(version), nil
+}
+
+// migrateBatchSize is the number of keys written or deleted in each batch
+// when copying or clearing a datastore
+const migrateBatchSize = 1000
+
+// copyKeys puts every key in from into to, streaming them in batches
+func copyKeys(from datastore.Batching, to datastore.Batching) (int, error) {
+	results, err := from.Query(query.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+	batch, err := to.Batch()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for result := range results.Next() {
+		if result.Error != nil {
+			return count, result.Error
+		}
+		if err := batch.Put(datastore.NewKey(result.Key), result.Value); err != nil {
+			return count, err
+		}
+		count++
+		if count%migrateBatchSize != 0 {
+			continue
+		}
+		if err := batch.Commit(); err != nil {
+			return count, err
+		}
+		if batch, err = to.Batch(); err != nil {
+			return count, err
+		}
+	}
+	return count, batch.Commit()
+}
+
+// clearKeys deletes every key in ds, a batch at a time
+func clearKeys(ds datastore.Batching) error {
+	for {
+		results, err := ds.Query(query.Query{KeysOnly: true, Limit: migrateBatchSize})
+		if err != nil {
+			return err
+		}
+		entries, err := results.Rest()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		batch, err := ds.Batch()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := batch.Delete(datastore.NewKey(entry.Key)); err != nil {
+				return err
+			}
+		}
+		if err := batch.Commit(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package channels_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	versioning "github.com/filecoin-project/go-ds-versioning/pkg"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	v2 "github.com/filecoin-project/go-data-transfer/channels/internal/migrations/v2"
+	"github.com/filecoin-project/go-data-transfer/cidlists"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	selfPeer := testutil.GeneratePeers(1)[0]
+
+	t.Run("dry run leaves the datastore unchanged", func(t *testing.T) {
+		ds, chids := v2Datastore(t, selfPeer, 3)
+		before := dumpKeys(t, ds)
+
+		report, err := channels.DryRunMigration(ctx, ds, selfPeer)
+		require.NoError(t, err)
+		require.Equal(t, versioning.VersionKey("2"), report.From)
+		require.Equal(t, channels.CurrentVersion, report.To)
+		require.Equal(t, len(chids), report.Channels)
+		require.True(t, report.Migrated())
+		require.Equal(t, before, dumpKeys(t, ds))
+
+		// each channel gains the block counts added in version 3
+		require.Len(t, report.Changes, len(chids))
+		keys := make(map[string]bool, len(chids))
+		for _, chid := range chids {
+			keys["/"+chid.String()] = true
+		}
+		for _, change := range report.Changes {
+			require.True(t, keys[change.Key], change.Key)
+			require.Subset(t, change.Added, []string{"QueuedBlocks", "SentBlocks", "ReceivedBlocks"})
+			require.Empty(t, change.Removed)
+			require.Empty(t, change.Changed)
+		}
+	})
+
+	t.Run("backs up and migrates", func(t *testing.T) {
+		ds, chids := v2Datastore(t, selfPeer, 3)
+		before := dumpKeys(t, ds)
+		backup := dss.MutexWrap(datastore.NewMapDatastore())
+		require.NoError(t, backup.Put(datastore.NewKey("stale"), []byte("stale")))
+		cidLists := cidlists.NewDatastoreCIDLists(dss.MutexWrap(datastore.NewMapDatastore()))
+
+		report, err := channels.Migrate(ctx, ds, cidLists, selfPeer, channels.BackupTo(backup))
+		require.NoError(t, err)
+		require.Equal(t, len(chids), report.Channels)
+		require.Equal(t, len(before), report.BackedUp)
+		require.False(t, report.RolledBack)
+		require.Equal(t, before, dumpKeys(t, backup))
+		version, err := channels.StoredVersion(ds)
+		require.NoError(t, err)
+		require.Equal(t, channels.CurrentVersion, version)
+
+		channelList, err := channels.New(ds, cidLists, func(datatransfer.Event, datatransfer.ChannelState) {}, decoderByType, decoderByType, &fakeEnv{}, selfPeer)
+		require.NoError(t, err)
+		require.NoError(t, channelList.Start(ctx))
+		for _, chid := range chids {
+			_, err := channelList.GetByID(ctx, chid)
+			require.NoError(t, err)
+		}
+		require.NoError(t, channelList.Stop(ctx))
+
+		// migrating again does nothing, and leaves the backup alone
+		report, err = channels.Migrate(ctx, ds, cidLists, selfPeer, channels.BackupTo(backup))
+		require.NoError(t, err)
+		require.False(t, report.Migrated())
+		require.Equal(t, len(chids), report.Channels)
+		require.Equal(t, before, dumpKeys(t, backup))
+
+		require.NoError(t, channels.RestoreBackup(ds, backup))
+		require.Equal(t, before, dumpKeys(t, ds))
+	})
+
+	t.Run("rolls back on failure", func(t *testing.T) {
+		ds, _ := v2Datastore(t, selfPeer, 3)
+		require.NoError(t, ds.Put(datastore.NewKey("/2/corrupt"), []byte("not a channel")))
+		before := dumpKeys(t, ds)
+		backup := dss.MutexWrap(datastore.NewMapDatastore())
+		cidLists := cidlists.NewDatastoreCIDLists(dss.MutexWrap(datastore.NewMapDatastore()))
+
+		report, err := channels.Migrate(ctx, ds, cidLists, selfPeer, channels.BackupTo(backup))
+		require.Error(t, err)
+		require.True(t, report.RolledBack)
+		require.Equal(t, before, dumpKeys(t, ds))
+
+		// without a backup the failure is still reported
+		_, err = channels.DryRunMigration(ctx, ds, selfPeer)
+		require.Error(t, err)
+	})
+
+	t.Run("empty datastore", func(t *testing.T) {
+		ds := dss.MutexWrap(datastore.NewMapDatastore())
+		report, err := channels.DryRunMigration(ctx, ds, selfPeer)
+		require.NoError(t, err)
+		require.Equal(t, versioning.VersionKey(""), report.From)
+		require.Equal(t, 0, report.Channels)
+		require.Empty(t, report.Changes)
+	})
+
+	t.Run("copies and clears more keys than fit in a batch", func(t *testing.T) {
+		ds, _ := v2Datastore(t, selfPeer, 1)
+		for i := 0; i < 2500; i++ {
+			require.NoError(t, ds.Put(datastore.NewKey(fmt.Sprintf("/other/%d", i)), []byte("x")))
+		}
+		before := dumpKeys(t, ds)
+		backup := dss.MutexWrap(datastore.NewMapDatastore())
+		for i := 0; i < 1500; i++ {
+			require.NoError(t, backup.Put(datastore.NewKey(fmt.Sprintf("/stale/%d", i)), []byte("stale")))
+		}
+		cidLists := cidlists.NewDatastoreCIDLists(dss.MutexWrap(datastore.NewMapDatastore()))
+
+		report, err := channels.Migrate(ctx, ds, cidLists, selfPeer, channels.BackupTo(backup))
+		require.NoError(t, err)
+		require.Equal(t, len(before), report.BackedUp)
+		require.Equal(t, before, dumpKeys(t, backup))
+
+		require.NoError(t, channels.RestoreBackup(ds, backup))
+		require.Equal(t, before, dumpKeys(t, ds))
+	})
+}
+
+// v2Datastore returns a datastore holding the given number of channel records
+// at version 2
+func v2Datastore(t *testing.T, selfPeer peer.ID, numChannels int) (datastore.Batching, []datatransfer.ChannelID) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	allSelectorBuf := new(bytes.Buffer)
+	allSelector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	require.NoError(t, dagcbor.Encode(allSelector, allSelectorBuf))
+	require.NoError(t, ds.Put(datastore.NewKey("/versions/current"), []byte("2")))
+
+	chids := make([]datatransfer.ChannelID, 0, numChannels)
+	for i := 0; i < numChannels; i++ {
+		chid := datatransfer.ChannelID{
+			ID:        datatransfer.TransferID(i),
+			Initiator: testutil.GeneratePeers(1)[0],
+			Responder: selfPeer,
+		}
+		channel := v2.ChannelState{
+			SelfPeer:   selfPeer,
+			TransferID: chid.ID,
+			Initiator:  chid.Initiator,
+			Responder:  chid.Responder,
+			BaseCid:    testutil.GenerateCids(1)[0],
+			Selector:   &cbg.Deferred{Raw: allSelectorBuf.Bytes()},
+			Sender:     chid.Initiator,
+			Recipient:  chid.Responder,
+			Status:     datatransfer.Ongoing,
+		}
+		buf := new(bytes.Buffer)
+		require.NoError(t, channel.MarshalCBOR(buf))
+		require.NoError(t, ds.Put(datastore.NewKey("2").Child(datastore.NewKey(chid.String())), buf.Bytes()))
+		chids = append(chids, chid)
+	}
+	return ds, chids
+}
+
+func dumpKeys(t *testing.T, ds datastore.Batching) map[string]string {
+	results, err := ds.Query(query.Query{})
+	require.NoError(t, err)
+	entries, err := results.Rest()
+	require.NoError(t, err)
+	dump := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		dump[entry.Key] = string(entry.Value)
+	}
+	return dump
+}
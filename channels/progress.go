@@ -0,0 +1,112 @@
+package channels
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// throughputWindow is the time constant of the moving average used to
+// estimate throughput. Samples older than a few windows have little weight.
+const throughputWindow = 5 * time.Second
+
+// channelProgress is the in-memory throughput estimate for one channel
+type channelProgress struct {
+	average    float64
+	started    time.Time
+	lastSample time.Time
+	// pending is the size of the first block, which has no interval to
+	// measure a rate over, and is counted with the next sample instead
+	pending uint64
+}
+
+// progressTracker estimates the throughput of each channel from the data
+// progress events fired on it. Estimates are kept in memory only, and start
+// again from zero when the process restarts.
+type progressTracker struct {
+	lk       sync.Mutex
+	now      func() time.Time
+	channels map[datatransfer.ChannelID]*channelProgress
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{
+		now:      time.Now,
+		channels: make(map[datatransfer.ChannelID]*channelProgress),
+	}
+}
+
+// record adds a newly sent or received block of the given size to the
+// estimate for the channel
+func (pt *progressTracker) record(chid datatransfer.ChannelID, size uint64) {
+	pt.lk.Lock()
+	defer pt.lk.Unlock()
+
+	now := pt.now()
+	cp, ok := pt.channels[chid]
+	if !ok {
+		pt.channels[chid] = &channelProgress{started: now, lastSample: now, pending: size}
+		return
+	}
+	elapsed := now.Sub(cp.lastSample)
+	if elapsed <= 0 {
+		// fold blocks arriving together into the next sample
+		elapsed = time.Nanosecond
+	}
+	// exponentially weighted moving average, weighted by the time since the
+	// last sample so bursts of small blocks do not swamp the estimate
+	alpha := 1 - math.Exp(-float64(elapsed)/float64(throughputWindow))
+	rate := float64(size+cp.pending) / elapsed.Seconds()
+	cp.average = alpha*rate + (1-alpha)*cp.average
+	cp.lastSample = now
+	cp.pending = 0
+}
+
+// remove drops the estimate for the channel
+func (pt *progressTracker) remove(chid datatransfer.ChannelID) {
+	pt.lk.Lock()
+	delete(pt.channels, chid)
+	pt.lk.Unlock()
+}
+
+// progress returns the progress of the channel, given how much data it has
+// transferred so far and how much it is expected to transfer
+func (pt *progressTracker) progress(chid datatransfer.ChannelID, transferred uint64, blocks uint64, totalSize uint64, totalBlocks uint64) datatransfer.ChannelProgress {
+	progress := datatransfer.ChannelProgress{
+		Transferred: transferred,
+		Blocks:      blocks,
+		TotalSize:   totalSize,
+		TotalBlocks: totalBlocks,
+	}
+	if pt != nil {
+		pt.lk.Lock()
+		if cp, ok := pt.channels[chid]; ok {
+			now := pt.now()
+			// decay the average over the time nothing has been transferred,
+			// so a stalled or paused channel does not keep its old rate, and
+			// correct for the average starting at zero, so it is not
+			// underestimated for channels younger than the window
+			decay := math.Exp(-float64(now.Sub(cp.lastSample)) / float64(throughputWindow))
+			weight := 1 - math.Exp(-float64(now.Sub(cp.started))/float64(throughputWindow))
+			if weight > 0 {
+				progress.Throughput = cp.average * decay / weight
+			}
+		}
+		pt.lk.Unlock()
+	}
+	if totalSize == 0 {
+		return progress
+	}
+	if transferred >= totalSize {
+		progress.PercentComplete = 100
+		return progress
+	}
+	progress.PercentComplete = float64(transferred) * 100 / float64(totalSize)
+	if progress.Throughput > 0 {
+		remaining := float64(totalSize-transferred) / progress.Throughput
+		progress.EstimatedTimeRemaining = time.Duration(remaining * float64(time.Second))
+	}
+	return progress
+}
@@ -0,0 +1,28 @@
+package channels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestProgressTrackerCountsFirstBlock(t *testing.T) {
+	peers := testutil.GeneratePeers(2)
+	chid := datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 1}
+
+	now := time.Unix(1000, 0)
+	pt := newProgressTracker()
+	pt.now = func() time.Time { return now }
+
+	pt.record(chid, 100)
+	require.Zero(t, pt.progress(chid, 100, 1, 0, 0).Throughput)
+
+	now = now.Add(time.Second)
+	pt.record(chid, 100)
+	// both blocks were transferred within the second since the first sample
+	require.InDelta(t, 200, pt.progress(chid, 200, 2, 0, 0).Throughput, 0.001)
+}
@@ -0,0 +1,111 @@
+package channels
+
+import (
+	"os"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels/internal"
+	"github.com/filecoin-project/go-data-transfer/cidlists"
+	"github.com/filecoin-project/go-data-transfer/cidsets"
+)
+
+// reconcileSeenCIDs brings the block and byte counts of channels that are
+// still in progress back in step with the sets of blocks seen on them.
+//
+// Inserts into the seen sets and appends to the cid lists are buffered, while
+// the counts are written to the channel state as each new block arrives, so
+// after an unclean shutdown the counts can include blocks missing from the
+// sets. Left alone, those blocks would be counted a second time if they are
+// transferred again. The sets record the size of each block, so the counts
+// are reset to exactly the blocks in the sets. Blocks missing from the set of
+// received blocks are dropped from the cid list too, so they are requested
+// and counted again when the transfer restarts.
+func (c *Channels) reconcileSeenCIDs() error {
+	var internalChannels []internal.ChannelState
+	if err := c.stateMachines.List(&internalChannels); err != nil {
+		return err
+	}
+	for _, ch := range internalChannels {
+		if IsChannelTerminated(ch.Status) {
+			continue
+		}
+		chid := datatransfer.ChannelID{Initiator: ch.Initiator, Responder: ch.Responder, ID: ch.TransferID}
+		counts := []struct {
+			evt    datatransfer.EventCode
+			blocks uint64
+			bytes  uint64
+		}{
+			{datatransfer.DataQueued, ch.QueuedBlocks, ch.Queued},
+			{datatransfer.DataSent, ch.SentBlocks, ch.Sent},
+			{datatransfer.DataReceived, ch.ReceivedBlocks, ch.Received},
+		}
+		for _, count := range counts {
+			if err := c.reconcileSeenCIDSet(chid, count.evt, count.blocks, count.bytes); err != nil {
+				return xerrors.Errorf("reconciling %s blocks for channel %s: %w", datatransfer.Events[count.evt], chid, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Channels) reconcileSeenCIDSet(chid datatransfer.ChannelID, evt datatransfer.EventCode, blocks uint64, bytes uint64) error {
+	sid := internal.SeenCIDsSetID(chid, evt)
+	seen, seenBytes, err := c.seenCIDs.Totals(sid)
+	if xerrors.Is(err, cidsets.ErrSizeUnknown) {
+		// the set was written before the sizes of blocks were recorded, so
+		// the counts cannot be corrected
+		if seen, err := c.seenCIDs.Count(sid); err == nil && uint64(seen) != blocks {
+			log.Warnf("channel %s counted %d %s blocks but has seen %d", chid, blocks, datatransfer.Events[evt], seen)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// channels migrated from before blocks were counted have no seen sets
+	if evt == datatransfer.DataReceived && (seen > 0 || blocks > 0) {
+		if err := c.trimReceivedList(chid, sid); err != nil {
+			log.Warnf("dropping blocks missing from the received set of channel %s from its cid list: %s", chid, err)
+		}
+	}
+	// each block counted adds its size to the byte count, and is recorded in
+	// the set with the same size, so the counts agree if the blocks do. Byte
+	// counts carried over from before blocks were counted are left alone.
+	if uint64(seen) == blocks {
+		return nil
+	}
+	log.Warnf("channel %s counted %d %s blocks of %d bytes but has seen %d of %d bytes, correcting count",
+		chid, blocks, datatransfer.Events[evt], bytes, seen, seenBytes)
+	return c.stateMachines.Send(chid, datatransfer.DataCountsReconciled, evt, uint64(seen), seenBytes)
+}
+
+// trimReceivedList drops the blocks that are missing from the set of blocks
+// received on a channel from its cid list, so they are not left out of the
+// transfer when it restarts
+func (c *Channels) trimReceivedList(chid datatransfer.ChannelID, sid cidsets.SetID) error {
+	var kept []cid.Cid
+	dropped := 0
+	err := c.cidLists.IterateList(chid, func(k cid.Cid) error {
+		has, err := c.seenCIDs.Has(sid, k)
+		if err != nil {
+			return err
+		}
+		if has {
+			kept = append(kept, k)
+		} else {
+			dropped++
+		}
+		return nil
+	})
+	if xerrors.Is(err, cidlists.ErrListNotFound) || os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil || dropped == 0 {
+		return err
+	}
+	log.Warnf("channel %s: dropping %d blocks missing from its received set from its cid list", chid, dropped)
+	return c.cidLists.CreateList(chid, kept)
+}
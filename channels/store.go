@@ -0,0 +1,190 @@
+package channels
+
+import (
+	"strings"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// ChannelStore stores the state of each channel as an encoded record. The
+// default keeps the records in the datastore given to New; other
+// implementations can be given with the WithChannelStore option to keep them
+// in a SQL database or any other store, and should pass the conformance tests
+// in testutil/channelstoretest.
+//
+// Records are opaque to the store. Calls may be made concurrently, but never
+// concurrently for the same channel.
+type ChannelStore interface {
+	// Has returns true if a record is stored for the channel
+	Has(chid datatransfer.ChannelID) (bool, error)
+	// Get returns the record stored for the channel, or an *ErrNotFound if
+	// there is none
+	Get(chid datatransfer.ChannelID) ([]byte, error)
+	// Put stores the record for the channel, replacing any stored before
+	Put(chid datatransfer.ChannelID, record []byte) error
+	// Delete removes the record for the channel. Deleting a channel with no
+	// record is not an error.
+	Delete(chid datatransfer.ChannelID) error
+	// List calls fn with every stored channel and its record, in no
+	// particular order, stopping at the first error fn returns
+	List(fn func(chid datatransfer.ChannelID, record []byte) error) error
+}
+
+// Option configures the channels
+type Option func(*Channels)
+
+// WithChannelStore keeps the state of channels in the given store rather than
+// in the datastore. The datastore is still used for the records of blocks
+// seen on each channel. Records are not migrated: the store must only ever
+// hold records at CurrentVersion.
+func WithChannelStore(store ChannelStore) Option {
+	return func(c *Channels) {
+		c.store = store
+	}
+}
+
+type dsChannelStore struct {
+	ds datastore.Batching
+}
+
+// NewDatastoreChannelStore returns a channel store keeping each record under
+// the channel ID in the given datastore, which should be namespaced for its
+// exclusive use
+func NewDatastoreChannelStore(ds datastore.Batching) ChannelStore {
+	return &dsChannelStore{ds}
+}
+
+func (s *dsChannelStore) Has(chid datatransfer.ChannelID) (bool, error) {
+	return s.ds.Has(channelKey(chid))
+}
+
+func (s *dsChannelStore) Get(chid datatransfer.ChannelID) ([]byte, error) {
+	record, err := s.ds.Get(channelKey(chid))
+	if err == datastore.ErrNotFound {
+		return nil, NewErrNotFound(chid)
+	}
+	return record, err
+}
+
+func (s *dsChannelStore) Put(chid datatransfer.ChannelID, record []byte) error {
+	return s.ds.Put(channelKey(chid), record)
+}
+
+func (s *dsChannelStore) Delete(chid datatransfer.ChannelID) error {
+	return s.ds.Delete(channelKey(chid))
+}
+
+func (s *dsChannelStore) List(fn func(chid datatransfer.ChannelID, record []byte) error) error {
+	results, err := s.ds.Query(query.Query{})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		chid, err := keyChannelID(result.Key)
+		if err != nil {
+			return err
+		}
+		if err := fn(chid, result.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// channelKey is the same key go-statemachine stores a channel's state under
+func channelKey(chid datatransfer.ChannelID) datastore.Key {
+	return datastore.NewKey(chid.String())
+}
+
+func keyChannelID(key string) (datatransfer.ChannelID, error) {
+	chid, err := datatransfer.ParseChannelID(strings.TrimPrefix(key, "/"))
+	if err != nil {
+		return datatransfer.ChannelID{}, xerrors.Errorf("channel record key %s: %w", key, err)
+	}
+	return chid, nil
+}
+
+// storeDatastore presents a channel store as the datastore go-statemachine
+// keeps state in, with each key the string form of a channel ID
+type storeDatastore struct {
+	store ChannelStore
+}
+
+var _ datastore.Datastore = storeDatastore{}
+
+func (sd storeDatastore) Get(key datastore.Key) ([]byte, error) {
+	chid, err := keyChannelID(key.String())
+	if err != nil {
+		return nil, err
+	}
+	record, err := sd.store.Get(chid)
+	var notFound *ErrNotFound
+	if xerrors.As(err, &notFound) {
+		return nil, datastore.ErrNotFound
+	}
+	return record, err
+}
+
+func (sd storeDatastore) Has(key datastore.Key) (bool, error) {
+	chid, err := keyChannelID(key.String())
+	if err != nil {
+		return false, err
+	}
+	return sd.store.Has(chid)
+}
+
+func (sd storeDatastore) GetSize(key datastore.Key) (int, error) {
+	record, err := sd.Get(key)
+	if err != nil {
+		return -1, err
+	}
+	return len(record), nil
+}
+
+func (sd storeDatastore) Put(key datastore.Key, value []byte) error {
+	chid, err := keyChannelID(key.String())
+	if err != nil {
+		return err
+	}
+	return sd.store.Put(chid, value)
+}
+
+func (sd storeDatastore) Delete(key datastore.Key) error {
+	chid, err := keyChannelID(key.String())
+	if err != nil {
+		return err
+	}
+	return sd.store.Delete(chid)
+}
+
+func (sd storeDatastore) Query(q query.Query) (query.Results, error) {
+	var entries []query.Entry
+	err := sd.store.List(func(chid datatransfer.ChannelID, record []byte) error {
+		entry := query.Entry{Key: channelKey(chid).String(), Size: len(record)}
+		if !q.KeysOnly {
+			entry.Value = record
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return query.NaiveQueryApply(q, query.ResultsWithEntries(q, entries)), nil
+}
+
+func (sd storeDatastore) Sync(datastore.Key) error {
+	return nil
+}
+
+func (sd storeDatastore) Close() error {
+	return nil
+}
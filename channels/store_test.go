@@ -0,0 +1,77 @@
+package channels_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/testutil/channelstoretest"
+)
+
+func TestDatastoreChannelStore(t *testing.T) {
+	channelstoretest.Run(t, func(t *testing.T) channels.ChannelStore {
+		return channels.NewDatastoreChannelStore(dss.MutexWrap(datastore.NewMapDatastore()))
+	})
+}
+
+func TestMapChannelStore(t *testing.T) {
+	channelstoretest.Run(t, func(t *testing.T) channels.ChannelStore {
+		return &mapChannelStore{records: make(map[datatransfer.ChannelID][]byte)}
+	})
+}
+
+// mapChannelStore is a channel store that does not use a datastore at all
+type mapChannelStore struct {
+	lk      sync.RWMutex
+	records map[datatransfer.ChannelID][]byte
+}
+
+func (s *mapChannelStore) Has(chid datatransfer.ChannelID) (bool, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	_, ok := s.records[chid]
+	return ok, nil
+}
+
+func (s *mapChannelStore) Get(chid datatransfer.ChannelID) ([]byte, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	record, ok := s.records[chid]
+	if !ok {
+		return nil, channels.NewErrNotFound(chid)
+	}
+	return record, nil
+}
+
+func (s *mapChannelStore) Put(chid datatransfer.ChannelID, record []byte) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.records[chid] = record
+	return nil
+}
+
+func (s *mapChannelStore) Delete(chid datatransfer.ChannelID) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	delete(s.records, chid)
+	return nil
+}
+
+func (s *mapChannelStore) List(fn func(chid datatransfer.ChannelID, record []byte) error) error {
+	s.lk.RLock()
+	records := make(map[datatransfer.ChannelID][]byte, len(s.records))
+	for chid, record := range s.records {
+		records[chid] = record
+	}
+	s.lk.RUnlock()
+	for chid, record := range records {
+		if err := fn(chid, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
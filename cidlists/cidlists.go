@@ -3,23 +3,42 @@ package cidlists
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
 	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 )
 
-// CIDLists maintains files that contain a list of CIDs received for different data transfers
+var log = logging.Logger("dt-cidlists")
+
+// CIDLists maintains lists of CIDs received for different data transfers
 type CIDLists interface {
 	CreateList(chid datatransfer.ChannelID, initalCids []cid.Cid) error
 	AppendList(chid datatransfer.ChannelID, c cid.Cid) error
 	ReadList(chid datatransfer.ChannelID) ([]cid.Cid, error)
+	// IterateList calls fn with each CID in the list in order, stopping at
+	// the first error
+	IterateList(chid datatransfer.ChannelID, fn func(cid.Cid) error) error
 	DeleteList(chid datatransfer.ChannelID) error
 }
 
+// FlushableCIDLists are CID lists that buffer appended CIDs in memory, and
+// can be told to write them out
+type FlushableCIDLists interface {
+	CIDLists
+	// Flush writes every buffered CID to storage
+	Flush() error
+}
+
 type cidLists struct {
 	baseDir string
 }
@@ -76,27 +95,42 @@ func (cl *cidLists) AppendList(chid datatransfer.ChannelID, c cid.Cid) (err erro
 }
 
 // ReadList reads an on disk list of cids for the given data transfer channel
-func (cl *cidLists) ReadList(chid datatransfer.ChannelID) (cids []cid.Cid, err error) {
-	f, err := os.Open(transferFilename(cl.baseDir, chid))
+func (cl *cidLists) ReadList(chid datatransfer.ChannelID) ([]cid.Cid, error) {
+	var receivedCids []cid.Cid
+	err := cl.IterateList(chid, func(c cid.Cid) error {
+		receivedCids = append(receivedCids, c)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return receivedCids, nil
+}
+
+// IterateList reads an on disk list of cids for the given data transfer
+// channel one at a time
+func (cl *cidLists) IterateList(chid datatransfer.ChannelID, fn func(cid.Cid) error) (err error) {
+	f, err := os.Open(transferFilename(cl.baseDir, chid))
+	if err != nil {
+		return err
+	}
 	defer func() {
 		closeErr := f.Close()
 		if err == nil {
 			err = closeErr
 		}
 	}()
-	var receivedCids []cid.Cid
 	for {
 		c, err := cbg.ReadCid(f)
 		if err != nil {
 			if err == io.EOF {
-				return receivedCids, nil
+				return nil
 			}
-			return nil, err
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
 		}
-		receivedCids = append(receivedCids, c)
 	}
 }
 
@@ -105,6 +139,79 @@ func (cl *cidLists) DeleteList(chid datatransfer.ChannelID) error {
 	return os.Remove(transferFilename(cl.baseDir, chid))
 }
 
+// ImportFiles copies every list in the given directory of files into the
+// given CID lists, deleting each file once its list has been copied. Files
+// that are not CID lists are left alone. A list file that cannot be read to
+// the end, such as one truncated by a crash, is logged and the CIDs read from
+// it before the error are imported. A file that cannot be opened is logged and
+// left in place. It can be run again safely if it is interrupted.
+func ImportFiles(baseDir string, to CIDLists) error {
+	from, err := NewCIDLists(baseDir)
+	if err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(baseDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		chid, ok := parseTransferFilename(entry.Name())
+		if !ok {
+			continue
+		}
+		var cids []cid.Cid
+		err := from.IterateList(chid, func(c cid.Cid) error {
+			cids = append(cids, c)
+			return nil
+		})
+		var pathErr *os.PathError
+		if xerrors.As(err, &pathErr) {
+			// the file could not be opened, so leave it for another import
+			log.Warnf("opening cid list file %s: %s", entry.Name(), err)
+			continue
+		}
+		if err != nil {
+			log.Warnf("reading cid list file %s: %s; importing the %d cids read before the error", entry.Name(), err, len(cids))
+		}
+		if err := to.CreateList(chid, cids); err != nil {
+			return xerrors.Errorf("importing cid list file %s: %w", entry.Name(), err)
+		}
+		if err := from.DeleteList(chid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTransferFilename returns the channel a file is the list for, or false
+// if the name is not that of a list file
+func parseTransferFilename(filename string) (datatransfer.ChannelID, bool) {
+	parts := strings.Split(filename, "-")
+	if len(parts) != 3 {
+		return datatransfer.ChannelID{}, false
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return datatransfer.ChannelID{}, false
+	}
+	initiator, err := peer.Decode(parts[1])
+	if err != nil {
+		return datatransfer.ChannelID{}, false
+	}
+	responder, err := peer.Decode(parts[2])
+	if err != nil {
+		return datatransfer.ChannelID{}, false
+	}
+	chid := datatransfer.ChannelID{ID: datatransfer.TransferID(id), Initiator: initiator, Responder: responder}
+	if filepath.Base(transferFilename("", chid)) != filename {
+		return datatransfer.ChannelID{}, false
+	}
+	return chid, true
+}
+
 func transferFilename(baseDir string, chid datatransfer.ChannelID) string {
 	filename := fmt.Sprintf("%d-%s-%s", chid.ID, chid.Initiator, chid.Responder)
 	return filepath.Join(baseDir, filename)
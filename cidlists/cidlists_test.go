@@ -1,6 +1,7 @@
 package cidlists_test
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -9,6 +10,10 @@ import (
 	"testing"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dss "github.com/ipfs/go-datastore/sync"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
 	"github.com/stretchr/testify/require"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
@@ -82,3 +87,134 @@ func TestCIDLists(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestDatastoreCIDLists(t *testing.T) {
+	chid1 := datatransfer.ChannelID{ID: datatransfer.TransferID(rand.Uint64()), Initiator: testutil.GeneratePeers(1)[0], Responder: testutil.GeneratePeers(1)[0]}
+	chid2 := datatransfer.ChannelID{ID: datatransfer.TransferID(rand.Uint64()), Initiator: testutil.GeneratePeers(1)[0], Responder: testutil.GeneratePeers(1)[0]}
+	initialCids1 := testutil.GenerateCids(100)
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	cidLists := cidlists.NewDatastoreCIDLists(ds, cidlists.FlushInterval(3))
+
+	t.Run("creating lists", func(t *testing.T) {
+		require.NoError(t, cidLists.CreateList(chid1, initialCids1))
+		require.NoError(t, cidLists.CreateList(chid2, nil))
+	})
+
+	t.Run("reading lists", func(t *testing.T) {
+		savedCids1, err := cidLists.ReadList(chid1)
+		require.NoError(t, err)
+		require.Equal(t, initialCids1, savedCids1)
+
+		savedCids2, err := cidLists.ReadList(chid2)
+		require.NoError(t, err)
+		require.Nil(t, savedCids2)
+
+		var iterated []cid.Cid
+		err = cidLists.IterateList(chid1, func(c cid.Cid) error {
+			iterated = append(iterated, c)
+			if len(iterated) == 10 {
+				return errors.New("stop")
+			}
+			return nil
+		})
+		require.EqualError(t, err, "stop")
+		require.Equal(t, initialCids1[:10], iterated)
+
+		missing := datatransfer.ChannelID{ID: datatransfer.TransferID(rand.Uint64()), Initiator: testutil.GeneratePeers(1)[0], Responder: testutil.GeneratePeers(1)[0]}
+		_, err = cidLists.ReadList(missing)
+		require.True(t, errors.Is(err, cidlists.ErrListNotFound))
+	})
+
+	t.Run("appending lists", func(t *testing.T) {
+		newCids1 := testutil.GenerateCids(5)
+		for _, c := range newCids1 {
+			require.NoError(t, cidLists.AppendList(chid1, c))
+		}
+		savedCids1, err := cidLists.ReadList(chid1)
+		require.NoError(t, err)
+		require.Equal(t, append(initialCids1, newCids1...), savedCids1)
+
+		// appends are buffered until the flush interval is reached
+		newCids2 := testutil.GenerateCids(4)
+		for _, c := range newCids2 {
+			require.NoError(t, cidLists.AppendList(chid2, c))
+		}
+		reloaded := cidlists.NewDatastoreCIDLists(ds)
+		savedCids2, err := reloaded.ReadList(chid2)
+		require.NoError(t, err)
+		require.Equal(t, newCids2[:3], savedCids2)
+
+		savedCids2, err = cidLists.ReadList(chid2)
+		require.NoError(t, err)
+		require.Equal(t, newCids2, savedCids2)
+
+		// the list carries on where it left off when loaded again
+		reloaded = cidlists.NewDatastoreCIDLists(ds)
+		newCid2 := testutil.GenerateCids(1)[0]
+		require.NoError(t, reloaded.AppendList(chid2, newCid2))
+		savedCids2, err = reloaded.ReadList(chid2)
+		require.NoError(t, err)
+		require.Equal(t, append(newCids2, newCid2), savedCids2)
+	})
+
+	t.Run("deleting lists", func(t *testing.T) {
+		require.NoError(t, cidLists.DeleteList(chid1))
+		_, err := cidLists.ReadList(chid1)
+		require.True(t, errors.Is(err, cidlists.ErrListNotFound))
+
+		require.NoError(t, cidLists.DeleteList(chid2))
+		_, err = cidLists.ReadList(chid2)
+		require.True(t, errors.Is(err, cidlists.ErrListNotFound))
+
+		results, err := ds.Query(query.Query{KeysOnly: true})
+		require.NoError(t, err)
+		entries, err := results.Rest()
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+}
+
+func TestImportFiles(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "cidlistimporttest")
+	require.NoError(t, err)
+
+	fileLists, err := cidlists.NewCIDLists(baseDir)
+	require.NoError(t, err)
+	chids := make([]datatransfer.ChannelID, 3)
+	lists := make([][]cid.Cid, 3)
+	for i := range chids {
+		// list files are only recognised if named for valid peer IDs
+		chids[i] = datatransfer.ChannelID{ID: datatransfer.TransferID(rand.Uint64()), Initiator: p2ptest.RandPeerIDFatal(t), Responder: p2ptest.RandPeerIDFatal(t)}
+		lists[i] = testutil.GenerateCids(10 * (i + 1))
+		require.NoError(t, fileLists.CreateList(chids[i], lists[i]))
+	}
+	// a list truncated part way through a cid keeps the cids before it
+	truncated := filepath.Join(baseDir, fmt.Sprintf("%d-%s-%s", chids[1].ID, chids[1].Initiator, chids[1].Responder))
+	info, err := os.Stat(truncated)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(truncated, info.Size()-3))
+	lists[1] = lists[1][:len(lists[1])-1]
+	otherFile := filepath.Join(baseDir, "not-a-list")
+	require.NoError(t, ioutil.WriteFile(otherFile, []byte("hello"), 0644))
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	dsLists := cidlists.NewDatastoreCIDLists(ds)
+	require.NoError(t, cidlists.ImportFiles(baseDir, dsLists))
+
+	for i, chid := range chids {
+		saved, err := dsLists.ReadList(chid)
+		require.NoError(t, err)
+		require.Equal(t, lists[i], saved)
+		_, err = os.Stat(filepath.Join(baseDir, fmt.Sprintf("%d-%s-%s", chid.ID, chid.Initiator, chid.Responder)))
+		require.True(t, os.IsNotExist(err))
+	}
+	_, err = os.Stat(otherFile)
+	require.NoError(t, err)
+
+	// importing again does nothing
+	require.NoError(t, cidlists.ImportFiles(baseDir, dsLists))
+	saved, err := dsLists.ReadList(chids[2])
+	require.NoError(t, err)
+	require.Equal(t, lists[2], saved)
+}
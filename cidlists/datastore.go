@@ -0,0 +1,294 @@
+package cidlists
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// DefaultFlushInterval is the number of CIDs appended to a list that are
+// buffered in memory before they are written to the datastore
+const DefaultFlushInterval = 64
+
+// ErrListNotFound is returned when reading a list that was never created
+var ErrListNotFound = xerrors.New("cid list not found")
+
+// dsList is the in memory state of a single list in the datastore
+type dsList struct {
+	// next is the index the next CID appended to the list will be stored at
+	next uint64
+	// pending are appended CIDs not yet written to the datastore
+	pending []cid.Cid
+}
+
+type dsCIDLists struct {
+	ds            datastore.Batching
+	flushInterval int
+
+	lk    sync.Mutex
+	lists map[datatransfer.ChannelID]*dsList
+}
+
+// DatastoreOption configures the datastore backed CID lists
+type DatastoreOption func(*dsCIDLists)
+
+// FlushInterval sets the number of appended CIDs buffered in memory before
+// they are written to the datastore in a single batch. CIDs still buffered
+// when the process stops uncleanly are lost.
+func FlushInterval(n int) DatastoreOption {
+	return func(cl *dsCIDLists) {
+		cl.flushInterval = n
+	}
+}
+
+// NewDatastoreCIDLists returns CID lists stored in the given datastore, which
+// should be namespaced for their exclusive use. Each CID is stored under its
+// own key, so appending is cheap and lists can be read back without loading
+// them into memory.
+func NewDatastoreCIDLists(ds datastore.Batching, options ...DatastoreOption) FlushableCIDLists {
+	cl := &dsCIDLists{
+		ds:            ds,
+		flushInterval: DefaultFlushInterval,
+		lists:         make(map[datatransfer.ChannelID]*dsList),
+	}
+	for _, option := range options {
+		option(cl)
+	}
+	return cl
+}
+
+// CreateList initializes a new CID list with the given initial cids (or can be
+// empty) for a data transfer channel, replacing any existing list
+func (cl *dsCIDLists) CreateList(chid datatransfer.ChannelID, initialCids []cid.Cid) error {
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+
+	batch, err := cl.ds.Batch()
+	if err != nil {
+		return err
+	}
+	if err := cl.deleteEntries(batch, chid); err != nil {
+		return err
+	}
+	list := &dsList{}
+	if err := cl.writeCids(batch, chid, list, initialCids); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	cl.lists[chid] = list
+	return nil
+}
+
+// AppendList appends a single CID to the list for a given data transfer
+// channel, creating the list if needed. The CID is written out once the flush
+// interval is reached.
+func (cl *dsCIDLists) AppendList(chid datatransfer.ChannelID, c cid.Cid) error {
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+
+	list, err := cl.getList(chid)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		list = &dsList{}
+		cl.lists[chid] = list
+	}
+	list.pending = append(list.pending, c)
+	if len(list.pending) < cl.flushInterval {
+		return nil
+	}
+	return cl.flush(chid, list)
+}
+
+// ReadList reads the list of cids for the given data transfer channel
+func (cl *dsCIDLists) ReadList(chid datatransfer.ChannelID) ([]cid.Cid, error) {
+	var cids []cid.Cid
+	err := cl.IterateList(chid, func(c cid.Cid) error {
+		cids = append(cids, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cids, nil
+}
+
+// IterateList calls fn with each cid in the list for the given data transfer
+// channel, in the order they were added, without reading the whole list into
+// memory
+func (cl *dsCIDLists) IterateList(chid datatransfer.ChannelID, fn func(cid.Cid) error) error {
+	cl.lk.Lock()
+	list, err := cl.getList(chid)
+	if err == nil && list == nil {
+		err = ErrListNotFound
+	}
+	if err == nil {
+		err = cl.flush(chid, list)
+	}
+	cl.lk.Unlock()
+	if err != nil {
+		return err
+	}
+
+	results, err := cl.ds.Query(query.Query{
+		Prefix: cidsKey(chid).String(),
+		Orders: []query.Order{query.OrderByKey{}},
+	})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+	for result := range results.Next() {
+		if result.Error != nil {
+			return result.Error
+		}
+		c, err := cid.Cast(result.Value)
+		if err != nil {
+			return xerrors.Errorf("decoding cid at %s: %w", result.Key, err)
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteList deletes the list for the given data transfer channel in a single
+// batch, so it is either removed entirely or left as it was
+func (cl *dsCIDLists) DeleteList(chid datatransfer.ChannelID) error {
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+
+	batch, err := cl.ds.Batch()
+	if err != nil {
+		return err
+	}
+	if err := cl.deleteEntries(batch, chid); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	delete(cl.lists, chid)
+	return nil
+}
+
+// Flush writes the buffered cids of every list to the datastore
+func (cl *dsCIDLists) Flush() error {
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+
+	for chid, list := range cl.lists {
+		if err := cl.flush(chid, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getList returns the in memory state for a list, loading it from the
+// datastore if needed, or nil if the list does not exist
+func (cl *dsCIDLists) getList(chid datatransfer.ChannelID) (*dsList, error) {
+	list, ok := cl.lists[chid]
+	if ok {
+		return list, nil
+	}
+	value, err := cl.ds.Get(nextKey(chid))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(value) != 8 {
+		return nil, xerrors.Errorf("corrupt cid list length for channel %s", chid)
+	}
+	list = &dsList{next: binary.BigEndian.Uint64(value)}
+	cl.lists[chid] = list
+	return list, nil
+}
+
+// flush writes the pending cids for a list to the datastore
+func (cl *dsCIDLists) flush(chid datatransfer.ChannelID, list *dsList) error {
+	if len(list.pending) == 0 {
+		return nil
+	}
+	batch, err := cl.ds.Batch()
+	if err != nil {
+		return err
+	}
+	pending := list.pending
+	list.pending = nil
+	next := list.next
+	if err := cl.writeCids(batch, chid, list, pending); err != nil {
+		list.next, list.pending = next, pending
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		list.next, list.pending = next, pending
+		return err
+	}
+	return nil
+}
+
+// writeCids adds the given cids to the end of the list in the batch, along
+// with the new length of the list
+func (cl *dsCIDLists) writeCids(batch datastore.Batch, chid datatransfer.ChannelID, list *dsList, cids []cid.Cid) error {
+	for _, c := range cids {
+		if err := batch.Put(cidKey(chid, list.next), c.Bytes()); err != nil {
+			return err
+		}
+		list.next++
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, list.next)
+	return batch.Put(nextKey(chid), value)
+}
+
+// deleteEntries removes every key stored for a list in the batch
+func (cl *dsCIDLists) deleteEntries(batch datastore.Batch, chid datatransfer.ChannelID) error {
+	results, err := cl.ds.Query(query.Query{
+		Prefix:   listKey(chid).String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := batch.Delete(datastore.NewKey(entry.Key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listKey(chid datatransfer.ChannelID) datastore.Key {
+	return datastore.NewKey(fmt.Sprintf("%d-%s-%s", chid.ID, chid.Initiator, chid.Responder))
+}
+
+func nextKey(chid datatransfer.ChannelID) datastore.Key {
+	return listKey(chid).ChildString("next")
+}
+
+func cidsKey(chid datatransfer.ChannelID) datastore.Key {
+	return listKey(chid).ChildString("cids")
+}
+
+// cidKey is zero padded so the cids in a list sort in the order they were added
+func cidKey(chid datatransfer.ChannelID, index uint64) datastore.Key {
+	return cidsKey(chid).ChildString(fmt.Sprintf("%020d", index))
+}
@@ -1,52 +1,189 @@
 package cidsets
 
 import (
+	"encoding/binary"
 	"sync"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
 	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
 )
 
+var log = logging.Logger("dt-cidsets")
+
 // SetID is a unique ID for a CID set
 type SetID string
 
+// DefaultFlushInterval is the number of CIDs inserted into a set that are
+// buffered in memory before they are written to the datastore
+const DefaultFlushInterval = 16
+
+// DefaultIdleTimeout is how long a set can go unused before its buffered
+// CIDs are written out and it is dropped from memory
+const DefaultIdleTimeout = time.Minute
+
 // CIDSetManager keeps track of several CID sets, by SetID
 type CIDSetManager struct {
-	ds   datastore.Datastore
-	lk   sync.Mutex
-	sets map[SetID]*cidSet
+	ds            datastore.Datastore
+	flushInterval int
+	idleTimeout   time.Duration
+	now           func() time.Time
+
+	lk        sync.Mutex
+	sets      map[SetID]*cidSet
+	lastSweep time.Time
 }
 
-func NewCIDSetManager(ds datastore.Datastore) *CIDSetManager {
-	return &CIDSetManager{ds: ds, sets: make(map[SetID]*cidSet)}
+// Option configures a CIDSetManager
+type Option func(*CIDSetManager)
+
+// FlushInterval sets the number of inserted CIDs buffered in memory for each
+// set before they are written to the datastore in a single batch. CIDs still
+// buffered when the process stops uncleanly are lost.
+func FlushInterval(n int) Option {
+	return func(mgr *CIDSetManager) {
+		mgr.flushInterval = n
+	}
+}
+
+// IdleTimeout sets how long a set can go unused before it is flushed and
+// dropped from memory
+func IdleTimeout(timeout time.Duration) Option {
+	return func(mgr *CIDSetManager) {
+		mgr.idleTimeout = timeout
+	}
+}
+
+func NewCIDSetManager(ds datastore.Datastore, options ...Option) *CIDSetManager {
+	mgr := &CIDSetManager{
+		ds:            ds,
+		flushInterval: DefaultFlushInterval,
+		idleTimeout:   DefaultIdleTimeout,
+		now:           time.Now,
+		sets:          make(map[SetID]*cidSet),
+	}
+	for _, option := range options {
+		option(mgr)
+	}
+	mgr.lastSweep = mgr.now()
+	return mgr
 }
 
+// ErrSizeUnknown is returned when totalling the sizes of the blocks in a set
+// that has CIDs inserted without a size
+var ErrSizeUnknown = xerrors.New("size of block in cid set is not known")
+
 // InsertSetCID inserts a CID into a CID set.
 // Returns true if the set already contained the CID.
 func (mgr *CIDSetManager) InsertSetCID(sid SetID, c cid.Cid) (exists bool, err error) {
-	return mgr.getSet(sid).Insert(c)
+	s := mgr.getSet(sid)
+	defer mgr.releaseSet(s)
+	return s.Insert(c, nil)
+}
+
+// InsertSetCIDSize inserts the CID of a block into a CID set along with the
+// size of the block, which is counted by Totals.
+// Returns true if the set already contained the CID.
+func (mgr *CIDSetManager) InsertSetCIDSize(sid SetID, c cid.Cid, size uint64) (exists bool, err error) {
+	s := mgr.getSet(sid)
+	defer mgr.releaseSet(s)
+	value := make([]byte, binary.MaxVarintLen64)
+	return s.Insert(c, value[:binary.PutUvarint(value, size)])
+}
+
+// Has returns true if a CID set contains the CID
+func (mgr *CIDSetManager) Has(sid SetID, c cid.Cid) (bool, error) {
+	s := mgr.getSet(sid)
+	defer mgr.releaseSet(s)
+	return s.Has(c)
+}
+
+// Count returns the number of CIDs in a CID set
+func (mgr *CIDSetManager) Count(sid SetID) (int, error) {
+	s := mgr.getSet(sid)
+	defer mgr.releaseSet(s)
+	return s.Count()
+}
+
+// Totals returns the number of CIDs in a CID set and the combined size of
+// their blocks. It returns ErrSizeUnknown if a CID was inserted without a
+// size.
+func (mgr *CIDSetManager) Totals(sid SetID) (int, uint64, error) {
+	s := mgr.getSet(sid)
+	defer mgr.releaseSet(s)
+	return s.Totals()
 }
 
 // DeleteSet deletes a CID set
 func (mgr *CIDSetManager) DeleteSet(sid SetID) error {
-	return mgr.getSet(sid).Truncate()
+	s := mgr.getSet(sid)
+	defer mgr.releaseSet(s)
+	return s.Truncate()
+}
+
+// Flush writes the buffered CIDs of every set to the datastore
+func (mgr *CIDSetManager) Flush() error {
+	mgr.lk.Lock()
+	defer mgr.lk.Unlock()
+
+	for _, s := range mgr.sets {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// getSet gets the cidSet for the given SetID
+// getSet gets the cidSet for the given SetID, which must be released with
+// releaseSet once the caller is done with it
 func (mgr *CIDSetManager) getSet(sid SetID) *cidSet {
 	mgr.lk.Lock()
 	defer mgr.lk.Unlock()
 
+	now := mgr.now()
+	if now.Sub(mgr.lastSweep) >= mgr.idleTimeout {
+		mgr.sweep(now)
+	}
+
 	s, ok := mgr.sets[sid]
 	if !ok {
 		s = NewCIDSet(mgr.getSetDS(sid))
+		s.flushInterval = mgr.flushInterval
 		mgr.sets[sid] = s
 	}
+	s.refs++
+	s.lastUsed = now
 	return s
 }
 
+// releaseSet marks the caller as done with a set returned by getSet
+func (mgr *CIDSetManager) releaseSet(s *cidSet) {
+	mgr.lk.Lock()
+	s.refs--
+	mgr.lk.Unlock()
+}
+
+// sweep flushes and drops any set that is not in use and has been idle for
+// longer than the idle timeout. A set that fails to flush is kept, so its
+// buffered CIDs are not lost.
+func (mgr *CIDSetManager) sweep(now time.Time) {
+	mgr.lastSweep = now
+	for sid, s := range mgr.sets {
+		if s.refs > 0 || now.Sub(s.lastUsed) < mgr.idleTimeout {
+			continue
+		}
+		if err := s.Flush(); err != nil {
+			log.Errorf("flushing idle cid set %s: %s", sid, err)
+			continue
+		}
+		delete(mgr.sets, sid)
+	}
+}
+
 // getSetDS gets the wrapped datastore for the given SetID
 func (mgr *CIDSetManager) getSetDS(sid SetID) datastore.Batching {
 	setDSKey := datastore.NewKey(string(sid) + "/cids")
@@ -55,21 +192,32 @@ func (mgr *CIDSetManager) getSetDS(sid SetID) datastore.Batching {
 
 // cidSet persists a set of CIDs
 type cidSet struct {
-	lk sync.Mutex
-	ds datastore.Batching
+	lk            sync.Mutex
+	ds            datastore.Batching
+	flushInterval int
+	// pending are inserted CIDs not yet written to the datastore, with the
+	// values to write for them
+	pending map[datastore.Key][]byte
+
+	// refs and lastUsed are guarded by the manager's lock
+	refs     int
+	lastUsed time.Time
 }
 
 func NewCIDSet(ds datastore.Batching) *cidSet {
-	return &cidSet{ds: ds}
+	return &cidSet{ds: ds, pending: make(map[datastore.Key][]byte)}
 }
 
-// Insert a CID into the set.
+// Insert a CID into the set, with the value to store for it.
 // Returns true if the the CID was already in the set.
-func (s *cidSet) Insert(c cid.Cid) (exists bool, err error) {
+func (s *cidSet) Insert(c cid.Cid, value []byte) (exists bool, err error) {
 	s.lk.Lock()
 	defer s.lk.Unlock()
 
 	k := datastore.NewKey(c.String())
+	if _, ok := s.pending[k]; ok {
+		return true, nil
+	}
 	has, err := s.ds.Has(k)
 	if err != nil {
 		return false, err
@@ -77,7 +225,111 @@ func (s *cidSet) Insert(c cid.Cid) (exists bool, err error) {
 	if has {
 		return true, nil
 	}
-	return false, s.ds.Put(k, nil)
+	s.pending[k] = value
+	if len(s.pending) < s.flushInterval {
+		return false, nil
+	}
+	return false, s.flush()
+}
+
+// Has returns true if the set contains the CID
+func (s *cidSet) Has(c cid.Cid) (bool, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	k := datastore.NewKey(c.String())
+	if _, ok := s.pending[k]; ok {
+		return true, nil
+	}
+	return s.ds.Has(k)
+}
+
+// Count returns the number of CIDs in the set
+func (s *cidSet) Count() (int, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if err := s.flush(); err != nil {
+		return 0, err
+	}
+
+	res, err := s.ds.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	count := 0
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return 0, entry.Error
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Totals returns the number of CIDs in the set and the combined size of their
+// blocks
+func (s *cidSet) Totals() (int, uint64, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if err := s.flush(); err != nil {
+		return 0, 0, err
+	}
+
+	res, err := s.ds.Query(query.Query{})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer res.Close()
+
+	count := 0
+	var total uint64
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return 0, 0, entry.Error
+		}
+		size, n := binary.Uvarint(entry.Value)
+		if n <= 0 {
+			return 0, 0, xerrors.Errorf("block %s: %w", entry.Key, ErrSizeUnknown)
+		}
+		count++
+		total += size
+	}
+	return count, total, nil
+}
+
+// Flush writes the buffered CIDs in the set to the datastore
+func (s *cidSet) Flush() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	return s.flush()
+}
+
+func (s *cidSet) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	batched, err := s.ds.Batch()
+	if err != nil {
+		return err
+	}
+
+	for k, value := range s.pending {
+		if err := batched.Put(k, value); err != nil {
+			return err
+		}
+	}
+
+	if err := batched.Commit(); err != nil {
+		return err
+	}
+	s.pending = make(map[datastore.Key][]byte)
+	return nil
 }
 
 // Truncate removes all CIDs in the set
@@ -85,6 +337,8 @@ func (s *cidSet) Truncate() error {
 	s.lk.Lock()
 	defer s.lk.Unlock()
 
+	s.pending = make(map[datastore.Key][]byte)
+
 	res, err := s.ds.Query(query.Query{KeysOnly: true})
 	if err != nil {
 		return err
@@ -2,10 +2,13 @@ package cidsets
 
 import (
 	"testing"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 	ds_sync "github.com/ipfs/go-datastore/sync"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-data-transfer/testutil"
 )
@@ -45,3 +48,166 @@ func TestCIDSetManager(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, exists)
 }
+
+func TestCIDSetCount(t *testing.T) {
+	cids := testutil.GenerateCids(3)
+
+	dstore := ds_sync.MutexWrap(ds.NewMapDatastore())
+	mgr := NewCIDSetManager(dstore)
+	setID1 := SetID("set1")
+	setID2 := SetID("set2")
+
+	count, err := mgr.Count(setID1)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	for _, c := range append(cids, cids[0]) {
+		_, err := mgr.InsertSetCID(setID1, c)
+		require.NoError(t, err)
+	}
+	_, err = mgr.InsertSetCID(setID2, cids[0])
+	require.NoError(t, err)
+
+	count, err = mgr.Count(setID1)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	count, err = mgr.Count(setID2)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	err = mgr.DeleteSet(setID1)
+	require.NoError(t, err)
+
+	count, err = mgr.Count(setID1)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
+
+func TestCIDSetTotals(t *testing.T) {
+	cids := testutil.GenerateCids(3)
+
+	dstore := ds_sync.MutexWrap(ds.NewMapDatastore())
+	mgr := NewCIDSetManager(dstore, FlushInterval(2))
+	setID := SetID("set1")
+
+	count, size, err := mgr.Totals(setID)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	require.Equal(t, uint64(0), size)
+
+	for i, c := range cids[:2] {
+		_, err := mgr.InsertSetCIDSize(setID, c, uint64(100*(i+1)))
+		require.NoError(t, err)
+	}
+	exists, err := mgr.InsertSetCIDSize(setID, cids[0], 500)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	count, size, err = mgr.Totals(setID)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, uint64(300), size)
+
+	has, err := mgr.Has(setID, cids[1])
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = mgr.Has(setID, cids[2])
+	require.NoError(t, err)
+	require.False(t, has)
+
+	// a cid inserted without a size leaves the total size unknown
+	_, err = mgr.InsertSetCID(setID, cids[2])
+	require.NoError(t, err)
+	_, _, err = mgr.Totals(setID)
+	require.True(t, xerrors.Is(err, ErrSizeUnknown))
+	count, err = mgr.Count(setID)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+}
+
+func TestCIDSetBatching(t *testing.T) {
+	cids := testutil.GenerateCids(5)
+
+	dstore := ds_sync.MutexWrap(ds.NewMapDatastore())
+	mgr := NewCIDSetManager(dstore, FlushInterval(3))
+	setID := SetID("set1")
+
+	// nothing is written until the flush interval is reached
+	for _, c := range cids[:2] {
+		exists, err := mgr.InsertSetCID(setID, c)
+		require.NoError(t, err)
+		require.False(t, exists)
+	}
+	exists, err := mgr.InsertSetCID(setID, cids[0])
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 0, countKeys(t, dstore))
+
+	exists, err = mgr.InsertSetCID(setID, cids[2])
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, 3, countKeys(t, dstore))
+
+	exists, err = mgr.InsertSetCID(setID, cids[3])
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, 3, countKeys(t, dstore))
+
+	// a new manager over the same datastore only sees what was written
+	reopened := NewCIDSetManager(dstore)
+	exists, err = reopened.InsertSetCID(setID, cids[2])
+	require.NoError(t, err)
+	require.True(t, exists)
+	count, err := reopened.Count(setID)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	require.NoError(t, mgr.Flush())
+	require.Equal(t, 4, countKeys(t, dstore))
+
+	// deleting a set drops buffered cids too
+	exists, err = mgr.InsertSetCID(setID, cids[4])
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.NoError(t, mgr.DeleteSet(setID))
+	require.NoError(t, mgr.Flush())
+	require.Equal(t, 0, countKeys(t, dstore))
+}
+
+func TestCIDSetEviction(t *testing.T) {
+	cids := testutil.GenerateCids(2)
+
+	dstore := ds_sync.MutexWrap(ds.NewMapDatastore())
+	mgr := NewCIDSetManager(dstore, IdleTimeout(time.Minute))
+	now := time.Now()
+	mgr.now = func() time.Time { return now }
+
+	_, err := mgr.InsertSetCID(SetID("set1"), cids[0])
+	require.NoError(t, err)
+	now = now.Add(30 * time.Second)
+	_, err = mgr.InsertSetCID(SetID("set2"), cids[1])
+	require.NoError(t, err)
+	require.Len(t, mgr.sets, 2)
+
+	// set1 has been idle for over a minute, set2 for 30 seconds
+	now = now.Add(40 * time.Second)
+	_, err = mgr.Count(SetID("set3"))
+	require.NoError(t, err)
+	require.Len(t, mgr.sets, 2)
+	require.NotContains(t, mgr.sets, SetID("set1"))
+	require.Contains(t, mgr.sets, SetID("set2"))
+
+	// the evicted set was written out before it was dropped
+	exists, err := mgr.InsertSetCID(SetID("set1"), cids[0])
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func countKeys(t *testing.T, dstore ds.Datastore) int {
+	res, err := dstore.Query(query.Query{KeysOnly: true})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	return len(entries)
+}
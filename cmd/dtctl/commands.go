@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+)
+
+func listChannels(ctx context.Context, env *env, args []string) error {
+	if len(args) != 0 {
+		return xerrors.New("usage: list")
+	}
+	all, err := env.channels.InProgress()
+	if err != nil {
+		return err
+	}
+	chids := make([]datatransfer.ChannelID, 0, len(all))
+	for chid := range all {
+		chids = append(chids, chid)
+	}
+	sort.Slice(chids, func(i, j int) bool {
+		return chids[i].String() < chids[j].String()
+	})
+
+	w := tabwriter.NewWriter(env.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tSTATUS\tSENT\tRECEIVED\tTOTAL\tMESSAGE")
+	for _, chid := range chids {
+		chst := all[chid]
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", chid, datatransfer.Statuses[chst.Status()], chst.Sent(), chst.Received(), chst.TotalSize(), chst.Message())
+	}
+	return w.Flush()
+}
+
+func showChannel(ctx context.Context, env *env, args []string) error {
+	chst, err := getChannel(ctx, env, args, "show <channel-id>")
+	if err != nil {
+		return err
+	}
+	encoded := new(bytes.Buffer)
+	if err := dagjson.Encode(chst.Selector(), encoded); err != nil {
+		return xerrors.Errorf("encoding selector: %w", err)
+	}
+	selector := new(bytes.Buffer)
+	if err := json.Compact(selector, encoded.Bytes()); err != nil {
+		return xerrors.Errorf("encoding selector: %w", err)
+	}
+
+	w := tabwriter.NewWriter(env.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Channel:\t%s\n", chst.ChannelID())
+	fmt.Fprintf(w, "Status:\t%s\n", datatransfer.Statuses[chst.Status()])
+	fmt.Fprintf(w, "Message:\t%s\n", chst.Message())
+	fmt.Fprintf(w, "Self:\t%s\n", chst.SelfPeer())
+	fmt.Fprintf(w, "Sender:\t%s\n", chst.Sender())
+	fmt.Fprintf(w, "Recipient:\t%s\n", chst.Recipient())
+	fmt.Fprintf(w, "Pull:\t%t\n", chst.IsPull())
+	fmt.Fprintf(w, "Base CID:\t%s\n", chst.BaseCID())
+	fmt.Fprintf(w, "Selector:\t%s\n", selector)
+	fmt.Fprintf(w, "Queued:\t%d bytes, %d blocks\n", chst.Queued(), chst.QueuedBlocks())
+	fmt.Fprintf(w, "Sent:\t%d bytes, %d blocks\n", chst.Sent(), chst.SentBlocks())
+	fmt.Fprintf(w, "Received:\t%d bytes, %d blocks\n", chst.Received(), chst.ReceivedBlocks())
+	fmt.Fprintf(w, "Total size:\t%d bytes, %d blocks\n", chst.TotalSize(), chst.TotalBlocks())
+	for _, voucher := range chst.Vouchers() {
+		fmt.Fprintf(w, "Voucher:\t%s\n", describeRegisterable(voucher))
+	}
+	for _, result := range chst.VoucherResults() {
+		fmt.Fprintf(w, "Voucher result:\t%s\n", describeRegisterable(result))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	stages := chst.Stages()
+	if stages == nil || len(stages.Stages) == 0 {
+		return nil
+	}
+	fmt.Fprintln(env.out, "\nStages:")
+	for _, stage := range stages.Stages {
+		fmt.Fprintf(env.out, "  %s  %s: %s\n", formatTime(stage.CreatedTime.Time()), stage.Name, stage.Description)
+		for _, log := range stage.Logs {
+			fmt.Fprintf(env.out, "    %s  %s\n", formatTime(log.UpdatedTime.Time()), log.Log)
+		}
+	}
+	return nil
+}
+
+func dumpCIDs(ctx context.Context, env *env, args []string) error {
+	if len(args) != 1 {
+		return xerrors.New("usage: cids <channel-id>")
+	}
+	chid, err := datatransfer.ParseChannelID(args[0])
+	if err != nil {
+		return err
+	}
+	return env.cidLists.IterateList(chid, func(c cid.Cid) error {
+		_, err := fmt.Fprintln(env.out, c)
+		return err
+	})
+}
+
+func migrate(ctx context.Context, env *env, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(env.out)
+	dryRun := fs.Bool("dry-run", false, "migrate a copy of the channel records in memory, leaving the datastore as it is")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !*dryRun {
+		return xerrors.New("only -dry-run is supported: the node migrates its channel records when it starts")
+	}
+
+	report, err := channels.DryRunMigration(ctx, env.ds, env.cfg.self)
+	if err != nil {
+		return err
+	}
+	if !report.Migrated() {
+		fmt.Fprintf(env.out, "channel records are at the current version %q, nothing to migrate\n", report.To)
+		return nil
+	}
+	fmt.Fprintf(env.out, "channel records would be migrated from version %q to %q: %d channels\n", report.From, report.To, report.Channels)
+	for _, change := range report.Changes {
+		fmt.Fprintf(env.out, "  %s\n", change.Key)
+		for _, fields := range []struct {
+			name   string
+			fields []string
+		}{{"added", change.Added}, {"removed", change.Removed}, {"changed", change.Changed}} {
+			if len(fields.fields) > 0 {
+				fmt.Fprintf(env.out, "    %s: %s\n", fields.name, strings.Join(fields.fields, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func failChannel(ctx context.Context, env *env, args []string) error {
+	chst, err := getChannel(ctx, env, args, "fail <channel-id>")
+	if err != nil {
+		return err
+	}
+	chid := chst.ChannelID()
+	if channels.IsChannelTerminated(chst.Status()) {
+		return xerrors.Errorf("channel %s is already %s", chid, datatransfer.Statuses[chst.Status()])
+	}
+	ok, err := env.confirm(fmt.Sprintf("Mark channel %s, currently %s, as failed?", chid, datatransfer.Statuses[chst.Status()]))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintln(env.out, "nothing changed")
+		return nil
+	}
+	if err := env.channels.Error(chid, xerrors.New("marked as failed with dtctl")); err != nil {
+		return err
+	}
+	// wait for the channel to be cleaned up and reach its final state
+	for {
+		chst, err = env.channels.GetByID(ctx, chid)
+		if err != nil {
+			return err
+		}
+		if chst.Status() == datatransfer.Failed {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return xerrors.Errorf("waiting for channel %s to fail: %w", chid, ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	fmt.Fprintf(env.out, "channel %s failed\n", chid)
+	return nil
+}
+
+func deleteChannel(ctx context.Context, env *env, args []string) error {
+	chst, err := getChannel(ctx, env, args, "delete <channel-id>")
+	if err != nil {
+		return err
+	}
+	chid := chst.ChannelID()
+	ok, err := env.confirm(fmt.Sprintf("Delete channel %s, currently %s, and everything recorded for it?", chid, datatransfer.Statuses[chst.Status()]))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintln(env.out, "nothing changed")
+		return nil
+	}
+	if err := env.channels.Delete(chid); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.out, "channel %s deleted\n", chid)
+	return nil
+}
+
+// getChannel looks up the channel named by the only argument to a command
+func getChannel(ctx context.Context, env *env, args []string, usage string) (datatransfer.ChannelState, error) {
+	if len(args) != 1 {
+		return nil, xerrors.Errorf("usage: %s", usage)
+	}
+	chid, err := datatransfer.ParseChannelID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return env.channels.GetByID(ctx, chid)
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// describeRegisterable gives the type of a voucher or voucher result, and its
+// size if it was kept as raw CBOR
+func describeRegisterable(r datatransfer.Registerable) string {
+	raw, ok := r.(*rawRegisterable)
+	if !ok {
+		return string(r.Type())
+	}
+	return fmt.Sprintf("%s, %d bytes", raw.Type(), len(raw.raw))
+}
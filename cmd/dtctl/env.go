@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	badgerds "github.com/ipfs/go-ds-badger"
+	leveldbds "github.com/ipfs/go-ds-leveldb"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/cidlists"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+)
+
+// env is what a command runs against
+type env struct {
+	cfg config
+	ds  datastore.Batching
+	// channels and cidLists are only set up for commands that are not raw
+	channels *channels.Channels
+	cidLists cidlists.CIDLists
+	in       *bufio.Reader
+	out      io.Writer
+}
+
+// openDatastore opens the badger or leveldb datastore at the given path and
+// returns the part of it under prefix. If readOnly is set, the datastore is
+// opened read-only and changes are kept in memory, so the records can be
+// migrated without changing anything on disk.
+func openDatastore(kind string, path string, prefix datastore.Key, readOnly bool) (datastore.Batching, func(), error) {
+	var bds datastore.Batching
+	var err error
+	switch kind {
+	case "badger":
+		opts := badgerds.DefaultOptions
+		opts.ReadOnly = readOnly
+		bds, err = badgerds.NewDatastore(path, &opts)
+	case "leveldb":
+		bds, err = leveldbds.NewDatastore(path, &leveldbds.Options{ReadOnly: readOnly, ErrorIfMissing: true})
+	default:
+		return nil, nil, xerrors.Errorf("unknown datastore type %q, expected badger or leveldb", kind)
+	}
+	if err != nil {
+		return nil, nil, xerrors.Errorf("opening %s datastore at %s: %w", kind, path, err)
+	}
+	closeDS := func() { _ = bds.Close() }
+	ds := namespace.Wrap(bds, prefix)
+	if readOnly {
+		return newOverlay(ds), closeDS, nil
+	}
+	return ds, closeDS, nil
+}
+
+// startChannels sets up the channels in the datastore, migrating them if
+// needed
+func (e *env) startChannels(ctx context.Context, readOnly bool) error {
+	version, err := channels.StoredVersion(e.ds)
+	if err != nil {
+		return err
+	}
+	// never migrate the datastore on disk, that is left to the node
+	if !readOnly && version != channels.CurrentVersion {
+		return xerrors.Errorf("channel records are at version %q rather than %q: start the node once to migrate them, or check them with migrate -dry-run", version, channels.CurrentVersion)
+	}
+
+	if e.cfg.cidListsDir != "" {
+		if e.cidLists, err = cidlists.NewCIDLists(e.cfg.cidListsDir); err != nil {
+			return err
+		}
+		if readOnly {
+			e.cidLists = readOnlyCIDLists{e.cidLists}
+		}
+	} else {
+		e.cidLists = cidlists.NewDatastoreCIDLists(namespace.Wrap(e.ds, datastore.NewKey("cidlists")))
+	}
+
+	e.channels, err = channels.New(e.ds, e.cidLists, func(datatransfer.Event, datatransfer.ChannelState) {}, decoderByType, decoderByType, fakeEnv{e.cfg.self}, e.cfg.self)
+	if err != nil {
+		return err
+	}
+	if err := e.channels.Start(ctx); err != nil {
+		return xerrors.Errorf("migrating channels from version %q: %w", version, err)
+	}
+	return nil
+}
+
+// readOnlyCIDLists reads cid list files but discards any changes to them,
+// such as lists created when migrating the oldest channel records
+type readOnlyCIDLists struct {
+	cidlists.CIDLists
+}
+
+func (readOnlyCIDLists) CreateList(datatransfer.ChannelID, []cid.Cid) error { return nil }
+func (readOnlyCIDLists) AppendList(datatransfer.ChannelID, cid.Cid) error   { return nil }
+func (readOnlyCIDLists) DeleteList(datatransfer.ChannelID) error            { return nil }
+
+// rawRegisterable is a voucher or voucher result of a type dtctl does not
+// know how to decode, kept as its raw CBOR
+type rawRegisterable struct {
+	typ datatransfer.TypeIdentifier
+	raw []byte
+}
+
+func (r *rawRegisterable) Type() datatransfer.TypeIdentifier { return r.typ }
+
+func (r *rawRegisterable) MarshalCBOR(w io.Writer) error {
+	_, err := w.Write(r.raw)
+	return err
+}
+
+type rawDecoder struct {
+	typ datatransfer.TypeIdentifier
+}
+
+func (d rawDecoder) DecodeFromCbor(raw []byte) (encoding.Encodable, error) {
+	return &rawRegisterable{typ: d.typ, raw: raw}, nil
+}
+
+func decoderByType(typ datatransfer.TypeIdentifier) (encoding.Decoder, bool) {
+	return rawDecoder{typ}, true
+}
+
+// fakeEnv stands in for the network, which channels only use when they are
+// cleaned up
+type fakeEnv struct {
+	self peer.ID
+}
+
+func (fakeEnv) Protect(peer.ID, string)               {}
+func (fakeEnv) Unprotect(peer.ID, string) bool        { return false }
+func (fe fakeEnv) ID() peer.ID                        { return fe.self }
+func (fakeEnv) CleanupChannel(datatransfer.ChannelID) {}
@@ -0,0 +1,17 @@
+module github.com/filecoin-project/go-data-transfer/cmd/dtctl
+
+go 1.14
+
+require (
+	github.com/filecoin-project/go-data-transfer v0.0.0
+	github.com/ipfs/go-cid v0.0.7
+	github.com/ipfs/go-datastore v0.4.5
+	github.com/ipfs/go-ds-badger v0.2.6
+	github.com/ipfs/go-ds-leveldb v0.4.2
+	github.com/ipld/go-ipld-prime v0.9.1-0.20210324083106-dc342a9917db
+	github.com/libp2p/go-libp2p-core v0.8.5
+	github.com/stretchr/testify v1.6.1
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+)
+
+replace github.com/filecoin-project/go-data-transfer => ../..
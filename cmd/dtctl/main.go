@@ -0,0 +1,176 @@
+// Command dtctl inspects and repairs the data transfer state kept in a node's
+// datastore, while the node is stopped.
+//
+// Commands that only read open the datastore read-only and keep any changes
+// in memory, so any migrations they need are never written back. Commands that change channels ask for confirmation
+// first, unless -yes is given.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+)
+
+type config struct {
+	repo        string
+	dsType      string
+	prefix      string
+	cidListsDir string
+	self        peer.ID
+	yes         bool
+	timeout     time.Duration
+}
+
+type command struct {
+	usage       string
+	description string
+	// writes is true if the command changes the datastore
+	writes bool
+	// raw is true if the command works on the records in the datastore as
+	// they are, without the channels being set up and migrated
+	raw bool
+	run func(ctx context.Context, env *env, args []string) error
+}
+
+var commands = map[string]command{
+	"list": {
+		usage:       "list",
+		description: "list every channel with its status and progress",
+		run:         listChannels,
+	},
+	"show": {
+		usage:       "show <channel-id>",
+		description: "show the full state and stage timeline of a channel",
+		run:         showChannel,
+	},
+	"cids": {
+		usage:       "cids <channel-id>",
+		description: "print the cids received on a channel",
+		run:         dumpCIDs,
+	},
+	"migrate": {
+		usage:       "migrate -dry-run",
+		description: "check the channel records can be migrated to the current version",
+		raw:         true,
+		run:         migrate,
+	},
+	"fail": {
+		usage:       "fail <channel-id>",
+		description: "mark a stuck channel as failed",
+		writes:      true,
+		run:         failChannel,
+	},
+	"delete": {
+		usage:       "delete <channel-id>",
+		description: "delete a channel and everything recorded for it",
+		writes:      true,
+		run:         deleteChannel,
+	},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "dtctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("dtctl", flag.ContinueOnError)
+	fs.SetOutput(out)
+	var cfg config
+	var self string
+	fs.StringVar(&cfg.repo, "repo", "", "path to the node's datastore")
+	fs.StringVar(&cfg.dsType, "datastore", "badger", "type of the node's datastore: badger or leveldb")
+	fs.StringVar(&cfg.prefix, "prefix", "", "namespace the data transfer module's records are kept under, such as /datatransfer/client/transfers (required)")
+	fs.StringVar(&cfg.cidListsDir, "cidlists", "", "directory of cid list files, if the node keeps them on disk rather than in the datastore")
+	fs.StringVar(&self, "self", "", "peer ID of the node, needed to migrate records from before channels were versioned")
+	fs.BoolVar(&cfg.yes, "yes", false, "do not ask for confirmation before changing channels")
+	fs.DurationVar(&cfg.timeout, "timeout", time.Minute, "how long to wait for a command to finish")
+	fs.Usage = func() {
+		fmt.Fprintln(out, "usage: dtctl [flags] <command> [args]")
+		fmt.Fprintln(out, "\ncommands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "  %-20s %s\n", commands[name].usage, commands[name].description)
+		}
+		fmt.Fprintln(out, "\nflags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return xerrors.New("no command given")
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return xerrors.Errorf("unknown command %q", fs.Arg(0))
+	}
+	if cfg.repo == "" {
+		return xerrors.New("-repo is required")
+	}
+	if cfg.prefix == "" {
+		return xerrors.New("-prefix is required")
+	}
+	if self != "" {
+		var err error
+		if cfg.self, err = peer.Decode(self); err != nil {
+			return xerrors.Errorf("parsing -self: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+
+	ds, closeDS, err := openDatastore(cfg.dsType, cfg.repo, datastore.NewKey(cfg.prefix), !cmd.writes)
+	if err != nil {
+		return err
+	}
+	defer closeDS()
+
+	env := &env{cfg: cfg, ds: ds, in: bufio.NewReader(in), out: out}
+	if cmd.raw {
+		return cmd.run(ctx, env, fs.Args()[1:])
+	}
+	if err := env.startChannels(ctx, !cmd.writes); err != nil {
+		return err
+	}
+	if err := cmd.run(ctx, env, fs.Args()[1:]); err != nil {
+		_ = env.channels.Stop(ctx)
+		return err
+	}
+	return env.channels.Stop(ctx)
+}
+
+// confirm asks the user a yes or no question, returning true if they answer
+// yes or -yes was given
+func (e *env) confirm(question string) (bool, error) {
+	if e.cfg.yes {
+		return true, nil
+	}
+	fmt.Fprintf(e.out, "%s [y/N] ", question)
+	answer, err := e.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
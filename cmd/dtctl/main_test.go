@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	badgerds "github.com/ipfs/go-ds-badger"
+	leveldbds "github.com/ipfs/go-ds-leveldb"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	p2ptest "github.com/libp2p/go-libp2p-core/test"
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/cidlists"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestDtctl(t *testing.T) {
+	ctx := context.Background()
+	repo, err := ioutil.TempDir("", "dtctl")
+	require.NoError(t, err)
+	defer os.RemoveAll(repo)
+
+	self := p2ptest.RandPeerIDFatal(t)
+	other := p2ptest.RandPeerIDFatal(t)
+	cids := testutil.GenerateCids(3)
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+
+	// set up a node's datastore with two channels
+	opts := badgerds.DefaultOptions
+	bds, err := badgerds.NewDatastore(repo, &opts)
+	require.NoError(t, err)
+	ds := namespace.Wrap(bds, datastore.NewKey("/dt"))
+	cidLists := cidlists.NewDatastoreCIDLists(namespace.Wrap(ds, datastore.NewKey("cidlists")))
+	chans, err := channels.New(ds, cidLists, func(datatransfer.Event, datatransfer.ChannelState) {}, decoderByType, decoderByType, fakeEnv{self}, self)
+	require.NoError(t, err)
+	require.NoError(t, chans.Start(ctx))
+	chid1, err := chans.CreateNew(self, 1, cids[0], selector, &testutil.FakeDTType{Data: "voucher"}, other, other, self)
+	require.NoError(t, err)
+	require.NoError(t, chans.Accept(chid1))
+	for _, c := range cids[1:] {
+		_, err = chans.DataReceived(chid1, c, 100)
+		require.NoError(t, err)
+	}
+	chid2, err := chans.CreateNew(self, 2, cids[0], selector, &testutil.FakeDTType{Data: "voucher"}, self, self, other)
+	require.NoError(t, err)
+	require.NoError(t, chans.Stop(ctx))
+	require.NoError(t, bds.Close())
+
+	dtctl := func(input string, args ...string) (string, error) {
+		out := new(bytes.Buffer)
+		err := run(append([]string{"-repo", repo, "-prefix", "/dt"}, args...), strings.NewReader(input), out)
+		return out.String(), err
+	}
+
+	err = run([]string{"-repo", repo, "list"}, strings.NewReader(""), new(bytes.Buffer))
+	require.EqualError(t, err, "-prefix is required")
+
+	out, err := dtctl("", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, chid1.String())
+	require.Contains(t, out, chid2.String())
+	require.Contains(t, out, "Ongoing")
+	require.Contains(t, out, "Requested")
+
+	out, err = dtctl("", "show", chid1.String())
+	require.NoError(t, err)
+	require.Regexp(t, `Received:\s+200 bytes, 2 blocks`, out)
+	require.Regexp(t, `Voucher:\s+FakeDTType`, out)
+	require.Contains(t, out, "Stages:")
+
+	out, err = dtctl("", "cids", chid1.String())
+	require.NoError(t, err)
+	require.Equal(t, cids[1].String()+"\n"+cids[2].String()+"\n", out)
+
+	out, err = dtctl("", "migrate", "-dry-run")
+	require.NoError(t, err)
+	require.Contains(t, out, "nothing to migrate")
+	_, err = dtctl("", "migrate")
+	require.Error(t, err)
+
+	_, err = dtctl("", "show", "not-a-channel")
+	require.Error(t, err)
+
+	// declining leaves the channel alone
+	out, err = dtctl("n\n", "fail", chid1.String())
+	require.NoError(t, err)
+	require.Contains(t, out, "nothing changed")
+	out, err = dtctl("", "show", chid1.String())
+	require.NoError(t, err)
+	require.Regexp(t, `Status:\s+Ongoing`, out)
+
+	out, err = dtctl("y\n", "fail", chid1.String())
+	require.NoError(t, err)
+	require.Contains(t, out, "failed")
+	out, err = dtctl("", "show", chid1.String())
+	require.NoError(t, err)
+	require.Regexp(t, `Status:\s+Failed`, out)
+	require.Contains(t, out, "marked as failed with dtctl")
+	_, err = dtctl("", "-yes", "fail", chid1.String())
+	require.Error(t, err)
+
+	_, err = dtctl("", "-yes", "delete", chid2.String())
+	require.NoError(t, err)
+	out, err = dtctl("", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, chid1.String())
+	require.NotContains(t, out, chid2.String())
+}
+
+func TestDtctlLevelDB(t *testing.T) {
+	ctx := context.Background()
+	repo, err := ioutil.TempDir("", "dtctl")
+	require.NoError(t, err)
+	defer os.RemoveAll(repo)
+
+	self := p2ptest.RandPeerIDFatal(t)
+	other := p2ptest.RandPeerIDFatal(t)
+	cids := testutil.GenerateCids(3)
+	selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+
+	ldb, err := leveldbds.NewDatastore(repo, nil)
+	require.NoError(t, err)
+	ds := namespace.Wrap(ldb, datastore.NewKey("/dt"))
+	cidLists := cidlists.NewDatastoreCIDLists(namespace.Wrap(ds, datastore.NewKey("cidlists")))
+	chans, err := channels.New(ds, cidLists, func(datatransfer.Event, datatransfer.ChannelState) {}, decoderByType, decoderByType, fakeEnv{self}, self)
+	require.NoError(t, err)
+	require.NoError(t, chans.Start(ctx))
+	chid, err := chans.CreateNew(self, 1, cids[0], selector, &testutil.FakeDTType{Data: "voucher"}, other, other, self)
+	require.NoError(t, err)
+	require.NoError(t, chans.Accept(chid))
+	for _, c := range cids[1:] {
+		_, err = chans.DataReceived(chid, c, 100)
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		chst, err := chans.GetByID(ctx, chid)
+		return err == nil && chst.ReceivedBlocks() == 2
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, chans.Stop(ctx))
+	require.NoError(t, ldb.Close())
+
+	dtctl := func(args ...string) (string, error) {
+		out := new(bytes.Buffer)
+		err := run(append([]string{"-repo", repo, "-prefix", "/dt"}, args...), strings.NewReader(""), out)
+		return out.String(), err
+	}
+
+	out, err := dtctl("-datastore", "leveldb", "show", chid.String())
+	require.NoError(t, err)
+	require.Regexp(t, `Received:\s+200 bytes, 2 blocks`, out)
+	out, err = dtctl("-datastore", "leveldb", "cids", chid.String())
+	require.NoError(t, err)
+	require.Equal(t, cids[1].String()+"\n"+cids[2].String()+"\n", out)
+
+	_, err = dtctl("-datastore", "sqlite", "list")
+	require.Error(t, err)
+}
+
+func TestOverlay(t *testing.T) {
+	base := datastore.NewMapDatastore()
+	require.NoError(t, base.Put(datastore.NewKey("/a/1"), []byte("one")))
+	require.NoError(t, base.Put(datastore.NewKey("/a/2"), []byte("two")))
+	require.NoError(t, base.Put(datastore.NewKey("/b/1"), []byte("other")))
+
+	o := newOverlay(base)
+	require.NoError(t, o.Put(datastore.NewKey("/a/1"), []byte("changed")))
+	require.NoError(t, o.Put(datastore.NewKey("/a/3"), []byte("three")))
+	require.NoError(t, o.Delete(datastore.NewKey("/a/2")))
+
+	value, err := o.Get(datastore.NewKey("/a/1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("changed"), value)
+	_, err = o.Get(datastore.NewKey("/a/2"))
+	require.Equal(t, datastore.ErrNotFound, err)
+	results, err := o.Query(query.Query{Prefix: "/a", Orders: []query.Order{query.OrderByKey{}}})
+	require.NoError(t, err)
+	entries, err := results.Rest()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "/a/1", entries[0].Key)
+	require.Equal(t, []byte("changed"), entries[0].Value)
+	require.Equal(t, "/a/3", entries[1].Key)
+
+	// nothing is written through
+	value, err = base.Get(datastore.NewKey("/a/1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("one"), value)
+	has, err := base.Has(datastore.NewKey("/a/2"))
+	require.NoError(t, err)
+	require.True(t, has)
+	has, err = base.Has(datastore.NewKey("/a/3"))
+	require.NoError(t, err)
+	require.False(t, has)
+}
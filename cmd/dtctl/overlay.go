@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// overlay reads through to a datastore opened read-only and keeps any changes
+// in memory, so the records can be migrated without changing anything on disk
+// or copying them all first
+type overlay struct {
+	base datastore.Read
+
+	lk      sync.RWMutex
+	changes *datastore.MapDatastore
+	deleted map[datastore.Key]struct{}
+}
+
+var _ datastore.Batching = (*overlay)(nil)
+
+func newOverlay(base datastore.Read) *overlay {
+	return &overlay{
+		base:    base,
+		changes: datastore.NewMapDatastore(),
+		deleted: make(map[datastore.Key]struct{}),
+	}
+}
+
+func (o *overlay) Get(key datastore.Key) ([]byte, error) {
+	o.lk.RLock()
+	defer o.lk.RUnlock()
+	if _, ok := o.deleted[key]; ok {
+		return nil, datastore.ErrNotFound
+	}
+	value, err := o.changes.Get(key)
+	if err != datastore.ErrNotFound {
+		return value, err
+	}
+	return o.base.Get(key)
+}
+
+func (o *overlay) Has(key datastore.Key) (bool, error) {
+	return datastore.GetBackedHas(o, key)
+}
+
+func (o *overlay) GetSize(key datastore.Key) (int, error) {
+	return datastore.GetBackedSize(o, key)
+}
+
+func (o *overlay) Put(key datastore.Key, value []byte) error {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	delete(o.deleted, key)
+	return o.changes.Put(key, value)
+}
+
+func (o *overlay) Delete(key datastore.Key) error {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	o.deleted[key] = struct{}{}
+	return o.changes.Delete(key)
+}
+
+// Query merges the records on disk with the changes made to them, then applies
+// the rest of the query to the result
+func (o *overlay) Query(q query.Query) (query.Results, error) {
+	o.lk.RLock()
+	defer o.lk.RUnlock()
+	entries := make(map[string]query.Entry)
+	for _, ds := range []datastore.Read{o.base, o.changes} {
+		results, err := ds.Query(query.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly, ReturnsSizes: q.ReturnsSizes})
+		if err != nil {
+			return nil, err
+		}
+		all, err := results.Rest()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range all {
+			if _, ok := o.deleted[datastore.NewKey(entry.Key)]; !ok {
+				entries[entry.Key] = entry
+			}
+		}
+	}
+	merged := make([]query.Entry, 0, len(entries))
+	for _, entry := range entries {
+		merged = append(merged, entry)
+	}
+	return query.NaiveQueryApply(q, query.ResultsWithEntries(q, merged)), nil
+}
+
+func (o *overlay) Batch() (datastore.Batch, error) {
+	return datastore.NewBasicBatch(o), nil
+}
+
+func (o *overlay) Sync(datastore.Key) error {
+	return nil
+}
+
+func (o *overlay) Close() error {
+	return nil
+}
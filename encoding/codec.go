@@ -0,0 +1,132 @@
+package encoding
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/schema"
+	cborgen "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// Codec is the multicodec code of the IPLD codec a value is encoded with
+type Codec uint64
+
+const (
+	// DagCBOR is the codec values are encoded with unless they declare
+	// another. Records written before codecs were recorded have codec 0,
+	// which is read as DagCBOR.
+	DagCBOR Codec = 0x71
+	// DagJSON encodes values as DAG-JSON
+	DagJSON Codec = 0x0129
+)
+
+func (c Codec) String() string {
+	switch c {
+	case 0, DagCBOR:
+		return "dag-cbor"
+	case DagJSON:
+		return "dag-json"
+	default:
+		return fmt.Sprintf("codec 0x%x", uint64(c))
+	}
+}
+
+// CodecEncodable is implemented by encodables that declare the codec they
+// are encoded with
+type CodecEncodable interface {
+	Codec() Codec
+}
+
+// CodecOf returns the codec a value is encoded with
+func CodecOf(value Encodable) Codec {
+	if codecEncodable, ok := value.(CodecEncodable); ok && codecEncodable.Codec() != 0 {
+		return codecEncodable.Codec()
+	}
+	return DagCBOR
+}
+
+// SchemaBound is implemented by encodables bound to a node of an IPLD
+// schema type, such as one generated by go-ipld-prime's schema/gen. They
+// are encoded from the representation of the node, and decoded by building
+// a node with SchemaPrototype and binding a new value to it.
+//
+// The version of go-ipld-prime this module is built with, which is the one
+// go-graphsync requires, predates bindnode, so Go types cannot be bound to a
+// schema automatically. Types have to provide their typed node themselves,
+// usually by wrapping code generated from the schema. Once go-graphsync
+// moves to a go-ipld-prime with bindnode, it can implement SchemaBound for
+// plain Go types.
+type SchemaBound interface {
+	// SchemaNode returns the typed node the value is bound to
+	SchemaNode() schema.TypedNode
+	// SchemaPrototype returns the prototype of the nodes to bind to
+	SchemaPrototype() ipld.NodePrototype
+	// Bind returns a new value bound to the given node
+	Bind(node ipld.Node) (Encodable, error)
+}
+
+type schemaDecoder struct {
+	bound SchemaBound
+}
+
+func (decoder *schemaDecoder) DecodeFromCbor(encoded []byte) (Encodable, error) {
+	nb := decoder.bound.SchemaPrototype().NewBuilder()
+	if err := dagcbor.Decode(nb, bytes.NewReader(encoded)); err != nil {
+		return nil, err
+	}
+	return decoder.bound.Bind(nb.Build())
+}
+
+// EncodeItem encodes a value with the codec it declares, as a single CBOR
+// data item that can be embedded in a message or record. DAG-JSON is
+// embedded as a text string.
+func EncodeItem(value Encodable) ([]byte, Codec, error) {
+	codec := CodecOf(value)
+	switch codec {
+	case DagCBOR:
+		encoded, err := Encode(value)
+		return encoded, codec, err
+	case DagJSON:
+		encoded, err := EncodeDagJSON(value)
+		if err != nil {
+			return nil, codec, err
+		}
+		buf := new(bytes.Buffer)
+		if err := cborgen.WriteMajorTypeHeader(buf, cborgen.MajTextString, uint64(len(encoded))); err != nil {
+			return nil, codec, err
+		}
+		buf.Write(encoded)
+		return buf.Bytes(), codec, nil
+	default:
+		return nil, codec, xerrors.Errorf("unsupported codec %s", codec)
+	}
+}
+
+// ItemToCBOR converts a data item written by EncodeItem with the given codec
+// to the CBOR encoding of the value
+func ItemToCBOR(codec Codec, item []byte) ([]byte, error) {
+	switch codec {
+	case 0, DagCBOR:
+		return item, nil
+	case DagJSON:
+		encoded, err := cborgen.ReadString(bytes.NewReader(item))
+		if err != nil {
+			return nil, xerrors.Errorf("reading DAG-JSON item: %w", err)
+		}
+		return DagJSONToCBOR([]byte(encoded))
+	default:
+		return nil, xerrors.Errorf("unsupported codec %s", codec)
+	}
+}
+
+// DecodeItem decodes a data item written by EncodeItem with the given codec
+func DecodeItem(decoder Decoder, codec Codec, item []byte) (Encodable, error) {
+	encoded, err := ItemToCBOR(codec, item)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.DecodeFromCbor(encoded)
+}
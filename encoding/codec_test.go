@@ -0,0 +1,65 @@
+package encoding_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/encoding/testdata"
+)
+
+func TestCodecs(t *testing.T) {
+	testCases := map[string]struct {
+		val           encoding.Encodable
+		expectedCodec encoding.Codec
+	}{
+		"cbor-gen types default to dag-cbor": {
+			val:           testdata.Cbg,
+			expectedCodec: encoding.DagCBOR,
+		},
+		"schema bound types default to dag-cbor": {
+			val:           testdata.Schema,
+			expectedCodec: encoding.DagCBOR,
+		},
+		"types can declare dag-json": {
+			val:           testdata.JSON,
+			expectedCodec: encoding.DagJSON,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			item, codec, err := encoding.EncodeItem(data.val)
+			require.NoError(t, err)
+			require.Equal(t, data.expectedCodec, codec)
+			decoder, err := encoding.NewDecoder(data.val)
+			require.NoError(t, err)
+			decoded, err := encoding.DecodeItem(decoder, codec, item)
+			require.NoError(t, err)
+			require.Equal(t, data.val, decoded)
+		})
+	}
+
+	t.Run("dag-json is embedded as a text string", func(t *testing.T) {
+		item, _, err := encoding.EncodeItem(testdata.JSON)
+		require.NoError(t, err)
+		require.Equal(t, append([]byte{0x72}, `[100,"appleSauce"]`...), item)
+	})
+
+	t.Run("codec 0 is read as dag-cbor", func(t *testing.T) {
+		encoded, err := encoding.Encode(testdata.Cbg)
+		require.NoError(t, err)
+		decoder, err := encoding.NewDecoder(testdata.Cbg)
+		require.NoError(t, err)
+		decoded, err := encoding.DecodeItem(decoder, 0, encoded)
+		require.NoError(t, err)
+		require.Equal(t, testdata.Cbg, decoded)
+	})
+
+	t.Run("rejects unknown codecs", func(t *testing.T) {
+		decoder, err := encoding.NewDecoder(testdata.Cbg)
+		require.NoError(t, err)
+		_, err = encoding.DecodeItem(decoder, 0x55, []byte{0xf6})
+		require.EqualError(t, err, "unsupported codec codec 0x55")
+	})
+}
@@ -0,0 +1,286 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"golang.org/x/xerrors"
+)
+
+// EncodeDagJSON encodes an encodable to DAG-JSON, by way of its CBOR encoding
+func EncodeDagJSON(value Encodable) ([]byte, error) {
+	if schemaBound, ok := value.(SchemaBound); ok {
+		value = schemaBound.SchemaNode().Representation()
+	}
+	if node, ok := value.(ipld.Node); ok {
+		buf := new(bytes.Buffer)
+		if err := WriteDagJSON(node, buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	encoded, err := Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return CBORToDagJSON(encoded)
+}
+
+// CBORToDagJSON converts DAG-CBOR to DAG-JSON
+func CBORToDagJSON(encoded []byte) ([]byte, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, bytes.NewReader(encoded)); err != nil {
+		return nil, xerrors.Errorf("decoding CBOR: %w", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteDagJSON(nb.Build(), buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DagJSONToCBOR converts DAG-JSON to DAG-CBOR
+func DagJSONToCBOR(encoded []byte) ([]byte, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := ReadDagJSON(nb, bytes.NewReader(encoded)); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := dagcbor.Encode(nb.Build(), buf); err != nil {
+		return nil, xerrors.Errorf("encoding CBOR: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteDagJSON writes a node as DAG-JSON, with the keys of maps sorted, links
+// written as {"/": "<cid>"} and bytes as {"/": {"bytes": "<base64>"}}.
+// Strings must be valid UTF-8, as JSON strings cannot hold anything else.
+//
+// The dagjson codec of the go-ipld-prime version in use cannot write bytes,
+// which vouchers often hold, so nodes are written here instead.
+func WriteDagJSON(n ipld.Node, w io.Writer) error {
+	switch n.Kind() {
+	case ipld.Kind_Null:
+		_, err := io.WriteString(w, "null")
+		return err
+	case ipld.Kind_Bool:
+		v, err := n.AsBool()
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, strconv.FormatBool(v))
+		return err
+	case ipld.Kind_Int:
+		v, err := n.AsInt()
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, strconv.FormatInt(v, 10))
+		return err
+	case ipld.Kind_Float:
+		v, err := n.AsFloat()
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, v)
+	case ipld.Kind_String:
+		v, err := n.AsString()
+		if err != nil {
+			return err
+		}
+		if !utf8.ValidString(v) {
+			return xerrors.Errorf("string %q is not valid UTF-8", v)
+		}
+		return writeJSON(w, v)
+	case ipld.Kind_Bytes:
+		v, err := n.AsBytes()
+		if err != nil {
+			return err
+		}
+		return writeBytes(w, v)
+	case ipld.Kind_Link:
+		v, err := n.AsLink()
+		if err != nil {
+			return err
+		}
+		lnk, ok := v.(cidlink.Link)
+		if !ok {
+			return xerrors.Errorf("unsupported link type %T", v)
+		}
+		_, err = io.WriteString(w, `{"/":"`+lnk.Cid.String()+`"}`)
+		return err
+	case ipld.Kind_List:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		for itr := n.ListIterator(); !itr.Done(); {
+			idx, v, err := itr.Next()
+			if err != nil {
+				return err
+			}
+			if idx > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			if err := WriteDagJSON(v, w); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "]")
+		return err
+	case ipld.Kind_Map:
+		entries := make(map[string]ipld.Node, n.Length())
+		keys := make([]string, 0, n.Length())
+		for itr := n.MapIterator(); !itr.Done(); {
+			k, v, err := itr.Next()
+			if err != nil {
+				return err
+			}
+			key, err := k.AsString()
+			if err != nil {
+				return err
+			}
+			entries[key] = v
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if _, err := io.WriteString(w, "{"); err != nil {
+			return err
+		}
+		for i, key := range keys {
+			if i > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			if err := writeJSON(w, key); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, ":"); err != nil {
+				return err
+			}
+			if err := WriteDagJSON(entries[key], w); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "}")
+		return err
+	default:
+		return xerrors.Errorf("unsupported node kind %s", n.Kind())
+	}
+}
+
+func writeBytes(w io.Writer, v []byte) error {
+	_, err := io.WriteString(w, `{"/":{"bytes":"`+base64.RawStdEncoding.EncodeToString(v)+`"}}`)
+	return err
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+// ReadDagJSON reads DAG-JSON written by WriteDagJSON into a node assembler
+func ReadDagJSON(na ipld.NodeAssembler, r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return xerrors.Errorf("decoding JSON: %w", err)
+	}
+	return assembleDagJSON(na, value)
+}
+
+func assembleDagJSON(na ipld.NodeAssembler, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return na.AssignNull()
+	case bool:
+		return na.AssignBool(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return na.AssignInt(i)
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return xerrors.Errorf("decoding number %s: %w", v, err)
+		}
+		return na.AssignFloat(f)
+	case string:
+		return na.AssignString(v)
+	case []interface{}:
+		la, err := na.BeginList(int64(len(v)))
+		if err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := assembleDagJSON(la.AssembleValue(), item); err != nil {
+				return err
+			}
+		}
+		return la.Finish()
+	case map[string]interface{}:
+		if special, ok := v["/"]; ok && len(v) == 1 {
+			return assembleSpecial(na, special)
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		ma, err := na.BeginMap(int64(len(v)))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := ma.AssembleKey().AssignString(key); err != nil {
+				return err
+			}
+			if err := assembleDagJSON(ma.AssembleValue(), v[key]); err != nil {
+				return err
+			}
+		}
+		return ma.Finish()
+	default:
+		return xerrors.Errorf("unexpected JSON value %T", value)
+	}
+}
+
+// assembleSpecial assembles the value of a map with the single key "/", which
+// is either a link or bytes
+func assembleSpecial(na ipld.NodeAssembler, special interface{}) error {
+	switch v := special.(type) {
+	case string:
+		c, err := cid.Decode(v)
+		if err != nil {
+			return xerrors.Errorf("decoding link %s: %w", v, err)
+		}
+		return na.AssignLink(cidlink.Link{Cid: c})
+	case map[string]interface{}:
+		encoded, ok := v["bytes"].(string)
+		if !ok || len(v) != 1 {
+			break
+		}
+		decoded, err := base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil {
+			return xerrors.Errorf("decoding bytes: %w", err)
+		}
+		return na.AssignBytes(decoded)
+	}
+	return xerrors.New(`map with the key "/" must be a link or bytes`)
+}
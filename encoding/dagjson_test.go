@@ -0,0 +1,82 @@
+package encoding_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/fluent"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/encoding/testdata"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestDagJSON(t *testing.T) {
+	link := cidlink.Link{Cid: testutil.GenerateCids(1)[0]}
+	node := fluent.MustBuildMap(basicnode.Prototype.Map, 8, func(ma fluent.MapAssembler) {
+		ma.AssembleEntry("string").AssignString("hello")
+		ma.AssembleEntry("int").AssignInt(-42)
+		ma.AssembleEntry("float").AssignFloat(1.5)
+		ma.AssembleEntry("bool").AssignBool(true)
+		ma.AssembleEntry("null").AssignNull()
+		ma.AssembleEntry("bytes").AssignBytes([]byte{0, 1, 2, 255})
+		ma.AssembleEntry("link").AssignLink(link)
+		ma.AssembleEntry("list").CreateList(2, func(la fluent.ListAssembler) {
+			la.AssembleValue().AssignInt(1)
+			la.AssembleValue().AssignString("two")
+		})
+	})
+
+	encoded, err := encoding.EncodeDagJSON(node)
+	require.NoError(t, err)
+	require.Equal(t, `{"bool":true,"bytes":{"/":{"bytes":"AAEC/w"}},"float":1.5,"int":-42,"link":{"/":"`+link.Cid.String()+`"},"list":[1,"two"],"null":null,"string":"hello"}`, string(encoded))
+
+	nb := basicnode.Prototype.Any.NewBuilder()
+	require.NoError(t, encoding.ReadDagJSON(nb, bytes.NewReader(encoded)))
+	roundTripped, err := encoding.EncodeDagJSON(nb.Build())
+	require.NoError(t, err)
+	require.Equal(t, encoded, roundTripped)
+
+	t.Run("converts to and from CBOR", func(t *testing.T) {
+		cborEncoded, err := encoding.Encode(testdata.Cbg)
+		require.NoError(t, err)
+		dagJSON, err := encoding.CBORToDagJSON(cborEncoded)
+		require.NoError(t, err)
+		dagJSON2, err := encoding.EncodeDagJSON(testdata.Cbg)
+		require.NoError(t, err)
+		require.Equal(t, dagJSON, dagJSON2)
+		backToCBOR, err := encoding.DagJSONToCBOR(dagJSON)
+		require.NoError(t, err)
+
+		// both decode to the same data model
+		expected := basicnode.Prototype.Any.NewBuilder()
+		require.NoError(t, dagcbor.Decode(expected, bytes.NewReader(cborEncoded)))
+		actual := basicnode.Prototype.Any.NewBuilder()
+		require.NoError(t, dagcbor.Decode(actual, bytes.NewReader(backToCBOR)))
+		require.Equal(t, expected.Build(), actual.Build())
+	})
+
+	t.Run("rejects strings that are not UTF-8", func(t *testing.T) {
+		_, err := encoding.EncodeDagJSON(basicnode.NewString(string([]byte{0xff, 0xfe})))
+		require.Error(t, err)
+	})
+
+	t.Run("rejects malformed special forms", func(t *testing.T) {
+		for _, encoded := range []string{
+			`{"/":"not a cid"}`,
+			`{"/":{"bytes":"!!"}}`,
+			`{"/":{"string":"!!"}}`,
+			`{"/":{"bytes":"AAE","string":"AAE"}}`,
+			`{"/":{"other":"AAE"}}`,
+			`{"/":1}`,
+			`{"a":`,
+		} {
+			_, err := encoding.DagJSONToCBOR([]byte(encoded))
+			require.Error(t, err, encoded)
+		}
+	})
+}
@@ -25,9 +25,12 @@ func Encode(value Encodable) ([]byte, error) {
 		}
 		return buf.Bytes(), nil
 	}
+	if schemaBound, ok := value.(SchemaBound); ok {
+		value = schemaBound.SchemaNode().Representation()
+	}
 	if ipldEncodable, ok := value.(ipld.Node); ok {
 		buf := new(bytes.Buffer)
-		err := dagcbor.Encoder(ipldEncodable, buf)
+		err := dagcbor.Encode(ipldEncodable, buf)
 		if err != nil {
 			return nil, err
 		}
@@ -45,6 +48,10 @@ type Decoder interface {
 // object type. It will use the decoding that is optimal for that type
 // It returns error if it's not possible to setup a decoder for this type
 func NewDecoder(decodeType Encodable) (Decoder, error) {
+	// check if type is bound to a schema type, if so, bind decoded nodes
+	if schemaBound, ok := decodeType.(SchemaBound); ok {
+		return &schemaDecoder{schemaBound}, nil
+	}
 	// check if type is ipld.Node, if so, just use style
 	if ipldDecodable, ok := decodeType.(ipld.Node); ok {
 		return &ipldDecoder{ipldDecodable.Prototype()}, nil
@@ -79,7 +86,7 @@ type ipldDecoder struct {
 func (decoder *ipldDecoder) DecodeFromCbor(encoded []byte) (Encodable, error) {
 	builder := decoder.style.NewBuilder()
 	buf := bytes.NewReader(encoded)
-	err := dagcbor.Decoder(builder, buf)
+	err := dagcbor.Decode(builder, buf)
 	if err != nil {
 		return nil, err
 	}
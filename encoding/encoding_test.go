@@ -22,6 +22,9 @@ func TestRoundTrip(t *testing.T) {
 		"can encode/decode old ipld format types": {
 			val: testdata.Standard,
 		},
+		"can encode/decode schema bound types": {
+			val: testdata.Schema,
+		},
 	}
 	for testCase, data := range testCases {
 		t.Run(testCase, func(t *testing.T) {
@@ -2,8 +2,14 @@ package testdata
 
 import (
 	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/fluent"
 	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/node/gendemo"
+	"github.com/ipld/go-ipld-prime/schema"
+	"golang.org/x/xerrors"
+
+	"github.com/filecoin-project/go-data-transfer/encoding"
 )
 
 // Prime = an instance of an ipld prime piece of data
@@ -35,3 +41,43 @@ type cbgType struct {
 
 // Cbg = an instance of a cbor-gen type
 var Cbg *cbgType = &cbgType{X: 100, Y: "appleSauce"}
+
+// jsonType is a cbor-gen type that declares it is encoded as DAG-JSON
+type jsonType struct {
+	cbgType
+}
+
+func (*jsonType) Codec() encoding.Codec {
+	return encoding.DagJSON
+}
+
+// JSON = an instance of a type encoded as DAG-JSON
+var JSON *jsonType = &jsonType{cbgType{X: 100, Y: "appleSauce"}}
+
+// schemaType is bound to a node of a schema type generated by go-ipld-prime
+type schemaType struct {
+	node gendemo.Msg3
+}
+
+func (s *schemaType) SchemaNode() schema.TypedNode {
+	return s.node
+}
+
+func (s *schemaType) SchemaPrototype() ipld.NodePrototype {
+	return gendemo.Type.Msg3
+}
+
+func (s *schemaType) Bind(node ipld.Node) (encoding.Encodable, error) {
+	msg, ok := node.(gendemo.Msg3)
+	if !ok {
+		return nil, xerrors.Errorf("expected Msg3, got %T", node)
+	}
+	return &schemaType{msg}, nil
+}
+
+// Schema = an instance of a type bound to an IPLD schema type
+var Schema *schemaType = &schemaType{fluent.MustBuildMap(gendemo.Type.Msg3, 3, func(na fluent.MapAssembler) {
+	na.AssembleEntry("whee").AssignInt(1)
+	na.AssembleEntry("woot").AssignInt(2)
+	na.AssembleEntry("waga").AssignInt(3)
+}).(gendemo.Msg3)}
@@ -28,5 +28,13 @@ const ErrResume = errorType("resume channel")
 // ErrRejected indicates a request was not accepted
 const ErrRejected = errorType("response rejected")
 
+// ErrValidationTimedOut indicates a request was not validated by its
+// asynchronous validators before the validation timeout
+const ErrValidationTimedOut = errorType("request validation timed out")
+
 // ErrUnsupported indicates an operation is not supported by the transport protocol
 const ErrUnsupported = errorType("unsupported")
+
+// ErrSkipBlock is a special error that a BlockValidator can use to have a
+// received block discarded rather than stored, without stopping the transfer
+const ErrSkipBlock = errorType("skip block")
@@ -98,6 +98,25 @@ const (
 	// SendDataError indicates that the transport layer had an error trying
 	// to send data to the remote peer
 	SendDataError
+
+	// BlockRejected is emitted when a BlockValidator has a received block
+	// skipped or the channel paused. The reason is recorded in the channel
+	// message.
+	BlockRejected
+
+	// TotalSizeKnown is emitted when the total number of blocks and bytes to
+	// be transferred on a channel has been computed by the sender, or
+	// received from it
+	TotalSizeKnown
+
+	// BeginValidation is emitted when the responder starts validating a
+	// request asynchronously
+	BeginValidation
+
+	// DataCountsReconciled is emitted on startup when the count of blocks
+	// and bytes queued, sent or received on a channel is reset to the blocks
+	// recorded as seen on it, after an unclean shutdown left them out of step
+	DataCountsReconciled
 )
 
 // Events are human readable names for data transfer events
@@ -127,6 +146,10 @@ var Events = map[EventCode]string{
 	DataQueuedProgress:          "DataQueuedProgress",
 	DataSentProgress:            "DataSentProgress",
 	DataReceivedProgress:        "DataReceivedProgress",
+	BlockRejected:               "BlockRejected",
+	TotalSizeKnown:              "TotalSizeKnown",
+	BeginValidation:             "BeginValidation",
+	DataCountsReconciled:        "DataCountsReconciled",
 }
 
 // Event is a struct containing information about a data transfer event
@@ -0,0 +1,211 @@
+package fetch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync/storeutil"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+)
+
+var log = logging.Logger("dt-fetch")
+
+// closeTimeout bounds closing the channel of a fetch whose context is
+// cancelled
+const closeTimeout = 30 * time.Second
+
+// ProgressFunc is called with the latest channel state each time new data is
+// received on a fetch. It is called synchronously from the data transfer event
+// loop and must not block.
+type ProgressFunc func(datatransfer.ChannelState)
+
+type fetchOptions struct {
+	voucher  datatransfer.Voucher
+	progress ProgressFunc
+}
+
+// Option configures a single call to Fetch
+type Option func(*fetchOptions)
+
+// WithVoucher sets the voucher sent to the responder. If no voucher is given,
+// an empty fetch.Voucher is sent.
+func WithVoucher(voucher datatransfer.Voucher) Option {
+	return func(fo *fetchOptions) {
+		fo.voucher = voucher
+	}
+}
+
+// WithProgress registers a function that is called as data is received
+func WithProgress(progress ProgressFunc) Option {
+	return func(fo *fetchOptions) {
+		fo.progress = progress
+	}
+}
+
+type fetchRequest struct {
+	// lk orders events replayed once the channel is opened before events
+	// received after
+	lk       sync.Mutex
+	progress ProgressFunc
+	done     chan datatransfer.ChannelState
+}
+
+type fetchEvent struct {
+	event        datatransfer.Event
+	channelState datatransfer.ChannelState
+}
+
+// Fetcher pulls DAGs from remote peers into a blockstore chosen per call,
+// waiting for each transfer to finish. The manager must use a
+// datatransfer.StoreConfigurableTransport, such as the graphsync transport.
+type Fetcher struct {
+	dt    datatransfer.Manager
+	unsub datatransfer.Unsubscribe
+
+	lk     sync.Mutex
+	active map[datatransfer.ChannelID]*fetchRequest
+	// opening counts the channels being opened. While any are, events for
+	// channels we initiated that are not yet active are kept in early, as
+	// they may belong to a channel being opened.
+	opening int
+	early   map[datatransfer.ChannelID][]fetchEvent
+}
+
+// NewFetcher returns a Fetcher that opens pull channels on the given manager
+func NewFetcher(dt datatransfer.Manager) *Fetcher {
+	f := &Fetcher{
+		dt:     dt,
+		active: make(map[datatransfer.ChannelID]*fetchRequest),
+		early:  make(map[datatransfer.ChannelID][]fetchEvent),
+	}
+	f.unsub = dt.SubscribeToEvents(f.onEvent)
+	return f
+}
+
+// Close stops the Fetcher from listening to data transfer events. Fetches
+// still in progress will only return when their context is cancelled.
+func (f *Fetcher) Close() {
+	f.unsub()
+}
+
+// Fetch pulls the DAG under root matching selector from the given peer into
+// the given blockstore. It returns once the channel reaches a final state.
+// If the channel does not complete successfully, the returned error is a
+// *fetch.Error. If the context is cancelled first, the channel is closed and
+// the context error is returned.
+func (f *Fetcher) Fetch(ctx context.Context, from peer.ID, root cid.Cid, selector ipld.Node, bs bstore.Blockstore, options ...Option) (datatransfer.ChannelState, error) {
+	fo := fetchOptions{}
+	for _, option := range options {
+		option(&fo)
+	}
+	voucher := fo.voucher
+	if voucher == nil {
+		voucher = &Voucher{}
+	}
+
+	req := &fetchRequest{
+		progress: fo.progress,
+		done:     make(chan datatransfer.ChannelState, 1),
+	}
+	store := datatransfer.WithStore(storeutil.LinkSystemForBlockstore(bs))
+
+	f.lk.Lock()
+	f.opening++
+	f.lk.Unlock()
+	chid, err := f.dt.OpenPullDataChannel(ctx, from, voucher, root, selector, store)
+	f.lk.Lock()
+	f.opening--
+	var early []fetchEvent
+	if err == nil {
+		// replay the events received while the channel was opened before
+		// any received from now on
+		req.lk.Lock()
+		f.active[chid] = req
+		early = f.early[chid]
+	}
+	if f.opening == 0 {
+		f.early = make(map[datatransfer.ChannelID][]fetchEvent)
+	} else {
+		delete(f.early, chid)
+	}
+	f.lk.Unlock()
+	if err != nil {
+		return nil, xerrors.Errorf("opening fetch channel to %s: %w", from, err)
+	}
+	for _, fe := range early {
+		f.handleEvent(req, chid, fe.event, fe.channelState)
+	}
+	req.lk.Unlock()
+
+	select {
+	case <-ctx.Done():
+		f.release(chid)
+		closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		defer cancel()
+		if err := f.dt.CloseDataTransferChannel(closeCtx, chid); err != nil {
+			log.Warnf("closing fetch channel %s: %s", chid, err)
+		}
+		return nil, ctx.Err()
+	case chst := <-req.done:
+		if chst.Status() != datatransfer.Completed {
+			return chst, &Error{
+				ChannelID: chid,
+				Status:    chst.Status(),
+				Message:   chst.Message(),
+			}
+		}
+		return chst, nil
+	}
+}
+
+func (f *Fetcher) release(chid datatransfer.ChannelID) {
+	f.lk.Lock()
+	delete(f.active, chid)
+	f.lk.Unlock()
+}
+
+func (f *Fetcher) onEvent(event datatransfer.Event, channelState datatransfer.ChannelState) {
+	chid := channelState.ChannelID()
+	f.lk.Lock()
+	req, ok := f.active[chid]
+	if !ok {
+		if f.opening > 0 && chid.Initiator == channelState.SelfPeer() {
+			f.early[chid] = append(f.early[chid], fetchEvent{event, channelState})
+		}
+		f.lk.Unlock()
+		return
+	}
+	f.lk.Unlock()
+
+	req.lk.Lock()
+	defer req.lk.Unlock()
+	f.handleEvent(req, chid, event, channelState)
+}
+
+// handleEvent reports progress on a fetch, and completes it once its channel
+// reaches a final state
+func (f *Fetcher) handleEvent(req *fetchRequest, chid datatransfer.ChannelID, event datatransfer.Event, channelState datatransfer.ChannelState) {
+	if channels.IsChannelTerminated(channelState.Status()) {
+		f.release(chid)
+	}
+
+	if event.Code == datatransfer.DataReceivedProgress && req.progress != nil {
+		req.progress(channelState)
+	}
+
+	if channels.IsChannelTerminated(channelState.Status()) {
+		select {
+		case req.done <- channelState:
+		default:
+		}
+	}
+}
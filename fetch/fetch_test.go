@@ -0,0 +1,152 @@
+package fetch_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/fetch"
+	. "github.com/filecoin-project/go-data-transfer/impl"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+func TestFetch(t *testing.T) {
+	testCases := map[string]struct {
+		voucher       datatransfer.Voucher
+		rejectRequest bool
+	}{
+		"default voucher": {},
+		"custom voucher": {
+			voucher: testutil.NewFakeDTType(),
+		},
+		"rejected request": {
+			rejectRequest: true,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+			host1 := gsData.Host1 // data sender
+			root := gsData.LoadUnixFSFile(t, false)
+			rootCid := root.(cidlink.Link).Cid
+
+			tp1 := gsData.SetupGSTransportHost1()
+			tp2 := gsData.SetupGSTransportHost2()
+
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			sv := testutil.NewStubbedValidator()
+			if data.rejectRequest {
+				sv.StubErrorPull()
+			} else {
+				sv.StubSuccessPull()
+			}
+			var voucherType datatransfer.Voucher = &fetch.Voucher{}
+			if data.voucher != nil {
+				voucherType = &testutil.FakeDTType{}
+			}
+			require.NoError(t, dt1.RegisterVoucherType(voucherType, sv))
+
+			bs := bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+			fetcher := fetch.NewFetcher(dt2)
+			defer fetcher.Close()
+
+			// progress is reported on the event goroutine
+			var progressCalls int64
+			options := []fetch.Option{fetch.WithProgress(func(datatransfer.ChannelState) {
+				atomic.AddInt64(&progressCalls, 1)
+			})}
+			if data.voucher != nil {
+				options = append(options, fetch.WithVoucher(data.voucher))
+			}
+			chst, err := fetcher.Fetch(ctx, host1.ID(), rootCid, gsData.AllSelector, bs, options...)
+
+			if data.rejectRequest {
+				var fetchErr *fetch.Error
+				require.True(t, xerrors.As(err, &fetchErr))
+				require.Equal(t, datatransfer.Failed, fetchErr.Status)
+				require.Equal(t, datatransfer.Failed, chst.Status())
+				require.Zero(t, atomic.LoadInt64(&progressCalls))
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, datatransfer.Completed, chst.Status())
+			require.NotZero(t, chst.Received())
+			require.NotZero(t, atomic.LoadInt64(&progressCalls))
+			dagService := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+			testutil.VerifyHasFile(ctx, t, dagService, root, gsData.OrigBytes)
+
+			// the default blockstore for the fetching node should be untouched
+			has, err := gsData.Bs2.Has(rootCid)
+			require.NoError(t, err)
+			require.False(t, has)
+		})
+	}
+}
+
+// completedChannel is the state of a channel that completed
+type completedChannel struct {
+	datatransfer.ChannelState
+	chid datatransfer.ChannelID
+}
+
+func (cc completedChannel) ChannelID() datatransfer.ChannelID { return cc.chid }
+func (cc completedChannel) SelfPeer() peer.ID                 { return cc.chid.Initiator }
+func (cc completedChannel) Status() datatransfer.Status       { return datatransfer.Completed }
+
+// earlyEventsManager completes channels before returning from
+// OpenPullDataChannel, as a fast responder can
+type earlyEventsManager struct {
+	datatransfer.Manager
+	self       peer.ID
+	subscriber datatransfer.Subscriber
+}
+
+func (em *earlyEventsManager) SubscribeToEvents(subscriber datatransfer.Subscriber) datatransfer.Unsubscribe {
+	em.subscriber = subscriber
+	return func() {}
+}
+
+func (em *earlyEventsManager) OpenPullDataChannel(ctx context.Context, to peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node, options ...datatransfer.ChannelOption) (datatransfer.ChannelID, error) {
+	chid := datatransfer.ChannelID{Initiator: em.self, Responder: to, ID: 1}
+	em.subscriber(datatransfer.Event{Code: datatransfer.Open}, completedChannel{chid: chid})
+	em.subscriber(datatransfer.Event{Code: datatransfer.CleanupComplete}, completedChannel{chid: chid})
+	return chid, nil
+}
+
+func TestFetchEventsBeforeOpenReturns(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+	fetcher := fetch.NewFetcher(&earlyEventsManager{self: peers[0]})
+	defer fetcher.Close()
+
+	bs := bstore.NewBlockstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	chst, err := fetcher.Fetch(ctx, peers[1], testutil.GenerateCids(1)[0], testutil.AllSelector(), bs)
+	require.NoError(t, err)
+	require.Equal(t, datatransfer.Completed, chst.Status())
+}
@@ -0,0 +1,36 @@
+package fetch
+
+import (
+	"fmt"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+//go:generate cbor-gen-for Voucher
+
+// Voucher is the voucher sent when Fetch is called without a voucher of its own.
+// Responders that wish to serve plain fetch requests must register a validator
+// for this type.
+type Voucher struct{}
+
+// Type satisfies datatransfer.Registerable
+func (v *Voucher) Type() datatransfer.TypeIdentifier {
+	return "FetchVoucher"
+}
+
+var _ datatransfer.Voucher = &Voucher{}
+
+// Error is returned when a fetch does not reach the Completed state
+type Error struct {
+	// ChannelID is the channel the fetch was performed on
+	ChannelID datatransfer.ChannelID
+	// Status is the final status of the channel
+	Status datatransfer.Status
+	// Message is the last message recorded for the channel
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("fetch on channel %s ended in status %s: %s",
+		e.ChannelID, datatransfer.Statuses[e.Status], e.Message)
+}
@@ -0,0 +1,235 @@
+package impl
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/validators"
+)
+
+const (
+	defaultAsyncValidationTimeout = time.Minute
+	asyncValidationSendTimeout    = 30 * time.Second
+)
+
+// errValidating is returned when accepting a request that is being
+// validated asynchronously
+var errValidating = xerrors.New("request is being validated")
+
+// AsyncValidationTimeout sets how long asynchronous validators have to
+// validate a request before it is rejected with
+// datatransfer.ErrValidationTimedOut
+func AsyncValidationTimeout(timeout time.Duration) DataTransferOption {
+	return func(m *manager) {
+		m.asyncValidationTimeout = timeout
+	}
+}
+
+// RegisterAsyncVoucherType registers a validator that validates requests
+// with the given voucher type asynchronously, once the synchronous
+// validators accept them. Requests are rejected unless a synchronous
+// validator is also registered for the type.
+// returns error if:
+// * voucher type does not implement voucher
+// * voucherType's Kind is not reflect.Ptr
+// * a different Go type is already registered with the same voucher type
+func (m *manager) RegisterAsyncVoucherType(voucherType datatransfer.Voucher, validator datatransfer.AsyncRequestValidator) error {
+	m.requestValidatorsLk.Lock()
+	defer m.requestValidatorsLk.Unlock()
+	registered, err := m.typeValidatorsFor(voucherType)
+	if err != nil {
+		return err
+	}
+	registered.async = append(registered.async, validator)
+	return nil
+}
+
+// asyncValidators returns the asynchronous validators registered for a
+// voucher type
+func (m *manager) asyncValidators(voucherType datatransfer.TypeIdentifier) []datatransfer.AsyncRequestValidator {
+	m.requestValidatorsLk.RLock()
+	defer m.requestValidatorsLk.RUnlock()
+	processor, has := m.validatedTypes.Processor(voucherType)
+	if !has {
+		return nil
+	}
+	return append([]datatransfer.AsyncRequestValidator(nil), processor.(*typeValidators).async...)
+}
+
+// validateAsync runs the asynchronous validators on a request the
+// synchronous validators accepted, then accepts or rejects the request. If
+// the request is accepted and the total size of the data it pulls is to be
+// computed, it is computed before the request is accepted. Validation stops
+// when ctx is cancelled, leaving the channel to be failed by
+// failInterruptedValidations the next time the manager starts.
+func (m *manager) validateAsync(ctx context.Context,
+	chid datatransfer.ChannelID,
+	incoming datatransfer.Request,
+	voucher datatransfer.Voucher,
+	stor ipld.Node,
+	syncDecision validators.Decision,
+	store *ipld.LinkSystem,
+	asyncValidators []datatransfer.AsyncRequestValidator) {
+	validateCtx, cancel := context.WithTimeout(ctx, m.asyncValidationTimeout)
+	defer cancel()
+
+	decisions := []validators.Decision{syncDecision}
+	outcome, decided := validators.Decision{}, false
+	for _, validator := range asyncValidators {
+		done := make(chan validators.Decision, 1)
+		callback := func(result datatransfer.VoucherResult, err error) {
+			// only the first call completes the validation
+			select {
+			case done <- validators.Decision{Result: result, Err: err}:
+			default:
+			}
+		}
+		if incoming.IsPull() {
+			validator.ValidatePullAsync(chid, chid.Initiator, voucher, incoming.BaseCid(), stor, callback)
+		} else {
+			validator.ValidatePushAsync(chid, chid.Initiator, voucher, incoming.BaseCid(), stor, callback)
+		}
+
+		var decision validators.Decision
+		select {
+		case decision = <-done:
+		case <-validateCtx.Done():
+			if ctx.Err() != nil {
+				return
+			}
+			decision = validators.Decision{Err: datatransfer.ErrValidationTimedOut}
+		}
+		result, asyncStore := unwrapVoucherResult(decision.Result)
+		decision.Result = result
+		if asyncStore != nil {
+			store = asyncStore
+		}
+		decisions = append(decisions, decision)
+		if outcome, decided = validators.CombineAllMustAccept(decisions, false); decided {
+			break
+		}
+	}
+	if !decided {
+		outcome, _ = validators.CombineAllMustAccept(decisions, true)
+	}
+	if (outcome.Err == nil || outcome.Err == datatransfer.ErrPause) && m.computesTotalSize(incoming) {
+		m.computeTotalSize(ctx, chid, incoming.BaseCid(), stor, store)
+	}
+
+	sendCtx, sendCancel := context.WithTimeout(ctx, asyncValidationSendTimeout)
+	defer sendCancel()
+	if err := m.completeValidation(sendCtx, chid, incoming, voucher, stor, store, decisions[1:], outcome); err != nil {
+		log.Errorf("channel %s: completing validation: %s", chid, err)
+	}
+}
+
+// completeValidation records the voucher results of the asynchronous
+// validators, then accepts or rejects a request once validation completes
+func (m *manager) completeValidation(ctx context.Context,
+	chid datatransfer.ChannelID,
+	incoming datatransfer.Request,
+	voucher datatransfer.Voucher,
+	stor ipld.Node,
+	store *ipld.LinkSystem,
+	asyncDecisions []validators.Decision,
+	outcome validators.Decision) error {
+	chst, err := m.channels.GetByID(ctx, chid)
+	if err != nil {
+		return err
+	}
+	if chst.Status() != datatransfer.Validating {
+		// the request was cancelled while it was validated
+		return nil
+	}
+	for _, decision := range asyncDecisions {
+		if decision.Result != nil {
+			if err := m.channels.NewVoucherResult(chid, decision.Result); err != nil {
+				return err
+			}
+		}
+	}
+
+	if outcome.Err != nil && outcome.Err != datatransfer.ErrPause {
+		return m.rejectValidated(ctx, chid, incoming, outcome)
+	}
+
+	response, err := m.response(false, true, outcome.Err, chid.ID, outcome.Result)
+	if err != nil {
+		return err
+	}
+	if err := m.acceptChannel(chid, incoming, voucher, stor, store, outcome.Err); err != nil && err != datatransfer.ErrPause {
+		return err
+	}
+	response = m.responseWithTotalSize(chid, response)
+	if incoming.IsPull() {
+		return m.resumeValidatedPull(ctx, chid, response, outcome.Err == datatransfer.ErrPause)
+	}
+	return m.transport.OpenChannel(ctx, chid.Initiator, chid, cidlink.Link{Cid: incoming.BaseCid()}, stor, nil, response)
+}
+
+// rejectValidated tells the requester a request was rejected, then fails
+// the channel
+func (m *manager) rejectValidated(ctx context.Context, chid datatransfer.ChannelID, incoming datatransfer.Request, outcome validators.Decision) error {
+	resultType := datatransfer.EmptyTypeIdentifier
+	if outcome.Result != nil {
+		resultType = outcome.Result.Type()
+	}
+	var response datatransfer.Response
+	var err error
+	if outcome.Err == datatransfer.ErrValidationTimedOut {
+		response, err = message.RejectResponse(chid.ID, outcome.Err.Error(), resultType, outcome.Result)
+	} else {
+		response, err = message.NewResponse(chid.ID, false, false, resultType, outcome.Result)
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.dataTransferNetwork.SendMessage(ctx, chid.Initiator, response); err != nil {
+		log.Warnf("channel %s: sending rejection to %s: %s", chid, chid.Initiator, err)
+	}
+	if incoming.IsPull() {
+		if err := m.transport.CloseChannel(ctx, chid); err != nil {
+			log.Warnf("channel %s: closing rejected pull request: %s", chid, err)
+		}
+	}
+	return m.channels.Error(chid, outcome.Err)
+}
+
+// failInterruptedValidations fails channels whose requests were being
+// validated when the manager stopped, as their validation cannot complete
+func (m *manager) failInterruptedValidations() error {
+	inProgress, err := m.channels.InProgress()
+	if err != nil {
+		return xerrors.Errorf("listing channels: %w", err)
+	}
+	for chid, chst := range inProgress {
+		if chst.Status() != datatransfer.Validating {
+			continue
+		}
+		if err := m.channels.Error(chid, xerrors.New("request validation was interrupted by a restart")); err != nil {
+			return xerrors.Errorf("failing channel %s: %w", chid, err)
+		}
+	}
+	return nil
+}
+
+// resumeValidatedPull resumes a pull request that was paused on the
+// transport while it was validated, sending the response. The transport
+// waits for its request hook to finish pausing the request before resuming
+// it, so validation that completes quickly does not race the pause.
+func (m *manager) resumeValidatedPull(ctx context.Context, chid datatransfer.ChannelID, response datatransfer.Response, paused bool) error {
+	if paused {
+		// a validator paused the request, so it stays paused on the transport
+		return m.dataTransferNetwork.SendMessage(ctx, chid.Initiator, response)
+	}
+	if err := m.transport.(datatransfer.PauseableTransport).ResumeChannel(ctx, response, chid); err != nil {
+		return xerrors.Errorf("resuming validated pull request: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package impl
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/message"
+)
+
+const defaultChannelMessageRetryInterval = 10 * time.Second
+
+// ChannelMessageRetry sets how long to wait for a channel message to be
+// acknowledged before sending it again
+func ChannelMessageRetry(interval time.Duration) DataTransferOption {
+	return func(m *manager) {
+		m.channelMessageRetryInterval = interval
+	}
+}
+
+type channelMessageKey struct {
+	chid  datatransfer.ChannelID
+	msgID uint64
+}
+
+// dsKey is the key a message is stored under until it is acknowledged
+func (k channelMessageKey) dsKey() datastore.Key {
+	return datastore.KeyWithNamespaces([]string{
+		k.chid.Initiator.String(),
+		k.chid.Responder.String(),
+		strconv.FormatUint(uint64(k.chid.ID), 10),
+		strconv.FormatUint(k.msgID, 10),
+	})
+}
+
+func channelMessageKeyFromDS(key datastore.Key) (channelMessageKey, error) {
+	parts := key.Namespaces()
+	if len(parts) != 4 {
+		return channelMessageKey{}, xerrors.Errorf("malformed channel message key %s", key)
+	}
+	initiator, err := peer.Decode(parts[0])
+	if err != nil {
+		return channelMessageKey{}, xerrors.Errorf("decoding initiator of channel message key %s: %w", key, err)
+	}
+	responder, err := peer.Decode(parts[1])
+	if err != nil {
+		return channelMessageKey{}, xerrors.Errorf("decoding responder of channel message key %s: %w", key, err)
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return channelMessageKey{}, xerrors.Errorf("decoding transfer ID of channel message key %s: %w", key, err)
+	}
+	msgID, err := strconv.ParseUint(parts[3], 10, 64)
+	if err != nil {
+		return channelMessageKey{}, xerrors.Errorf("decoding message ID of channel message key %s: %w", key, err)
+	}
+	chid := datatransfer.ChannelID{Initiator: initiator, Responder: responder, ID: datatransfer.TransferID(id)}
+	return channelMessageKey{chid, msgID}, nil
+}
+
+// pendingChannelMessage is a channel message that is sent again until it is
+// acknowledged
+type pendingChannelMessage struct {
+	msg       datatransfer.Message
+	otherPeer peer.ID
+	// resend is signalled to send the message again without waiting for the
+	// retry interval
+	resend chan struct{}
+	// done is closed once the message is acknowledged or the channel ends
+	done chan struct{}
+}
+
+// RegisterChannelMessageType registers a type of application message that can
+// be sent on open channels, and the handler for messages of that type
+func (m *manager) RegisterChannelMessageType(msgType datatransfer.ChannelMessage, handler datatransfer.ChannelMessageHandler) error {
+	err := m.channelMessageTypes.Register(msgType, handler)
+	if err != nil {
+		return xerrors.Errorf("error registering channel message type: %w", err)
+	}
+	return nil
+}
+
+// SendChannelMessage stores an application message for the other party of an
+// open channel and returns. The message is sent in the background, and sent
+// again every retry interval, when the channel restarts and when the manager
+// restarts, until it is acknowledged or the channel ends.
+func (m *manager) SendChannelMessage(ctx context.Context, chid datatransfer.ChannelID, msg datatransfer.ChannelMessage) error {
+	chst, err := m.channels.GetByID(ctx, chid)
+	if err != nil {
+		return err
+	}
+	if channels.IsChannelTerminated(chst.Status()) {
+		return xerrors.Errorf("cannot send channel message on channel %s: channel is %s", chid, datatransfer.Statuses[chst.Status()])
+	}
+	otherPeer := chst.OtherPeer()
+	if capabilities, ok := m.PeerCapabilities(otherPeer); ok && !capabilities.Has(datatransfer.CapabilityChannelMessages) {
+		return xerrors.Errorf("peer %s does not support capability %s", otherPeer, datatransfer.CapabilityChannelMessages)
+	}
+
+	msgID := m.transferIDGen.next()
+	var netMsg datatransfer.Message
+	if chid.Initiator == m.peerID {
+		netMsg, err = message.ChannelMessageRequest(chid.ID, msgID, msg.Type(), msg)
+	} else {
+		netMsg, err = message.ChannelMessageResponse(chid.ID, msgID, msg.Type(), msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	key := channelMessageKey{chid, msgID}
+	buf := new(bytes.Buffer)
+	if err := netMsg.ToNet(buf); err != nil {
+		return xerrors.Errorf("encoding channel message: %w", err)
+	}
+	if err := m.channelMessagesDS.Put(key.dsKey(), buf.Bytes()); err != nil {
+		return xerrors.Errorf("storing channel message %d on channel %s: %w", msgID, chid, err)
+	}
+	m.startChannelMessage(key, otherPeer, netMsg)
+	return nil
+}
+
+// startChannelMessage sends a stored channel message in the background until
+// it is acknowledged or the channel ends
+func (m *manager) startChannelMessage(key channelMessageKey, otherPeer peer.ID, msg datatransfer.Message) {
+	pending := &pendingChannelMessage{
+		msg:       msg,
+		otherPeer: otherPeer,
+		resend:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	m.channelMessagesLk.Lock()
+	m.channelMessagesPending[key] = pending
+	m.channelMessagesLk.Unlock()
+	m.runInBackground(func(ctx context.Context) {
+		m.sendChannelMessage(ctx, key, pending)
+	})
+}
+
+func (m *manager) sendChannelMessage(ctx context.Context, key channelMessageKey, pending *pendingChannelMessage) {
+	for {
+		chst, err := m.channels.GetByID(ctx, key.chid)
+		if ctx.Err() != nil {
+			// the manager is stopping: the message is sent again on restart
+			return
+		}
+		if err == nil && channels.IsChannelTerminated(chst.Status()) {
+			log.Infof("channel %s: dropping unacknowledged channel message %d: channel is %s", key.chid, key.msgID, datatransfer.Statuses[chst.Status()])
+			m.dropChannelMessage(key)
+			return
+		}
+		if err != nil {
+			if xerrors.As(err, new(*channels.ErrNotFound)) {
+				log.Infof("channel %s: dropping unacknowledged channel message %d: %s", key.chid, key.msgID, err)
+				m.dropChannelMessage(key)
+				return
+			}
+			log.Warnf("channel %s: getting state to send channel message %d: %s", key.chid, key.msgID, err)
+		} else if err := m.dataTransferNetwork.SendMessage(ctx, pending.otherPeer, pending.msg); err != nil {
+			log.Warnf("channel %s: sending channel message %d to %s: %s", key.chid, key.msgID, pending.otherPeer, err)
+		}
+
+		timer := time.NewTimer(m.channelMessageRetryInterval)
+		select {
+		case <-pending.done:
+			timer.Stop()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-pending.resend:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// dropChannelMessage stops sending a channel message and deletes it from the
+// datastore
+func (m *manager) dropChannelMessage(key channelMessageKey) {
+	m.channelMessagesLk.Lock()
+	if pending, ok := m.channelMessagesPending[key]; ok {
+		close(pending.done)
+		delete(m.channelMessagesPending, key)
+	}
+	m.channelMessagesLk.Unlock()
+	if err := m.channelMessagesDS.Delete(key.dsKey()); err != nil {
+		log.Warnf("channel %s: deleting channel message %d: %s", key.chid, key.msgID, err)
+	}
+}
+
+// resendChannelMessages sends the unacknowledged messages on a channel again
+// without waiting for the retry interval, such as when the channel restarts
+func (m *manager) resendChannelMessages(chid datatransfer.ChannelID) {
+	m.channelMessagesLk.Lock()
+	defer m.channelMessagesLk.Unlock()
+	for key, pending := range m.channelMessagesPending {
+		if key.chid != chid {
+			continue
+		}
+		select {
+		case pending.resend <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// resumeChannelMessages starts sending the messages that were not acknowledged
+// before the manager last stopped
+func (m *manager) resumeChannelMessages() {
+	results, err := m.channelMessagesDS.Query(query.Query{})
+	if err != nil {
+		log.Errorf("querying unacknowledged channel messages: %s", err)
+		return
+	}
+	defer results.Close()
+	for result := range results.Next() {
+		if result.Error != nil {
+			log.Errorf("reading unacknowledged channel messages: %s", result.Error)
+			return
+		}
+		dsKey := datastore.NewKey(result.Key)
+		key, err := channelMessageKeyFromDS(dsKey)
+		if err == nil {
+			var msg datatransfer.Message
+			msg, err = message.FromNet(bytes.NewReader(result.Value))
+			if err == nil {
+				m.startChannelMessage(key, key.chid.OtherParty(m.peerID), msg)
+				continue
+			}
+		}
+		log.Warnf("dropping unreadable channel message %s: %s", dsKey, err)
+		if err := m.channelMessagesDS.Delete(dsKey); err != nil {
+			log.Warnf("deleting channel message %s: %s", dsKey, err)
+		}
+	}
+}
+
+// receiveChannelMessage handles an application message or acknowledgement
+// received on a channel. Messages are acknowledged once handled, and
+// messages received again are acknowledged without being handled again.
+// Messages received while an earlier copy is being handled, or on channels
+// that have ended, are dropped unacknowledged.
+func (m *manager) receiveChannelMessage(ctx context.Context, chid datatransfer.ChannelID, sender peer.ID, incoming datatransfer.Message) error {
+	key := channelMessageKey{chid, incoming.ChannelMessageID()}
+	if incoming.IsChannelMessageAck() {
+		m.channelMessagesLk.Lock()
+		_, ok := m.channelMessagesPending[key]
+		m.channelMessagesLk.Unlock()
+		if ok {
+			m.dropChannelMessage(key)
+		}
+		return nil
+	}
+
+	// reserve the message ID before handling it, so a copy received while
+	// the handler runs is not handled as well
+	m.channelMessagesLk.Lock()
+	handled, seen := m.channelMessagesSeen[chid][key.msgID]
+	if !seen {
+		if m.channelMessagesSeen[chid] == nil {
+			m.channelMessagesSeen[chid] = make(map[uint64]bool)
+		}
+		m.channelMessagesSeen[chid][key.msgID] = false
+	}
+	m.channelMessagesLk.Unlock()
+	if seen && !handled {
+		return nil
+	}
+	if !seen {
+		if err := m.handleReservedChannelMessage(ctx, chid, incoming); err != nil {
+			m.channelMessagesLk.Lock()
+			delete(m.channelMessagesSeen[chid], key.msgID)
+			m.channelMessagesLk.Unlock()
+			return err
+		}
+		m.channelMessagesLk.Lock()
+		if m.channelMessagesSeen[chid] != nil {
+			m.channelMessagesSeen[chid][key.msgID] = true
+		}
+		m.channelMessagesLk.Unlock()
+	}
+
+	var ack datatransfer.Message
+	if chid.Initiator == m.peerID {
+		ack = message.ChannelMessageAckRequest(chid.ID, key.msgID)
+	} else {
+		ack = message.ChannelMessageAckResponse(chid.ID, key.msgID)
+	}
+	return m.dataTransferNetwork.SendMessage(ctx, sender, ack)
+}
+
+func (m *manager) handleReservedChannelMessage(ctx context.Context, chid datatransfer.ChannelID, incoming datatransfer.Message) error {
+	chst, err := m.channels.GetByID(ctx, chid)
+	if err != nil {
+		return err
+	}
+	if channels.IsChannelTerminated(chst.Status()) {
+		return xerrors.Errorf("dropping channel message %d: channel %s is %s", incoming.ChannelMessageID(), chid, datatransfer.Statuses[chst.Status()])
+	}
+	return m.handleChannelMessage(chid, incoming)
+}
+
+func (m *manager) handleChannelMessage(chid datatransfer.ChannelID, incoming datatransfer.Message) error {
+	msgType := incoming.ChannelMessageType()
+	decoder, has := m.channelMessageTypes.Decoder(msgType)
+	if !has {
+		return xerrors.Errorf("unknown channel message type: %s", msgType)
+	}
+	decoded, err := incoming.ChannelMessage(decoder)
+	if err != nil {
+		return xerrors.Errorf("decoding channel message: %w", err)
+	}
+	processor, _ := m.channelMessageTypes.Processor(msgType)
+	handler := processor.(datatransfer.ChannelMessageHandler)
+	if err := handler.HandleChannelMessage(chid, decoded.(datatransfer.ChannelMessage)); err != nil {
+		return xerrors.Errorf("handling channel message of type %s: %w", msgType, err)
+	}
+	return nil
+}
+
+// forgetChannelMessages drops the record of messages received on the
+// channel, and the messages still waiting to be acknowledged, once it is
+// cleaned up
+func (m *manager) forgetChannelMessages(chid datatransfer.ChannelID) {
+	m.channelMessagesLk.Lock()
+	delete(m.channelMessagesSeen, chid)
+	var unacked []channelMessageKey
+	for key := range m.channelMessagesPending {
+		if key.chid == chid {
+			unacked = append(unacked, key)
+		}
+	}
+	m.channelMessagesLk.Unlock()
+	for _, key := range unacked {
+		m.dropChannelMessage(key)
+	}
+}
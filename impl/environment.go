@@ -24,4 +24,8 @@ func (ce *channelEnvironment) ID() peer.ID {
 
 func (ce *channelEnvironment) CleanupChannel(chid datatransfer.ChannelID) {
 	ce.m.transport.CleanupChannel(chid)
+	ce.m.forgetStore(chid)
+	ce.m.forgetChannelMessages(chid)
+	ce.m.forgetRevalidation(chid)
+	ce.m.forgetPeerCapabilities(chid)
 }
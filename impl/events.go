@@ -3,8 +3,8 @@ package impl
 import (
 	"context"
 	"errors"
+	"fmt"
 
-	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -13,6 +13,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/encoding"
 	"github.com/filecoin-project/go-data-transfer/registry"
+	"github.com/filecoin-project/go-data-transfer/validators"
 )
 
 func (m *manager) OnChannelOpened(chid datatransfer.ChannelID) error {
@@ -29,7 +30,7 @@ func (m *manager) OnChannelOpened(chid datatransfer.ChannelID) error {
 }
 
 func (m *manager) OnDataReceived(chid datatransfer.ChannelID, link ipld.Link, size uint64) error {
-	err := m.channels.DataReceived(chid, link.(cidlink.Link).Cid, size)
+	isNew, err := m.channels.DataReceived(chid, link.(cidlink.Link).Cid, size)
 	if err != nil {
 		return err
 	}
@@ -46,6 +47,10 @@ func (m *manager) OnDataReceived(chid datatransfer.ChannelID, link ipld.Link, si
 			}
 			return nil
 		})
+		blocksResult, blocksErr := m.blockTransferred(chid, isNew)
+		if err == nil && result == nil {
+			result, err = blocksResult, blocksErr
+		}
 		if err != nil || result != nil {
 			msg, err := m.processRevalidationResult(chid, result, err)
 			if msg != nil {
@@ -59,8 +64,56 @@ func (m *manager) OnDataReceived(chid datatransfer.ChannelID, link ipld.Link, si
 	return nil
 }
 
+// OnBlockReceived consults the registered block validators on a block
+// received for the given channel
+func (m *manager) OnBlockReceived(chid datatransfer.ChannelID, link ipld.Link, size uint64) error {
+	m.blockValidatorsLk.RLock()
+	validators := m.blockValidators
+	m.blockValidatorsLk.RUnlock()
+	if len(validators) == 0 {
+		return nil
+	}
+
+	chst, err := m.channels.GetByID(context.TODO(), chid)
+	if err != nil {
+		return err
+	}
+	for _, validator := range validators {
+		err := validator.ValidateBlock(chst, link, size)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, datatransfer.ErrSkipBlock) {
+			log.Infof("channel %s: skipping block %s: %s", chid, link, err)
+			if err := m.channels.BlockRejected(chid, err); err != nil {
+				return err
+			}
+			return datatransfer.ErrSkipBlock
+		}
+		if errors.Is(err, datatransfer.ErrPause) {
+			log.Infof("channel %s: pausing on block %s: %s", chid, link, err)
+			if err := m.channels.BlockRejected(chid, err); err != nil {
+				return err
+			}
+			// the transport pauses the request it received the block on,
+			// until the channel is resumed with ResumeDataTransferChannel
+			if err := m.pause(chid); err != nil {
+				return err
+			}
+			return datatransfer.ErrPause
+		}
+		log.Warnf("channel %s: rejected block %s: %s", chid, link, err)
+		if err := m.channels.Error(chid, err); err != nil {
+			return err
+		}
+		return err
+	}
+	return nil
+}
+
 func (m *manager) OnDataQueued(chid datatransfer.ChannelID, link ipld.Link, size uint64) (datatransfer.Message, error) {
-	if err := m.channels.DataQueued(chid, link.(cidlink.Link).Cid, size); err != nil {
+	isNew, err := m.channels.DataQueued(chid, link.(cidlink.Link).Cid, size)
+	if err != nil {
 		return nil, err
 	}
 	if chid.Initiator != m.peerID {
@@ -75,6 +128,10 @@ func (m *manager) OnDataQueued(chid datatransfer.ChannelID, link ipld.Link, size
 			}
 			return nil
 		})
+		blocksResult, blocksErr := m.blockTransferred(chid, isNew)
+		if err == nil && result == nil {
+			result, err = blocksResult, blocksErr
+		}
 		if err != nil || result != nil {
 			return m.processRevalidationResult(chid, result, err)
 		}
@@ -84,10 +141,12 @@ func (m *manager) OnDataQueued(chid datatransfer.ChannelID, link ipld.Link, size
 }
 
 func (m *manager) OnDataSent(chid datatransfer.ChannelID, link ipld.Link, size uint64) error {
-	return m.channels.DataSent(chid, link.(cidlink.Link).Cid, size)
+	_, err := m.channels.DataSent(chid, link.(cidlink.Link).Cid, size)
+	return err
 }
 
 func (m *manager) OnRequestReceived(chid datatransfer.ChannelID, request datatransfer.Request) (datatransfer.Response, error) {
+	m.recordPeerCapabilities(chid.OtherParty(m.peerID), request)
 	if request.IsRestart() {
 		return m.receiveRestartRequest(chid, request)
 	}
@@ -123,6 +182,7 @@ func (m *manager) OnRequestReceived(chid datatransfer.ChannelID, request datatra
 }
 
 func (m *manager) OnResponseReceived(chid datatransfer.ChannelID, response datatransfer.Response) error {
+	m.recordPeerCapabilities(chid.OtherParty(m.peerID), response)
 	if response.IsCancel() {
 		log.Infof("channel %s: received cancel response, cancelling channel", chid)
 		return m.channels.Cancel(chid)
@@ -140,7 +200,11 @@ func (m *manager) OnResponseReceived(chid datatransfer.ChannelID, response datat
 		}
 		if !response.Accepted() {
 			log.Infof("channel %s: received rejected response, erroring out channel", chid)
-			return m.channels.Error(chid, datatransfer.ErrRejected)
+			var rejectErr error = datatransfer.ErrRejected
+			if reason := response.RejectionReason(); reason != "" {
+				rejectErr = fmt.Errorf("%w: %s", datatransfer.ErrRejected, reason)
+			}
+			return m.channels.Error(chid, rejectErr)
 		}
 		if response.IsNew() {
 			log.Infof("channel %s: received new response, accepting channel", chid)
@@ -157,6 +221,10 @@ func (m *manager) OnResponseReceived(chid datatransfer.ChannelID, response datat
 				return err
 			}
 		}
+
+		if response.IsNew() || response.IsRestart() {
+			m.recordTotalSize(chid, chid.Responder, response)
+		}
 	}
 	if response.IsComplete() && response.Accepted() {
 		if !response.IsPaused() {
@@ -246,7 +314,7 @@ func (m *manager) receiveRestartRequest(chid datatransfer.ChannelID, incoming da
 	if msgErr != nil {
 		return nil, msgErr
 	}
-	return msg, err
+	return m.responseWithTotalSize(chid, msg), err
 }
 
 func (m *manager) receiveNewRequest(
@@ -255,11 +323,20 @@ func (m *manager) receiveNewRequest(
 	log.Infof("received new channel request from %s", initiator)
 
 	result, err := m.acceptRequest(initiator, incoming)
+	if err == errValidating {
+		// the response is sent once validation completes. Until then, a pull
+		// request is paused on the transport.
+		if incoming.IsPull() {
+			return nil, datatransfer.ErrPause
+		}
+		return nil, nil
+	}
 	msg, msgErr := m.response(false, true, err, incoming.TransferID(), result)
 	if msgErr != nil {
 		return nil, msgErr
 	}
-	return msg, err
+	chid := datatransfer.ChannelID{Initiator: initiator, Responder: m.peerID, ID: incoming.TransferID()}
+	return m.responseWithTotalSize(chid, msg), err
 }
 
 func (m *manager) restartRequest(chid datatransfer.ChannelID,
@@ -279,7 +356,8 @@ func (m *manager) restartRequest(chid datatransfer.ChannelID,
 		return nil, err
 	}
 
-	voucher, result, err := m.validateVoucher(initiator, incoming, incoming.IsPull(), incoming.BaseCid(), stor)
+	voucher, result, stor, err := m.validateVoucher(chid, incoming, true, incoming.Capabilities(), stor)
+	result, store := unwrapVoucherResult(result)
 	if err != nil && err != datatransfer.ErrPause {
 		return result, xerrors.Errorf("failed to validate voucher: %w", err)
 	}
@@ -294,11 +372,20 @@ func (m *manager) restartRequest(chid datatransfer.ChannelID,
 	if err := m.channels.Restart(chid); err != nil {
 		return result, xerrors.Errorf("failed to restart channel %s: %w", chid, err)
 	}
+	if store != nil {
+		err = m.useStore(chid, *store)
+	} else {
+		err = m.reuseStore(chid)
+	}
+	if err != nil {
+		return result, xerrors.Errorf("unable to use store for channel %s: %w", chid, err)
+	}
 	processor, has := m.transportConfigurers.Processor(voucher.Type())
 	if has {
 		transportConfigurer := processor.(datatransfer.TransportConfigurer)
 		transportConfigurer(chid, voucher, m.transport)
 	}
+	m.recordTotalSize(chid, initiator, incoming)
 	m.dataTransferNetwork.Protect(initiator, chid.String())
 	if voucherErr == datatransfer.ErrPause {
 		err := m.channels.PauseResponder(chid)
@@ -306,6 +393,7 @@ func (m *manager) restartRequest(chid datatransfer.ChannelID,
 			return result, err
 		}
 	}
+	m.startRevalidationTimers(chid)
 	return result, voucherErr
 }
 
@@ -318,7 +406,10 @@ func (m *manager) acceptRequest(
 		return nil, err
 	}
 
-	voucher, result, err := m.validateVoucher(initiator, incoming, incoming.IsPull(), incoming.BaseCid(), stor)
+	// the ID of the channel the request will open
+	chid := datatransfer.ChannelID{Initiator: initiator, Responder: m.peerID, ID: incoming.TransferID()}
+	voucher, result, stor, err := m.validateVoucher(chid, incoming, false, incoming.Capabilities(), stor)
+	result, store := unwrapVoucherResult(result)
 	if err != nil && err != datatransfer.ErrPause {
 		return result, err
 	}
@@ -333,60 +424,110 @@ func (m *manager) acceptRequest(
 		dataReceiver = m.peerID
 	}
 
-	chid, err := m.channels.CreateNew(m.peerID, incoming.TransferID(), incoming.BaseCid(), stor, voucher, initiator, dataSender, dataReceiver)
+	chid, err = m.channels.CreateNew(m.peerID, incoming.TransferID(), incoming.BaseCid(), stor, voucher, initiator, dataSender, dataReceiver)
 	if err != nil {
 		return result, err
 	}
+	m.recordTotalSize(chid, initiator, incoming)
 	if result != nil {
 		err := m.channels.NewVoucherResult(chid, result)
 		if err != nil {
 			return result, err
 		}
 	}
+	// the request is accepted in the background if it has to be validated
+	// asynchronously, or if the total size of the data it pulls has to be
+	// computed first so it can be given on the response
+	if asyncValidators := m.asyncValidators(voucher.Type()); len(asyncValidators) > 0 || m.computesTotalSize(incoming) {
+		if err := m.channels.BeginValidation(chid); err != nil {
+			return result, err
+		}
+		syncDecision := validators.Decision{Result: result, Err: voucherErr}
+		m.runInBackground(func(ctx context.Context) {
+			m.validateAsync(ctx, chid, incoming, voucher, stor, syncDecision, store, asyncValidators)
+		})
+		return result, errValidating
+	}
+	return result, m.acceptChannel(chid, incoming, voucher, stor, store, voucherErr)
+}
+
+// acceptChannel accepts a validated request on a new channel, pausing it if
+// a validator paused the request
+func (m *manager) acceptChannel(chid datatransfer.ChannelID,
+	incoming datatransfer.Request,
+	voucher datatransfer.Voucher,
+	stor ipld.Node,
+	store *ipld.LinkSystem,
+	voucherErr error) error {
 	if err := m.channels.Accept(chid); err != nil {
-		return result, err
+		return err
+	}
+	if store != nil {
+		if err := m.useStore(chid, *store); err != nil {
+			return xerrors.Errorf("unable to use store for channel %s: %w", chid, err)
+		}
 	}
 	processor, has := m.transportConfigurers.Processor(voucher.Type())
 	if has {
 		transportConfigurer := processor.(datatransfer.TransportConfigurer)
 		transportConfigurer(chid, voucher, m.transport)
 	}
-	m.dataTransferNetwork.Protect(initiator, chid.String())
+	m.dataTransferNetwork.Protect(chid.Initiator, chid.String())
 	if voucherErr == datatransfer.ErrPause {
 		err := m.channels.PauseResponder(chid)
 		if err != nil {
-			return result, err
+			return err
 		}
 	}
-	return result, voucherErr
+	m.startRevalidationTimers(chid)
+	return voucherErr
 }
 
 // validateVoucher converts a voucher in an incoming message to its appropriate
-// voucher struct, then runs the validator and returns the results.
+// voucher struct, applies the selector policy for the voucher type, then runs
+// the validator and returns the results along with the selector to use.
 // returns error if:
 //   * reading voucher fails
 //   * deserialization of selector fails
+//   * the selector policy rejects the selector
 //   * validation fails
-func (m *manager) validateVoucher(sender peer.ID,
+func (m *manager) validateVoucher(chid datatransfer.ChannelID,
 	incoming datatransfer.Request,
-	isPull bool,
-	baseCid cid.Cid,
-	stor ipld.Node) (datatransfer.Voucher, datatransfer.VoucherResult, error) {
+	isRestart bool,
+	capabilities datatransfer.Capabilities,
+	stor ipld.Node) (datatransfer.Voucher, datatransfer.VoucherResult, ipld.Node, error) {
 	vouch, err := m.decodeVoucher(incoming, m.validatedTypes)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+	isPull := incoming.IsPull()
+	if processor, has := m.selectorPolicies.Processor(vouch.Type()); has {
+		stor, err = processor.(datatransfer.SelectorPolicy).ApplyPolicy(isPull, stor)
+		if err != nil {
+			return vouch, nil, nil, err
+		}
 	}
-	var validatorFunc func(peer.ID, datatransfer.Voucher, cid.Cid, ipld.Node) (datatransfer.VoucherResult, error)
-	processor, _ := m.validatedTypes.Processor(vouch.Type())
-	validator := processor.(datatransfer.RequestValidator)
+	request := datatransfer.ValidationRequest{
+		ChannelID:    chid,
+		Peer:         chid.OtherParty(m.peerID),
+		IsPull:       isPull,
+		IsRestart:    isRestart,
+		Voucher:      vouch,
+		BaseCid:      incoming.BaseCid(),
+		Selector:     stor,
+		Message:      incoming,
+		Capabilities: capabilities,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.validationTimeout)
+	defer cancel()
+	validator := m.requestValidator(vouch.Type())
+	var result datatransfer.VoucherResult
 	if isPull {
-		validatorFunc = validator.ValidatePull
+		result, err = validator.ValidatePullRequest(ctx, request)
 	} else {
-		validatorFunc = validator.ValidatePush
+		result, err = validator.ValidatePushRequest(ctx, request)
 	}
-
-	result, err := validatorFunc(sender, vouch, baseCid, stor)
-	return vouch, result, err
+	return vouch, result, stor, err
 }
 
 // revalidateVoucher converts a voucher in an incoming message to its appropriate
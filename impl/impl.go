@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/hannahhoward/go-pubsub"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
@@ -22,6 +26,7 @@ import (
 	"github.com/filecoin-project/go-data-transfer/message"
 	"github.com/filecoin-project/go-data-transfer/network"
 	"github.com/filecoin-project/go-data-transfer/registry"
+	"github.com/filecoin-project/go-data-transfer/validators"
 )
 
 var log = logging.Logger("dt-impl")
@@ -31,6 +36,8 @@ type manager struct {
 	validatedTypes       *registry.Registry
 	resultTypes          *registry.Registry
 	revalidators         *registry.Registry
+	selectorPolicies     *registry.Registry
+	voucherUpgraders     *registry.Registry
 	transportConfigurers *registry.Registry
 	pubSub               *pubsub.PubSub
 	readySub             *pubsub.PubSub
@@ -41,6 +48,40 @@ type manager struct {
 	channelMonitor       *channelmonitor.Monitor
 	channelMonitorCfg    *channelmonitor.Config
 	transferIDGen        *timeCounter
+	storesLk             sync.RWMutex
+	stores               map[datatransfer.ChannelID]ipld.LinkSystem
+	requestValidatorsLk  sync.RWMutex
+	requestValidators    []datatransfer.RequestValidatorV2
+	blockValidatorsLk    sync.RWMutex
+	blockValidators      []datatransfer.BlockValidator
+	totalSizeLinkSystem  *ipld.LinkSystem
+	totalSizeMaxBlocks   uint64
+	datastoreCIDLists    bool
+	cidListsImportDir    string
+	ds                   datastore.Batching
+	migrationBackup      datastore.Batching
+	channelStore         channels.ChannelStore
+	peerCapsLk           sync.RWMutex
+	peerCaps             map[peer.ID]datatransfer.Capabilities
+
+	validationTimeout      time.Duration
+	asyncValidationTimeout time.Duration
+
+	revalidationLk     sync.Mutex
+	revalidationTimers map[datatransfer.ChannelID]context.CancelFunc
+
+	channelMessageTypes         *registry.Registry
+	channelMessageRetryInterval time.Duration
+	channelMessagesDS           datastore.Batching
+	channelMessagesLk           sync.Mutex
+	channelMessagesPending      map[channelMessageKey]*pendingChannelMessage
+	channelMessagesSeen         map[datatransfer.ChannelID]map[uint64]bool
+
+	backgroundLk      sync.Mutex
+	backgroundCtx     context.Context
+	stopBackground    context.CancelFunc
+	backgroundStopped bool
+	background        sync.WaitGroup
 }
 
 type internalEvent struct {
@@ -85,37 +126,101 @@ func ChannelRestartConfig(cfg channelmonitor.Config) DataTransferOption {
 	}
 }
 
-// NewDataTransfer initializes a new instance of a data transfer manager
+// DatastoreCIDLists keeps the lists of CIDs received on each channel in the
+// manager's datastore, rather than in files in cidListsDir. If cidListsDir is
+// not empty, any lists in it are imported into the datastore when the manager
+// starts, and the files removed; otherwise it is not used.
+func DatastoreCIDLists() DataTransferOption {
+	return func(m *manager) {
+		m.datastoreCIDLists = true
+	}
+}
+
+// BackupBeforeMigrating copies the data transfer records to the given
+// datastore before migrating them to the current version when the manager
+// starts. If the migration fails, or leaves records that cannot be decoded,
+// the records are restored from the copy and OnReady is called with the
+// error. The backup datastore must not be under the namespace of the
+// manager's datastore.
+func BackupBeforeMigrating(backup datastore.Batching) DataTransferOption {
+	return func(m *manager) {
+		m.migrationBackup = backup
+	}
+}
+
+// CustomChannelStore keeps the state of channels in the given store rather
+// than in the manager's datastore, which is still used for everything else.
+// Channel records already in the datastore are neither migrated nor read.
+func CustomChannelStore(store channels.ChannelStore) DataTransferOption {
+	return func(m *manager) {
+		m.channelStore = store
+	}
+}
+
+// defaultValidationTimeout is how long request validators have to validate a
+// request by default
+const defaultValidationTimeout = 30 * time.Second
+
+// ValidationTimeout sets the deadline of the context passed to
+// datatransfer.RequestValidatorV2 validators
+func ValidationTimeout(timeout time.Duration) DataTransferOption {
+	return func(m *manager) {
+		m.validationTimeout = timeout
+	}
+}
+
+// NewDataTransfer initializes a new instance of a data transfer manager.
+// cidListsDir may be empty if the DatastoreCIDLists option is given.
 func NewDataTransfer(ds datastore.Batching, cidListsDir string, dataTransferNetwork network.DataTransferNetwork, transport datatransfer.Transport, options ...DataTransferOption) (datatransfer.Manager, error) {
 	m := &manager{
 		dataTransferNetwork:  dataTransferNetwork,
 		validatedTypes:       registry.NewRegistry(),
 		resultTypes:          registry.NewRegistry(),
 		revalidators:         registry.NewRegistry(),
+		selectorPolicies:     registry.NewRegistry(),
+		voucherUpgraders:     registry.NewRegistry(),
 		transportConfigurers: registry.NewRegistry(),
 		pubSub:               pubsub.New(dispatcher),
 		readySub:             pubsub.New(readyDispatcher),
 		peerID:               dataTransferNetwork.ID(),
 		transport:            transport,
 		transferIDGen:        newTimeCounter(),
+		stores:               make(map[datatransfer.ChannelID]ipld.LinkSystem),
+		ds:                   ds,
+		peerCaps:             make(map[peer.ID]datatransfer.Capabilities),
+		validationTimeout:    defaultValidationTimeout,
+		revalidationTimers:   make(map[datatransfer.ChannelID]context.CancelFunc),
+
+		channelMessageTypes:         registry.NewRegistry(),
+		channelMessageRetryInterval: defaultChannelMessageRetryInterval,
+		asyncValidationTimeout:      defaultAsyncValidationTimeout,
+		channelMessagesDS:           namespace.Wrap(ds, datastore.NewKey("channel-messages")),
+		channelMessagesPending:      make(map[channelMessageKey]*pendingChannelMessage),
+		channelMessagesSeen:         make(map[datatransfer.ChannelID]map[uint64]bool),
+	}
+
+	m.backgroundCtx, m.stopBackground = context.WithCancel(context.Background())
+
+	// Apply config options
+	for _, option := range options {
+		option(m)
 	}
 
-	cidLists, err := cidlists.NewCIDLists(cidListsDir)
+	cidLists, err := m.newCIDLists(ds, cidListsDir)
 	if err != nil {
 		return nil, err
 	}
 	m.cidLists = cidLists
-	channels, err := channels.New(ds, cidLists, m.notifier, m.voucherDecoder, m.resultTypes.Decoder, &channelEnvironment{m}, dataTransferNetwork.ID())
+	var channelOptions []channels.Option
+	if m.channelStore != nil {
+		channelOptions = append(channelOptions, channels.WithChannelStore(m.channelStore))
+	}
+	channels, err := channels.New(ds, cidLists, m.notifier, m.voucherDecoder, m.resultTypes.Decoder, &channelEnvironment{m}, dataTransferNetwork.ID(), channelOptions...)
 	if err != nil {
 		return nil, err
 	}
 	m.channels = channels
 
-	// Apply config options
-	for _, option := range options {
-		option(m)
-	}
-
 	// Start push / pull channel monitor after applying config options as the config
 	// options may apply to the monitor
 	m.channelMonitor = channelmonitor.NewMonitor(m, m.channelMonitorCfg)
@@ -124,15 +229,51 @@ func NewDataTransfer(ds datastore.Batching, cidListsDir string, dataTransferNetw
 	return m, nil
 }
 
+// newCIDLists sets up where the CIDs received on each channel are listed
+func (m *manager) newCIDLists(ds datastore.Batching, cidListsDir string) (cidlists.CIDLists, error) {
+	if !m.datastoreCIDLists {
+		return cidlists.NewCIDLists(cidListsDir)
+	}
+	// files in the directory are imported once the channel states have been
+	// migrated, as migrating from unversioned state reads every key in the
+	// datastore
+	m.cidListsImportDir = cidListsDir
+	return cidlists.NewDatastoreCIDLists(namespace.Wrap(ds, datastore.NewKey("cidlists"))), nil
+}
+
+// importCIDLists moves any lists left in files into the datastore
+func (m *manager) importCIDLists() error {
+	if m.cidListsImportDir == "" {
+		return nil
+	}
+	if err := cidlists.ImportFiles(m.cidListsImportDir, m.cidLists); err != nil {
+		return xerrors.Errorf("importing cid lists from %s: %w", m.cidListsImportDir, err)
+	}
+	return nil
+}
+
 func (m *manager) voucherDecoder(voucherType datatransfer.TypeIdentifier) (encoding.Decoder, bool) {
 	decoder, has := m.validatedTypes.Decoder(voucherType)
-	if !has {
-		return m.revalidators.Decoder(voucherType)
+	if has {
+		return decoder, true
 	}
-	return decoder, true
+	decoder, has = m.revalidators.Decoder(voucherType)
+	if has {
+		return decoder, true
+	}
+	return m.upgradingDecoder(voucherType)
+}
+
+// debugMessage renders a message for logging, decoding its voucher or voucher
+// result with the registered types
+func (m *manager) debugMessage(msg datatransfer.Message) message.Debug {
+	return message.Debug{Message: msg, Vouchers: m.voucherDecoder, VoucherResults: m.resultTypes.Decoder}
 }
 
 func (m *manager) notifier(evt datatransfer.Event, chst datatransfer.ChannelState) {
+	if evt.Code == datatransfer.Restart {
+		m.resendChannelMessages(chst.ChannelID())
+	}
 	err := m.pubSub.Publish(internalEvent{evt, chst})
 	if err != nil {
 		log.Warnf("err publishing DT event: %s", err.Error())
@@ -144,9 +285,20 @@ func (m *manager) Start(ctx context.Context) error {
 	log.Info("start data-transfer module")
 
 	go func() {
-		err := m.channels.Start(ctx)
+		err := m.migrate(ctx)
+		if err == nil {
+			err = m.channels.Start(ctx)
+		}
+		if err == nil {
+			err = m.failInterruptedValidations()
+		}
 		if err != nil {
 			log.Errorf("Migrating data transfer state machines: %s", err.Error())
+		} else {
+			m.resumeChannelMessages()
+			if err = m.importCIDLists(); err != nil {
+				log.Errorf("Migrating data transfer cid lists: %s", err.Error())
+			}
 		}
 		err = m.readySub.Publish(err)
 		if err != nil {
@@ -159,6 +311,22 @@ func (m *manager) Start(ctx context.Context) error {
 	return m.transport.SetEventHandler(m)
 }
 
+// migrate backs up and migrates the channel records if BackupBeforeMigrating
+// was given. Otherwise they are migrated by the channels when they start.
+func (m *manager) migrate(ctx context.Context) error {
+	if m.migrationBackup == nil || m.channelStore != nil {
+		return nil
+	}
+	report, err := channels.Migrate(ctx, m.ds, m.cidLists, m.peerID, channels.BackupTo(m.migrationBackup))
+	if err != nil {
+		return err
+	}
+	if report.Migrated() {
+		log.Infof("migrated %d data transfer channels from version %q to %q, backed up %d records", report.Channels, report.From, report.To, report.BackedUp)
+	}
+	return nil
+}
+
 // OnReady registers a listener for when the data transfer manager has finished starting up
 func (m *manager) OnReady(ready datatransfer.ReadyFunc) {
 	m.readySub.Subscribe(ready)
@@ -168,28 +336,128 @@ func (m *manager) OnReady(ready datatransfer.ReadyFunc) {
 func (m *manager) Stop(ctx context.Context) error {
 	log.Info("stop data-transfer module")
 	m.channelMonitor.Shutdown()
+	m.stopRevalidationTimers()
+	m.backgroundLk.Lock()
+	m.backgroundStopped = true
+	m.stopBackground()
+	m.backgroundLk.Unlock()
+	m.background.Wait()
+	if err := m.channels.Flush(); err != nil {
+		log.Errorf("flushing data transfer channel state: %s", err)
+	}
 	return m.transport.Shutdown(ctx)
 }
 
-// RegisterVoucherType registers a validator for the given voucher type
+// runInBackground runs fn on its own goroutine, with a context that is
+// cancelled when the manager stops. Stop waits for fn to return. fn is not
+// run once the manager has stopped.
+func (m *manager) runInBackground(fn func(ctx context.Context)) {
+	m.backgroundLk.Lock()
+	defer m.backgroundLk.Unlock()
+	if m.backgroundStopped {
+		return
+	}
+	m.background.Add(1)
+	go func() {
+		defer m.background.Done()
+		fn(m.backgroundCtx)
+	}()
+}
+
+// RegisterVoucherType registers a validator for the given voucher type.
+// Registering more validators for a type adds them to the type's chain of
+// validators, which must all accept a request.
 // returns error if:
 // * voucher type does not implement voucher
-// * there is a voucher type registered with an identical identifier
 // * voucherType's Kind is not reflect.Ptr
+// * a different Go type is already registered with the same voucher type
 func (m *manager) RegisterVoucherType(voucherType datatransfer.Voucher, validator datatransfer.RequestValidator) error {
-	err := m.validatedTypes.Register(voucherType, validator)
+	return m.RegisterVoucherTypeV2(voucherType, validators.Adapt(validator))
+}
+
+// RegisterVoucherTypeV2 registers a datatransfer.RequestValidatorV2 for the
+// given voucher type, like RegisterVoucherType
+func (m *manager) RegisterVoucherTypeV2(voucherType datatransfer.Voucher, validator datatransfer.RequestValidatorV2) error {
+	m.requestValidatorsLk.Lock()
+	defer m.requestValidatorsLk.Unlock()
+	registered, err := m.typeValidatorsFor(voucherType)
 	if err != nil {
-		return xerrors.Errorf("error registering voucher type: %w", err)
+		return err
+	}
+	registered.validators = append(registered.validators, validator)
+	return nil
+}
+
+// RegisterRequestValidator registers a validator run on requests with any
+// voucher type, before the validators registered for the voucher's type
+func (m *manager) RegisterRequestValidator(validator datatransfer.RequestValidator) error {
+	if validator == nil {
+		return xerrors.New("error registering request validator: validator is nil")
+	}
+	return m.RegisterRequestValidatorV2(validators.Adapt(validator))
+}
+
+// RegisterRequestValidatorV2 registers a datatransfer.RequestValidatorV2 run
+// on requests with any voucher type, like RegisterRequestValidator
+func (m *manager) RegisterRequestValidatorV2(validator datatransfer.RequestValidatorV2) error {
+	if validator == nil {
+		return xerrors.New("error registering request validator: validator is nil")
 	}
+	m.requestValidatorsLk.Lock()
+	m.requestValidators = append(m.requestValidators, validator)
+	m.requestValidatorsLk.Unlock()
 	return nil
 }
 
+// typeValidators are the validators registered for a voucher type
+type typeValidators struct {
+	// goType is the Go type registered for the voucher type
+	goType     reflect.Type
+	validators []datatransfer.RequestValidatorV2
+	async      []datatransfer.AsyncRequestValidator
+}
+
+// typeValidatorsFor returns the validators registered for a voucher type,
+// registering the type if it is new. The Go type of the voucher must match
+// the one the type was first registered with, as it is the type requests'
+// vouchers are decoded to. Must be called with requestValidatorsLk held.
+func (m *manager) typeValidatorsFor(voucherType datatransfer.Voucher) (*typeValidators, error) {
+	goType := reflect.TypeOf(voucherType)
+	if processor, has := m.validatedTypes.Processor(voucherType.Type()); has {
+		registered := processor.(*typeValidators)
+		if registered.goType != goType {
+			return nil, xerrors.Errorf("error registering voucher type: %s is registered with Go type %s, not %s", voucherType.Type(), registered.goType, goType)
+		}
+		return registered, nil
+	}
+	registered := &typeValidators{goType: goType}
+	if err := m.validatedTypes.Register(voucherType, registered); err != nil {
+		return nil, xerrors.Errorf("error registering voucher type: %w", err)
+	}
+	return registered, nil
+}
+
+// requestValidator returns the chain of validators to run on a request with
+// the given voucher type: the validators registered for all types, then the
+// validators registered for the type
+func (m *manager) requestValidator(voucherType datatransfer.TypeIdentifier) datatransfer.RequestValidatorV2 {
+	m.requestValidatorsLk.RLock()
+	defer m.requestValidatorsLk.RUnlock()
+	processor, _ := m.validatedTypes.Processor(voucherType)
+	registered := processor.(*typeValidators)
+	chain := make([]datatransfer.RequestValidatorV2, 0, len(m.requestValidators)+len(registered.validators))
+	chain = append(chain, m.requestValidators...)
+	chain = append(chain, registered.validators...)
+	return validators.NewChainV2(validators.CombineAllMustAccept, chain...)
+}
+
 // OpenPushDataChannel opens a data transfer that will send data to the recipient peer and
 // transfer parts of the piece that match the selector
-func (m *manager) OpenPushDataChannel(ctx context.Context, requestTo peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node) (datatransfer.ChannelID, error) {
+func (m *manager) OpenPushDataChannel(ctx context.Context, requestTo peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node, options ...datatransfer.ChannelOption) (datatransfer.ChannelID, error) {
 	log.Infof("open push channel to %s with base cid %s", requestTo, baseCid)
 
-	req, err := m.newRequest(ctx, selector, false, voucher, baseCid, requestTo)
+	co := channelOptions(options)
+	req, err := m.newRequest(ctx, selector, false, voucher, baseCid, requestTo, co)
 	if err != nil {
 		return datatransfer.ChannelID{}, err
 	}
@@ -199,11 +467,18 @@ func (m *manager) OpenPushDataChannel(ctx context.Context, requestTo peer.ID, vo
 	if err != nil {
 		return chid, err
 	}
+	if err := m.applyChannelOptions(chid, co); err != nil {
+		_ = m.channels.Error(chid, err)
+		return chid, err
+	}
 	processor, has := m.transportConfigurers.Processor(voucher.Type())
 	if has {
 		transportConfigurer := processor.(datatransfer.TransportConfigurer)
 		transportConfigurer(chid, voucher, m.transport)
 	}
+	if !co.SkipTotalSize && m.computeTotalSize(ctx, chid, baseCid, selector, nil) {
+		req = m.requestWithTotalSize(chid, req)
+	}
 	m.dataTransferNetwork.Protect(requestTo, chid.String())
 	monitoredChan := m.channelMonitor.AddPushChannel(chid)
 	if err := m.dataTransferNetwork.SendMessage(ctx, requestTo, req); err != nil {
@@ -224,10 +499,11 @@ func (m *manager) OpenPushDataChannel(ctx context.Context, requestTo peer.ID, vo
 
 // OpenPullDataChannel opens a data transfer that will request data from the sending peer and
 // transfer parts of the piece that match the selector
-func (m *manager) OpenPullDataChannel(ctx context.Context, requestTo peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node) (datatransfer.ChannelID, error) {
+func (m *manager) OpenPullDataChannel(ctx context.Context, requestTo peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node, options ...datatransfer.ChannelOption) (datatransfer.ChannelID, error) {
 	log.Infof("open pull channel to %s with base cid %s", requestTo, baseCid)
 
-	req, err := m.newRequest(ctx, selector, true, voucher, baseCid, requestTo)
+	co := channelOptions(options)
+	req, err := m.newRequest(ctx, selector, true, voucher, baseCid, requestTo, co)
 	if err != nil {
 		return datatransfer.ChannelID{}, err
 	}
@@ -237,6 +513,10 @@ func (m *manager) OpenPullDataChannel(ctx context.Context, requestTo peer.ID, vo
 	if err != nil {
 		return chid, err
 	}
+	if err := m.applyChannelOptions(chid, co); err != nil {
+		_ = m.channels.Error(chid, err)
+		return chid, err
+	}
 	processor, has := m.transportConfigurers.Processor(voucher.Type())
 	if has {
 		transportConfigurer := processor.(datatransfer.TransportConfigurer)
@@ -280,6 +560,41 @@ func (m *manager) SendVoucher(ctx context.Context, channelID datatransfer.Channe
 	return m.channels.NewVoucher(channelID, voucher)
 }
 
+// SendVoucherResult sends an unsolicited voucher result to the initiator of a
+// channel we are responding to. The response carries the responder's current
+// pause state, so the initiator only records the result.
+func (m *manager) SendVoucherResult(ctx context.Context, channelID datatransfer.ChannelID, voucherResult datatransfer.VoucherResult) error {
+	chst, err := m.channels.GetByID(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	if channelID.Initiator == m.peerID {
+		return errors.New("cannot send voucher result for request we initiated")
+	}
+	if channels.IsChannelTerminated(chst.Status()) {
+		return xerrors.Errorf("cannot send voucher result for channel %s: channel is %s", channelID, datatransfer.Statuses[chst.Status()])
+	}
+	var response datatransfer.Response
+	if chst.Status() == datatransfer.Finalizing {
+		response, err = m.completeResponse(datatransfer.ErrPause, channelID.ID, voucherResult)
+	} else {
+		var resultErr error
+		if responderPausedStates.Contains(chst.Status()) {
+			resultErr = datatransfer.ErrPause
+		}
+		response, err = m.response(false, false, resultErr, channelID.ID, voucherResult)
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.dataTransferNetwork.SendMessage(ctx, chst.OtherPeer(), response); err != nil {
+		err = fmt.Errorf("Unable to send response: %w", err)
+		_ = m.OnRequestDisconnected(channelID, err)
+		return err
+	}
+	return m.channels.NewVoucherResult(channelID, voucherResult)
+}
+
 // close an open channel (effectively a cancel)
 func (m *manager) CloseDataTransferChannel(ctx context.Context, chid datatransfer.ChannelID) error {
 	log.Infof("close channel %s", chid)
@@ -422,6 +737,16 @@ func (m *manager) InProgressChannels(ctx context.Context) (map[datatransfer.Chan
 	return m.channels.InProgress()
 }
 
+// RegisterSelectorPolicy registers a policy applied to the selectors of
+// requests with the given voucher type, before they are validated
+func (m *manager) RegisterSelectorPolicy(voucherType datatransfer.Voucher, policy datatransfer.SelectorPolicy) error {
+	err := m.selectorPolicies.Register(voucherType, policy)
+	if err != nil {
+		return xerrors.Errorf("error registering selector policy: %w", err)
+	}
+	return nil
+}
+
 // RegisterRevalidator registers a revalidator for the given voucher type
 // Note: this is the voucher type used to revalidate. It can share a name
 // with the initial validator type and CAN be the same type, or a different type.
@@ -445,6 +770,20 @@ func (m *manager) RegisterVoucherResultType(resultType datatransfer.VoucherResul
 	return nil
 }
 
+// RegisterBlockValidator registers a validator that is consulted for each
+// block received, in the order validators are registered
+// returns error if the transport does not check blocks before storing them
+func (m *manager) RegisterBlockValidator(validator datatransfer.BlockValidator) error {
+	checking, ok := m.transport.(datatransfer.BlockCheckingTransport)
+	if !ok || !checking.ChecksBlocksBeforeStoring() {
+		return xerrors.New("error registering block validator: transport does not check blocks before storing them")
+	}
+	m.blockValidatorsLk.Lock()
+	m.blockValidators = append(m.blockValidators, validator)
+	m.blockValidatorsLk.Unlock()
+	return nil
+}
+
 // RegisterTransportConfigurer registers the given transport configurer to be run on requests with the given voucher
 // type
 func (m *manager) RegisterTransportConfigurer(voucherType datatransfer.Voucher, configurer datatransfer.TransportConfigurer) error {
@@ -477,6 +816,13 @@ func (m *manager) RestartDataTransferChannel(ctx context.Context, chid datatrans
 
 	// initiate restart
 	chType := m.channelDataTransferType(channel)
+	required := datatransfer.CapabilityRestart
+	if chType == ManagerPeerReceivePush || chType == ManagerPeerReceivePull {
+		required = datatransfer.CapabilityRestartExistingChannel
+	}
+	if caps, ok := m.PeerCapabilities(channel.OtherPeer()); ok && !caps.Has(required) {
+		return xerrors.Errorf("peer %s does not support capability %s", channel.OtherPeer(), required)
+	}
 	switch chType {
 	case ManagerPeerReceivePush:
 		return m.restartManagerPeerReceivePush(ctx, channel)
@@ -491,6 +837,47 @@ func (m *manager) RestartDataTransferChannel(ctx context.Context, chid datatrans
 	return nil
 }
 
+// PeerCapabilities returns the capabilities supported by both this node and
+// the given peer
+func (m *manager) PeerCapabilities(p peer.ID) (datatransfer.Capabilities, bool) {
+	m.peerCapsLk.RLock()
+	defer m.peerCapsLk.RUnlock()
+	caps, ok := m.peerCaps[p]
+	return caps, ok
+}
+
+// recordPeerCapabilities remembers the capabilities of the peer that sent a
+// message, if it carries them
+func (m *manager) recordPeerCapabilities(p peer.ID, msg datatransfer.Message) {
+	caps := msg.Capabilities()
+	if caps == nil {
+		return
+	}
+	m.peerCapsLk.Lock()
+	defer m.peerCapsLk.Unlock()
+	m.peerCaps[p] = datatransfer.SupportedCapabilities.Intersect(caps)
+}
+
+// forgetPeerCapabilities drops the capabilities recorded for the other party
+// to a channel that is being cleaned up, unless another channel with them is
+// still in progress
+func (m *manager) forgetPeerCapabilities(chid datatransfer.ChannelID) {
+	p := chid.OtherParty(m.peerID)
+	chsts, err := m.channels.InProgress()
+	if err != nil {
+		log.Warnf("channel %s: listing channels to clean up peer capabilities: %s", chid, err)
+		return
+	}
+	for otherChid, chst := range chsts {
+		if otherChid != chid && otherChid.OtherParty(m.peerID) == p && !channels.IsChannelTerminated(chst.Status()) {
+			return
+		}
+	}
+	m.peerCapsLk.Lock()
+	defer m.peerCapsLk.Unlock()
+	delete(m.peerCaps, p)
+}
+
 func (m *manager) channelDataTransferType(channel datatransfer.ChannelState) ChannelDataTransferType {
 	initiator := channel.ChannelID().Initiator
 	if channel.IsPull() {
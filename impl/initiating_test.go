@@ -2,6 +2,7 @@ package impl_test
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"os"
 	"testing"
@@ -89,6 +90,33 @@ func TestDataTransferInitiating(t *testing.T) {
 				require.True(t, xerrors.As(err, new(*channels.ErrNotFound)))
 			},
 		},
+		"SendVoucherResult from initiator fails": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				err = h.dt.SendVoucherResult(ctx, channelID, testutil.NewFakeDTType())
+				require.EqualError(t, err, "cannot send voucher result for request we initiated")
+			},
+		},
+		"receive unsolicited voucher result": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.NewVoucherResult, datatransfer.Accept, datatransfer.ResumeResponder, datatransfer.NewVoucherResult, datatransfer.ResumeResponder},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message.NewResponse(channelID.ID, true, false, h.voucherResult.Type(), h.voucherResult)
+				require.NoError(t, err)
+				h.network.Delegate.ReceiveResponse(h.ctx, h.peers[1], response)
+				voucherResult := testutil.NewFakeDTType()
+				response, err = message.VoucherResultResponse(channelID.ID, true, false, voucherResult.Type(), voucherResult)
+				require.NoError(t, err)
+				h.network.Delegate.ReceiveResponse(h.ctx, h.peers[1], response)
+				chst, err := h.dt.ChannelState(h.ctx, channelID)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.Ongoing, chst.Status())
+				require.Equal(t, voucherResult, chst.LastVoucherResult())
+			},
+		},
 		"SendVoucher with channel open, push succeeds": {
 			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.NewVoucher},
 			verify: func(t *testing.T, h *harness) {
@@ -126,14 +154,14 @@ func TestDataTransferInitiating(t *testing.T) {
 				testutil.AssertFakeDTVoucher(t, receivedRequest, voucher)
 			},
 		},
-		"reregister voucher type again errors": {
+		"reregister voucher type again adds validator": {
 			verify: func(t *testing.T, h *harness) {
 				voucher := testutil.NewFakeDTType()
 				sv := testutil.NewStubbedValidator()
 				err := h.dt.RegisterVoucherType(h.voucher, sv)
 				require.NoError(t, err)
-				err = h.dt.RegisterVoucherType(voucher, sv)
-				require.EqualError(t, err, "error registering voucher type: identifier already registered: FakeDTType")
+				err = h.dt.RegisterVoucherType(voucher, testutil.NewStubbedValidator())
+				require.NoError(t, err)
 			},
 		},
 		"reregister non pointer errors": {
@@ -142,7 +170,24 @@ func TestDataTransferInitiating(t *testing.T) {
 				err := h.dt.RegisterVoucherType(h.voucher, sv)
 				require.NoError(t, err)
 				err = h.dt.RegisterVoucherType(testutil.FakeDTType{}, sv)
-				require.EqualError(t, err, "error registering voucher type: registering entry type FakeDTType: type must be a pointer")
+				require.EqualError(t, err, "error registering voucher type: FakeDTType is registered with Go type *testutil.FakeDTType, not testutil.FakeDTType")
+			},
+		},
+		"reregister with a different Go type errors": {
+			verify: func(t *testing.T, h *harness) {
+				sv := testutil.NewStubbedValidator()
+				err := h.dt.RegisterVoucherType(h.voucher, sv)
+				require.NoError(t, err)
+				err = h.dt.RegisterVoucherType(&otherFakeDTType{}, sv)
+				require.EqualError(t, err, "error registering voucher type: FakeDTType is registered with Go type *testutil.FakeDTType, not *impl_test.otherFakeDTType")
+				err = h.dt.RegisterAsyncVoucherType(&otherFakeDTType{}, nil)
+				require.Error(t, err)
+			},
+		},
+		"register nil request validator errors": {
+			verify: func(t *testing.T, h *harness) {
+				require.Error(t, h.dt.RegisterRequestValidator(nil))
+				require.Error(t, h.dt.RegisterRequestValidatorV2(nil))
 			},
 		},
 		"success response": {
@@ -169,6 +214,22 @@ func TestDataTransferInitiating(t *testing.T) {
 				require.NoError(t, err)
 			},
 		},
+		"rejected response, w/ reason": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Error, datatransfer.CleanupComplete},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				response, err := message.RejectResponse(channelID.ID, datatransfer.ErrValidationTimedOut.Error(), datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				err = h.transport.EventHandler.OnResponseReceived(channelID, response)
+				require.NoError(t, err)
+				require.Eventually(t, func() bool {
+					chst, err := h.dt.ChannelState(h.ctx, channelID)
+					require.NoError(t, err)
+					return chst.Message() == "response rejected: request validation timed out"
+				}, time.Second, 10*time.Millisecond)
+			},
+		},
 		"push request, pause behavior": {
 			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept, datatransfer.ResumeResponder, datatransfer.PauseInitiator, datatransfer.ResumeInitiator},
 			verify: func(t *testing.T, h *harness) {
@@ -404,6 +465,30 @@ func TestDataTransferRestartInitiating(t *testing.T) {
 				testutil.AssertFakeDTVoucher(t, receivedRequest, h.voucher)
 			},
 		},
+		"RestartDataTransferChannel: fails if the peer does not support restarts": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept, datatransfer.ResumeResponder},
+			verify: func(t *testing.T, h *harness) {
+				channelID, err := h.dt.OpenPushDataChannel(h.ctx, h.peers[1], h.voucher, h.baseCid, h.stor)
+				require.NoError(t, err)
+				_, ok := h.dt.PeerCapabilities(h.peers[1])
+				require.False(t, ok)
+
+				// the peer responds over the 1.0 protocol
+				response, err := message.NewResponse(channelID.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+				require.NoError(t, err)
+				oldResponse, err := response.MessageForProtocol(datatransfer.ProtocolDataTransfer1_0)
+				require.NoError(t, err)
+				err = h.transport.EventHandler.OnResponseReceived(channelID, oldResponse.(datatransfer.Response))
+				require.NoError(t, err)
+				caps, ok := h.dt.PeerCapabilities(h.peers[1])
+				require.True(t, ok)
+				require.False(t, caps.Has(datatransfer.CapabilityRestart))
+
+				err = h.dt.RestartDataTransferChannel(ctx, channelID)
+				require.EqualError(t, err, fmt.Sprintf("peer %s does not support capability restart", h.peers[1]))
+				require.Len(t, h.network.SentMessages, 1)
+			},
+		},
 		"RestartDataTransferChannel: Manager Peer Create Push Restart works": {
 			expectedEvents: []datatransfer.EventCode{datatransfer.Open},
 			verify: func(t *testing.T, h *harness) {
@@ -661,3 +746,9 @@ func (e eventVerifier) verify(ctx context.Context, t *testing.T) {
 		require.Equal(t, e.expectedEvents, receivedEvents)
 	}
 }
+
+// otherFakeDTType is a different Go type with the same voucher type as
+// testutil.FakeDTType
+type otherFakeDTType struct {
+	testutil.FakeDTType
+}
@@ -3,8 +3,13 @@ package impl_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"math/rand"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -28,9 +33,11 @@ import (
 	"github.com/libp2p/go-libp2p-core/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/channelmonitor"
+	"github.com/filecoin-project/go-data-transfer/cidlists"
 	"github.com/filecoin-project/go-data-transfer/encoding"
 	. "github.com/filecoin-project/go-data-transfer/impl"
 	"github.com/filecoin-project/go-data-transfer/message"
@@ -47,13 +54,18 @@ const loremFile = "lorem.txt"
 // default protocol -> default protocols
 // old protocol -> default protocols
 // default protocols -> old protocol
+// default protocols -> previous protocol
+// along with the capabilities the hosts should agree on
 var protocolsForTest = map[string]struct {
 	host1Protocols []protocol.ID
 	host2Protocols []protocol.ID
+	capabilities   datatransfer.Capabilities
 }{
-	"(new -> new)":      {nil, nil},
-	"(old -> new, old)": {[]protocol.ID{datatransfer.ProtocolDataTransfer1_0}, nil},
-	"(new, old -> old)": {nil, []protocol.ID{datatransfer.ProtocolDataTransfer1_0}},
+	"(new -> new)":      {nil, nil, datatransfer.SupportedCapabilities},
+	"(old -> new, old)": {[]protocol.ID{datatransfer.ProtocolDataTransfer1_0}, nil, datatransfer.NewCapabilities()},
+	"(new, old -> old)": {nil, []protocol.ID{datatransfer.ProtocolDataTransfer1_0}, datatransfer.NewCapabilities()},
+	"(new, prev -> prev)": {nil, []protocol.ID{datatransfer.ProtocolDataTransfer1_1},
+		datatransfer.ProtocolCapabilities(datatransfer.ProtocolDataTransfer1_1)},
 }
 
 func TestRoundTrip(t *testing.T) {
@@ -116,15 +128,29 @@ func TestRoundTrip(t *testing.T) {
 				opened := make(chan struct{}, 2)
 				sent := make(chan uint64, 21)
 				received := make(chan uint64, 21)
+				// capabilities are forgotten once the channel is cleaned up, so
+				// record them while data is flowing
+				var capsLk sync.Mutex
+				var senderCaps, receiverCaps datatransfer.Capabilities
 				var subscriber datatransfer.Subscriber = func(event datatransfer.Event, channelState datatransfer.ChannelState) {
 					if event.Code == datatransfer.DataQueued {
 						if channelState.Queued() > 0 {
+							capsLk.Lock()
+							if senderCaps == nil {
+								senderCaps, _ = dt1.PeerCapabilities(host2.ID())
+							}
+							capsLk.Unlock()
 							sent <- channelState.Queued()
 						}
 					}
 
 					if event.Code == datatransfer.DataReceived {
 						if channelState.Received() > 0 {
+							capsLk.Lock()
+							if receiverCaps == nil {
+								receiverCaps, _ = dt2.PeerCapabilities(host1.ID())
+							}
+							capsLk.Unlock()
 							received <- channelState.Received()
 						}
 					}
@@ -148,15 +174,14 @@ func TestRoundTrip(t *testing.T) {
 				if data.customSourceStore {
 					ds := dss.MutexWrap(datastore.NewMapDatastore())
 					bs := bstore.NewBlockstore(namespace.Wrap(ds, datastore.NewKey("blockstore")))
-					loader := storeutil.LoaderForBlockstore(bs)
-					storer := storeutil.StorerForBlockstore(bs)
+					lsys := storeutil.LinkSystemForBlockstore(bs)
 					sourceDagService = merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
 					err := dt1.RegisterTransportConfigurer(&testutil.FakeDTType{}, func(channelID datatransfer.ChannelID, testVoucher datatransfer.Voucher, transport datatransfer.Transport) {
 						fv, ok := testVoucher.(*testutil.FakeDTType)
 						if ok && fv.Data == voucher.Data {
 							gsTransport, ok := transport.(*tp.Transport)
 							if ok {
-								err := gsTransport.UseStore(channelID, loader, storer)
+								err := gsTransport.UseStore(channelID, lsys)
 								require.NoError(t, err)
 							}
 						}
@@ -172,15 +197,14 @@ func TestRoundTrip(t *testing.T) {
 				if data.customTargetStore {
 					ds := dss.MutexWrap(datastore.NewMapDatastore())
 					bs := bstore.NewBlockstore(namespace.Wrap(ds, datastore.NewKey("blockstore")))
-					loader := storeutil.LoaderForBlockstore(bs)
-					storer := storeutil.StorerForBlockstore(bs)
+					lsys := storeutil.LinkSystemForBlockstore(bs)
 					destDagService = merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
 					err := dt2.RegisterTransportConfigurer(&testutil.FakeDTType{}, func(channelID datatransfer.ChannelID, testVoucher datatransfer.Voucher, transport datatransfer.Transport) {
 						fv, ok := testVoucher.(*testutil.FakeDTType)
 						if ok && fv.Data == voucher.Data {
 							gsTransport, ok := transport.(*tp.Transport)
 							if ok {
-								err := gsTransport.UseStore(channelID, loader, storer)
+								err := gsTransport.UseStore(channelID, lsys)
 								require.NoError(t, err)
 							}
 						}
@@ -228,6 +252,15 @@ func TestRoundTrip(t *testing.T) {
 				} else {
 					assert.Equal(t, chid.Initiator, host1.ID())
 				}
+				capsLk.Lock()
+				require.Equal(t, ps.capabilities, senderCaps)
+				require.Equal(t, ps.capabilities, receiverCaps)
+				capsLk.Unlock()
+				require.Eventually(t, func() bool {
+					_, ok1 := dt1.PeerCapabilities(host2.ID())
+					_, ok2 := dt2.PeerCapabilities(host1.ID())
+					return !ok1 && !ok2
+				}, time.Second, 10*time.Millisecond)
 			})
 		}
 	} //
@@ -292,18 +325,15 @@ func TestMultipleRoundTripMultipleStores(t *testing.T) {
 			rootCid := root.(cidlink.Link).Cid
 
 			destDagServices := make([]ipldformat.DAGService, 0, data.requestCount)
-			loaders := make([]ipld.Loader, 0, data.requestCount)
-			storers := make([]ipld.Storer, 0, data.requestCount)
+			linkSystems := make([]ipld.LinkSystem, 0, data.requestCount)
 			for i := 0; i < data.requestCount; i++ {
 				ds := dss.MutexWrap(datastore.NewMapDatastore())
 				bs := bstore.NewBlockstore(namespace.Wrap(ds, datastore.NewKey("blockstore")))
-				loader := storeutil.LoaderForBlockstore(bs)
-				storer := storeutil.StorerForBlockstore(bs)
+				lsys := storeutil.LinkSystemForBlockstore(bs)
 				destDagService := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
 
 				destDagServices = append(destDagServices, destDagService)
-				loaders = append(loaders, loader)
-				storers = append(storers, storer)
+				linkSystems = append(linkSystems, lsys)
 			}
 
 			err = dt2.RegisterTransportConfigurer(&testutil.FakeDTType{}, func(channelID datatransfer.ChannelID, testVoucher datatransfer.Voucher, transport datatransfer.Transport) {
@@ -313,7 +343,7 @@ func TestMultipleRoundTripMultipleStores(t *testing.T) {
 						if fv.Data == voucher.(*testutil.FakeDTType).Data {
 							gsTransport, ok := transport.(*tp.Transport)
 							if ok {
-								err := gsTransport.UseStore(channelID, loaders[i], storers[i])
+								err := gsTransport.UseStore(channelID, linkSystems[i])
 								require.NoError(t, err)
 							}
 						}
@@ -358,6 +388,467 @@ func TestMultipleRoundTripMultipleStores(t *testing.T) {
 	}
 }
 
+func TestChannelStores(t *testing.T) {
+	ctx := context.Background()
+	testCases := map[string]struct {
+		isPull bool
+		// whether the custom store is chosen by the initiator when opening the
+		// channel, or by the responder in its validation result
+		responderStore bool
+		// whether the custom store holds the data being sent
+		sourceStore bool
+	}{
+		"initiator option, push": {
+			sourceStore: true,
+		},
+		"initiator option, pull": {
+			isPull: true,
+		},
+		"responder result, push": {
+			responderStore: true,
+		},
+		"responder result, pull": {
+			isPull:         true,
+			responderStore: true,
+			sourceStore:    true,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+			host2 := gsData.Host2 // responder, host1 is the initiator
+
+			tp1 := gsData.SetupGSTransportHost1()
+			tp2 := gsData.SetupGSTransportHost2()
+
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			finished := make(chan struct{}, 2)
+			errChan := make(chan string, 2)
+			var subscriber datatransfer.Subscriber = func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+				if channelState.Status() == datatransfer.Completed {
+					finished <- struct{}{}
+				}
+				if event.Code == datatransfer.Error {
+					errChan <- event.Message
+				}
+			}
+			dt1.SubscribeToEvents(subscriber)
+			dt2.SubscribeToEvents(subscriber)
+
+			ds := dss.MutexWrap(datastore.NewMapDatastore())
+			bs := bstore.NewBlockstore(namespace.Wrap(ds, datastore.NewKey("blockstore")))
+			customDagService := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+			lsys := storeutil.LinkSystemForBlockstore(bs)
+
+			// the initiator sends on a push, the responder sends on a pull
+			sourceDagService, destDagService := gsData.DagService1, gsData.DagService2
+			if data.isPull {
+				sourceDagService, destDagService = gsData.DagService2, gsData.DagService1
+			}
+			if data.sourceStore {
+				sourceDagService = customDagService
+			} else {
+				destDagService = customDagService
+			}
+			root, origBytes := testutil.LoadUnixFSFile(ctx, t, sourceDagService, loremFile)
+			rootCid := root.(cidlink.Link).Cid
+
+			sv := testutil.NewStubbedValidator()
+			var options []datatransfer.ChannelOption
+			if data.responderStore {
+				sv.StubResult(&datatransfer.VoucherResultWithStore{LinkSystem: lsys})
+			} else {
+				options = append(options, datatransfer.WithStore(lsys))
+			}
+			require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+
+			voucher := testutil.NewFakeDTType()
+			if data.isPull {
+				sv.ExpectSuccessPull()
+				_, err = dt1.OpenPullDataChannel(ctx, host2.ID(), voucher, rootCid, gsData.AllSelector, options...)
+			} else {
+				sv.ExpectSuccessPush()
+				_, err = dt1.OpenPushDataChannel(ctx, host2.ID(), voucher, rootCid, gsData.AllSelector, options...)
+			}
+			require.NoError(t, err)
+
+			completes := 0
+			for completes < 2 {
+				select {
+				case <-ctx.Done():
+					t.Fatal("Did not complete successful data transfer")
+				case <-finished:
+					completes++
+				case err := <-errChan:
+					t.Fatalf("received error on data transfer: %s", err)
+				}
+			}
+			sv.VerifyExpectations(t)
+			testutil.VerifyHasFile(ctx, t, destDagService, root, origBytes)
+		})
+	}
+}
+
+func TestTotalSize(t *testing.T) {
+	ctx := context.Background()
+	testCases := map[string]struct {
+		isPull        bool
+		maxBlocks     uint64
+		skip          bool
+		expectUnknown bool
+	}{
+		"push": {},
+		"pull": {
+			isPull: true,
+		},
+		"push, under block limit": {
+			maxBlocks: 1000,
+		},
+		"pull, over block limit": {
+			isPull:        true,
+			maxBlocks:     1,
+			expectUnknown: true,
+		},
+		"push, skipped by channel option": {
+			skip:          true,
+			expectUnknown: true,
+		},
+		"pull, skipped by channel option": {
+			isPull:        true,
+			skip:          true,
+			expectUnknown: true,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+			host2 := gsData.Host2 // responder, host1 is the initiator
+
+			tp1 := gsData.SetupGSTransportHost1()
+			tp2 := gsData.SetupGSTransportHost2()
+
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1, ComputeTotalSize(gsData.LinkSystem1, data.maxBlocks))
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2, ComputeTotalSize(gsData.LinkSystem2, data.maxBlocks))
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			finished := make(chan datatransfer.ChannelState, 2)
+			errChan := make(chan string, 2)
+			var subscriber datatransfer.Subscriber = func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+				if channelState.Status() == datatransfer.Completed {
+					finished <- channelState
+				}
+				if event.Code == datatransfer.Error {
+					errChan <- event.Message
+				}
+			}
+			dt1.SubscribeToEvents(subscriber)
+			dt2.SubscribeToEvents(subscriber)
+
+			// the initiator sends on a push, the responder sends on a pull
+			sourceDagService := gsData.DagService1
+			if data.isPull {
+				sourceDagService = gsData.DagService2
+			}
+			root, _ := testutil.LoadUnixFSFile(ctx, t, sourceDagService, loremFile)
+			rootCid := root.(cidlink.Link).Cid
+
+			sv := testutil.NewStubbedValidator()
+			require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+
+			var options []datatransfer.ChannelOption
+			if data.skip {
+				options = append(options, datatransfer.WithoutTotalSize())
+			}
+			voucher := testutil.NewFakeDTType()
+			if data.isPull {
+				sv.ExpectSuccessPull()
+				_, err = dt1.OpenPullDataChannel(ctx, host2.ID(), voucher, rootCid, gsData.AllSelector, options...)
+			} else {
+				sv.ExpectSuccessPush()
+				_, err = dt1.OpenPushDataChannel(ctx, host2.ID(), voucher, rootCid, gsData.AllSelector, options...)
+			}
+			require.NoError(t, err)
+
+			var states []datatransfer.ChannelState
+			for len(states) < 2 {
+				select {
+				case <-ctx.Done():
+					t.Fatal("Did not complete successful data transfer")
+				case chst := <-finished:
+					states = append(states, chst)
+				case err := <-errChan:
+					t.Fatalf("received error on data transfer: %s", err)
+				}
+			}
+			var received uint64
+			for _, chst := range states {
+				if chst.SelfPeer() == chst.Recipient() {
+					received = chst.Received()
+				}
+			}
+			var totalBlocks []uint64
+			for _, mgr := range []datatransfer.Manager{dt1, dt2} {
+				// the total size is given on the message that opens or
+				// accepts the channel, so is recorded before any data is sent
+				chst, err := mgr.ChannelState(ctx, states[0].ChannelID())
+				require.NoError(t, err)
+				if data.expectUnknown {
+					require.Zero(t, chst.TotalBlocks())
+					require.Zero(t, chst.TotalSize())
+					continue
+				}
+				require.Equal(t, received, chst.TotalSize())
+				require.Equal(t, float64(100), chst.Progress().PercentComplete)
+				require.Equal(t, chst.TotalBlocks(), chst.Progress().Blocks)
+				require.Zero(t, chst.Progress().EstimatedTimeRemaining)
+				totalBlocks = append(totalBlocks, chst.TotalBlocks())
+			}
+			if !data.expectUnknown {
+				require.Equal(t, totalBlocks[0], totalBlocks[1])
+			}
+		})
+	}
+}
+
+func TestDatastoreCIDLists(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+	host2 := gsData.Host2 // responder, host1 is the initiator
+
+	// a list left in files by an earlier version is imported on startup
+	fileLists, err := cidlists.NewCIDLists(gsData.TempDir1)
+	require.NoError(t, err)
+	oldChid := datatransfer.ChannelID{ID: 1, Initiator: gsData.Host1.ID(), Responder: host2.ID()}
+	oldCids := testutil.GenerateCids(5)
+	require.NoError(t, fileLists.CreateList(oldChid, oldCids))
+
+	tp1 := gsData.SetupGSTransportHost1()
+	tp2 := gsData.SetupGSTransportHost2()
+
+	dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1, DatastoreCIDLists())
+	require.NoError(t, err)
+	testutil.StartAndWaitForReady(ctx, t, dt1)
+	_, err = fileLists.ReadList(oldChid)
+	require.Error(t, err)
+
+	// the directory is optional when the lists are kept in the datastore
+	dt2, err := NewDataTransfer(gsData.DtDs2, "", gsData.DtNet2, tp2, DatastoreCIDLists())
+	require.NoError(t, err)
+	testutil.StartAndWaitForReady(ctx, t, dt2)
+
+	finished := make(chan datatransfer.ChannelState, 2)
+	errChan := make(chan string, 2)
+	var subscriber datatransfer.Subscriber = func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+		if channelState.Status() == datatransfer.Completed {
+			finished <- channelState
+		}
+		if event.Code == datatransfer.Error {
+			errChan <- event.Message
+		}
+	}
+	dt1.SubscribeToEvents(subscriber)
+	dt2.SubscribeToEvents(subscriber)
+
+	root, origBytes := testutil.LoadUnixFSFile(ctx, t, gsData.DagService2, loremFile)
+	rootCid := root.(cidlink.Link).Cid
+
+	sv := testutil.NewStubbedValidator()
+	sv.ExpectSuccessPull()
+	require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+
+	chid, err := dt1.OpenPullDataChannel(ctx, host2.ID(), testutil.NewFakeDTType(), rootCid, gsData.AllSelector)
+	require.NoError(t, err)
+
+	completes := 0
+	for completes < 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Did not complete successful data transfer")
+		case <-finished:
+			completes++
+		case err := <-errChan:
+			t.Fatalf("received error on data transfer: %s", err)
+		}
+	}
+	testutil.VerifyHasFile(ctx, t, gsData.DagService1, root, origBytes)
+
+	chst, err := dt1.ChannelState(ctx, chid)
+	require.NoError(t, err)
+	require.NotEmpty(t, chst.ReceivedCids())
+	require.Len(t, chst.ReceivedCids(), int(chst.ReceivedBlocks()))
+}
+
+type blockValidatorFunc func(chst datatransfer.ChannelState, link ipld.Link, size uint64) error
+
+func (bv blockValidatorFunc) ValidateBlock(chst datatransfer.ChannelState, link ipld.Link, size uint64) error {
+	return bv(chst, link, size)
+}
+
+func TestBlockValidator(t *testing.T) {
+	ctx := context.Background()
+	testCases := map[string]struct {
+		customStore    bool
+		verdict        error
+		expectedStatus datatransfer.Status
+	}{
+		"skip block, custom store": {
+			customStore:    true,
+			verdict:        xerrors.Errorf("blocklisted: %w", datatransfer.ErrSkipBlock),
+			expectedStatus: datatransfer.Completed,
+		},
+		"pause, custom store": {
+			customStore:    true,
+			verdict:        xerrors.Errorf("needs review: %w", datatransfer.ErrPause),
+			expectedStatus: datatransfer.Completed,
+		},
+		"fail, custom store": {
+			customStore:    true,
+			verdict:        xerrors.New("wrong codec"),
+			expectedStatus: datatransfer.Failed,
+		},
+		"skip block, default store": {
+			verdict:        xerrors.Errorf("blocklisted: %w", datatransfer.ErrSkipBlock),
+			expectedStatus: datatransfer.Completed,
+		},
+		"pause, default store": {
+			verdict:        xerrors.Errorf("needs review: %w", datatransfer.ErrPause),
+			expectedStatus: datatransfer.Completed,
+		},
+		"fail, default store": {
+			verdict:        xerrors.New("wrong codec"),
+			expectedStatus: datatransfer.Failed,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+			host2 := gsData.Host2 // responder, host1 is the initiator
+
+			tp1 := gsData.SetupGSTransportHost1(tp.DefaultStore(gsData.LinkSystem1))
+			tp2 := gsData.SetupGSTransportHost2()
+
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			// reject the second block received
+			var rejected ipld.Link
+			received := 0
+			err = dt1.RegisterBlockValidator(blockValidatorFunc(func(chst datatransfer.ChannelState, link ipld.Link, size uint64) error {
+				received++
+				if received != 2 {
+					return nil
+				}
+				rejected = link
+				return data.verdict
+			}))
+			require.NoError(t, err)
+
+			paused := make(chan struct{}, 1)
+			finished := make(chan datatransfer.ChannelState, 1)
+			dt1.SubscribeToEvents(func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+				if event.Code == datatransfer.PauseInitiator {
+					paused <- struct{}{}
+				}
+				if channelState.Status() == datatransfer.Completed || channelState.Status() == datatransfer.Failed {
+					finished <- channelState
+				}
+			})
+
+			destDagService := gsData.DagService1
+			destBs := gsData.Bs1
+			var options []datatransfer.ChannelOption
+			if data.customStore {
+				ds := dss.MutexWrap(datastore.NewMapDatastore())
+				destBs = bstore.NewBlockstore(namespace.Wrap(ds, datastore.NewKey("blockstore")))
+				destDagService = merkledag.NewDAGService(blockservice.New(destBs, offline.Exchange(destBs)))
+				options = append(options, datatransfer.WithStore(storeutil.LinkSystemForBlockstore(destBs)))
+			}
+
+			root, origBytes := testutil.LoadUnixFSFile(ctx, t, gsData.DagService2, loremFile)
+			rootCid := root.(cidlink.Link).Cid
+
+			sv := testutil.NewStubbedValidator()
+			sv.ExpectSuccessPull()
+			require.NoError(t, dt2.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+
+			chid, err := dt1.OpenPullDataChannel(ctx, host2.ID(), testutil.NewFakeDTType(), rootCid, gsData.AllSelector, options...)
+			require.NoError(t, err)
+
+			if errors.Is(data.verdict, datatransfer.ErrPause) {
+				select {
+				case <-ctx.Done():
+					t.Fatal("channel was not paused")
+				case <-paused:
+				}
+				chst, err := dt1.ChannelState(ctx, chid)
+				require.NoError(t, err)
+				require.Equal(t, datatransfer.InitiatorPaused, chst.Status())
+				require.Equal(t, data.verdict.Error(), chst.Message())
+				require.NoError(t, dt1.ResumeDataTransferChannel(ctx, chid))
+			}
+
+			var chst datatransfer.ChannelState
+			select {
+			case <-ctx.Done():
+				t.Fatal("data transfer did not finish")
+			case chst = <-finished:
+			}
+			require.Equal(t, data.expectedStatus, chst.Status())
+			require.Equal(t, data.verdict.Error(), chst.Message())
+
+			switch {
+			case errors.Is(data.verdict, datatransfer.ErrSkipBlock):
+				has, err := destBs.Has(rejected.(cidlink.Link).Cid)
+				require.NoError(t, err)
+				require.False(t, has)
+				require.NotContains(t, chst.ReceivedCids(), rejected.(cidlink.Link).Cid)
+			case errors.Is(data.verdict, datatransfer.ErrPause):
+				testutil.VerifyHasFile(ctx, t, destDagService, root, origBytes)
+			}
+		})
+	}
+}
+
+func TestBlockValidatorNeedsDefaultStore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+	accept := blockValidatorFunc(func(datatransfer.ChannelState, ipld.Link, uint64) error { return nil })
+
+	// without graphsync's store, blocks would be stored before they are checked
+	dt, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, gsData.SetupGSTransportHost1())
+	require.NoError(t, err)
+	require.Error(t, dt.RegisterBlockValidator(accept))
+
+	dt, err = NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, gsData.SetupGSTransportHost2(tp.DefaultStore(gsData.LinkSystem2)))
+	require.NoError(t, err)
+	require.NoError(t, dt.RegisterBlockValidator(accept))
+}
+
 func TestManyReceiversAtOnce(t *testing.T) {
 	ctx := context.Background()
 	testCases := map[string]struct {
@@ -397,28 +888,25 @@ func TestManyReceiversAtOnce(t *testing.T) {
 				bs := bstore.NewBlockstore(namespace.Wrap(ds, datastore.NewKey("blockstore")))
 				altBs := bstore.NewBlockstore(namespace.Wrap(ds, datastore.NewKey("altstore")))
 
-				loader := storeutil.LoaderForBlockstore(bs)
-				storer := storeutil.StorerForBlockstore(bs)
-				altLoader := storeutil.LoaderForBlockstore(altBs)
-				altStorer := storeutil.StorerForBlockstore(altBs)
+				lsys := storeutil.LinkSystemForBlockstore(bs)
+				altLinkSystem := storeutil.LinkSystemForBlockstore(altBs)
 
 				destDagService := merkledag.NewDAGService(blockservice.New(altBs, offline.Exchange(altBs)))
 
-				gs := gsimpl.New(gsData.Ctx, gsnet, loader, storer)
+				gs := gsimpl.New(gsData.Ctx, gsnet, lsys)
 				gsTransport := tp.NewTransport(host.ID(), gs)
 
 				dtDs := namespace.Wrap(ds, datastore.NewKey("datatransfer"))
 
 				receiver, err := NewDataTransfer(dtDs, os.TempDir(), dtnet, gsTransport)
 				require.NoError(t, err)
-				err = receiver.Start(gsData.Ctx)
-				require.NoError(t, err)
+				testutil.StartAndWaitForReady(gsData.Ctx, t, receiver)
 
 				err = receiver.RegisterTransportConfigurer(&testutil.FakeDTType{}, func(channelID datatransfer.ChannelID, testVoucher datatransfer.Voucher, transport datatransfer.Transport) {
 					_, isFv := testVoucher.(*testutil.FakeDTType)
 					gsTransport, isGs := transport.(*tp.Transport)
 					if isFv && isGs {
-						err := gsTransport.UseStore(channelID, altLoader, altStorer)
+						err := gsTransport.UseStore(channelID, altLinkSystem)
 						require.NoError(t, err)
 					}
 				})
@@ -1274,6 +1762,117 @@ func TestUnrecognizedVoucherRoundTrip(t *testing.T) {
 	}
 }
 
+// channelMessageRecorder records the channel messages it handles, failing
+// the first few so they are sent again
+type channelMessageRecorder struct {
+	failures int32
+	received chan datatransfer.ChannelMessage
+}
+
+func (r *channelMessageRecorder) HandleChannelMessage(chid datatransfer.ChannelID, msg datatransfer.ChannelMessage) error {
+	if atomic.AddInt32(&r.failures, -1) >= 0 {
+		return errors.New("not ready")
+	}
+	r.received <- msg
+	return nil
+}
+
+func TestChannelMessages(t *testing.T) {
+	ctx := context.Background()
+	for pname, ps := range protocolsForTest {
+		t.Run(pname, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			gsData := testutil.NewGraphsyncTestingData(ctx, t, ps.host1Protocols, ps.host2Protocols)
+			host1 := gsData.Host1 // responder, data sender
+			tp1 := gsData.SetupGSTransportHost1()
+			tp2 := gsData.SetupGSTransportHost2()
+
+			retry := ChannelMessageRetry(100 * time.Millisecond)
+			dt1, err := NewDataTransfer(gsData.DtDs1, gsData.TempDir1, gsData.DtNet1, tp1, retry)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt1)
+			dt2, err := NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, tp2, retry)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+
+			// the responder fails the first message it receives, so it is sent again
+			responderMessages := &channelMessageRecorder{failures: 1, received: make(chan datatransfer.ChannelMessage, 2)}
+			require.NoError(t, dt1.RegisterChannelMessageType(&testutil.FakeDTType{}, responderMessages))
+			initiatorMessages := &channelMessageRecorder{received: make(chan datatransfer.ChannelMessage, 2)}
+			require.NoError(t, dt2.RegisterChannelMessageType(&testutil.FakeDTType{}, initiatorMessages))
+
+			// keep the channel open by pausing it until messages are exchanged
+			sv := testutil.NewStubbedValidator()
+			sv.ExpectPausePull()
+			require.NoError(t, dt1.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+			accepted := make(chan struct{}, 1)
+			dt2.SubscribeToEvents(func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+				if event.Code == datatransfer.Accept {
+					accepted <- struct{}{}
+				}
+			})
+
+			root, _ := testutil.LoadUnixFSFile(ctx, t, gsData.DagService1, loremFile)
+			chid, err := dt2.OpenPullDataChannel(ctx, host1.ID(), testutil.NewFakeDTType(), root.(cidlink.Link).Cid, gsData.AllSelector)
+			require.NoError(t, err)
+			select {
+			case <-ctx.Done():
+				t.Fatal("channel was not accepted")
+			case <-accepted:
+			}
+
+			fromInitiator := &testutil.FakeDTType{Data: "from initiator"}
+			fromResponder := &testutil.FakeDTType{Data: "from responder"}
+			if !ps.capabilities.Has(datatransfer.CapabilityChannelMessages) {
+				err = dt2.SendChannelMessage(ctx, chid, fromInitiator)
+				require.EqualError(t, err, fmt.Sprintf("peer %s does not support capability %s", host1.ID(), datatransfer.CapabilityChannelMessages))
+				return
+			}
+
+			require.NoError(t, dt2.SendChannelMessage(ctx, chid, fromInitiator))
+			require.Equal(t, fromInitiator, <-responderMessages.received)
+			require.NoError(t, dt1.SendChannelMessage(ctx, chid, fromResponder))
+			require.Equal(t, fromResponder, <-initiatorMessages.received)
+
+			// each message was handled once
+			require.Empty(t, responderMessages.received)
+			require.Empty(t, initiatorMessages.received)
+
+			// a message that is not acknowledged before the initiator restarts
+			// is sent again once it is back
+			atomic.StoreInt32(&responderMessages.failures, math.MaxInt32)
+			unacked := &testutil.FakeDTType{Data: "across restart"}
+			require.NoError(t, dt2.SendChannelMessage(ctx, chid, unacked))
+			time.Sleep(200 * time.Millisecond)
+			require.NoError(t, dt2.Stop(ctx))
+			atomic.StoreInt32(&responderMessages.failures, 0)
+			dt2, err = NewDataTransfer(gsData.DtDs2, gsData.TempDir2, gsData.DtNet2, gsData.SetupGSTransportHost2(), retry)
+			require.NoError(t, err)
+			testutil.StartAndWaitForReady(ctx, t, dt2)
+			select {
+			case <-ctx.Done():
+				t.Fatal("channel message was not sent again after restarting")
+			case received := <-responderMessages.received:
+				require.Equal(t, unacked, received)
+			}
+
+			// messages that arrive after the channel ends are dropped
+			require.NoError(t, dt1.CloseDataTransferChannel(ctx, chid))
+			require.Eventually(t, func() bool {
+				chst, err := dt1.ChannelState(ctx, chid)
+				return err == nil && chst.Status() == datatransfer.Cancelled
+			}, 5*time.Second, 10*time.Millisecond)
+			late, err := message.ChannelMessageRequest(chid.ID, 1000, fromInitiator.Type(), fromInitiator)
+			require.NoError(t, err)
+			require.NoError(t, gsData.DtNet2.SendMessage(ctx, host1.ID(), late))
+			time.Sleep(200 * time.Millisecond)
+			require.Empty(t, responderMessages.received)
+		})
+	}
+}
+
 func TestDataTransferSubscribing(t *testing.T) {
 	// create network
 	ctx := context.Background()
@@ -1453,7 +2052,7 @@ func TestRespondingToPushGraphsyncRequests(t *testing.T) {
 		extData := buf.Bytes()
 
 		request := gsmsg.NewRequest(graphsync.RequestID(rand.Int31()), link.(cidlink.Link).Cid, gsData.AllSelector, graphsync.Priority(rand.Int31()), graphsync.ExtensionData{
-			Name: extension.ExtensionDataTransfer1_1,
+			Name: extension.ExtensionDataTransfer1_2,
 			Data: extData,
 		})
 		builder := gsmsg.NewBuilder(0)
@@ -1475,7 +2074,7 @@ func TestRespondingToPushGraphsyncRequests(t *testing.T) {
 		extData := buf.Bytes()
 
 		request := gsmsg.NewRequest(graphsync.RequestID(rand.Int31()), link.(cidlink.Link).Cid, gsData.AllSelector, graphsync.Priority(rand.Int31()), graphsync.ExtensionData{
-			Name: extension.ExtensionDataTransfer1_1,
+			Name: extension.ExtensionDataTransfer1_2,
 			Data: extData,
 		})
 		builder := gsmsg.NewBuilder(0)
@@ -1571,7 +2170,7 @@ func TestRespondingToPullGraphsyncRequests(t *testing.T) {
 				extData := buf.Bytes()
 
 				gsRequest := gsmsg.NewRequest(graphsync.RequestID(rand.Int31()), link.(cidlink.Link).Cid, gsData.AllSelector, graphsync.Priority(rand.Int31()), graphsync.ExtensionData{
-					Name: extension.ExtensionDataTransfer1_1,
+					Name: extension.ExtensionDataTransfer1_2,
 					Data: extData,
 				})
 
@@ -1602,7 +2201,7 @@ func TestRespondingToPullGraphsyncRequests(t *testing.T) {
 				require.NoError(t, err)
 				extData := buf.Bytes()
 				request := gsmsg.NewRequest(graphsync.RequestID(rand.Int31()), link.(cidlink.Link).Cid, gsData.AllSelector, graphsync.Priority(rand.Int31()), graphsync.ExtensionData{
-					Name: extension.ExtensionDataTransfer1_1,
+					Name: extension.ExtensionDataTransfer1_2,
 					Data: extData,
 				})
 				builder := gsmsg.NewBuilder(0)
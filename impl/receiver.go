@@ -3,7 +3,6 @@ package impl
 import (
 	"context"
 
-	"github.com/ipfs/go-cid"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p-core/peer"
 
@@ -21,6 +20,7 @@ func (r *receiver) ReceiveRequest(
 	ctx context.Context,
 	initiator peer.ID,
 	incoming datatransfer.Request) {
+	log.Debugf("received request from %s: %s", initiator, r.manager.debugMessage(incoming))
 	err := r.receiveRequest(ctx, initiator, incoming)
 	if err != nil {
 		log.Warnf("error processing request from %s: %s", initiator, err)
@@ -29,6 +29,9 @@ func (r *receiver) ReceiveRequest(
 
 func (r *receiver) receiveRequest(ctx context.Context, initiator peer.ID, incoming datatransfer.Request) error {
 	chid := datatransfer.ChannelID{Initiator: initiator, Responder: r.manager.peerID, ID: incoming.TransferID()}
+	if incoming.IsChannelMessage() || incoming.IsChannelMessageAck() {
+		return r.manager.receiveChannelMessage(ctx, chid, initiator, incoming)
+	}
 	response, receiveErr := r.manager.OnRequestReceived(chid, incoming)
 
 	if receiveErr == datatransfer.ErrResume {
@@ -44,17 +47,17 @@ func (r *receiver) receiveRequest(ctx context.Context, initiator peer.ID, incomi
 
 	if response != nil {
 		if (response.IsNew() || response.IsRestart()) && response.Accepted() && !incoming.IsPull() {
-			var doNotSendCids []cid.Cid
+			channel, err := r.manager.channels.GetByID(ctx, chid)
+			if err != nil {
+				return err
+			}
+			// use the channel's selector, which a selector policy may have narrowed
 			if response.IsRestart() {
-				channel, err := r.manager.channels.GetByID(ctx, chid)
-				if err != nil {
-					return err
-				}
-				doNotSendCids = channel.ReceivedCids()
+				err = r.manager.openRestartedChannel(ctx, initiator, chid, cidlink.Link{Cid: incoming.BaseCid()}, channel.Selector(), channel, response)
+			} else {
+				err = r.manager.transport.OpenChannel(ctx, initiator, chid, cidlink.Link{Cid: incoming.BaseCid()}, channel.Selector(), nil, response)
 			}
-
-			stor, _ := incoming.Selector()
-			if err := r.manager.transport.OpenChannel(ctx, initiator, chid, cidlink.Link{Cid: incoming.BaseCid()}, stor, doNotSendCids, response); err != nil {
+			if err != nil {
 				return err
 			}
 		} else {
@@ -82,6 +85,7 @@ func (r *receiver) ReceiveResponse(
 	ctx context.Context,
 	sender peer.ID,
 	incoming datatransfer.Response) {
+	log.Debugf("received response from %s: %s", sender, r.manager.debugMessage(incoming))
 	err := r.receiveResponse(ctx, sender, incoming)
 	if err != nil {
 		log.Error(err)
@@ -92,6 +96,9 @@ func (r *receiver) receiveResponse(
 	sender peer.ID,
 	incoming datatransfer.Response) error {
 	chid := datatransfer.ChannelID{Initiator: r.manager.peerID, Responder: sender, ID: incoming.TransferID()}
+	if incoming.IsChannelMessage() || incoming.IsChannelMessageAck() {
+		return r.manager.receiveChannelMessage(ctx, chid, sender, incoming)
+	}
 	err := r.manager.OnResponseReceived(chid, incoming)
 	if err == datatransfer.ErrPause {
 		return r.manager.transport.(datatransfer.PauseableTransport).PauseChannel(ctx, chid)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,6 +14,9 @@ import (
 	dss "github.com/ipfs/go-datastore/sync"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,8 +24,10 @@ import (
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/encoding"
 	. "github.com/filecoin-project/go-data-transfer/impl"
 	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/selectorpolicy"
 	"github.com/filecoin-project/go-data-transfer/testutil"
 )
 
@@ -191,6 +197,54 @@ func TestDataTransferResponding(t *testing.T) {
 				require.EqualError(t, err, "cannot send voucher for request we did not initiate")
 			},
 		},
+		"send voucher result from responder, push request": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.NewVoucherResult, datatransfer.Accept, datatransfer.NewVoucherResult},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+				sv.StubResult(testutil.NewFakeDTType())
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], h.pushRequest)
+				voucherResult := testutil.NewFakeDTType()
+				err := h.dt.SendVoucherResult(h.ctx, channelID(h.id, h.peers), voucherResult)
+				require.NoError(t, err)
+				require.Len(t, h.network.SentMessages, 1)
+				response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+				require.True(t, ok)
+				require.True(t, response.Accepted())
+				require.Equal(t, response.TransferID(), h.id)
+				require.False(t, response.IsNew())
+				require.False(t, response.IsPaused())
+				require.True(t, response.IsVoucherResult())
+				testutil.AssertFakeDTVoucherResult(t, response, voucherResult)
+			},
+		},
+		"send voucher result from responder keeps the responder paused": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.NewVoucherResult, datatransfer.Accept, datatransfer.PauseResponder, datatransfer.NewVoucherResult},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectPausePush()
+				sv.StubResult(testutil.NewFakeDTType())
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], h.pushRequest)
+				voucherResult := testutil.NewFakeDTType()
+				err := h.dt.SendVoucherResult(h.ctx, channelID(h.id, h.peers), voucherResult)
+				require.NoError(t, err)
+				require.Len(t, h.network.SentMessages, 1)
+				response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+				require.True(t, ok)
+				require.True(t, response.Accepted())
+				require.True(t, response.IsPaused())
+				require.True(t, response.IsVoucherResult())
+				testutil.AssertFakeDTVoucherResult(t, response, voucherResult)
+			},
+		},
+		"send voucher result with no channel open": {
+			verify: func(t *testing.T, h *receiverHarness) {
+				err := h.dt.SendVoucherResult(h.ctx, channelID(h.id, h.peers), testutil.NewFakeDTType())
+				require.True(t, xerrors.As(err, new(*channels.ErrNotFound)))
+			},
+		},
 		"receive voucher": {
 			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.NewVoucherResult, datatransfer.Accept, datatransfer.NewVoucher, datatransfer.ResumeResponder},
 			configureValidator: func(sv *testutil.StubbedValidator) {
@@ -509,6 +563,94 @@ func TestDataTransferResponding(t *testing.T) {
 				require.NoError(t, err)
 			},
 		},
+		"new push request, selector rewritten by policy": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.NewVoucherResult, datatransfer.Accept},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+				sv.StubResult(testutil.NewFakeDTType())
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				policy := selectorpolicy.New(selectorpolicy.MaxRecursionDepth(5), selectorpolicy.RewriteToLimits())
+				require.NoError(t, h.dt.RegisterSelectorPolicy(h.voucher, policy))
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], h.pushRequest)
+
+				ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+				expected, err := encoding.Encode(ssb.ExploreRecursive(selector.RecursionLimitDepth(5),
+					ssb.ExploreAll(ssb.ExploreRecursiveEdge())).Node())
+				require.NoError(t, err)
+
+				require.Len(t, h.sv.ValidationsReceived, 1)
+				validated, err := encoding.Encode(h.sv.ValidationsReceived[0].Selector)
+				require.NoError(t, err)
+				require.Equal(t, expected, validated)
+
+				require.Len(t, h.transport.OpenedChannels, 1)
+				opened, err := encoding.Encode(h.transport.OpenedChannels[0].Selector)
+				require.NoError(t, err)
+				require.Equal(t, expected, opened)
+			},
+		},
+		"new pull request, selector rejected by policy": {
+			verify: func(t *testing.T, h *receiverHarness) {
+				policy := selectorpolicy.New(selectorpolicy.MaxRecursionDepth(5), selectorpolicy.RewriteToLimits())
+				require.NoError(t, h.dt.RegisterSelectorPolicy(h.voucher, policy))
+				response, err := h.transport.EventHandler.OnRequestReceived(channelID(h.id, h.peers), h.pullRequest)
+				require.Error(t, err)
+				require.False(t, response.Accepted())
+				require.Empty(t, h.sv.ValidationsReceived)
+			},
+		},
+		"new push request, every validator for the type must accept": {
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPush()
+				sv.StubResult(testutil.NewFakeDTType())
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				second := testutil.NewStubbedValidator()
+				second.ExpectErrorPush()
+				require.NoError(t, h.dt.RegisterVoucherType(h.voucher, second))
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], h.pushRequest)
+				second.VerifyExpectations(t)
+				require.Len(t, h.sv.ValidationsReceived, 1)
+				require.Len(t, second.ValidationsReceived, 1)
+				require.Empty(t, h.transport.OpenedChannels)
+				require.Len(t, h.network.SentMessages, 1)
+				response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+				require.True(t, ok)
+				require.False(t, response.Accepted())
+			},
+		},
+		"new push request, validators for all types run first": {
+			verify: func(t *testing.T, h *receiverHarness) {
+				allTypes := testutil.NewStubbedValidator()
+				allTypes.ExpectErrorPush()
+				require.NoError(t, h.dt.RegisterRequestValidator(allTypes))
+				h.network.Delegate.ReceiveRequest(h.ctx, h.peers[1], h.pushRequest)
+				allTypes.VerifyExpectations(t)
+				require.Empty(t, h.sv.ValidationsReceived)
+				require.Len(t, h.network.SentMessages, 1)
+				response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+				require.True(t, ok)
+				require.False(t, response.Accepted())
+			},
+		},
+		"new pull request, validators for all types and the type accept": {
+			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.Accept},
+			configureValidator: func(sv *testutil.StubbedValidator) {
+				sv.ExpectSuccessPull()
+			},
+			verify: func(t *testing.T, h *receiverHarness) {
+				allTypes := testutil.NewStubbedValidator()
+				allTypes.ExpectSuccessPull()
+				require.NoError(t, h.dt.RegisterRequestValidator(allTypes))
+				response, err := h.transport.EventHandler.OnRequestReceived(channelID(h.id, h.peers), h.pullRequest)
+				require.NoError(t, err)
+				require.True(t, response.Accepted())
+				allTypes.VerifyExpectations(t)
+				require.Len(t, allTypes.ValidationsReceived, 1)
+				require.Len(t, h.sv.ValidationsReceived, 1)
+			},
+		},
 		"new push request, customized transport": {
 			expectedEvents: []datatransfer.EventCode{datatransfer.Open, datatransfer.NewVoucherResult, datatransfer.Accept},
 			configureValidator: func(sv *testutil.StubbedValidator) {
@@ -1041,3 +1183,639 @@ type receiverHarness struct {
 func channelID(id datatransfer.TransferID, peers []peer.ID) datatransfer.ChannelID {
 	return datatransfer.ChannelID{ID: id, Initiator: peers[1], Responder: peers[0]}
 }
+
+func TestVoucherUpgrades(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+	stor := testutil.AllSelector()
+	baseCid := testutil.GenerateCids(1)[0]
+
+	newManager := func(t *testing.T, ds datastore.Batching) (datatransfer.Manager, *testutil.FakeNetwork) {
+		network := testutil.NewFakeNetwork(peers[0])
+		dt, err := NewDataTransfer(ds, os.TempDir(), network, testutil.NewFakeTransport())
+		require.NoError(t, err)
+		testutil.StartAndWaitForReady(ctx, t, dt)
+		return dt, network
+	}
+	receivePush := func(t *testing.T, network *testutil.FakeNetwork, voucher datatransfer.Voucher) datatransfer.ChannelID {
+		id := datatransfer.TransferID(rand.Int31())
+		request, err := message.NewRequest(id, false, false, voucher.Type(), voucher, baseCid, stor)
+		require.NoError(t, err)
+		network.Delegate.ReceiveRequest(ctx, peers[1], request)
+		return channelID(id, peers)
+	}
+
+	t.Run("request voucher is upgraded before validation", func(t *testing.T) {
+		dt, network := newManager(t, dss.MutexWrap(datastore.NewMapDatastore()))
+		sv := testutil.NewStubbedValidator()
+		sv.ExpectSuccessPush()
+		require.NoError(t, dt.RegisterVoucherType(&testutil.FakeDTTypeV2{}, sv))
+		require.NoError(t, dt.RegisterVoucherUpgrader(&testutil.FakeDTTypeV1{}, testutil.UpgradeFakeDTTypeV1))
+
+		voucher := testutil.NewFakeDTTypeV1()
+		chid := receivePush(t, network, voucher)
+		sv.VerifyExpectations(t)
+		upgraded := &testutil.FakeDTTypeV2{FakeDTType: voucher.FakeDTType}
+		require.Len(t, sv.ValidationsReceived, 1)
+		require.Equal(t, upgraded, sv.ValidationsReceived[0].Voucher)
+		chst, err := dt.ChannelState(ctx, chid)
+		require.NoError(t, err)
+		require.Equal(t, upgraded, chst.Voucher())
+	})
+
+	t.Run("stored voucher is upgraded when read", func(t *testing.T) {
+		ds := dss.MutexWrap(datastore.NewMapDatastore())
+		dt, network := newManager(t, ds)
+		sv := testutil.NewStubbedValidator()
+		sv.ExpectSuccessPush()
+		require.NoError(t, dt.RegisterVoucherType(&testutil.FakeDTTypeV1{}, sv))
+		voucher := testutil.NewFakeDTTypeV1()
+		chid := receivePush(t, network, voucher)
+		sv.VerifyExpectations(t)
+		require.NoError(t, dt.Stop(ctx))
+
+		dt, _ = newManager(t, ds)
+		require.NoError(t, dt.RegisterVoucherType(&testutil.FakeDTTypeV2{}, testutil.NewStubbedValidator()))
+		require.NoError(t, dt.RegisterVoucherUpgrader(&testutil.FakeDTTypeV1{}, testutil.UpgradeFakeDTTypeV1))
+		chst, err := dt.ChannelState(ctx, chid)
+		require.NoError(t, err)
+		require.Equal(t, []datatransfer.Voucher{&testutil.FakeDTTypeV2{FakeDTType: voucher.FakeDTType}}, chst.Vouchers())
+	})
+
+	t.Run("upgrade must produce a newer version of the type", func(t *testing.T) {
+		dt, network := newManager(t, dss.MutexWrap(datastore.NewMapDatastore()))
+		sv := testutil.NewStubbedValidator()
+		require.NoError(t, dt.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+		require.NoError(t, dt.RegisterVoucherUpgrader(&testutil.FakeDTTypeV1{}, func(voucher datatransfer.Voucher) (datatransfer.Voucher, error) {
+			return &voucher.(*testutil.FakeDTTypeV1).FakeDTType, nil
+		}))
+
+		receivePush(t, network, testutil.NewFakeDTTypeV1())
+		require.Empty(t, sv.ValidationsReceived)
+		require.Len(t, network.SentMessages, 1)
+		response, ok := network.SentMessages[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.False(t, response.Accepted())
+	})
+
+	t.Run("upgraded voucher must have a validator", func(t *testing.T) {
+		dt, network := newManager(t, dss.MutexWrap(datastore.NewMapDatastore()))
+		require.NoError(t, dt.RegisterVoucherUpgrader(&testutil.FakeDTTypeV1{}, testutil.UpgradeFakeDTTypeV1))
+
+		receivePush(t, network, testutil.NewFakeDTTypeV1())
+		require.Len(t, network.SentMessages, 1)
+		response, ok := network.SentMessages[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.False(t, response.Accepted())
+	})
+}
+
+func TestAsyncValidation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+	stor := testutil.AllSelector()
+	baseCid := testutil.GenerateCids(1)[0]
+	voucher := testutil.NewFakeDTType()
+
+	type asyncHarness struct {
+		dt        datatransfer.Manager
+		network   *testutil.FakeNetwork
+		transport *testutil.FakeTransport
+		sv        *testutil.StubbedValidator
+		asv       *testutil.StubbedAsyncValidator
+		events    chan datatransfer.Event
+		chid      datatransfer.ChannelID
+		request   func(isPull bool) datatransfer.Request
+	}
+	setup := func(t *testing.T, options ...DataTransferOption) *asyncHarness {
+		h := &asyncHarness{
+			network:   testutil.NewFakeNetwork(peers[0]),
+			transport: testutil.NewFakeTransport(),
+			sv:        testutil.NewStubbedValidator(),
+			asv:       testutil.NewStubbedAsyncValidator(),
+			events:    make(chan datatransfer.Event, 32),
+		}
+		dt, err := NewDataTransfer(dss.MutexWrap(datastore.NewMapDatastore()), os.TempDir(), h.network, h.transport, options...)
+		require.NoError(t, err)
+		testutil.StartAndWaitForReady(ctx, t, dt)
+		h.dt = dt
+		dt.SubscribeToEvents(func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+			h.events <- event
+		})
+		require.NoError(t, dt.RegisterVoucherType(voucher, h.sv))
+		require.NoError(t, dt.RegisterAsyncVoucherType(voucher, h.asv))
+		id := datatransfer.TransferID(rand.Int31())
+		h.chid = channelID(id, peers)
+		h.request = func(isPull bool) datatransfer.Request {
+			request, err := message.NewRequest(id, false, isPull, voucher.Type(), voucher, baseCid, stor)
+			require.NoError(t, err)
+			return request
+		}
+		return h
+	}
+	waitFor := func(t *testing.T, h *asyncHarness, code datatransfer.EventCode) {
+		for {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("did not receive %s event", datatransfer.Events[code])
+			case event := <-h.events:
+				if event.Code == code {
+					return
+				}
+			}
+		}
+	}
+	status := func(t *testing.T, h *asyncHarness) datatransfer.Status {
+		chst, err := h.dt.ChannelState(ctx, h.chid)
+		require.NoError(t, err)
+		return chst.Status()
+	}
+
+	t.Run("push request accepted once validated", func(t *testing.T) {
+		h := setup(t)
+		h.sv.ExpectSuccessPush()
+		h.network.Delegate.ReceiveRequest(ctx, peers[1], h.request(false))
+		validation := h.asv.NextValidation(ctx, t)
+		require.Equal(t, h.chid, validation.ChannelID)
+		require.False(t, validation.IsPull)
+		require.Equal(t, voucher, validation.Voucher)
+		require.Equal(t, datatransfer.Validating, status(t, h))
+		require.Empty(t, h.network.SentMessages)
+		require.Empty(t, h.transport.OpenedChannels)
+
+		result := testutil.NewFakeDTType()
+		validation.Done(result, nil)
+		waitFor(t, h, datatransfer.Accept)
+		require.Equal(t, datatransfer.Ongoing, status(t, h))
+		require.Eventually(t, func() bool { return len(h.transport.OpenedChannels) == 1 }, time.Second, 10*time.Millisecond)
+		response, ok := h.transport.OpenedChannels[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.True(t, response.Accepted())
+		require.True(t, response.IsNew())
+		testutil.AssertFakeDTVoucherResult(t, response, result)
+		h.sv.VerifyExpectations(t)
+	})
+
+	t.Run("push request rejected by async validator", func(t *testing.T) {
+		h := setup(t)
+		h.network.Delegate.ReceiveRequest(ctx, peers[1], h.request(false))
+		validation := h.asv.NextValidation(ctx, t)
+		validation.Done(nil, xerrors.New("not on chain"))
+		waitFor(t, h, datatransfer.CleanupComplete)
+		require.Equal(t, datatransfer.Failed, status(t, h))
+		require.Empty(t, h.transport.OpenedChannels)
+		require.Len(t, h.network.SentMessages, 1)
+		response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.False(t, response.Accepted())
+		require.Empty(t, response.RejectionReason())
+	})
+
+	t.Run("push request rejected by sync validator is not validated async", func(t *testing.T) {
+		h := setup(t)
+		h.sv.ExpectErrorPush()
+		h.network.Delegate.ReceiveRequest(ctx, peers[1], h.request(false))
+		h.asv.VerifyNoValidations(t)
+		require.Len(t, h.network.SentMessages, 1)
+		response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.False(t, response.Accepted())
+	})
+
+	t.Run("validation timeout rejects with a reason", func(t *testing.T) {
+		h := setup(t, AsyncValidationTimeout(50*time.Millisecond))
+		h.network.Delegate.ReceiveRequest(ctx, peers[1], h.request(false))
+		validation := h.asv.NextValidation(ctx, t)
+		waitFor(t, h, datatransfer.CleanupComplete)
+		chst, err := h.dt.ChannelState(ctx, h.chid)
+		require.NoError(t, err)
+		require.Equal(t, datatransfer.Failed, chst.Status())
+		require.Equal(t, datatransfer.ErrValidationTimedOut.Error(), chst.Message())
+		require.Len(t, h.network.SentMessages, 1)
+		response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.False(t, response.Accepted())
+		require.Equal(t, datatransfer.ErrValidationTimedOut.Error(), response.RejectionReason())
+
+		// completing after the timeout has no effect
+		validation.Done(nil, nil)
+		require.Len(t, h.network.SentMessages, 1)
+	})
+
+	t.Run("pull request paused on transport until validated", func(t *testing.T) {
+		h := setup(t)
+		h.sv.ExpectSuccessPull()
+		response, err := h.transport.EventHandler.OnRequestReceived(h.chid, h.request(true))
+		require.Equal(t, datatransfer.ErrPause, err)
+		require.Nil(t, response)
+		validation := h.asv.NextValidation(ctx, t)
+		require.True(t, validation.IsPull)
+		require.Equal(t, datatransfer.Validating, status(t, h))
+
+		validation.Done(nil, nil)
+		waitFor(t, h, datatransfer.Accept)
+		require.Eventually(t, func() bool { return len(h.transport.ResumedChannels) == 1 }, time.Second, 10*time.Millisecond)
+		resumed, ok := h.transport.ResumedChannels[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.True(t, resumed.Accepted())
+		require.Equal(t, h.chid, h.transport.ResumedChannels[0].ChannelID)
+		h.sv.VerifyExpectations(t)
+	})
+
+	t.Run("pull request rejected once validated", func(t *testing.T) {
+		h := setup(t)
+		_, err := h.transport.EventHandler.OnRequestReceived(h.chid, h.request(true))
+		require.Equal(t, datatransfer.ErrPause, err)
+		validation := h.asv.NextValidation(ctx, t)
+		validation.Done(nil, xerrors.New("not on chain"))
+		waitFor(t, h, datatransfer.CleanupComplete)
+		require.Equal(t, []datatransfer.ChannelID{h.chid}, h.transport.ClosedChannels)
+		require.Len(t, h.network.SentMessages, 1)
+		response, ok := h.network.SentMessages[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.False(t, response.Accepted())
+	})
+
+	t.Run("stopping interrupts validation", func(t *testing.T) {
+		h := setup(t, AsyncValidationTimeout(50*time.Millisecond))
+		h.network.Delegate.ReceiveRequest(ctx, peers[1], h.request(false))
+		validation := h.asv.NextValidation(ctx, t)
+		require.NoError(t, h.dt.Stop(ctx))
+
+		// the validation neither times out nor completes once the manager
+		// has stopped
+		time.Sleep(100 * time.Millisecond)
+		validation.Done(nil, nil)
+		require.Empty(t, h.network.SentMessages)
+		require.Empty(t, h.transport.OpenedChannels)
+	})
+
+	t.Run("request with only async validators is rejected", func(t *testing.T) {
+		network := testutil.NewFakeNetwork(peers[0])
+		asv := testutil.NewStubbedAsyncValidator()
+		dt, err := NewDataTransfer(dss.MutexWrap(datastore.NewMapDatastore()), os.TempDir(), network, testutil.NewFakeTransport())
+		require.NoError(t, err)
+		testutil.StartAndWaitForReady(ctx, t, dt)
+		require.NoError(t, dt.RegisterAsyncVoucherType(voucher, asv))
+		request, err := message.NewRequest(datatransfer.TransferID(rand.Int31()), false, false, voucher.Type(), voucher, baseCid, stor)
+		require.NoError(t, err)
+		network.Delegate.ReceiveRequest(ctx, peers[1], request)
+		asv.VerifyNoValidations(t)
+		require.Len(t, network.SentMessages, 1)
+		response, ok := network.SentMessages[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.False(t, response.Accepted())
+	})
+}
+
+// recordingValidatorV2 accepts every request, recording the requests it
+// validates and the deadlines of their contexts
+type recordingValidatorV2 struct {
+	lk        sync.Mutex
+	requests  []datatransfer.ValidationRequest
+	deadlines []time.Time
+}
+
+func (rv *recordingValidatorV2) record(ctx context.Context, request datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	rv.lk.Lock()
+	defer rv.lk.Unlock()
+	deadline, _ := ctx.Deadline()
+	rv.requests = append(rv.requests, request)
+	rv.deadlines = append(rv.deadlines, deadline)
+	return nil, nil
+}
+
+func (rv *recordingValidatorV2) ValidatePushRequest(ctx context.Context, request datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	return rv.record(ctx, request)
+}
+
+func (rv *recordingValidatorV2) ValidatePullRequest(ctx context.Context, request datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	return rv.record(ctx, request)
+}
+
+func TestRequestValidatorV2(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+	stor := testutil.AllSelector()
+	baseCid := testutil.GenerateCids(1)[0]
+	voucher := testutil.NewFakeDTType()
+
+	setup := func(t *testing.T, options ...DataTransferOption) (datatransfer.Manager, *testutil.FakeNetwork, *recordingValidatorV2) {
+		network := testutil.NewFakeNetwork(peers[0])
+		dt, err := NewDataTransfer(dss.MutexWrap(datastore.NewMapDatastore()), os.TempDir(), network, testutil.NewFakeTransport(), options...)
+		require.NoError(t, err)
+		testutil.StartAndWaitForReady(ctx, t, dt)
+		rv := &recordingValidatorV2{}
+		require.NoError(t, dt.RegisterVoucherTypeV2(voucher, rv))
+		return dt, network, rv
+	}
+
+	for _, isPull := range []bool{false, true} {
+		t.Run(fmt.Sprintf("new request, pull: %t", isPull), func(t *testing.T) {
+			_, network, rv := setup(t, ValidationTimeout(time.Second))
+			id := datatransfer.TransferID(rand.Int31())
+			request, err := message.NewRequest(id, false, isPull, voucher.Type(), voucher, baseCid, stor)
+			require.NoError(t, err)
+			start := time.Now()
+			network.Delegate.ReceiveRequest(ctx, peers[1], request)
+
+			require.Len(t, rv.requests, 1)
+			validated := rv.requests[0]
+			require.Equal(t, channelID(id, peers), validated.ChannelID)
+			require.Equal(t, peers[1], validated.Peer)
+			require.Equal(t, isPull, validated.IsPull)
+			require.False(t, validated.IsRestart)
+			require.Equal(t, voucher, validated.Voucher)
+			require.Equal(t, baseCid, validated.BaseCid)
+			require.Equal(t, stor, validated.Selector)
+			require.Equal(t, request, validated.Message)
+			require.Equal(t, request.Capabilities(), validated.Capabilities)
+			require.WithinDuration(t, start.Add(time.Second), rv.deadlines[0], time.Second)
+		})
+	}
+
+	t.Run("restart request", func(t *testing.T) {
+		_, network, rv := setup(t)
+		id := datatransfer.TransferID(rand.Int31())
+		request, err := message.NewRequest(id, false, false, voucher.Type(), voucher, baseCid, stor)
+		require.NoError(t, err)
+		network.Delegate.ReceiveRequest(ctx, peers[1], request)
+		chid := channelID(id, peers)
+
+		restart, err := message.NewRequest(id, true, false, voucher.Type(), voucher, baseCid, stor)
+		require.NoError(t, err)
+		network.Delegate.ReceiveRequest(ctx, peers[1], restart)
+		require.Len(t, rv.requests, 2)
+		require.Equal(t, chid, rv.requests[1].ChannelID)
+		require.True(t, rv.requests[1].IsRestart)
+		require.Equal(t, restart, rv.requests[1].Message)
+	})
+
+	t.Run("runs with adapted validators", func(t *testing.T) {
+		dt, network, rv := setup(t)
+		sv := testutil.NewStubbedValidator()
+		sv.StubErrorPush()
+		require.NoError(t, dt.RegisterVoucherType(voucher, sv))
+		allTypes := &recordingValidatorV2{}
+		require.NoError(t, dt.RegisterRequestValidatorV2(allTypes))
+
+		id := datatransfer.TransferID(rand.Int31())
+		request, err := message.NewRequest(id, false, false, voucher.Type(), voucher, baseCid, stor)
+		require.NoError(t, err)
+		network.Delegate.ReceiveRequest(ctx, peers[1], request)
+		require.Len(t, allTypes.requests, 1)
+		require.Len(t, rv.requests, 1)
+		require.Len(t, sv.ValidationsReceived, 1)
+		response, ok := network.SentMessages[0].Message.(datatransfer.Response)
+		require.True(t, ok)
+		require.False(t, response.Accepted())
+	})
+}
+
+func TestTriggeredRevalidation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+	stor := testutil.AllSelector()
+	baseCid := testutil.GenerateCids(1)[0]
+	voucher := testutil.NewFakeDTType()
+
+	type triggerHarness struct {
+		dt        datatransfer.Manager
+		network   *testutil.FakeNetwork
+		transport *testutil.FakeTransport
+		srv       *testutil.StubbedTriggeredRevalidator
+		chid      datatransfer.ChannelID
+	}
+	start := func(t *testing.T, ds datastore.Batching, trigger datatransfer.RevalidationTrigger) *triggerHarness {
+		h := &triggerHarness{
+			network:   testutil.NewFakeNetwork(peers[0]),
+			transport: testutil.NewFakeTransport(),
+			srv:       testutil.NewStubbedTriggeredRevalidator(trigger),
+		}
+		dt, err := NewDataTransfer(ds, os.TempDir(), h.network, h.transport)
+		require.NoError(t, err)
+		testutil.StartAndWaitForReady(ctx, t, dt)
+		t.Cleanup(func() { require.NoError(t, dt.Stop(ctx)) })
+		h.dt = dt
+		sv := testutil.NewStubbedValidator()
+		sv.StubSuccessPush()
+		sv.StubSuccessPull()
+		require.NoError(t, dt.RegisterVoucherType(voucher, sv))
+		require.NoError(t, dt.RegisterRevalidator(testutil.NewFakeDTType(), h.srv))
+		return h
+	}
+	setupWith := func(t *testing.T, ds datastore.Batching, trigger datatransfer.RevalidationTrigger, isPull bool) *triggerHarness {
+		h := start(t, ds, trigger)
+		id := datatransfer.TransferID(rand.Int31())
+		request, err := message.NewRequest(id, false, isPull, voucher.Type(), voucher, baseCid, stor)
+		require.NoError(t, err)
+		if isPull {
+			_, err = h.transport.EventHandler.OnRequestReceived(channelID(id, peers), request)
+		} else {
+			h.network.Delegate.ReceiveRequest(ctx, peers[1], request)
+		}
+		require.NoError(t, err)
+		h.chid = channelID(id, peers)
+		return h
+	}
+	setup := func(t *testing.T, trigger datatransfer.RevalidationTrigger, isPull bool) *triggerHarness {
+		return setupWith(t, dss.MutexWrap(datastore.NewMapDatastore()), trigger, isPull)
+	}
+	requirePausedVoucherResult := func(t *testing.T, msg datatransfer.Message) {
+		response, ok := msg.(datatransfer.Response)
+		require.True(t, ok)
+		require.True(t, response.Accepted())
+		require.True(t, response.IsPaused())
+		require.True(t, response.IsVoucherResult())
+		require.False(t, response.EmptyVoucherResult())
+	}
+
+	t.Run("push request paused every block interval", func(t *testing.T) {
+		h := setup(t, datatransfer.RevalidationTrigger{Blocks: 2}, false)
+		h.srv.StubTriggerResult(true, testutil.NewFakeDTType(), datatransfer.ErrPause)
+		cids := testutil.GenerateCids(2)
+		err := h.transport.EventHandler.OnDataReceived(h.chid, cidlink.Link{Cid: cids[0]}, 100)
+		require.NoError(t, err)
+		require.Equal(t, 0, h.srv.BlockCalls())
+		err = h.transport.EventHandler.OnDataReceived(h.chid, cidlink.Link{Cid: cids[1]}, 100)
+		require.Equal(t, datatransfer.ErrPause, err)
+		require.Equal(t, 1, h.srv.BlockCalls())
+		require.Len(t, h.network.SentMessages, 1)
+		requirePausedVoucherResult(t, h.network.SentMessages[0].Message)
+		chst, err := h.dt.ChannelState(ctx, h.chid)
+		require.NoError(t, err)
+		require.Equal(t, datatransfer.ResponderPaused, chst.Status())
+	})
+
+	t.Run("pull request paused every block interval", func(t *testing.T) {
+		h := setup(t, datatransfer.RevalidationTrigger{Blocks: 2}, true)
+		h.srv.StubTriggerResult(true, testutil.NewFakeDTType(), datatransfer.ErrPause)
+		cids := testutil.GenerateCids(2)
+		msg, err := h.transport.EventHandler.OnDataQueued(h.chid, cidlink.Link{Cid: cids[0]}, 100)
+		require.NoError(t, err)
+		require.Nil(t, msg)
+		msg, err = h.transport.EventHandler.OnDataQueued(h.chid, cidlink.Link{Cid: cids[1]}, 100)
+		require.Equal(t, datatransfer.ErrPause, err)
+		requirePausedVoucherResult(t, msg)
+		require.Equal(t, 1, h.srv.BlockCalls())
+	})
+
+	t.Run("block interval counts each block once", func(t *testing.T) {
+		h := setup(t, datatransfer.RevalidationTrigger{Blocks: 2}, true)
+		h.srv.StubTriggerResult(true, testutil.NewFakeDTType(), datatransfer.ErrPause)
+		cids := testutil.GenerateCids(2)
+		for i := 0; i < 2; i++ {
+			_, err := h.transport.EventHandler.OnDataQueued(h.chid, cidlink.Link{Cid: cids[0]}, 100)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 0, h.srv.BlockCalls())
+		_, err := h.transport.EventHandler.OnDataQueued(h.chid, cidlink.Link{Cid: cids[1]}, 100)
+		require.Equal(t, datatransfer.ErrPause, err)
+		require.Equal(t, 1, h.srv.BlockCalls())
+	})
+
+	t.Run("block interval carries on across a restart", func(t *testing.T) {
+		ds := dss.MutexWrap(datastore.NewMapDatastore())
+		trigger := datatransfer.RevalidationTrigger{Blocks: 2}
+		h := setupWith(t, ds, trigger, false)
+		cids := testutil.GenerateCids(2)
+		require.NoError(t, h.transport.EventHandler.OnDataReceived(h.chid, cidlink.Link{Cid: cids[0]}, 100))
+		require.Equal(t, 0, h.srv.BlockCalls())
+		require.NoError(t, h.dt.Stop(ctx))
+
+		restarted := start(t, ds, trigger)
+		restarted.srv.StubTriggerResult(true, testutil.NewFakeDTType(), datatransfer.ErrPause)
+		err := restarted.transport.EventHandler.OnDataReceived(h.chid, cidlink.Link{Cid: cids[1]}, 100)
+		require.Equal(t, datatransfer.ErrPause, err)
+		require.Equal(t, 1, restarted.srv.BlockCalls())
+	})
+
+	t.Run("time interval pauses until revalidated", func(t *testing.T) {
+		h := setup(t, datatransfer.RevalidationTrigger{Interval: 20 * time.Millisecond}, false)
+		h.srv.StubTriggerResult(true, testutil.NewFakeDTType(), datatransfer.ErrPause)
+		require.Eventually(t, func() bool {
+			chst, err := h.dt.ChannelState(ctx, h.chid)
+			require.NoError(t, err)
+			return chst.Status() == datatransfer.ResponderPaused && len(h.network.SentMessages) == 1
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, []datatransfer.ChannelID{h.chid}, h.transport.PausedChannels)
+		requirePausedVoucherResult(t, h.network.SentMessages[0].Message)
+
+		// the interval is not counted while the request is paused
+		time.Sleep(100 * time.Millisecond)
+		require.Equal(t, 1, h.srv.IntervalCalls())
+
+		h.srv.StubTriggerResult(true, nil, nil)
+		update, err := message.VoucherRequest(h.chid.ID, voucher.Type(), testutil.NewFakeDTType())
+		require.NoError(t, err)
+		_, err = h.transport.EventHandler.OnRequestReceived(h.chid, update)
+		require.Equal(t, datatransfer.ErrResume, err)
+		require.Eventually(t, func() bool {
+			return h.srv.IntervalCalls() > 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("time interval stops if request is not handled", func(t *testing.T) {
+		h := setup(t, datatransfer.RevalidationTrigger{Interval: 10 * time.Millisecond}, false)
+		h.srv.StubTriggerResult(false, nil, nil)
+		require.Eventually(t, func() bool {
+			return h.srv.IntervalCalls() == 1
+		}, time.Second, 10*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		require.Equal(t, 1, h.srv.IntervalCalls())
+	})
+}
+
+func TestTotalSizeOnAcceptAndRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	gsData := testutil.NewGraphsyncTestingData(ctx, t, nil, nil)
+	root, _ := testutil.LoadUnixFSFile(ctx, t, gsData.DagService1, loremFile)
+	baseCid := root.(cidlink.Link).Cid
+	peers := testutil.GeneratePeers(2)
+	chid := channelID(datatransfer.TransferID(rand.Int31()), peers)
+
+	network := testutil.NewFakeNetwork(peers[0])
+	dt, err := NewDataTransfer(dss.MutexWrap(datastore.NewMapDatastore()), os.TempDir(), network, testutil.NewFakeTransport(),
+		ComputeTotalSize(gsData.LinkSystem1, 0))
+	require.NoError(t, err)
+	testutil.StartAndWaitForReady(ctx, t, dt)
+	sv := testutil.NewStubbedValidator()
+	sv.ExpectSuccessPull()
+	require.NoError(t, dt.RegisterVoucherType(&testutil.FakeDTType{}, sv))
+
+	// the pull request is paused while the total size is computed in the
+	// background, then accepted with a response giving the total
+	voucher := testutil.NewFakeDTType()
+	request, err := message.NewRequest(chid.ID, false, true, voucher.Type(), voucher, baseCid, gsData.AllSelector)
+	require.NoError(t, err)
+	response, err := dt.(datatransfer.EventsHandler).OnRequestReceived(chid, request)
+	require.Equal(t, datatransfer.ErrPause, err)
+	require.Nil(t, response)
+	var chst datatransfer.ChannelState
+	require.Eventually(t, func() bool {
+		chst, err = dt.ChannelState(ctx, chid)
+		require.NoError(t, err)
+		return chst.Status() == datatransfer.Ongoing
+	}, 5*time.Second, 10*time.Millisecond)
+	totalBlocks, totalBytes := chst.TotalBlocks(), chst.TotalSize()
+	require.NotZero(t, totalBlocks)
+	require.NotZero(t, totalBytes)
+
+	// the total size recorded for the channel is given on the response to a
+	// restart, without computing it again
+	sv.ExpectSuccessPull()
+	restart, err := message.NewRequest(chid.ID, true, true, voucher.Type(), voucher, baseCid, gsData.AllSelector)
+	require.NoError(t, err)
+	response, err = dt.(datatransfer.EventsHandler).OnRequestReceived(chid, restart)
+	require.NoError(t, err)
+	require.True(t, response.IsRestart())
+	restartBlocks, restartBytes := response.TotalSize()
+	require.Equal(t, totalBlocks, restartBlocks)
+	require.Equal(t, totalBytes, restartBytes)
+}
+
+func TestTotalSizeOnlyFromSender(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+	baseCid := testutil.GenerateCids(1)[0]
+	stor := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	voucher := testutil.NewFakeDTType()
+
+	network := testutil.NewFakeNetwork(peers[0])
+	dt, err := NewDataTransfer(dss.MutexWrap(datastore.NewMapDatastore()), os.TempDir(), network, testutil.NewFakeTransport())
+	require.NoError(t, err)
+	testutil.StartAndWaitForReady(ctx, t, dt)
+	require.NoError(t, dt.RegisterVoucherType(&testutil.FakeDTType{}, testutil.NewStubbedValidator()))
+
+	acceptWithTotalSize := func(chid datatransfer.ChannelID) datatransfer.ChannelState {
+		response, err := message.NewResponse(chid.ID, true, false, datatransfer.EmptyTypeIdentifier, nil)
+		require.NoError(t, err)
+		response, err = message.ResponseWithTotalSize(response, 12, 3456)
+		require.NoError(t, err)
+		require.NoError(t, dt.(datatransfer.EventsHandler).OnResponseReceived(chid, response))
+		chst, err := dt.ChannelState(ctx, chid)
+		require.NoError(t, err)
+		require.Equal(t, datatransfer.Ongoing, chst.Status())
+		return chst
+	}
+
+	// the responder sends the data on a pull, so its total size is recorded
+	pull, err := dt.OpenPullDataChannel(ctx, peers[1], voucher, baseCid, stor)
+	require.NoError(t, err)
+	chst := acceptWithTotalSize(pull)
+	require.Equal(t, uint64(12), chst.TotalBlocks())
+	require.Equal(t, uint64(3456), chst.TotalSize())
+
+	// the responder receives the data on a push, so its total size is ignored
+	push, err := dt.OpenPushDataChannel(ctx, peers[1], voucher, baseCid, stor)
+	require.NoError(t, err)
+	chst = acceptWithTotalSize(push)
+	require.Zero(t, chst.TotalBlocks())
+	require.Zero(t, chst.TotalSize())
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"golang.org/x/xerrors"
@@ -73,7 +75,8 @@ func (m *manager) validateRestartVoucher(channel datatransfer.ChannelState, isPu
 	}
 
 	// revalidate the voucher by reconstructing the request that would have led to the creation of this channel
-	if _, _, err := m.validateVoucher(channel.OtherPeer(), req, isPull, channel.BaseCID(), channel.Selector()); err != nil {
+	capabilities, _ := m.PeerCapabilities(channel.OtherPeer())
+	if _, _, _, err := m.validateVoucher(chid, req, true, capabilities, channel.Selector()); err != nil {
 		return err
 	}
 
@@ -92,11 +95,15 @@ func (m *manager) openPushRestartChannel(ctx context.Context, channel datatransf
 		return err
 	}
 
+	if err := m.reuseStore(chid); err != nil {
+		return xerrors.Errorf("unable to use store for channel %s: %w", chid, err)
+	}
 	processor, has := m.transportConfigurers.Processor(voucher.Type())
 	if has {
 		transportConfigurer := processor.(datatransfer.TransportConfigurer)
 		transportConfigurer(chid, voucher, m.transport)
 	}
+	req = m.requestWithTotalSize(chid, req)
 	m.dataTransferNetwork.Protect(requestTo, chid.String())
 
 	log.Infof("sending push restart channel to %s for channel %s", requestTo, chid)
@@ -119,6 +126,9 @@ func (m *manager) openPullRestartChannel(ctx context.Context, channel datatransf
 		return err
 	}
 
+	if err := m.reuseStore(chid); err != nil {
+		return xerrors.Errorf("unable to use store for channel %s: %w", chid, err)
+	}
 	processor, has := m.transportConfigurers.Processor(voucher.Type())
 	if has {
 		transportConfigurer := processor.(datatransfer.TransportConfigurer)
@@ -127,13 +137,39 @@ func (m *manager) openPullRestartChannel(ctx context.Context, channel datatransf
 	m.dataTransferNetwork.Protect(requestTo, chid.String())
 
 	log.Infof("sending open channel to %s to restart channel %s", requestTo, chid)
-	if err := m.transport.OpenChannel(ctx, requestTo, chid, cidlink.Link{Cid: baseCid}, selector, channel.ReceivedCids(), req); err != nil {
+	if err := m.openRestartedChannel(ctx, requestTo, chid, cidlink.Link{Cid: baseCid}, selector, channel, req); err != nil {
 		return xerrors.Errorf("Unable to send open channel restart request: %w", err)
 	}
 
 	return nil
 }
 
+// openRestartedChannel opens a channel on the transport, asking the sender not
+// to send the cids already received on it. If the transport supports it the
+// received cids are streamed to it from the channel's cid list rather than
+// read into memory first. As with ReceivedCids, failing to read the list is
+// only logged, and the channel is opened with the cids read up to that point.
+func (m *manager) openRestartedChannel(ctx context.Context, dataSender peer.ID, chid datatransfer.ChannelID, root ipld.Link, selector ipld.Node, channel datatransfer.ChannelState, msg datatransfer.Message) error {
+	if iterTransport, ok := m.transport.(datatransfer.DoNotSendIterTransport); ok {
+		receivedCids := func(fn func(cid.Cid) error) error {
+			var fnErr error
+			err := channel.ReceivedCidsIter(func(c cid.Cid) error {
+				fnErr = fn(c)
+				return fnErr
+			})
+			if fnErr != nil {
+				return fnErr
+			}
+			if err != nil {
+				log.Errorf("channel %s: reading received cids: %s", chid, err)
+			}
+			return nil
+		}
+		return iterTransport.OpenChannelIter(ctx, dataSender, chid, root, selector, receivedCids, msg)
+	}
+	return m.transport.OpenChannel(ctx, dataSender, chid, root, selector, channel.ReceivedCids(), msg)
+}
+
 func (m *manager) validateRestartRequest(ctx context.Context, otherPeer peer.ID, chid datatransfer.ChannelID, req datatransfer.Request) error {
 	// channel should exist
 	channel, err := m.channels.GetByID(ctx, chid)
@@ -146,6 +182,11 @@ func (m *manager) validateRestartRequest(ctx context.Context, otherPeer peer.ID,
 		return xerrors.New("channel is already terminated")
 	}
 
+	// channel must have finished validation before it was interrupted
+	if channel.Status() == datatransfer.Validating {
+		return xerrors.New("channel has not been validated")
+	}
+
 	// channel initator should be the sender peer
 	if channel.ChannelID().Initiator != otherPeer {
 		return xerrors.New("other peer is not the initiator of the channel")
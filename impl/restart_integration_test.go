@@ -18,6 +18,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	. "github.com/filecoin-project/go-data-transfer/impl"
 	"github.com/filecoin-project/go-data-transfer/testutil"
+	gstransport "github.com/filecoin-project/go-data-transfer/transport/graphsync"
 )
 
 const totalIncrements = 204
@@ -264,6 +265,42 @@ func TestRestartPull(t *testing.T) {
 				require.NoError(rh.t, rh.dt2.RestartDataTransferChannel(rh.testCtx, chId))
 			},
 		},
+		"Restart peer create pull with a do not send filter": {
+			stopAt: 40,
+			openPullF: func(rh *restartHarness) datatransfer.ChannelID {
+				voucher := testutil.FakeDTType{Data: "applesauce"}
+				chid, err := rh.dt2.OpenPullDataChannel(rh.testCtx, rh.peer1, &voucher, rh.rootCid, rh.gsData.AllSelector)
+				require.NoError(rh.t, err)
+				return chid
+			},
+			restartF: func(rh *restartHarness, chId datatransfer.ChannelID, subscriber datatransfer.Subscriber) {
+				var err error
+				// the sender can only skip blocks matching the filter if it
+				// knows the store they are read from
+				require.NoError(t, rh.dt1.Stop(rh.testCtx))
+				tp1 := rh.gsData.SetupGSTransportHost1(gstransport.DefaultStore(rh.gsData.LinkSystem1))
+				rh.dt1, err = NewDataTransfer(rh.gsData.DtDs1, rh.gsData.TempDir1, rh.gsData.DtNet1, tp1)
+				require.NoError(rh.t, err)
+				require.NoError(rh.t, rh.dt1.RegisterVoucherType(&testutil.FakeDTType{}, rh.sv))
+				testutil.StartAndWaitForReady(rh.testCtx, t, rh.dt1)
+				rh.dt1.SubscribeToEvents(subscriber)
+
+				// send most of the received cids in a filter with a high
+				// rate of false positives, so some blocks are requested again
+				require.NoError(t, rh.dt2.Stop(rh.testCtx))
+				time.Sleep(100 * time.Millisecond)
+				tp2 := rh.gsData.SetupGSTransportHost2(
+					gstransport.DefaultStore(rh.gsData.LinkSystem2),
+					gstransport.MaxDoNotSendCids(10),
+					gstransport.DoNotSendFilterRate(0.2))
+				rh.dt2, err = NewDataTransfer(rh.gsData.DtDs2, rh.gsData.TempDir2, rh.gsData.DtNet2, tp2)
+				require.NoError(rh.t, err)
+				require.NoError(rh.t, rh.dt2.RegisterVoucherType(&testutil.FakeDTType{}, rh.sv))
+				testutil.StartAndWaitForReady(rh.testCtx, t, rh.dt2)
+				rh.dt2.SubscribeToEvents(subscriber)
+				require.NoError(rh.t, rh.dt2.RestartDataTransferChannel(rh.testCtx, chId))
+			},
+		},
 		"Restart peer receive pull": {
 			stopAt: 40,
 			openPullF: func(rh *restartHarness) datatransfer.ChannelID {
@@ -0,0 +1,172 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/registry"
+)
+
+// triggeredRevalidators returns the registered revalidators that are
+// triggered by block counts or elapsed time
+func (m *manager) triggeredRevalidators() []datatransfer.TriggeredRevalidator {
+	var triggered []datatransfer.TriggeredRevalidator
+	_ = m.revalidators.Each(func(_ datatransfer.TypeIdentifier, _ encoding.Decoder, processor registry.Processor) error {
+		if revalidator, ok := processor.(datatransfer.TriggeredRevalidator); ok {
+			triggered = append(triggered, revalidator)
+		}
+		return nil
+	})
+	return triggered
+}
+
+// blockTransferred is called once a block queued or received for a request
+// this node responds to has been recorded on the channel. If the block was
+// new, it calls the revalidators whose block interval the channel's block
+// count completes, until one handles the request. The count is read from the
+// channel state, so intervals carry on across restarts of the manager. Its
+// result is used only if the byte based hooks did not already pause or
+// terminate the request.
+func (m *manager) blockTransferred(chid datatransfer.ChannelID, isNew bool) (datatransfer.VoucherResult, error) {
+	if !isNew {
+		return nil, nil
+	}
+	triggered := m.triggeredRevalidators()
+	if len(triggered) == 0 {
+		return nil, nil
+	}
+
+	chst, err := m.channels.GetByID(context.TODO(), chid)
+	if err != nil {
+		return nil, err
+	}
+	blocks := chst.QueuedBlocks()
+	if chst.Sender() != m.peerID {
+		blocks = chst.ReceivedBlocks()
+	}
+
+	for _, revalidator := range triggered {
+		trigger := revalidator.RevalidationTrigger()
+		if trigger.Blocks == 0 || blocks%trigger.Blocks != 0 {
+			continue
+		}
+		handled, result, err := revalidator.OnBlocksTransferred(chid, trigger.Blocks)
+		if handled {
+			return result, err
+		}
+	}
+	return nil, nil
+}
+
+// startRevalidationTimers starts calling the revalidators triggered by
+// elapsed time for a request this node responds to, if they are not running
+// for it already
+func (m *manager) startRevalidationTimers(chid datatransfer.ChannelID) {
+	triggered := m.triggeredRevalidators()
+
+	m.revalidationLk.Lock()
+	defer m.revalidationLk.Unlock()
+	if _, running := m.revalidationTimers[chid]; running {
+		return
+	}
+	var ctx context.Context
+	for _, revalidator := range triggered {
+		interval := revalidator.RevalidationTrigger().Interval
+		if interval <= 0 {
+			continue
+		}
+		if ctx == nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(context.Background())
+			m.revalidationTimers[chid] = cancel
+		}
+		go m.runRevalidationTimer(ctx, chid, revalidator, interval)
+	}
+}
+
+// runRevalidationTimer calls a revalidator each time the interval elapses
+// while data is transferring for the request, until the request ends or the
+// revalidator does not handle it
+func (m *manager) runRevalidationTimer(ctx context.Context, chid datatransfer.ChannelID, revalidator datatransfer.TriggeredRevalidator, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		chst, err := m.channels.GetByID(ctx, chid)
+		if err != nil {
+			log.Warnf("channel %s: stopping time based revalidation: %s", chid, err)
+			return
+		}
+		if channels.IsChannelTerminated(chst.Status()) {
+			return
+		}
+		if chst.Status() != datatransfer.Ongoing {
+			continue
+		}
+
+		handled, result, err := revalidator.OnIntervalElapsed(chid, interval)
+		if !handled {
+			return
+		}
+		if err == nil && result == nil {
+			continue
+		}
+		if err := m.processTriggeredRevalidation(ctx, chid, result, err); err != nil {
+			log.Errorf("channel %s: processing time based revalidation: %s", chid, err)
+			return
+		}
+	}
+}
+
+// processTriggeredRevalidation acts on the result of a revalidation that
+// happened outside of a transport hook: the request is paused on the
+// transport or terminated as the revalidator asked, and the voucher result is
+// sent to the initiator
+func (m *manager) processTriggeredRevalidation(ctx context.Context, chid datatransfer.ChannelID, result datatransfer.VoucherResult, resultErr error) error {
+	msg, err := m.processRevalidationResult(chid, result, resultErr)
+	switch {
+	case err == nil || errors.Is(err, datatransfer.ErrResume):
+	case errors.Is(err, datatransfer.ErrPause):
+		if pausable, ok := m.transport.(datatransfer.PauseableTransport); ok {
+			if err := pausable.PauseChannel(ctx, chid); err != nil {
+				log.Warnf("channel %s: pausing for revalidation: %s", chid, err)
+			}
+		}
+	default:
+		return m.CloseDataTransferChannelWithError(ctx, chid, err)
+	}
+	if msg != nil {
+		return m.dataTransferNetwork.SendMessage(ctx, chid.Initiator, msg)
+	}
+	return nil
+}
+
+// forgetRevalidation stops the revalidation timers of a request, once it is
+// cleaned up
+func (m *manager) forgetRevalidation(chid datatransfer.ChannelID) {
+	m.revalidationLk.Lock()
+	defer m.revalidationLk.Unlock()
+	if cancel, running := m.revalidationTimers[chid]; running {
+		cancel()
+		delete(m.revalidationTimers, chid)
+	}
+}
+
+// stopRevalidationTimers stops the revalidation timers of all requests
+func (m *manager) stopRevalidationTimers() {
+	m.revalidationLk.Lock()
+	defer m.revalidationLk.Unlock()
+	for chid, cancel := range m.revalidationTimers {
+		cancel()
+		delete(m.revalidationTimers, chid)
+	}
+}
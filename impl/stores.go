@@ -0,0 +1,77 @@
+package impl
+
+import (
+	"github.com/ipld/go-ipld-prime"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// useStore tells the transport to use the given link system for the channel,
+// and remembers it so it can be applied again if the channel is restarted
+func (m *manager) useStore(chid datatransfer.ChannelID, lsys ipld.LinkSystem) error {
+	storeTransport, ok := m.transport.(datatransfer.StoreConfigurableTransport)
+	if !ok {
+		return datatransfer.ErrUnsupported
+	}
+	if err := storeTransport.UseStore(chid, lsys); err != nil {
+		return err
+	}
+	m.storesLk.Lock()
+	m.stores[chid] = lsys
+	m.storesLk.Unlock()
+	return nil
+}
+
+// channelOptions collects the options given when opening a channel
+func channelOptions(options []datatransfer.ChannelOption) datatransfer.ChannelOptions {
+	var co datatransfer.ChannelOptions
+	for _, option := range options {
+		option(&co)
+	}
+	return co
+}
+
+// applyChannelOptions applies the store chosen when opening a channel, leaving
+// the caller to act on the rest of the options
+func (m *manager) applyChannelOptions(chid datatransfer.ChannelID, co datatransfer.ChannelOptions) error {
+	if co.LinkSystem == nil {
+		return nil
+	}
+	if err := m.useStore(chid, *co.LinkSystem); err != nil {
+		return xerrors.Errorf("unable to use store for channel %s: %w", chid, err)
+	}
+	return nil
+}
+
+// reuseStore applies the store previously chosen for the channel, if any
+func (m *manager) reuseStore(chid datatransfer.ChannelID) error {
+	m.storesLk.RLock()
+	lsys, ok := m.stores[chid]
+	m.storesLk.RUnlock()
+	if !ok {
+		return nil
+	}
+	return m.useStore(chid, lsys)
+}
+
+// forgetStore drops the store chosen for the channel, once it is cleaned up
+func (m *manager) forgetStore(chid datatransfer.ChannelID) {
+	m.storesLk.Lock()
+	delete(m.stores, chid)
+	m.storesLk.Unlock()
+}
+
+// unwrapVoucherResult separates a store chosen by a validator from the
+// voucher result that is recorded and sent to the other peer
+func unwrapVoucherResult(result datatransfer.VoucherResult) (datatransfer.VoucherResult, *ipld.LinkSystem) {
+	withStore, ok := result.(*datatransfer.VoucherResultWithStore)
+	if !ok || withStore == nil {
+		return result, nil
+	}
+	lsys := withStore.LinkSystem
+	if lsys.StorageReadOpener == nil && lsys.StorageWriteOpener == nil {
+		return withStore.Result, nil
+	}
+	return withStore.Result, &lsys
+}
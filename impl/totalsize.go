@@ -0,0 +1,190 @@
+package impl
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync/ipldutil"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message"
+)
+
+// ComputeTotalSize tells the manager to walk the selector over the data it is
+// about to send on a channel and count the blocks and bytes that will be sent.
+// The counts are recorded in the channel state and given to the receiver in
+// the message that opens or accepts the channel, and again in the message that
+// restarts it. A push channel is opened once the walk completes. A pull
+// request is accepted in the background once the walk completes, as requests
+// validated asynchronously are.
+//
+// The walk reads from the store set for the channel if there is one, and from
+// the given link system otherwise. It is abandoned, leaving the total size
+// unknown, if a block is missing or if it visits more than maxBlocks blocks.
+// A maxBlocks of 0 means no limit.
+func ComputeTotalSize(lsys ipld.LinkSystem, maxBlocks uint64) DataTransferOption {
+	return func(m *manager) {
+		m.totalSizeLinkSystem = &lsys
+		m.totalSizeMaxBlocks = maxBlocks
+	}
+}
+
+// computesTotalSize returns true if the total size of the data a pull request
+// asks for is computed before the request is accepted
+func (m *manager) computesTotalSize(incoming datatransfer.Request) bool {
+	return m.totalSizeLinkSystem != nil && incoming.IsPull() && incoming.Capabilities().Has(datatransfer.CapabilityTotalSize)
+}
+
+// computeTotalSize computes the total size of the data to send on the
+// channel, if configured to, and records it. The data is read from the given
+// store if there is one, or else from the store set for the channel. It
+// returns whether the total size was recorded.
+func (m *manager) computeTotalSize(ctx context.Context, chid datatransfer.ChannelID, baseCid cid.Cid, selector ipld.Node, store *ipld.LinkSystem) bool {
+	if m.totalSizeLinkSystem == nil {
+		return false
+	}
+	lsys := *m.totalSizeLinkSystem
+	if store != nil {
+		lsys = *store
+	} else {
+		m.storesLk.RLock()
+		if chStore, ok := m.stores[chid]; ok {
+			lsys = chStore
+		}
+		m.storesLk.RUnlock()
+	}
+
+	totalBlocks, totalBytes, err := walkTotalSize(ctx, lsys, baseCid, selector, m.totalSizeMaxBlocks)
+	if err != nil {
+		log.Infof("not computing total size for channel %s: %s", chid, err)
+		return false
+	}
+	if err := m.channels.TotalSizeKnown(chid, totalBlocks, totalBytes); err != nil {
+		log.Errorf("recording total size for channel %s: %s", chid, err)
+		return false
+	}
+	return true
+}
+
+// knownTotalSize returns the total size recorded for a channel we send the
+// data on, or 0 if it is not known
+func (m *manager) knownTotalSize(chid datatransfer.ChannelID) (uint64, uint64) {
+	chst, err := m.channels.GetByID(context.TODO(), chid)
+	if err != nil || chst.Sender() != m.peerID {
+		return 0, 0
+	}
+	return chst.TotalBlocks(), chst.TotalSize()
+}
+
+// responseWithTotalSize adds the total size recorded for a pull channel to
+// the response accepting or restarting it, if it is known
+func (m *manager) responseWithTotalSize(chid datatransfer.ChannelID, response datatransfer.Response) datatransfer.Response {
+	if response == nil || !response.Accepted() {
+		return response
+	}
+	totalBlocks, totalBytes := m.knownTotalSize(chid)
+	if totalBlocks == 0 {
+		return response
+	}
+	withTotal, err := message.ResponseWithTotalSize(response, totalBlocks, totalBytes)
+	if err != nil {
+		log.Warnf("channel %s: sending total size: %s", chid, err)
+		return response
+	}
+	return withTotal
+}
+
+// requestWithTotalSize adds the total size recorded for a push channel to
+// the request opening or restarting it, if it is known
+func (m *manager) requestWithTotalSize(chid datatransfer.ChannelID, request datatransfer.Request) datatransfer.Request {
+	totalBlocks, totalBytes := m.knownTotalSize(chid)
+	if totalBlocks == 0 {
+		return request
+	}
+	withTotal, err := message.RequestWithTotalSize(request, totalBlocks, totalBytes)
+	if err != nil {
+		log.Warnf("channel %s: sending total size: %s", chid, err)
+		return request
+	}
+	return withTotal
+}
+
+// recordTotalSize records the total size given on a message that opens,
+// accepts or restarts a channel. Only the data sender knows the total size,
+// so a total size from the data receiver is ignored.
+func (m *manager) recordTotalSize(chid datatransfer.ChannelID, sender peer.ID, incoming datatransfer.Message) {
+	totalBlocks, totalBytes := incoming.TotalSize()
+	if totalBlocks == 0 {
+		return
+	}
+	chst, err := m.channels.GetByID(context.TODO(), chid)
+	if err != nil {
+		log.Warnf("channel %s: recording total size: %s", chid, err)
+		return
+	}
+	if chst.Sender() != sender {
+		log.Warnf("channel %s: ignoring total size from %s, which does not send the data", chid, sender)
+		return
+	}
+	if err := m.channels.TotalSizeKnown(chid, totalBlocks, totalBytes); err != nil {
+		log.Warnf("channel %s: recording total size: %s", chid, err)
+	}
+}
+
+// walkTotalSize traverses the selector from the root, loading every block it
+// reaches from the link system, and returns the number of distinct blocks and
+// their combined size. Duplicate blocks are only counted once, as they are only
+// sent once.
+func walkTotalSize(ctx context.Context, lsys ipld.LinkSystem, root cid.Cid, selector ipld.Node, maxBlocks uint64) (uint64, uint64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	traverser := ipldutil.TraversalBuilder{
+		Root:       cidlink.Link{Cid: root},
+		Selector:   selector,
+		LinkSystem: lsys,
+	}.Start(ctx)
+	defer traverser.Shutdown(context.Background())
+
+	seen := make(map[string]struct{})
+	var totalBytes uint64
+	for {
+		isComplete, err := traverser.IsComplete()
+		if isComplete {
+			if err != nil {
+				return 0, 0, err
+			}
+			return uint64(len(seen)), totalBytes, nil
+		}
+		lnk, lnkCtx := traverser.CurrentRequest()
+		reader, err := lsys.StorageReadOpener(lnkCtx, lnk)
+		if err != nil {
+			traverser.Error(err)
+			return 0, 0, xerrors.Errorf("loading block %s: %w", lnk, err)
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			traverser.Error(err)
+			return 0, 0, xerrors.Errorf("reading block %s: %w", lnk, err)
+		}
+		if _, ok := seen[lnk.String()]; !ok {
+			seen[lnk.String()] = struct{}{}
+			if maxBlocks != 0 && uint64(len(seen)) > maxBlocks {
+				traverser.Error(errTooManyBlocks)
+				return 0, 0, errTooManyBlocks
+			}
+			totalBytes += uint64(len(data))
+		}
+		if err := traverser.Advance(bytes.NewReader(data)); err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+var errTooManyBlocks = xerrors.New("too many blocks to compute total size")
@@ -30,11 +30,26 @@ var resumeTransportStatesResponder = statusList{
 	datatransfer.InitiatorPaused,
 }
 
+var responderPausedStates = statusList{
+	datatransfer.ResponderPaused,
+	datatransfer.BothPaused,
+}
+
 // newRequest encapsulates message creation
-func (m *manager) newRequest(ctx context.Context, selector ipld.Node, isPull bool, voucher datatransfer.Voucher, baseCid cid.Cid, to peer.ID) (datatransfer.Request, error) {
+func (m *manager) newRequest(ctx context.Context, selector ipld.Node, isPull bool, voucher datatransfer.Voucher, baseCid cid.Cid, to peer.ID, co datatransfer.ChannelOptions) (datatransfer.Request, error) {
 	// Generate a new transfer ID for the request
 	tid := datatransfer.TransferID(m.transferIDGen.next())
-	return message.NewRequest(tid, false, isPull, voucher.Type(), voucher, baseCid, selector)
+	capabilities := datatransfer.SupportedCapabilities
+	if co.SkipTotalSize {
+		// so the responder does not compute the total size of a pull
+		capabilities = make(datatransfer.Capabilities, len(datatransfer.SupportedCapabilities))
+		for capability := range datatransfer.SupportedCapabilities {
+			if capability != datatransfer.CapabilityTotalSize {
+				capabilities[capability] = struct{}{}
+			}
+		}
+	}
+	return message.NewRequestWithCapabilities(tid, false, isPull, voucher.Type(), voucher, baseCid, selector, capabilities)
 }
 
 func (m *manager) response(isRestart bool, isNew bool, err error, tid datatransfer.TransferID, voucherResult datatransfer.VoucherResult) (datatransfer.Response, error) {
@@ -129,6 +144,9 @@ func (m *manager) decodeVoucherResult(response datatransfer.Response) (datatrans
 func (m *manager) decodeVoucher(request datatransfer.Request, registry *registry.Registry) (datatransfer.Voucher, error) {
 	vtypStr := datatransfer.TypeIdentifier(request.VoucherType())
 	decoder, has := registry.Decoder(vtypStr)
+	if !has {
+		decoder, has = m.upgradingDecoder(vtypStr)
+	}
 	if !has {
 		return nil, xerrors.Errorf("unknown voucher type: %s", vtypStr)
 	}
@@ -136,5 +154,9 @@ func (m *manager) decodeVoucher(request datatransfer.Request, registry *registry
 	if err != nil {
 		return nil, err
 	}
-	return encodable.(datatransfer.Registerable), nil
+	vouch := encodable.(datatransfer.Registerable)
+	if _, has := registry.Decoder(vouch.Type()); !has {
+		return nil, xerrors.Errorf("unknown voucher type: %s (upgraded from %s)", vouch.Type(), vtypStr)
+	}
+	return vouch, nil
 }
@@ -0,0 +1,66 @@
+package impl
+
+import (
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+)
+
+// RegisterVoucherUpgrader registers a function that upgrades vouchers of an
+// older version of a voucher type to a newer version
+// returns error if:
+// * voucher type does not implement voucher
+// * there is an upgrader registered for an identical identifier
+func (m *manager) RegisterVoucherUpgrader(voucherType datatransfer.Voucher, upgrader datatransfer.VoucherUpgrader) error {
+	err := m.voucherUpgraders.Register(voucherType, upgrader)
+	if err != nil {
+		return xerrors.Errorf("error registering voucher upgrader: %w", err)
+	}
+	return nil
+}
+
+// upgradeVoucher runs the registered upgraders on a voucher until it reaches
+// a version with no upgrader. Each upgrader must produce a newer version of
+// the same type, so that upgrading always ends.
+func (m *manager) upgradeVoucher(voucher datatransfer.Voucher) (datatransfer.Voucher, error) {
+	for {
+		from := voucher.Type()
+		processor, has := m.voucherUpgraders.Processor(from)
+		if !has {
+			return voucher, nil
+		}
+		upgraded, err := processor.(datatransfer.VoucherUpgrader)(voucher)
+		if err != nil {
+			return nil, xerrors.Errorf("upgrading voucher of type %s: %w", from, err)
+		}
+		to := upgraded.Type()
+		if to.Name() != from.Name() || to.Version() <= from.Version() {
+			return nil, xerrors.Errorf("upgrading voucher of type %s produced type %s, which is not a newer version", from, to)
+		}
+		voucher = upgraded
+	}
+}
+
+// upgradingDecoder returns a decoder for a voucher type with a registered
+// upgrader, that upgrades the vouchers it decodes
+func (m *manager) upgradingDecoder(voucherType datatransfer.TypeIdentifier) (encoding.Decoder, bool) {
+	decoder, has := m.voucherUpgraders.Decoder(voucherType)
+	if !has {
+		return nil, false
+	}
+	return &voucherUpgradingDecoder{decoder, m.upgradeVoucher}, true
+}
+
+type voucherUpgradingDecoder struct {
+	decoder encoding.Decoder
+	upgrade func(datatransfer.Voucher) (datatransfer.Voucher, error)
+}
+
+func (d *voucherUpgradingDecoder) DecodeFromCbor(encoded []byte) (encoding.Encodable, error) {
+	decoded, err := d.decoder.DecodeFromCbor(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return d.upgrade(decoded.(datatransfer.Voucher))
+}
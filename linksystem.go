@@ -0,0 +1,47 @@
+package datatransfer
+
+import (
+	"io"
+
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// Loader is the loader function signature used before ipld-prime introduced
+// LinkSystem.
+//
+// Deprecated: use ipld.LinkSystem and its StorageReadOpener instead.
+type Loader func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error)
+
+// StoreCommitter finishes storing a block written by a Storer.
+//
+// Deprecated: use ipld.BlockWriteCommitter instead.
+type StoreCommitter func(ipld.Link) error
+
+// Storer is the storer function signature used before ipld-prime introduced
+// LinkSystem.
+//
+// Deprecated: use ipld.LinkSystem and its StorageWriteOpener instead.
+type Storer func(lnkCtx ipld.LinkContext) (io.Writer, StoreCommitter, error)
+
+// LinkSystemForLoaderStorer builds a link system with the default CID
+// codecs and hashers on top of an existing loader / storer pair, so callers
+// that still have them can use APIs that take an ipld.LinkSystem.
+func LinkSystemForLoaderStorer(loader Loader, storer Storer) ipld.LinkSystem {
+	lsys := cidlink.DefaultLinkSystem()
+	if loader != nil {
+		lsys.StorageReadOpener = func(lnkCtx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+			return loader(lnk, lnkCtx)
+		}
+	}
+	if storer != nil {
+		lsys.StorageWriteOpener = func(lnkCtx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+			w, committer, err := storer(lnkCtx)
+			if err != nil {
+				return nil, nil, err
+			}
+			return w, ipld.BlockWriteCommitter(committer), nil
+		}
+	}
+	return lsys
+}
@@ -0,0 +1,77 @@
+package datatransfer_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+func TestLinkSystemForLoaderStorer(t *testing.T) {
+	blocks := make(map[ipld.Link][]byte)
+	loader := func(lnk ipld.Link, _ ipld.LinkContext) (io.Reader, error) {
+		data, ok := blocks[lnk]
+		if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return bytes.NewReader(data), nil
+	}
+	storer := func(ipld.LinkContext) (io.Writer, datatransfer.StoreCommitter, error) {
+		var buf bytes.Buffer
+		return &buf, func(lnk ipld.Link) error {
+			blocks[lnk] = buf.Bytes()
+			return nil
+		}, nil
+	}
+
+	node, err := qp.BuildMap(basicnode.Prototype.Any, 2, func(ma ipld.MapAssembler) {
+		qp.MapEntry(ma, "name", qp.String("block"))
+		qp.MapEntry(ma, "size", qp.Int(42))
+	})
+	require.NoError(t, err)
+
+	lsys := datatransfer.LinkSystemForLoaderStorer(loader, storer)
+	linkPrototype := cidlink.LinkPrototype{Prefix: cid.Prefix{
+		Version:  1,
+		Codec:    cid.DagCBOR,
+		MhType:   multihash.SHA2_256,
+		MhLength: -1,
+	}}
+	lnk, err := lsys.Store(ipld.LinkContext{}, linkPrototype, node)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+
+	loaded, err := lsys.Load(ipld.LinkContext{}, lnk, basicnode.Prototype.Any)
+	require.NoError(t, err)
+	requireSameNode(t, loaded)
+
+	// WithLoaderStorer gives the channel a link system over the same pair
+	var co datatransfer.ChannelOptions
+	datatransfer.WithLoaderStorer(loader, storer)(&co)
+	require.NotNil(t, co.LinkSystem)
+	loaded, err = co.LinkSystem.Load(ipld.LinkContext{}, lnk, basicnode.Prototype.Any)
+	require.NoError(t, err)
+	requireSameNode(t, loaded)
+}
+
+func requireSameNode(t *testing.T, node ipld.Node) {
+	name, err := node.LookupByString("name")
+	require.NoError(t, err)
+	nameStr, err := name.AsString()
+	require.NoError(t, err)
+	require.Equal(t, "block", nameStr)
+	size, err := node.LookupByString("size")
+	require.NoError(t, err)
+	sizeInt, err := size.AsInt()
+	require.NoError(t, err)
+	require.EqualValues(t, 42, sizeInt)
+}
@@ -2,6 +2,7 @@ package datatransfer
 
 import (
 	"context"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
@@ -25,6 +26,76 @@ type RequestValidator interface {
 		selector ipld.Node) (VoucherResult, error)
 }
 
+// ValidationRequest is a request to be validated by a RequestValidatorV2
+type ValidationRequest struct {
+	// ChannelID is the ID of the channel the request opens or restarts
+	ChannelID ChannelID
+	// Peer is the other party to the request: the peer that will send data
+	// for a push request, or the peer that will receive data for a pull
+	// request
+	Peer peer.ID
+	// IsPull is true for pull requests and false for push requests
+	IsPull bool
+	// IsRestart is true if the request restarts an existing channel
+	IsRestart bool
+	// Voucher is the voucher sent with the request
+	Voucher Voucher
+	// BaseCid is the root of the data to transfer
+	BaseCid cid.Cid
+	// Selector selects the data to transfer, after the selector policy of
+	// the voucher type is applied
+	Selector ipld.Node
+	// Message is the request message, for details of the request not
+	// covered by the fields above
+	Message Request
+	// Capabilities are the capabilities the other party advertised
+	Capabilities Capabilities
+}
+
+// RequestValidatorV2 validates requests with the full details of the request.
+// The context passed to it is cancelled once the validation timeout passes.
+// Validators implementing RequestValidator can be used as a
+// RequestValidatorV2 with validators.Adapt.
+type RequestValidatorV2 interface {
+	// ValidatePushRequest validates a push request received from the peer
+	// that will send data
+	ValidatePushRequest(ctx context.Context, request ValidationRequest) (VoucherResult, error)
+	// ValidatePullRequest validates a pull request received from the peer
+	// that will receive data
+	ValidatePullRequest(ctx context.Context, request ValidationRequest) (VoucherResult, error)
+}
+
+// ValidationCallback completes the validation of a request by an
+// AsyncRequestValidator, with the result and error a RequestValidator would
+// return
+type ValidationCallback func(result VoucherResult, err error)
+
+// AsyncRequestValidator is a request validator that validates requests
+// asynchronously, such as by checking a chain or a database. While it
+// validates a request, the channel is in the Validating status. If it does
+// not call back before the validation timeout, the request is rejected with
+// ErrValidationTimedOut.
+type AsyncRequestValidator interface {
+	// ValidatePushAsync starts validating a push request received from the
+	// peer that will send data, calling done once validated
+	ValidatePushAsync(
+		chid ChannelID,
+		sender peer.ID,
+		voucher Voucher,
+		baseCid cid.Cid,
+		selector ipld.Node,
+		done ValidationCallback)
+	// ValidatePullAsync starts validating a pull request received from the
+	// peer that will receive data, calling done once validated
+	ValidatePullAsync(
+		chid ChannelID,
+		receiver peer.ID,
+		voucher Voucher,
+		baseCid cid.Cid,
+		selector ipld.Node,
+		done ValidationCallback)
+}
+
 // Revalidator is a request validator revalidates in progress requests
 // by requesting request additional vouchers, and resuming when it receives them
 type Revalidator interface {
@@ -57,6 +128,133 @@ type Revalidator interface {
 	OnComplete(chid ChannelID) (bool, VoucherResult, error)
 }
 
+// RevalidationTrigger configures when the manager calls a
+// TriggeredRevalidator, in addition to the byte based hooks of Revalidator
+type RevalidationTrigger struct {
+	// Blocks calls OnBlocksTransferred each time this many more blocks are
+	// sent for a pull request or received for a push request. Blocks are
+	// counted once each, using the counts kept in the channel state, so a
+	// restart does not reset the count. 0 disables block based revalidation.
+	Blocks uint64
+	// Interval calls OnIntervalElapsed each time this much time passes on a
+	// channel that is transferring data. 0 disables time based revalidation.
+	Interval time.Duration
+}
+
+// TriggeredRevalidator is a Revalidator that also revalidates requests as
+// blocks are transferred or as time passes, such as to charge per block or
+// per minute. Its hooks are interpreted like the hooks of Revalidator: they
+// return whether the request was handled by this revalidator, and a
+// VoucherResult + ErrPause to pause the request until a new voucher is
+// received, nil to continue uninterrupted, or another error to terminate the
+// request.
+type TriggeredRevalidator interface {
+	Revalidator
+	// RevalidationTrigger returns when to call the revalidator's hooks
+	RevalidationTrigger() RevalidationTrigger
+	// OnBlocksTransferred is called on the responder side each time the
+	// configured number of blocks are transferred for a request
+	OnBlocksTransferred(chid ChannelID, additionalBlocks uint64) (bool, VoucherResult, error)
+	// OnIntervalElapsed is called on the responder side each time the
+	// configured interval passes for a request, unless the request is paused
+	// or otherwise not transferring data at that time. If the request is not
+	// handled, the revalidator is not called again for the request.
+	OnIntervalElapsed(chid ChannelID, elapsed time.Duration) (bool, VoucherResult, error)
+}
+
+// ChannelMessageHandler handles application messages of a registered type
+// received on open channels
+type ChannelMessageHandler interface {
+	// HandleChannelMessage handles a message received from the other party of
+	// the channel. Returning an error leaves the message unacknowledged, so
+	// the sender sends it again. Messages can be received more than once.
+	HandleChannelMessage(chid ChannelID, msg ChannelMessage) error
+}
+
+// SelectorPolicy checks the selector of a request received by this node
+// before it is passed to the RequestValidator. It returns the selector to
+// validate and use for the channel, which may be rewritten to narrow the
+// request, or an error to reject it. A rewritten selector only narrows push
+// requests, since on a pull the requestor traverses its own selector, so
+// policies should reject pull requests they would otherwise rewrite.
+type SelectorPolicy interface {
+	ApplyPolicy(isPull bool, selector ipld.Node) (ipld.Node, error)
+}
+
+// BlockValidator checks blocks received on a channel, e.g. to refuse
+// blocklisted CIDs, unexpected codecs or oversized blocks. It can return:
+// - nil to accept the block
+// - an error wrapping ErrSkipBlock to discard the block without stopping the transfer
+// - an error wrapping ErrPause to pause the channel, until it is resumed with
+//   ResumeDataTransferChannel
+// - any other error to fail the channel
+// The error message is recorded as the channel message.
+type BlockValidator interface {
+	ValidateBlock(chst ChannelState, link ipld.Link, size uint64) error
+}
+
+// VoucherResultWithStore can be returned by a RequestValidator in place of a
+// plain VoucherResult to choose the store the responder uses for the channel.
+// Only the wrapped Result (which may be nil) is recorded and sent to the
+// other peer. Choosing a store requires a StoreConfigurableTransport.
+type VoucherResultWithStore struct {
+	Result     VoucherResult
+	LinkSystem ipld.LinkSystem
+}
+
+// Type returns the type of the wrapped result
+func (vr *VoucherResultWithStore) Type() TypeIdentifier {
+	if vr.Result == nil {
+		return EmptyTypeIdentifier
+	}
+	return vr.Result.Type()
+}
+
+// ChannelOptions are optional settings for a channel opened by this node
+type ChannelOptions struct {
+	// LinkSystem, if set, is used by the transport to read and write blocks
+	// for the channel instead of its default store. It is kept in memory only
+	// and is used again if the channel is restarted.
+	LinkSystem *ipld.LinkSystem
+	// SkipTotalSize, if set, stops the total size of the data on the channel
+	// being computed: by this node when it sends the data on a push channel,
+	// and by the responder when it sends the data on a pull channel, as the
+	// request does not advertise CapabilityTotalSize. It is meant for DAGs
+	// too large to walk.
+	SkipTotalSize bool
+}
+
+// ChannelOption sets an option on a channel being opened
+type ChannelOption func(*ChannelOptions)
+
+// WithStore tells the transport to use the given link system for the
+// channel being opened. It requires a StoreConfigurableTransport.
+func WithStore(lsys ipld.LinkSystem) ChannelOption {
+	return func(co *ChannelOptions) {
+		co.LinkSystem = &lsys
+	}
+}
+
+// WithLoaderStorer is WithStore for callers that still have a loader /
+// storer pair, which it adapts with LinkSystemForLoaderStorer.
+//
+// Deprecated: use WithStore instead.
+func WithLoaderStorer(loader Loader, storer Storer) ChannelOption {
+	return WithStore(LinkSystemForLoaderStorer(loader, storer))
+}
+
+// WithoutTotalSize opens the channel without computing the total size of the
+// data sent on it, whichever side sends it
+func WithoutTotalSize() ChannelOption {
+	return func(co *ChannelOptions) {
+		co.SkipTotalSize = true
+	}
+}
+
+// VoucherUpgrader converts a voucher of an older version of a voucher type to
+// a newer version of the same type
+type VoucherUpgrader func(voucher Voucher) (Voucher, error)
+
 // TransportConfigurer provides a mechanism to provide transport specific configuration for a given voucher type
 type TransportConfigurer func(chid ChannelID, voucher Voucher, transport Transport)
 
@@ -77,36 +275,96 @@ type Manager interface {
 	Stop(ctx context.Context) error
 
 	// RegisterVoucherType registers a validator for the given voucher type
-	// will error if voucher type does not implement voucher
-	// or if there is a voucher type registered with an identical identifier
+	// will error if voucher type does not implement voucher, or if a
+	// different Go type is already registered with the same voucher type.
+	// Registering more validators for a type adds them to the type's chain of
+	// validators, which must all accept a request. Validators combined in
+	// other ways can be registered as a single chain from the validators
+	// package.
 	RegisterVoucherType(voucherType Voucher, validator RequestValidator) error
 
+	// RegisterRequestValidator registers a validator run on requests with any
+	// voucher type, such as a peer allowlist. Validators registered this way
+	// run in the order they are registered, before the validators for the
+	// voucher's type, and must all accept a request. Returns an error if
+	// the validator is nil.
+	RegisterRequestValidator(validator RequestValidator) error
+
+	// RegisterVoucherTypeV2 is RegisterVoucherType for a RequestValidatorV2
+	RegisterVoucherTypeV2(voucherType Voucher, validator RequestValidatorV2) error
+
+	// RegisterRequestValidatorV2 is RegisterRequestValidator for a
+	// RequestValidatorV2
+	RegisterRequestValidatorV2(validator RequestValidatorV2) error
+
+	// RegisterVoucherUpgrader registers a function that upgrades vouchers of
+	// an older version of a voucher type to a newer version. Vouchers of the
+	// older version in requests and stored channels are upgraded, through as
+	// many upgraders as needed, before they are used.
+	RegisterVoucherUpgrader(voucherType Voucher, upgrader VoucherUpgrader) error
+
+	// RegisterAsyncVoucherType registers a validator that validates requests
+	// with the given voucher type asynchronously. Asynchronous validators run
+	// in the order they are registered, once the synchronous validators accept
+	// a request, and must all accept it. A synchronous validator must also be
+	// registered for the type, or its requests are rejected.
+	RegisterAsyncVoucherType(voucherType Voucher, validator AsyncRequestValidator) error
+
+	// RegisterSelectorPolicy registers a policy applied to the selectors of
+	// requests with the given voucher type, before they are validated
+	RegisterSelectorPolicy(voucherType Voucher, policy SelectorPolicy) error
+
 	// RegisterRevalidator registers a revalidator for the given voucher type
 	// Note: this is the voucher type used to revalidate. It can share a name
 	// with the initial validator type and CAN be the same type, or a different type.
 	// The revalidator can simply be the sampe as the original request validator,
 	// or a different validator that satisfies the revalidator interface.
+	// Revalidators implementing TriggeredRevalidator are also called as
+	// blocks are transferred and as time passes.
 	RegisterRevalidator(voucherType Voucher, revalidator Revalidator) error
 
 	// RegisterVoucherResultType allows deserialization of a voucher result,
 	// so that a listener can read the metadata
 	RegisterVoucherResultType(resultType VoucherResult) error
 
+	// RegisterBlockValidator registers a validator that is consulted for each
+	// block received. Validators are consulted in the order they are
+	// registered, until one does not accept the block.
+	// returns error if the transport does not pass blocks to the validators
+	// before storing them, so a skipped block would be stored anyway
+	RegisterBlockValidator(validator BlockValidator) error
+
 	// RegisterTransportConfigurer registers the given transport configurer to be run on requests with the given voucher
 	// type
 	RegisterTransportConfigurer(voucherType Voucher, configurer TransportConfigurer) error
 
+	// RegisterChannelMessageType registers a type of application message that
+	// can be sent on open channels, and the handler for messages of that type
+	RegisterChannelMessageType(msgType ChannelMessage, handler ChannelMessageHandler) error
+
 	// open a data transfer that will send data to the recipient peer and
 	// transfer parts of the piece that match the selector
-	OpenPushDataChannel(ctx context.Context, to peer.ID, voucher Voucher, baseCid cid.Cid, selector ipld.Node) (ChannelID, error)
+	OpenPushDataChannel(ctx context.Context, to peer.ID, voucher Voucher, baseCid cid.Cid, selector ipld.Node, options ...ChannelOption) (ChannelID, error)
 
 	// open a data transfer that will request data from the sending peer and
 	// transfer parts of the piece that match the selector
-	OpenPullDataChannel(ctx context.Context, to peer.ID, voucher Voucher, baseCid cid.Cid, selector ipld.Node) (ChannelID, error)
+	OpenPullDataChannel(ctx context.Context, to peer.ID, voucher Voucher, baseCid cid.Cid, selector ipld.Node, options ...ChannelOption) (ChannelID, error)
 
 	// send an intermediate voucher as needed when the receiver sends a request for revalidation
 	SendVoucher(ctx context.Context, chid ChannelID, voucher Voucher) error
 
+	// send an unsolicited voucher result to the initiator of a channel we are
+	// responding to, such as a payment request or price update. The initiator
+	// receives it as a NewVoucherResult event
+	SendVoucherResult(ctx context.Context, chid ChannelID, voucherResult VoucherResult) error
+
+	// send an application message to the other party of an open channel.
+	// The message is stored and sent in the background, and sent again,
+	// including after a restart, until it is acknowledged or the channel ends,
+	// so it may be handled more than once. Only peers with the
+	// CapabilityChannelMessages capability receive channel messages
+	SendChannelMessage(ctx context.Context, chid ChannelID, msg ChannelMessage) error
+
 	// close an open channel (effectively a cancel)
 	CloseDataTransferChannel(ctx context.Context, chid ChannelID) error
 
@@ -130,4 +388,10 @@ type Manager interface {
 
 	// RestartDataTransferChannel restarts an existing data transfer channel
 	RestartDataTransferChannel(ctx context.Context, chid ChannelID) error
+
+	// PeerCapabilities returns the capabilities supported by both this node
+	// and the peer, as of the last new or restart request or response
+	// received from it. It returns false if none has been received since the
+	// manager started.
+	PeerCapabilities(p peer.ID) (Capabilities, bool)
 }
@@ -2,6 +2,7 @@ package datatransfer
 
 import (
 	"io"
+	"sort"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
@@ -12,6 +13,10 @@ import (
 )
 
 var (
+	// ProtocolDataTransfer1_2 is the protocol identifier for data transfer
+	// messages that carry the capabilities of the peer sending them
+	ProtocolDataTransfer1_2 protocol.ID = "/fil/datatransfer/1.2.0"
+
 	// ProtocolDataTransfer1_1 is the protocol identifier for graphsync messages
 	ProtocolDataTransfer1_1 protocol.ID = "/fil/datatransfer/1.1.0"
 
@@ -20,6 +25,94 @@ var (
 	ProtocolDataTransfer1_0 protocol.ID = "/fil/datatransfer/1.0.0"
 )
 
+// Capability is an optional feature of the data transfer protocol. Peers
+// exchange the set of capabilities they support in new and restart requests
+// and responses, so each side knows which features it can use with the
+// other. Peers that do not recognize a capability ignore it.
+type Capability string
+
+const (
+	// CapabilityRestart means the peer can restart a channel with a restart
+	// request or response
+	CapabilityRestart Capability = "restart"
+	// CapabilityRestartExistingChannel means the peer handles requests to
+	// restart a channel it opened
+	CapabilityRestartExistingChannel Capability = "restart-existing-channel"
+	// CapabilityChannelMessages means the peer can send and receive
+	// application messages on open channels
+	CapabilityChannelMessages Capability = "channel-messages"
+	// CapabilityTotalSize means the peer computes the total size of the data
+	// it sends on a channel and gives it to the receiver when the channel is
+	// opened, accepted or restarted
+	CapabilityTotalSize Capability = "total-size"
+	// CapabilityCompression means the peer can send and receive compressed
+	// data. It is reserved, and not supported by this implementation.
+	CapabilityCompression Capability = "compression"
+	// CapabilityMetadata means the peer accepts metadata attached to a
+	// channel. It is reserved, and not supported by this implementation.
+	CapabilityMetadata Capability = "metadata"
+	// CapabilityPriority means the peer schedules channels by the priority
+	// they are given. It is reserved, and not supported by this
+	// implementation.
+	CapabilityPriority Capability = "priority"
+)
+
+// Capabilities is a set of capabilities
+type Capabilities map[Capability]struct{}
+
+// NewCapabilities returns a set of the given capabilities
+func NewCapabilities(capabilities ...Capability) Capabilities {
+	set := make(Capabilities, len(capabilities))
+	for _, capability := range capabilities {
+		set[capability] = struct{}{}
+	}
+	return set
+}
+
+// Has returns true if the capability is in the set
+func (c Capabilities) Has(capability Capability) bool {
+	_, ok := c[capability]
+	return ok
+}
+
+// Intersect returns the capabilities in both sets, which are the features
+// two peers can use with each other
+func (c Capabilities) Intersect(other Capabilities) Capabilities {
+	set := make(Capabilities)
+	for capability := range c {
+		if other.Has(capability) {
+			set[capability] = struct{}{}
+		}
+	}
+	return set
+}
+
+// List returns the capabilities in the set in sorted order
+func (c Capabilities) List() []Capability {
+	list := make([]Capability, 0, len(c))
+	for capability := range c {
+		list = append(list, capability)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// SupportedCapabilities are the capabilities this implementation advertises
+// to other peers
+var SupportedCapabilities = NewCapabilities(CapabilityRestart, CapabilityRestartExistingChannel, CapabilityChannelMessages, CapabilityTotalSize)
+
+// ProtocolCapabilities returns the capabilities of a peer known only to speak
+// the given protocol. Peers on ProtocolDataTransfer1_2 and later advertise
+// their capabilities instead.
+func ProtocolCapabilities(p protocol.ID) Capabilities {
+	switch p {
+	case ProtocolDataTransfer1_1:
+		return NewCapabilities(CapabilityRestart, CapabilityRestartExistingChannel)
+	default:
+		return NewCapabilities()
+	}
+}
+
 // Message is a message for the data transfer protocol
 // (either request or response) that can serialize to a protobuf
 type Message interface {
@@ -34,6 +127,32 @@ type Message interface {
 	cborgen.CBORUnmarshaler
 	ToNet(w io.Writer) error
 	MessageForProtocol(targetProtocol protocol.ID) (newMsg Message, err error)
+	// Capabilities returns the capabilities of the peer that sent the
+	// message, or nil if the message does not say. On ProtocolDataTransfer1_2
+	// they are carried by new and restart requests and responses; on older
+	// protocols they are implied by the protocol.
+	Capabilities() Capabilities
+	// MarshalJSON renders the message in its network form as DAG-JSON,
+	// which can be read back by the FromDagJSON function of the message's
+	// package. The peers of a restart channel are given in their string form.
+	MarshalJSON() ([]byte, error)
+	// String renders the message as DAG-JSON for logging
+	String() string
+	// IsChannelMessage returns true if the message carries an application
+	// message sent on an open channel
+	IsChannelMessage() bool
+	// IsChannelMessageAck returns true if the message acknowledges an
+	// application message
+	IsChannelMessageAck() bool
+	// ChannelMessageID returns the sender's identifier for the application
+	// message carried or acknowledged
+	ChannelMessageID() uint64
+	ChannelMessageType() TypeIdentifier
+	ChannelMessage(decoder encoding.Decoder) (encoding.Encodable, error)
+	// TotalSize returns the number of blocks and bytes the sender of the
+	// data said it will send, given on new and restart messages from the
+	// sender, or 0 if it is not known
+	TotalSize() (totalBlocks uint64, totalBytes uint64)
 }
 
 // Request is a response message for the data transfer protocol
@@ -42,6 +161,7 @@ type Request interface {
 	IsPull() bool
 	IsVoucher() bool
 	VoucherType() TypeIdentifier
+	VoucherCodec() encoding.Codec
 	Voucher(decoder encoding.Decoder) (encoding.Encodable, error)
 	BaseCid() cid.Cid
 	Selector() (ipld.Node, error)
@@ -56,6 +176,8 @@ type Response interface {
 	IsComplete() bool
 	Accepted() bool
 	VoucherResultType() TypeIdentifier
+	VoucherResultCodec() encoding.Codec
 	VoucherResult(decoder encoding.Decoder) (encoding.Encodable, error)
 	EmptyVoucherResult() bool
+	RejectionReason() string
 }
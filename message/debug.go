@@ -0,0 +1,88 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+)
+
+// DecoderByType returns the decoder registered for a voucher or voucher
+// result type, if any
+type DecoderByType func(identifier datatransfer.TypeIdentifier) (encoding.Decoder, bool)
+
+// Debug renders a message for logging. Alongside the message as DAG-JSON,
+// its voucher or voucher result is decoded and rendered as JSON when a
+// decoder is registered for its type. It does no work until rendered, so can
+// be passed to debug logging cheaply.
+type Debug struct {
+	Message        datatransfer.Message
+	Vouchers       DecoderByType
+	VoucherResults DecoderByType
+}
+
+type debugJSON struct {
+	Message            json.RawMessage
+	Voucher            json.RawMessage `json:",omitempty"`
+	VoucherResult      json.RawMessage `json:",omitempty"`
+	VoucherError       string          `json:",omitempty"`
+	VoucherResultError string          `json:",omitempty"`
+}
+
+// MarshalJSON renders the message and its decoded voucher or voucher result
+func (d Debug) MarshalJSON() ([]byte, error) {
+	encoded, err := d.Message.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	out := debugJSON{Message: encoded}
+	switch msg := d.Message.(type) {
+	case datatransfer.Request:
+		if d.Vouchers == nil || msg.VoucherType() == datatransfer.EmptyTypeIdentifier {
+			break
+		}
+		if decoder, ok := d.Vouchers(msg.VoucherType()); ok {
+			out.Voucher, err = renderDecoded(msg.Voucher(decoder))
+			if err != nil {
+				out.VoucherError = err.Error()
+			}
+		}
+	case datatransfer.Response:
+		if d.VoucherResults == nil || msg.EmptyVoucherResult() {
+			break
+		}
+		if decoder, ok := d.VoucherResults(msg.VoucherResultType()); ok {
+			out.VoucherResult, err = renderDecoded(msg.VoucherResult(decoder))
+			if err != nil {
+				out.VoucherResultError = err.Error()
+			}
+		}
+	}
+	return json.Marshal(out)
+}
+
+// String renders the message and its decoded voucher or voucher result
+func (d Debug) String() string {
+	encoded, err := d.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("<unencodable message: %s>", err)
+	}
+	return string(encoded)
+}
+
+// renderDecoded renders IPLD nodes and schema bound types as DAG-JSON and
+// other types as JSON
+func renderDecoded(decoded encoding.Encodable, err error) (json.RawMessage, error) {
+	if err != nil {
+		return nil, err
+	}
+	_, isNode := decoded.(ipld.Node)
+	_, isSchemaBound := decoded.(encoding.SchemaBound)
+	if isNode || isSchemaBound {
+		return encoding.EncodeDagJSON(decoded)
+	}
+	return json.Marshal(decoded)
+}
@@ -1,18 +1,27 @@
 package message
 
 import (
-	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/message/message1_2"
 )
 
-var NewRequest = message1_1.NewRequest
-var RestartExistingChannelRequest = message1_1.RestartExistingChannelRequest
-var UpdateRequest = message1_1.UpdateRequest
-var VoucherRequest = message1_1.VoucherRequest
-var RestartResponse = message1_1.RestartResponse
-var NewResponse = message1_1.NewResponse
-var VoucherResultResponse = message1_1.VoucherResultResponse
-var CancelResponse = message1_1.CancelResponse
-var UpdateResponse = message1_1.UpdateResponse
-var FromNet = message1_1.FromNet
-var CompleteResponse = message1_1.CompleteResponse
-var CancelRequest = message1_1.CancelRequest
+var NewRequest = message1_2.NewRequest
+var NewRequestWithCapabilities = message1_2.NewRequestWithCapabilities
+var RestartExistingChannelRequest = message1_2.RestartExistingChannelRequest
+var UpdateRequest = message1_2.UpdateRequest
+var VoucherRequest = message1_2.VoucherRequest
+var RestartResponse = message1_2.RestartResponse
+var NewResponse = message1_2.NewResponse
+var VoucherResultResponse = message1_2.VoucherResultResponse
+var RejectResponse = message1_2.RejectResponse
+var CancelResponse = message1_2.CancelResponse
+var UpdateResponse = message1_2.UpdateResponse
+var FromNet = message1_2.FromNet
+var FromDagJSON = message1_2.FromDagJSON
+var CompleteResponse = message1_2.CompleteResponse
+var CancelRequest = message1_2.CancelRequest
+var ChannelMessageRequest = message1_2.ChannelMessageRequest
+var ChannelMessageAckRequest = message1_2.ChannelMessageAckRequest
+var ChannelMessageResponse = message1_2.ChannelMessageResponse
+var ChannelMessageAckResponse = message1_2.ChannelMessageAckResponse
+var RequestWithTotalSize = message1_2.RequestWithTotalSize
+var ResponseWithTotalSize = message1_2.ResponseWithTotalSize
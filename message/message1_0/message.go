@@ -8,6 +8,7 @@ import (
 	xerrors "golang.org/x/xerrors"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
 )
 
 // NewTransferRequest creates a transfer request for the 1_0 Data Transfer Protocol.
@@ -55,3 +56,9 @@ func FromNet(r io.Reader) (datatransfer.Message, error) {
 	}
 	return tresp.Response, nil
 }
+
+// FromDagJSON reads a message in the DAG-JSON form given by its MarshalJSON
+// method
+func FromDagJSON(r io.Reader) (datatransfer.Message, error) {
+	return messagejson.Unmarshal(r, FromNet)
+}
@@ -14,6 +14,7 @@ import (
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
 	"github.com/filecoin-project/go-data-transfer/message/types"
 )
 
@@ -47,6 +48,11 @@ func (trq *transferRequest) MessageForProtocol(targetProtocol protocol.ID) (data
 	}
 }
 
+// Capabilities returns the capabilities implied by the 1.0 protocol
+func (trq *transferRequest) Capabilities() datatransfer.Capabilities {
+	return datatransfer.ProtocolCapabilities(datatransfer.ProtocolDataTransfer1_0)
+}
+
 func (trq *transferRequest) IsNew() bool {
 	return trq.Type == uint64(types.NewMessage)
 }
@@ -78,6 +84,12 @@ func (trq *transferRequest) VoucherType() datatransfer.TypeIdentifier {
 	return trq.VTyp
 }
 
+// VoucherCodec returns the codec the voucher is encoded with, which is always
+// dag-cbor on this protocol
+func (trq *transferRequest) VoucherCodec() encoding.Codec {
+	return encoding.DagCBOR
+}
+
 // Voucher returns the Voucher bytes
 func (trq *transferRequest) Voucher(decoder encoding.Decoder) (encoding.Encodable, error) {
 	if trq.Vouch == nil {
@@ -105,7 +117,7 @@ func (trq *transferRequest) Selector() (ipld.Node, error) {
 	}
 	builder := basicnode.Prototype.Any.NewBuilder()
 	reader := bytes.NewReader(trq.Stor.Raw)
-	err := dagcbor.Decoder(builder, reader)
+	err := dagcbor.Decode(builder, reader)
 	if err != nil {
 		return nil, xerrors.Errorf("Error decoding selector: %w", err)
 	}
@@ -133,6 +145,16 @@ func (trq *transferRequest) ToNet(w io.Writer) error {
 	return msg.MarshalCBOR(w)
 }
 
+// MarshalJSON renders the message in its network form as DAG-JSON
+func (trq *transferRequest) MarshalJSON() ([]byte, error) {
+	return messagejson.Marshal(trq)
+}
+
+// String renders the message as DAG-JSON for logging
+func (trq *transferRequest) String() string {
+	return messagejson.String(trq)
+}
+
 func (trq *transferRequest) IsRestart() bool {
 	return false
 }
@@ -144,3 +166,33 @@ func (trq *transferRequest) IsRestartExistingChannelRequest() bool {
 func (trq *transferRequest) RestartChannelId() (datatransfer.ChannelID, error) {
 	return datatransfer.ChannelID{}, xerrors.New("not supported")
 }
+
+// IsChannelMessage returns false, as channel messages are not supported on this protocol
+func (trq *transferRequest) IsChannelMessage() bool {
+	return false
+}
+
+// IsChannelMessageAck returns false, as channel messages are not supported on this protocol
+func (trq *transferRequest) IsChannelMessageAck() bool {
+	return false
+}
+
+// ChannelMessageID returns 0, as channel messages are not supported on this protocol
+func (trq *transferRequest) ChannelMessageID() uint64 {
+	return 0
+}
+
+// ChannelMessageType returns the empty type, as channel messages are not supported on this protocol
+func (trq *transferRequest) ChannelMessageType() datatransfer.TypeIdentifier {
+	return datatransfer.EmptyTypeIdentifier
+}
+
+// ChannelMessage errors, as channel messages are not supported on this protocol
+func (trq *transferRequest) ChannelMessage(decoder encoding.Decoder) (encoding.Encodable, error) {
+	return nil, xerrors.New("channel messages are not supported on this protocol")
+}
+
+// TotalSize returns 0 blocks and bytes, as the total size is not supported on this protocol
+func (trq *transferRequest) TotalSize() (uint64, uint64) {
+	return 0, 0
+}
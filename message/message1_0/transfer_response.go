@@ -9,6 +9,7 @@ import (
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
 	"github.com/filecoin-project/go-data-transfer/message/types"
 )
 
@@ -41,6 +42,11 @@ func (trsp *transferResponse) MessageForProtocol(targetProtocol protocol.ID) (da
 	}
 }
 
+// Capabilities returns the capabilities implied by the 1.0 protocol
+func (trsp *transferResponse) Capabilities() datatransfer.Capabilities {
+	return datatransfer.ProtocolCapabilities(datatransfer.ProtocolDataTransfer1_0)
+}
+
 // IsRequest always returns false in this case because this is a transfer response
 func (trsp *transferResponse) IsRequest() bool {
 	return false
@@ -85,6 +91,18 @@ func (trsp *transferResponse) VoucherResultType() datatransfer.TypeIdentifier {
 	return trsp.VTyp
 }
 
+// VoucherResultCodec returns the codec the voucher result is encoded with,
+// which is always dag-cbor on this protocol
+func (trsp *transferResponse) VoucherResultCodec() encoding.Codec {
+	return encoding.DagCBOR
+}
+
+// RejectionReason is always empty, as rejection reasons are not sent on
+// this protocol
+func (trsp *transferResponse) RejectionReason() string {
+	return ""
+}
+
 func (trsp *transferResponse) VoucherResult(decoder encoding.Decoder) (encoding.Encodable, error) {
 	if trsp.VRes == nil {
 		return nil, xerrors.New("No voucher present to read")
@@ -106,3 +124,43 @@ func (trsp *transferResponse) ToNet(w io.Writer) error {
 	}
 	return msg.MarshalCBOR(w)
 }
+
+// MarshalJSON renders the message in its network form as DAG-JSON
+func (trsp *transferResponse) MarshalJSON() ([]byte, error) {
+	return messagejson.Marshal(trsp)
+}
+
+// String renders the message as DAG-JSON for logging
+func (trsp *transferResponse) String() string {
+	return messagejson.String(trsp)
+}
+
+// IsChannelMessage returns false, as channel messages are not supported on this protocol
+func (trsp *transferResponse) IsChannelMessage() bool {
+	return false
+}
+
+// IsChannelMessageAck returns false, as channel messages are not supported on this protocol
+func (trsp *transferResponse) IsChannelMessageAck() bool {
+	return false
+}
+
+// ChannelMessageID returns 0, as channel messages are not supported on this protocol
+func (trsp *transferResponse) ChannelMessageID() uint64 {
+	return 0
+}
+
+// ChannelMessageType returns the empty type, as channel messages are not supported on this protocol
+func (trsp *transferResponse) ChannelMessageType() datatransfer.TypeIdentifier {
+	return datatransfer.EmptyTypeIdentifier
+}
+
+// ChannelMessage errors, as channel messages are not supported on this protocol
+func (trsp *transferResponse) ChannelMessage(decoder encoding.Decoder) (encoding.Encodable, error) {
+	return nil, xerrors.New("channel messages are not supported on this protocol")
+}
+
+// TotalSize returns 0 blocks and bytes, as the total size is not supported on this protocol
+func (trsp *transferResponse) TotalSize() (uint64, uint64) {
+	return 0, 0
+}
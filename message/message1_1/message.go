@@ -10,9 +10,39 @@ import (
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
 	"github.com/filecoin-project/go-data-transfer/message/types"
 )
 
+// NewTransferRequest creates a transfer request for the 1_1 Data Transfer Protocol.
+func NewTransferRequest(bcid *cid.Cid, typ uint64, paus, part, pull bool, stor, vouch *cborgen.Deferred,
+	vtyp datatransfer.TypeIdentifier, xferId uint64, restartChannel datatransfer.ChannelID) datatransfer.Request {
+	return &transferRequest1_1{
+		BCid:           bcid,
+		Type:           typ,
+		Paus:           paus,
+		Part:           part,
+		Pull:           pull,
+		Stor:           stor,
+		Vouch:          vouch,
+		VTyp:           vtyp,
+		XferID:         xferId,
+		RestartChannel: restartChannel,
+	}
+}
+
+// NewTransferResponse creates a transfer response for the 1_1 Data Transfer Protocol.
+func NewTransferResponse(typ uint64, acpt bool, paus bool, xferId uint64, vRes *cborgen.Deferred, vtyp datatransfer.TypeIdentifier) datatransfer.Response {
+	return &transferResponse1_1{
+		Type:   typ,
+		Acpt:   acpt,
+		Paus:   paus,
+		XferID: xferId,
+		VRes:   vRes,
+		VTyp:   vtyp,
+	}
+}
+
 // NewRequest generates a new request for the data transfer protocol
 func NewRequest(id datatransfer.TransferID, isRestart bool, isPull bool, vtype datatransfer.TypeIdentifier, voucher encoding.Encodable, baseCid cid.Cid, selector ipld.Node) (datatransfer.Request, error) {
 	vbytes, err := encoding.Encode(voucher)
@@ -181,3 +211,9 @@ func FromNet(r io.Reader) (datatransfer.Message, error) {
 	}
 	return tresp.Response, nil
 }
+
+// FromDagJSON reads a message in the DAG-JSON form given by its MarshalJSON
+// method
+func FromDagJSON(r io.Reader) (datatransfer.Message, error) {
+	return messagejson.Unmarshal(r, FromNet)
+}
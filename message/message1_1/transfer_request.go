@@ -15,6 +15,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/encoding"
 	"github.com/filecoin-project/go-data-transfer/message/message1_0"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
 	"github.com/filecoin-project/go-data-transfer/message/types"
 )
 
@@ -63,6 +64,11 @@ func (trq *transferRequest1_1) MessageForProtocol(targetProtocol protocol.ID) (d
 	}
 }
 
+// Capabilities returns the capabilities implied by the 1.1 protocol
+func (trq *transferRequest1_1) Capabilities() datatransfer.Capabilities {
+	return datatransfer.ProtocolCapabilities(datatransfer.ProtocolDataTransfer1_1)
+}
+
 // IsRequest always returns true in this case because this is a transfer request
 func (trq *transferRequest1_1) IsRequest() bool {
 	return true
@@ -114,6 +120,12 @@ func (trq *transferRequest1_1) VoucherType() datatransfer.TypeIdentifier {
 	return trq.VTyp
 }
 
+// VoucherCodec returns the codec the voucher is encoded with, which is always
+// dag-cbor on this protocol
+func (trq *transferRequest1_1) VoucherCodec() encoding.Codec {
+	return encoding.DagCBOR
+}
+
 // Voucher returns the Voucher bytes
 func (trq *transferRequest1_1) Voucher(decoder encoding.Decoder) (encoding.Encodable, error) {
 	if trq.Vouch == nil {
@@ -141,7 +153,7 @@ func (trq *transferRequest1_1) Selector() (ipld.Node, error) {
 	}
 	builder := basicnode.Prototype.Any.NewBuilder()
 	reader := bytes.NewReader(trq.Stor.Raw)
-	err := dagcbor.Decoder(builder, reader)
+	err := dagcbor.Decode(builder, reader)
 	if err != nil {
 		return nil, xerrors.Errorf("Error decoding selector: %w", err)
 	}
@@ -168,3 +180,43 @@ func (trq *transferRequest1_1) ToNet(w io.Writer) error {
 	}
 	return msg.MarshalCBOR(w)
 }
+
+// MarshalJSON renders the message in its network form as DAG-JSON
+func (trq *transferRequest1_1) MarshalJSON() ([]byte, error) {
+	return messagejson.Marshal(trq)
+}
+
+// String renders the message as DAG-JSON for logging
+func (trq *transferRequest1_1) String() string {
+	return messagejson.String(trq)
+}
+
+// IsChannelMessage returns false, as channel messages are not supported on this protocol
+func (trq *transferRequest1_1) IsChannelMessage() bool {
+	return false
+}
+
+// IsChannelMessageAck returns false, as channel messages are not supported on this protocol
+func (trq *transferRequest1_1) IsChannelMessageAck() bool {
+	return false
+}
+
+// ChannelMessageID returns 0, as channel messages are not supported on this protocol
+func (trq *transferRequest1_1) ChannelMessageID() uint64 {
+	return 0
+}
+
+// ChannelMessageType returns the empty type, as channel messages are not supported on this protocol
+func (trq *transferRequest1_1) ChannelMessageType() datatransfer.TypeIdentifier {
+	return datatransfer.EmptyTypeIdentifier
+}
+
+// ChannelMessage errors, as channel messages are not supported on this protocol
+func (trq *transferRequest1_1) ChannelMessage(decoder encoding.Decoder) (encoding.Encodable, error) {
+	return nil, xerrors.New("channel messages are not supported on this protocol")
+}
+
+// TotalSize returns 0 blocks and bytes, as the total size is not supported on this protocol
+func (trq *transferRequest1_1) TotalSize() (uint64, uint64) {
+	return 0, 0
+}
@@ -10,6 +10,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/encoding"
 	"github.com/filecoin-project/go-data-transfer/message/message1_0"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
 	"github.com/filecoin-project/go-data-transfer/message/types"
 )
 
@@ -74,6 +75,18 @@ func (trsp *transferResponse1_1) VoucherResultType() datatransfer.TypeIdentifier
 	return trsp.VTyp
 }
 
+// VoucherResultCodec returns the codec the voucher result is encoded with,
+// which is always dag-cbor on this protocol
+func (trsp *transferResponse1_1) VoucherResultCodec() encoding.Codec {
+	return encoding.DagCBOR
+}
+
+// RejectionReason is always empty, as rejection reasons are not sent on
+// this protocol
+func (trsp *transferResponse1_1) RejectionReason() string {
+	return ""
+}
+
 func (trsp *transferResponse1_1) VoucherResult(decoder encoding.Decoder) (encoding.Encodable, error) {
 	if trsp.VRes == nil {
 		return nil, xerrors.New("No voucher present to read")
@@ -114,6 +127,11 @@ func (trsp *transferResponse1_1) MessageForProtocol(targetProtocol protocol.ID)
 	}
 }
 
+// Capabilities returns the capabilities implied by the 1.1 protocol
+func (trsp *transferResponse1_1) Capabilities() datatransfer.Capabilities {
+	return datatransfer.ProtocolCapabilities(datatransfer.ProtocolDataTransfer1_1)
+}
+
 // ToNet serializes a transfer response. It's a wrapper for MarshalCBOR to provide
 // symmetry with FromNet
 func (trsp *transferResponse1_1) ToNet(w io.Writer) error {
@@ -124,3 +142,43 @@ func (trsp *transferResponse1_1) ToNet(w io.Writer) error {
 	}
 	return msg.MarshalCBOR(w)
 }
+
+// MarshalJSON renders the message in its network form as DAG-JSON
+func (trsp *transferResponse1_1) MarshalJSON() ([]byte, error) {
+	return messagejson.Marshal(trsp)
+}
+
+// String renders the message as DAG-JSON for logging
+func (trsp *transferResponse1_1) String() string {
+	return messagejson.String(trsp)
+}
+
+// IsChannelMessage returns false, as channel messages are not supported on this protocol
+func (trsp *transferResponse1_1) IsChannelMessage() bool {
+	return false
+}
+
+// IsChannelMessageAck returns false, as channel messages are not supported on this protocol
+func (trsp *transferResponse1_1) IsChannelMessageAck() bool {
+	return false
+}
+
+// ChannelMessageID returns 0, as channel messages are not supported on this protocol
+func (trsp *transferResponse1_1) ChannelMessageID() uint64 {
+	return 0
+}
+
+// ChannelMessageType returns the empty type, as channel messages are not supported on this protocol
+func (trsp *transferResponse1_1) ChannelMessageType() datatransfer.TypeIdentifier {
+	return datatransfer.EmptyTypeIdentifier
+}
+
+// ChannelMessage errors, as channel messages are not supported on this protocol
+func (trsp *transferResponse1_1) ChannelMessage(decoder encoding.Decoder) (encoding.Encodable, error) {
+	return nil, xerrors.New("channel messages are not supported on this protocol")
+}
+
+// TotalSize returns 0 blocks and bytes, as the total size is not supported on this protocol
+func (trsp *transferResponse1_1) TotalSize() (uint64, uint64) {
+	return 0, 0
+}
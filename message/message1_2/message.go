@@ -0,0 +1,357 @@
+package message1_2
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cborgen "github.com/whyrusleeping/cbor-gen"
+	xerrors "golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
+	"github.com/filecoin-project/go-data-transfer/message/types"
+)
+
+// NewRequest generates a new request for the data transfer protocol
+func NewRequest(id datatransfer.TransferID, isRestart bool, isPull bool, vtype datatransfer.TypeIdentifier, voucher encoding.Encodable, baseCid cid.Cid, selector ipld.Node) (datatransfer.Request, error) {
+	return NewRequestWithCapabilities(id, isRestart, isPull, vtype, voucher, baseCid, selector, datatransfer.SupportedCapabilities)
+}
+
+// NewRequestWithCapabilities generates a new request that advertises the given
+// capabilities, such as to leave out optional features not wanted on the
+// channel
+func NewRequestWithCapabilities(id datatransfer.TransferID, isRestart bool, isPull bool, vtype datatransfer.TypeIdentifier, voucher encoding.Encodable, baseCid cid.Cid, selector ipld.Node, capabilities datatransfer.Capabilities) (datatransfer.Request, error) {
+	vbytes, vcodec, err := encoding.EncodeItem(voucher)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	if baseCid == cid.Undef {
+		return nil, xerrors.Errorf("base CID must be defined")
+	}
+	selBytes, err := encoding.Encode(selector)
+	if err != nil {
+		return nil, xerrors.Errorf("Error encoding selector")
+	}
+
+	var typ uint64
+	if isRestart {
+		typ = uint64(types.RestartMessage)
+	} else {
+		typ = uint64(types.NewMessage)
+	}
+
+	return &transferRequest1_2{
+		Type:   typ,
+		Pull:   isPull,
+		Vouch:  &cborgen.Deferred{Raw: vbytes},
+		VCdc:   vcodec,
+		Stor:   &cborgen.Deferred{Raw: selBytes},
+		BCid:   &baseCid,
+		VTyp:   vtype,
+		XferID: uint64(id),
+		Caps:   encodeCapabilities(capabilities),
+	}, nil
+}
+
+// RestartExistingChannelRequest creates a request to ask the other side to restart an existing channel
+func RestartExistingChannelRequest(channelId datatransfer.ChannelID) datatransfer.Request {
+
+	return &transferRequest1_2{Type: uint64(types.RestartExistingChannelRequestMessage),
+		RestartChannel: channelId}
+}
+
+// CancelRequest request generates a request to cancel an in progress request
+func CancelRequest(id datatransfer.TransferID) datatransfer.Request {
+	return &transferRequest1_2{
+		Type:   uint64(types.CancelMessage),
+		XferID: uint64(id),
+	}
+}
+
+// UpdateRequest generates a new request update
+func UpdateRequest(id datatransfer.TransferID, isPaused bool) datatransfer.Request {
+	return &transferRequest1_2{
+		Type:   uint64(types.UpdateMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+	}
+}
+
+// VoucherRequest generates a new request for the data transfer protocol
+func VoucherRequest(id datatransfer.TransferID, vtype datatransfer.TypeIdentifier, voucher encoding.Encodable) (datatransfer.Request, error) {
+	vbytes, vcodec, err := encoding.EncodeItem(voucher)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferRequest1_2{
+		Type:   uint64(types.VoucherMessage),
+		Vouch:  &cborgen.Deferred{Raw: vbytes},
+		VCdc:   vcodec,
+		VTyp:   vtype,
+		XferID: uint64(id),
+	}, nil
+}
+
+// RestartResponse builds a new Data Transfer response
+func RestartResponse(id datatransfer.TransferID, accepted bool, isPaused bool, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	vbytes, vcodec, err := encoding.EncodeItem(voucherResult)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferResponse1_2{
+		Acpt:   accepted,
+		Type:   uint64(types.RestartMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+		VTyp:   voucherResultType,
+		VRes:   &cborgen.Deferred{Raw: vbytes},
+		VCdc:   vcodec,
+		Caps:   encodeCapabilities(datatransfer.SupportedCapabilities),
+	}, nil
+}
+
+// NewResponse builds a new Data Transfer response
+func NewResponse(id datatransfer.TransferID, accepted bool, isPaused bool, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	vbytes, vcodec, err := encoding.EncodeItem(voucherResult)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferResponse1_2{
+		Acpt:   accepted,
+		Type:   uint64(types.NewMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+		VTyp:   voucherResultType,
+		VRes:   &cborgen.Deferred{Raw: vbytes},
+		VCdc:   vcodec,
+		Caps:   encodeCapabilities(datatransfer.SupportedCapabilities),
+	}, nil
+}
+
+// RejectResponse builds a response rejecting a new request, telling the
+// requester why it was rejected
+func RejectResponse(id datatransfer.TransferID, reason string, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	response, err := NewResponse(id, false, false, voucherResultType, voucherResult)
+	if err != nil {
+		return nil, err
+	}
+	response.(*transferResponse1_2).Rsn = reason
+	return response, nil
+}
+
+// VoucherResultResponse builds a new response for a voucher result
+func VoucherResultResponse(id datatransfer.TransferID, accepted bool, isPaused bool, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	vbytes, vcodec, err := encoding.EncodeItem(voucherResult)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferResponse1_2{
+		Acpt:   accepted,
+		Type:   uint64(types.VoucherResultMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+		VTyp:   voucherResultType,
+		VRes:   &cborgen.Deferred{Raw: vbytes},
+		VCdc:   vcodec,
+	}, nil
+}
+
+// UpdateResponse returns a new update response
+func UpdateResponse(id datatransfer.TransferID, isPaused bool) datatransfer.Response {
+	return &transferResponse1_2{
+		Type:   uint64(types.UpdateMessage),
+		Paus:   isPaused,
+		XferID: uint64(id),
+	}
+}
+
+// CancelResponse makes a new cancel response message
+func CancelResponse(id datatransfer.TransferID) datatransfer.Response {
+	return &transferResponse1_2{
+		Type:   uint64(types.CancelMessage),
+		XferID: uint64(id),
+	}
+}
+
+// CompleteResponse returns a new complete response message
+func CompleteResponse(id datatransfer.TransferID, isAccepted bool, isPaused bool, voucherResultType datatransfer.TypeIdentifier, voucherResult encoding.Encodable) (datatransfer.Response, error) {
+	vbytes, vcodec, err := encoding.EncodeItem(voucherResult)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferResponse1_2{
+		Type:   uint64(types.CompleteMessage),
+		Acpt:   isAccepted,
+		Paus:   isPaused,
+		VTyp:   voucherResultType,
+		VRes:   &cborgen.Deferred{Raw: vbytes},
+		VCdc:   vcodec,
+		XferID: uint64(id),
+	}, nil
+}
+
+// ChannelMessageRequest generates a request carrying an application message
+// from the initiator of a channel
+func ChannelMessageRequest(id datatransfer.TransferID, msgID uint64, msgType datatransfer.TypeIdentifier, msg encoding.Encodable) (datatransfer.Request, error) {
+	mbytes, mcodec, err := encoding.EncodeItem(msg)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating request: %w", err)
+	}
+	return &transferRequest1_2{
+		Type:   uint64(types.ChannelMessage),
+		XferID: uint64(id),
+		MsgID:  msgID,
+		Msg:    &cborgen.Deferred{Raw: mbytes},
+		MTyp:   msgType,
+		MCdc:   mcodec,
+	}, nil
+}
+
+// ChannelMessageAckRequest generates a request acknowledging an application
+// message received by the initiator of a channel
+func ChannelMessageAckRequest(id datatransfer.TransferID, msgID uint64) datatransfer.Request {
+	return &transferRequest1_2{
+		Type:   uint64(types.ChannelMessageAck),
+		XferID: uint64(id),
+		MsgID:  msgID,
+	}
+}
+
+// ChannelMessageResponse generates a response carrying an application message
+// from the responder of a channel
+func ChannelMessageResponse(id datatransfer.TransferID, msgID uint64, msgType datatransfer.TypeIdentifier, msg encoding.Encodable) (datatransfer.Response, error) {
+	mbytes, mcodec, err := encoding.EncodeItem(msg)
+	if err != nil {
+		return nil, xerrors.Errorf("Creating response: %w", err)
+	}
+	return &transferResponse1_2{
+		Type:   uint64(types.ChannelMessage),
+		XferID: uint64(id),
+		MsgID:  msgID,
+		Msg:    &cborgen.Deferred{Raw: mbytes},
+		MTyp:   msgType,
+		MCdc:   mcodec,
+	}, nil
+}
+
+// ChannelMessageAckResponse generates a response acknowledging an
+// application message received by the responder of a channel
+func ChannelMessageAckResponse(id datatransfer.TransferID, msgID uint64) datatransfer.Response {
+	return &transferResponse1_2{
+		Type:   uint64(types.ChannelMessageAck),
+		XferID: uint64(id),
+		MsgID:  msgID,
+	}
+}
+
+// RequestWithTotalSize returns a copy of a new or restart push request that
+// tells the responder the total size of the data the initiator will send
+func RequestWithTotalSize(request datatransfer.Request, totalBlocks uint64, totalBytes uint64) (datatransfer.Request, error) {
+	trq, ok := request.(*transferRequest1_2)
+	if !ok || !(trq.IsNew() || trq.IsRestart()) || trq.IsPull() {
+		return nil, xerrors.New("only new and restart push requests can give the total size")
+	}
+	withTotal := *trq
+	withTotal.TBlks = totalBlocks
+	withTotal.TSize = totalBytes
+	return &withTotal, nil
+}
+
+// ResponseWithTotalSize returns a copy of a new or restart response that tells
+// the initiator the total size of the data the responder will send
+func ResponseWithTotalSize(response datatransfer.Response, totalBlocks uint64, totalBytes uint64) (datatransfer.Response, error) {
+	trsp, ok := response.(*transferResponse1_2)
+	if !ok || !(trsp.IsNew() || trsp.IsRestart()) {
+		return nil, xerrors.New("only new and restart responses can give the total size")
+	}
+	withTotal := *trsp
+	withTotal.TBlks = totalBlocks
+	withTotal.TSize = totalBytes
+	return &withTotal, nil
+}
+
+// voucherToCBOR converts a voucher or voucher result to dag-cbor for
+// protocols that do not record its codec
+func voucherToCBOR(codec encoding.Codec, voucher *cborgen.Deferred) (*cborgen.Deferred, error) {
+	if voucher == nil {
+		return nil, nil
+	}
+	encoded, err := encoding.ItemToCBOR(codec, voucher.Raw)
+	if err != nil {
+		return nil, xerrors.Errorf("converting voucher to dag-cbor: %w", err)
+	}
+	return &cborgen.Deferred{Raw: encoded}, nil
+}
+
+// encodeCapabilities encodes a set of capabilities as a CBOR array of strings
+func encodeCapabilities(capabilities datatransfer.Capabilities) *cborgen.Deferred {
+	buf := new(bytes.Buffer)
+	list := capabilities.List()
+	// writes to a bytes.Buffer cannot fail
+	_ = cborgen.WriteMajorTypeHeader(buf, cborgen.MajArray, uint64(len(list)))
+	for _, capability := range list {
+		_ = cborgen.WriteMajorTypeHeader(buf, cborgen.MajTextString, uint64(len(capability)))
+		_, _ = buf.WriteString(string(capability))
+	}
+	return &cborgen.Deferred{Raw: buf.Bytes()}
+}
+
+// decodeCapabilities decodes a set of capabilities sent on the wire
+func decodeCapabilities(caps *cborgen.Deferred) (datatransfer.Capabilities, error) {
+	if caps == nil || bytes.Equal(caps.Raw, cborgen.CborNull) {
+		return datatransfer.NewCapabilities(), nil
+	}
+	r := bytes.NewReader(caps.Raw)
+	maj, n, err := cborgen.CborReadHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if maj != cborgen.MajArray {
+		return nil, xerrors.Errorf("capabilities should be an array, got major type %d", maj)
+	}
+	if n > cborgen.MaxLength {
+		return nil, xerrors.Errorf("too many capabilities: %d", n)
+	}
+	set := make(datatransfer.Capabilities, n)
+	for i := uint64(0); i < n; i++ {
+		capability, err := cborgen.ReadString(r)
+		if err != nil {
+			return nil, xerrors.Errorf("reading capability: %w", err)
+		}
+		set[datatransfer.Capability(capability)] = struct{}{}
+	}
+	return set, nil
+}
+
+// FromNet can read a network stream to deserialize a GraphSyncMessage
+func FromNet(r io.Reader) (datatransfer.Message, error) {
+	tresp := transferMessage1_2{}
+	err := tresp.UnmarshalCBOR(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if (tresp.IsRequest() && tresp.Request == nil) || (!tresp.IsRequest() && tresp.Response == nil) {
+		return nil, xerrors.Errorf("invalid/malformed message")
+	}
+
+	if tresp.IsRequest() {
+		if _, err := decodeCapabilities(tresp.Request.Caps); err != nil {
+			return nil, xerrors.Errorf("invalid/malformed capabilities: %w", err)
+		}
+		return tresp.Request, nil
+	}
+	if _, err := decodeCapabilities(tresp.Response.Caps); err != nil {
+		return nil, xerrors.Errorf("invalid/malformed capabilities: %w", err)
+	}
+	return tresp.Response, nil
+}
+
+// FromDagJSON reads a message in the DAG-JSON form given by its MarshalJSON
+// method
+func FromDagJSON(r io.Reader) (datatransfer.Message, error) {
+	return messagejson.Unmarshal(r, FromNet)
+}
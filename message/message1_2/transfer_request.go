@@ -0,0 +1,252 @@
+package message1_2
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	xerrors "golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
+	"github.com/filecoin-project/go-data-transfer/message/types"
+)
+
+//go:generate cbor-gen-for --map-encoding transferRequest1_2
+
+// transferRequest1_2 is a struct for the 1.2 Data Transfer Protocol that fulfills the datatransfer.Request interface.
+// its members are exported to be used by cbor-gen. It is the 1.1 request with
+// the capabilities of the requester added to new and restart requests, and
+// the codec of the voucher, which older protocols always send as dag-cbor.
+// It also carries application messages sent on open channels, and their
+// acknowledgements, and the total size of the data sent on push channels,
+// which older protocols cannot send.
+type transferRequest1_2 struct {
+	BCid   *cid.Cid
+	Type   uint64
+	Paus   bool
+	Part   bool
+	Pull   bool
+	Stor   *cbg.Deferred
+	Vouch  *cbg.Deferred
+	VTyp   datatransfer.TypeIdentifier
+	XferID uint64
+
+	RestartChannel datatransfer.ChannelID
+
+	Caps *cbg.Deferred
+	VCdc encoding.Codec
+
+	MsgID uint64
+	Msg   *cbg.Deferred
+	MTyp  datatransfer.TypeIdentifier
+	MCdc  encoding.Codec
+
+	TBlks uint64
+	TSize uint64
+}
+
+func (trq *transferRequest1_2) MessageForProtocol(targetProtocol protocol.ID) (datatransfer.Message, error) {
+	switch targetProtocol {
+	case datatransfer.ProtocolDataTransfer1_2:
+		return trq, nil
+	case datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0:
+		if trq.IsChannelMessage() || trq.IsChannelMessageAck() {
+			return nil, xerrors.Errorf("channel messages are not supported on protocol %s", targetProtocol)
+		}
+		// the capabilities are dropped: older peers infer them from the protocol
+		vouch, err := voucherToCBOR(trq.VCdc, trq.Vouch)
+		if err != nil {
+			return nil, err
+		}
+		lreq := message1_1.NewTransferRequest(
+			trq.BCid,
+			trq.Type,
+			trq.Paus,
+			trq.Part,
+			trq.Pull,
+			trq.Stor,
+			vouch,
+			trq.VTyp,
+			trq.XferID,
+			trq.RestartChannel,
+		)
+		return lreq.MessageForProtocol(targetProtocol)
+	default:
+		return nil, xerrors.Errorf("protocol not supported")
+	}
+}
+
+// Capabilities returns the capabilities of the requester, carried by new and
+// restart requests
+func (trq *transferRequest1_2) Capabilities() datatransfer.Capabilities {
+	if !trq.IsNew() && !trq.IsRestart() {
+		return nil
+	}
+	// capabilities that fail to decode are rejected by FromNet
+	capabilities, _ := decodeCapabilities(trq.Caps)
+	return capabilities
+}
+
+// IsRequest always returns true in this case because this is a transfer request
+func (trq *transferRequest1_2) IsRequest() bool {
+	return true
+}
+
+func (trq *transferRequest1_2) IsRestart() bool {
+	return trq.Type == uint64(types.RestartMessage)
+}
+
+func (trq *transferRequest1_2) IsRestartExistingChannelRequest() bool {
+	return trq.Type == uint64(types.RestartExistingChannelRequestMessage)
+}
+
+func (trq *transferRequest1_2) RestartChannelId() (datatransfer.ChannelID, error) {
+	if !trq.IsRestartExistingChannelRequest() {
+		return datatransfer.ChannelID{}, xerrors.New("not a restart request")
+	}
+	return trq.RestartChannel, nil
+}
+
+func (trq *transferRequest1_2) IsNew() bool {
+	return trq.Type == uint64(types.NewMessage)
+}
+
+func (trq *transferRequest1_2) IsUpdate() bool {
+	return trq.Type == uint64(types.UpdateMessage)
+}
+
+func (trq *transferRequest1_2) IsVoucher() bool {
+	return trq.Type == uint64(types.VoucherMessage) || trq.Type == uint64(types.NewMessage)
+}
+
+func (trq *transferRequest1_2) IsPaused() bool {
+	return trq.Paus
+}
+
+func (trq *transferRequest1_2) TransferID() datatransfer.TransferID {
+	return datatransfer.TransferID(trq.XferID)
+}
+
+// ========= datatransfer.Request interface
+// IsPull returns true if this is a data pull request
+func (trq *transferRequest1_2) IsPull() bool {
+	return trq.Pull
+}
+
+// VoucherType returns the Voucher ID
+func (trq *transferRequest1_2) VoucherType() datatransfer.TypeIdentifier {
+	return trq.VTyp
+}
+
+// Voucher returns the Voucher bytes
+func (trq *transferRequest1_2) Voucher(decoder encoding.Decoder) (encoding.Encodable, error) {
+	if trq.Vouch == nil {
+		return nil, xerrors.New("No voucher present to read")
+	}
+	return encoding.DecodeItem(decoder, trq.VCdc, trq.Vouch.Raw)
+}
+
+// VoucherCodec returns the codec the voucher is encoded with
+func (trq *transferRequest1_2) VoucherCodec() encoding.Codec {
+	return trq.VCdc
+}
+
+func (trq *transferRequest1_2) EmptyVoucher() bool {
+	return trq.VTyp == datatransfer.EmptyTypeIdentifier
+}
+
+// BaseCid returns the Base CID
+func (trq *transferRequest1_2) BaseCid() cid.Cid {
+	if trq.BCid == nil {
+		return cid.Undef
+	}
+	return *trq.BCid
+}
+
+// Selector returns the message Selector bytes
+func (trq *transferRequest1_2) Selector() (ipld.Node, error) {
+	if trq.Stor == nil {
+		return nil, xerrors.New("No selector present to read")
+	}
+	builder := basicnode.Prototype.Any.NewBuilder()
+	reader := bytes.NewReader(trq.Stor.Raw)
+	err := dagcbor.Decode(builder, reader)
+	if err != nil {
+		return nil, xerrors.Errorf("Error decoding selector: %w", err)
+	}
+	return builder.Build(), nil
+}
+
+// IsCancel returns true if this is a cancel request
+func (trq *transferRequest1_2) IsCancel() bool {
+	return trq.Type == uint64(types.CancelMessage)
+}
+
+// IsPartial returns true if this is a partial request
+func (trq *transferRequest1_2) IsPartial() bool {
+	return trq.Part
+}
+
+// IsChannelMessage returns true if the request carries an application message
+func (trq *transferRequest1_2) IsChannelMessage() bool {
+	return trq.Type == uint64(types.ChannelMessage)
+}
+
+// IsChannelMessageAck returns true if the request acknowledges an application message
+func (trq *transferRequest1_2) IsChannelMessageAck() bool {
+	return trq.Type == uint64(types.ChannelMessageAck)
+}
+
+// ChannelMessageID returns the identifier of the application message carried
+// or acknowledged
+func (trq *transferRequest1_2) ChannelMessageID() uint64 {
+	return trq.MsgID
+}
+
+// ChannelMessageType returns the type of the application message carried
+func (trq *transferRequest1_2) ChannelMessageType() datatransfer.TypeIdentifier {
+	return trq.MTyp
+}
+
+// ChannelMessage decodes the application message carried
+func (trq *transferRequest1_2) ChannelMessage(decoder encoding.Decoder) (encoding.Encodable, error) {
+	if !trq.IsChannelMessage() || trq.Msg == nil {
+		return nil, xerrors.New("No channel message present to read")
+	}
+	return encoding.DecodeItem(decoder, trq.MCdc, trq.Msg.Raw)
+}
+
+// ToNet serializes a transfer request. It's a wrapper for MarshalCBOR to provide
+// symmetry with FromNet
+func (trq *transferRequest1_2) ToNet(w io.Writer) error {
+	msg := transferMessage1_2{
+		IsRq:     true,
+		Request:  trq,
+		Response: nil,
+	}
+	return msg.MarshalCBOR(w)
+}
+
+// MarshalJSON renders the message in its network form as DAG-JSON
+func (trq *transferRequest1_2) MarshalJSON() ([]byte, error) {
+	return messagejson.Marshal(trq)
+}
+
+// String renders the message as DAG-JSON for logging
+func (trq *transferRequest1_2) String() string {
+	return messagejson.String(trq)
+}
+
+// TotalSize returns the number of blocks and bytes of data the initiator of a
+// push said it will send, or 0 if it is not known
+func (trq *transferRequest1_2) TotalSize() (uint64, uint64) {
+	return trq.TBlks, trq.TSize
+}
@@ -0,0 +1,209 @@
+package message1_2
+
+import (
+	"io"
+
+	"github.com/libp2p/go-libp2p-core/protocol"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	xerrors "golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/message/messagejson"
+	"github.com/filecoin-project/go-data-transfer/message/types"
+)
+
+//go:generate cbor-gen-for --map-encoding transferResponse1_2
+
+// transferResponse1_2 is a private struct that satisfies the datatransfer.Response interface
+// It is the response message for the Data Transfer 1.2 Protocol.
+type transferResponse1_2 struct {
+	Type   uint64
+	Acpt   bool
+	Paus   bool
+	XferID uint64
+	VRes   *cbg.Deferred
+	VTyp   datatransfer.TypeIdentifier
+
+	Caps *cbg.Deferred
+	VCdc encoding.Codec
+
+	MsgID uint64
+	Msg   *cbg.Deferred
+	MTyp  datatransfer.TypeIdentifier
+	MCdc  encoding.Codec
+
+	Rsn string
+
+	TBlks uint64
+	TSize uint64
+}
+
+func (trsp *transferResponse1_2) TransferID() datatransfer.TransferID {
+	return datatransfer.TransferID(trsp.XferID)
+}
+
+// IsRequest always returns false in this case because this is a transfer response
+func (trsp *transferResponse1_2) IsRequest() bool {
+	return false
+}
+
+// IsNew returns true if this is the first response sent
+func (trsp *transferResponse1_2) IsNew() bool {
+	return trsp.Type == uint64(types.NewMessage)
+}
+
+// IsUpdate returns true if this response is an update
+func (trsp *transferResponse1_2) IsUpdate() bool {
+	return trsp.Type == uint64(types.UpdateMessage)
+}
+
+// IsPaused returns true if the responder is paused
+func (trsp *transferResponse1_2) IsPaused() bool {
+	return trsp.Paus
+}
+
+// IsCancel returns true if the responder has cancelled this response
+func (trsp *transferResponse1_2) IsCancel() bool {
+	return trsp.Type == uint64(types.CancelMessage)
+}
+
+// IsComplete returns true if the responder has completed this response
+func (trsp *transferResponse1_2) IsComplete() bool {
+	return trsp.Type == uint64(types.CompleteMessage)
+}
+
+func (trsp *transferResponse1_2) IsVoucherResult() bool {
+	return trsp.Type == uint64(types.VoucherResultMessage) || trsp.Type == uint64(types.NewMessage) || trsp.Type == uint64(types.CompleteMessage) ||
+		trsp.Type == uint64(types.RestartMessage)
+}
+
+// 	Accepted returns true if the request is accepted in the response
+func (trsp *transferResponse1_2) Accepted() bool {
+	return trsp.Acpt
+}
+
+func (trsp *transferResponse1_2) VoucherResultType() datatransfer.TypeIdentifier {
+	return trsp.VTyp
+}
+
+func (trsp *transferResponse1_2) VoucherResult(decoder encoding.Decoder) (encoding.Encodable, error) {
+	if trsp.VRes == nil {
+		return nil, xerrors.New("No voucher present to read")
+	}
+	return encoding.DecodeItem(decoder, trsp.VCdc, trsp.VRes.Raw)
+}
+
+func (trq *transferResponse1_2) IsRestart() bool {
+	return trq.Type == uint64(types.RestartMessage)
+}
+
+// VoucherResultCodec returns the codec the voucher result is encoded with
+func (trsp *transferResponse1_2) VoucherResultCodec() encoding.Codec {
+	return trsp.VCdc
+}
+
+func (trsp *transferResponse1_2) EmptyVoucherResult() bool {
+	return trsp.VTyp == datatransfer.EmptyTypeIdentifier
+}
+
+func (trsp *transferResponse1_2) MessageForProtocol(targetProtocol protocol.ID) (datatransfer.Message, error) {
+	switch targetProtocol {
+	case datatransfer.ProtocolDataTransfer1_2:
+		return trsp, nil
+	case datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0:
+		if trsp.IsChannelMessage() || trsp.IsChannelMessageAck() {
+			return nil, xerrors.Errorf("channel messages are not supported on protocol %s", targetProtocol)
+		}
+		// the capabilities are dropped: older peers infer them from the protocol
+		vres, err := voucherToCBOR(trsp.VCdc, trsp.VRes)
+		if err != nil {
+			return nil, err
+		}
+		lresp := message1_1.NewTransferResponse(
+			trsp.Type,
+			trsp.Acpt,
+			trsp.Paus,
+			trsp.XferID,
+			vres,
+			trsp.VTyp,
+		)
+		return lresp.MessageForProtocol(targetProtocol)
+	default:
+		return nil, xerrors.Errorf("protocol %s not supported", targetProtocol)
+	}
+}
+
+// RejectionReason is why the responder rejected the request, if it says.
+// The reason is dropped when the response is sent on older protocols.
+func (trsp *transferResponse1_2) RejectionReason() string {
+	return trsp.Rsn
+}
+
+// Capabilities returns the capabilities of the responder, carried by new and
+// restart responses
+func (trsp *transferResponse1_2) Capabilities() datatransfer.Capabilities {
+	if !trsp.IsNew() && !trsp.IsRestart() {
+		return nil
+	}
+	// capabilities that fail to decode are rejected by FromNet
+	capabilities, _ := decodeCapabilities(trsp.Caps)
+	return capabilities
+}
+
+// ToNet serializes a transfer response. It's a wrapper for MarshalCBOR to provide
+// symmetry with FromNet
+func (trsp *transferResponse1_2) ToNet(w io.Writer) error {
+	msg := transferMessage1_2{
+		IsRq:     false,
+		Request:  nil,
+		Response: trsp,
+	}
+	return msg.MarshalCBOR(w)
+}
+
+// MarshalJSON renders the message in its network form as DAG-JSON
+func (trsp *transferResponse1_2) MarshalJSON() ([]byte, error) {
+	return messagejson.Marshal(trsp)
+}
+
+// String renders the message as DAG-JSON for logging
+func (trsp *transferResponse1_2) String() string {
+	return messagejson.String(trsp)
+}
+
+// IsChannelMessage returns true if the response carries an application message
+func (trsp *transferResponse1_2) IsChannelMessage() bool {
+	return trsp.Type == uint64(types.ChannelMessage)
+}
+
+// IsChannelMessageAck returns true if the response acknowledges an application message
+func (trsp *transferResponse1_2) IsChannelMessageAck() bool {
+	return trsp.Type == uint64(types.ChannelMessageAck)
+}
+
+// ChannelMessageID returns the identifier of the application message carried
+// or acknowledged
+func (trsp *transferResponse1_2) ChannelMessageID() uint64 {
+	return trsp.MsgID
+}
+
+// ChannelMessageType returns the type of the application message carried
+func (trsp *transferResponse1_2) ChannelMessageType() datatransfer.TypeIdentifier {
+	return trsp.MTyp
+}
+
+// ChannelMessage decodes the application message carried
+func (trsp *transferResponse1_2) ChannelMessage(decoder encoding.Decoder) (encoding.Encodable, error) {
+	if !trsp.IsChannelMessage() || trsp.Msg == nil {
+		return nil, xerrors.New("No channel message present to read")
+	}
+	return encoding.DecodeItem(decoder, trsp.MCdc, trsp.Msg.Raw)
+}
+
+// TotalSize returns the number of blocks and bytes of data the responder to a
+// pull said it will send, or 0 if it is not known
+func (trsp *transferResponse1_2) TotalSize() (uint64, uint64) {
+	return trsp.TBlks, trsp.TSize
+}
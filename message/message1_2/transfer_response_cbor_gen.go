@@ -0,0 +1,544 @@
+// Code generated by github.com/whyrusleeping/cbor-gen. DO NOT EDIT.
+
+package message1_2
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	encoding "github.com/filecoin-project/go-data-transfer/encoding"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	xerrors "golang.org/x/xerrors"
+)
+
+var _ = xerrors.Errorf
+var _ = cid.Undef
+var _ = sort.Sort
+
+func (t *transferResponse1_2) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write([]byte{175}); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Type (uint64) (uint64)
+	if len("Type") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Type\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Type"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Type")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Type)); err != nil {
+		return err
+	}
+
+	// t.Acpt (bool) (bool)
+	if len("Acpt") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Acpt\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Acpt"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Acpt")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteBool(w, t.Acpt); err != nil {
+		return err
+	}
+
+	// t.Paus (bool) (bool)
+	if len("Paus") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Paus\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Paus"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Paus")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteBool(w, t.Paus); err != nil {
+		return err
+	}
+
+	// t.XferID (uint64) (uint64)
+	if len("XferID") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"XferID\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("XferID"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("XferID")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.XferID)); err != nil {
+		return err
+	}
+
+	// t.VRes (typegen.Deferred) (struct)
+	if len("VRes") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"VRes\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("VRes"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("VRes")); err != nil {
+		return err
+	}
+
+	if err := t.VRes.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.VTyp (datatransfer.TypeIdentifier) (string)
+	if len("VTyp") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"VTyp\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("VTyp"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("VTyp")); err != nil {
+		return err
+	}
+
+	if len(t.VTyp) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.VTyp was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.VTyp))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.VTyp)); err != nil {
+		return err
+	}
+
+	// t.Caps (typegen.Deferred) (struct)
+	if len("Caps") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Caps\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Caps"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Caps")); err != nil {
+		return err
+	}
+
+	if err := t.Caps.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.VCdc (encoding.Codec) (uint64)
+	if len("VCdc") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"VCdc\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("VCdc"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("VCdc")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.VCdc)); err != nil {
+		return err
+	}
+
+	// t.MsgID (uint64) (uint64)
+	if len("MsgID") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"MsgID\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("MsgID"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("MsgID")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.MsgID)); err != nil {
+		return err
+	}
+
+	// t.Msg (typegen.Deferred) (struct)
+	if len("Msg") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Msg\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Msg"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Msg")); err != nil {
+		return err
+	}
+
+	if err := t.Msg.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.MTyp (datatransfer.TypeIdentifier) (string)
+	if len("MTyp") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"MTyp\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("MTyp"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("MTyp")); err != nil {
+		return err
+	}
+
+	if len(t.MTyp) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.MTyp was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.MTyp))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.MTyp)); err != nil {
+		return err
+	}
+
+	// t.MCdc (encoding.Codec) (uint64)
+	if len("MCdc") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"MCdc\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("MCdc"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("MCdc")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.MCdc)); err != nil {
+		return err
+	}
+
+	// t.Rsn (string) (string)
+	if len("Rsn") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"Rsn\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("Rsn"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("Rsn")); err != nil {
+		return err
+	}
+
+	if len(t.Rsn) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Rsn was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Rsn))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Rsn)); err != nil {
+		return err
+	}
+
+	// t.TBlks (uint64) (uint64)
+	if len("TBlks") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"TBlks\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("TBlks"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("TBlks")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.TBlks)); err != nil {
+		return err
+	}
+
+	// t.TSize (uint64) (uint64)
+	if len("TSize") > cbg.MaxLength {
+		return xerrors.Errorf("Value in field \"TSize\" was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len("TSize"))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string("TSize")); err != nil {
+		return err
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.TSize)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (t *transferResponse1_2) UnmarshalCBOR(r io.Reader) error {
+	*t = transferResponse1_2{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajMap {
+		return fmt.Errorf("cbor input should be of type map")
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("transferResponse1_2: map struct too large (%d)", extra)
+	}
+
+	var name string
+	n := extra
+
+	for i := uint64(0); i < n; i++ {
+
+		{
+			sval, err := cbg.ReadStringBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+
+			name = string(sval)
+		}
+
+		switch name {
+		// t.Type (uint64) (uint64)
+		case "Type":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.Type = uint64(extra)
+
+			}
+			// t.Acpt (bool) (bool)
+		case "Acpt":
+
+			maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+			if maj != cbg.MajOther {
+				return fmt.Errorf("booleans must be major type 7")
+			}
+			switch extra {
+			case 20:
+				t.Acpt = false
+			case 21:
+				t.Acpt = true
+			default:
+				return fmt.Errorf("booleans are either major type 7, value 20 or 21 (got %d)", extra)
+			}
+			// t.Paus (bool) (bool)
+		case "Paus":
+
+			maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+			if maj != cbg.MajOther {
+				return fmt.Errorf("booleans must be major type 7")
+			}
+			switch extra {
+			case 20:
+				t.Paus = false
+			case 21:
+				t.Paus = true
+			default:
+				return fmt.Errorf("booleans are either major type 7, value 20 or 21 (got %d)", extra)
+			}
+			// t.XferID (uint64) (uint64)
+		case "XferID":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.XferID = uint64(extra)
+
+			}
+			// t.VRes (typegen.Deferred) (struct)
+		case "VRes":
+
+			{
+
+				t.VRes = new(cbg.Deferred)
+
+				if err := t.VRes.UnmarshalCBOR(br); err != nil {
+					return xerrors.Errorf("failed to read deferred field: %w", err)
+				}
+			}
+			// t.VTyp (datatransfer.TypeIdentifier) (string)
+		case "VTyp":
+
+			{
+				sval, err := cbg.ReadStringBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+
+				t.VTyp = datatransfer.TypeIdentifier(sval)
+			}
+			// t.Caps (typegen.Deferred) (struct)
+		case "Caps":
+
+			{
+
+				t.Caps = new(cbg.Deferred)
+
+				if err := t.Caps.UnmarshalCBOR(br); err != nil {
+					return xerrors.Errorf("failed to read deferred field: %w", err)
+				}
+			}
+			// t.VCdc (encoding.Codec) (uint64)
+		case "VCdc":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.VCdc = encoding.Codec(extra)
+
+			}
+			// t.MsgID (uint64) (uint64)
+		case "MsgID":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.MsgID = uint64(extra)
+
+			}
+			// t.Msg (typegen.Deferred) (struct)
+		case "Msg":
+
+			{
+
+				t.Msg = new(cbg.Deferred)
+
+				if err := t.Msg.UnmarshalCBOR(br); err != nil {
+					return xerrors.Errorf("failed to read deferred field: %w", err)
+				}
+			}
+			// t.MTyp (datatransfer.TypeIdentifier) (string)
+		case "MTyp":
+
+			{
+				sval, err := cbg.ReadStringBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+
+				t.MTyp = datatransfer.TypeIdentifier(sval)
+			}
+			// t.MCdc (encoding.Codec) (uint64)
+		case "MCdc":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.MCdc = encoding.Codec(extra)
+
+			}
+			// t.Rsn (string) (string)
+		case "Rsn":
+
+			{
+				sval, err := cbg.ReadStringBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+
+				t.Rsn = string(sval)
+			}
+			// t.TBlks (uint64) (uint64)
+		case "TBlks":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.TBlks = uint64(extra)
+
+			}
+			// t.TSize (uint64) (uint64)
+		case "TSize":
+
+			{
+
+				maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+				if err != nil {
+					return err
+				}
+				if maj != cbg.MajUnsignedInt {
+					return fmt.Errorf("wrong type for uint64 field")
+				}
+				t.TSize = uint64(extra)
+
+			}
+
+		default:
+			// Field doesn't exist on this type, so ignore it
+			cbg.ScanForLinks(r, func(cid.Cid) {})
+		}
+	}
+
+	return nil
+}
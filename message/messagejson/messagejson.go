@@ -0,0 +1,167 @@
+// Package messagejson renders data transfer messages of every protocol
+// version as DAG-JSON, and reads them back
+package messagejson
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+)
+
+// Marshal renders the network form of a message as DAG-JSON. The peer IDs
+// of the channel a restart request names are binary strings that DAG-JSON
+// cannot hold, so they are rendered in their usual string form.
+func Marshal(msg datatransfer.Message) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := msg.ToNet(buf); err != nil {
+		return nil, err
+	}
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, buf); err != nil {
+		return nil, xerrors.Errorf("decoding CBOR: %w", err)
+	}
+	node, err := convertRestartChannel(nb.Build(), encodePeerID)
+	if err != nil {
+		return nil, err
+	}
+	out := new(bytes.Buffer)
+	if err := encoding.WriteDagJSON(node, out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// String renders a message as DAG-JSON for logging
+func String(msg datatransfer.Message) string {
+	encoded, err := Marshal(msg)
+	if err != nil {
+		return fmt.Sprintf("<unencodable message: %s>", err)
+	}
+	return string(encoded)
+}
+
+// Unmarshal reads a message rendered by Marshal, decoding its network form
+// with fromNet
+func Unmarshal(r io.Reader, fromNet func(io.Reader) (datatransfer.Message, error)) (datatransfer.Message, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := encoding.ReadDagJSON(nb, r); err != nil {
+		return nil, err
+	}
+	node, err := convertRestartChannel(nb.Build(), decodePeerID)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := dagcbor.Encode(node, buf); err != nil {
+		return nil, xerrors.Errorf("encoding CBOR: %w", err)
+	}
+	return fromNet(buf)
+}
+
+func encodePeerID(p string) (string, error) {
+	return peer.ID(p).String(), nil
+}
+
+func decodePeerID(p string) (string, error) {
+	id, err := peer.Decode(p)
+	if err != nil {
+		return "", xerrors.Errorf("decoding restart channel peer %s: %w", p, err)
+	}
+	return string(id), nil
+}
+
+// convertRestartChannel copies a message, converting the initiator and
+// responder of the channel a request names with RestartChannel. Messages on
+// protocols without the field, and empty peer IDs, are left as they are.
+func convertRestartChannel(msg ipld.Node, convert func(string) (string, error)) (ipld.Node, error) {
+	request, err := msg.LookupByString("Request")
+	if err != nil || request.Kind() != ipld.Kind_Map {
+		return msg, nil
+	}
+	channel, err := request.LookupByString("RestartChannel")
+	if err != nil || channel.Kind() != ipld.Kind_List {
+		return msg, nil
+	}
+
+	nb := basicnode.Prototype.List.NewBuilder()
+	la, err := nb.BeginList(channel.Length())
+	if err != nil {
+		return nil, err
+	}
+	for itr := channel.ListIterator(); !itr.Done(); {
+		idx, v, err := itr.Next()
+		if err != nil {
+			return nil, err
+		}
+		if idx < 2 && v.Kind() == ipld.Kind_String {
+			if v, err = convertString(v, convert); err != nil {
+				return nil, err
+			}
+		}
+		if err := la.AssembleValue().AssignNode(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := la.Finish(); err != nil {
+		return nil, err
+	}
+	request, err = replaceEntry(request, "RestartChannel", nb.Build())
+	if err != nil {
+		return nil, err
+	}
+	return replaceEntry(msg, "Request", request)
+}
+
+func convertString(n ipld.Node, convert func(string) (string, error)) (ipld.Node, error) {
+	s, err := n.AsString()
+	if err != nil || s == "" {
+		return n, err
+	}
+	converted, err := convert(s)
+	if err != nil {
+		return nil, err
+	}
+	return basicnode.NewString(converted), nil
+}
+
+// replaceEntry copies a map, keeping the order of its keys, with the value
+// of the given key replaced
+func replaceEntry(n ipld.Node, key string, value ipld.Node) (ipld.Node, error) {
+	nb := basicnode.Prototype.Map.NewBuilder()
+	ma, err := nb.BeginMap(n.Length())
+	if err != nil {
+		return nil, err
+	}
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		if err != nil {
+			return nil, err
+		}
+		s, err := k.AsString()
+		if err != nil {
+			return nil, err
+		}
+		if s == key {
+			v = value
+		}
+		if err := ma.AssembleKey().AssignString(s); err != nil {
+			return nil, err
+		}
+		if err := ma.AssembleValue().AssignNode(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := ma.Finish(); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
@@ -13,4 +13,7 @@ const (
 
 	RestartMessage
 	RestartExistingChannelRequestMessage
+
+	ChannelMessage
+	ChannelMessageAck
 )
@@ -0,0 +1,227 @@
+package message_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/fluent"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/message"
+	"github.com/filecoin-project/go-data-transfer/message/message1_0"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+var updateVectors = flag.Bool("update", false, "rewrite testdata/vectors.json from the current encoders")
+
+const vectorsFile = "testdata/vectors.json"
+
+// vector is a canonical message in both of its encodings
+type vector struct {
+	Name     string
+	Protocol protocol.ID
+	CBOR     string
+	DagJSON  json.RawMessage
+}
+
+type decoders struct {
+	fromNet     func(io.Reader) (datatransfer.Message, error)
+	fromDagJSON func(io.Reader) (datatransfer.Message, error)
+}
+
+var decodersForProtocol = map[protocol.ID]decoders{
+	datatransfer.ProtocolDataTransfer1_2: {message.FromNet, message.FromDagJSON},
+	datatransfer.ProtocolDataTransfer1_1: {message1_1.FromNet, message1_1.FromDagJSON},
+	datatransfer.ProtocolDataTransfer1_0: {message1_0.FromNet, message1_0.FromDagJSON},
+}
+
+func TestVectors(t *testing.T) {
+	if *updateVectors {
+		writeVectors(t)
+	}
+
+	encoded, err := ioutil.ReadFile(vectorsFile)
+	require.NoError(t, err)
+	var vectors []vector
+	require.NoError(t, json.Unmarshal(encoded, &vectors))
+	require.Len(t, vectors, len(canonicalVectors(t)))
+
+	for _, v := range vectors {
+		v := v
+		t.Run(v.Name+" "+string(v.Protocol), func(t *testing.T) {
+			dec, ok := decodersForProtocol[v.Protocol]
+			require.True(t, ok)
+			cborBytes, err := hex.DecodeString(v.CBOR)
+			require.NoError(t, err)
+			expectedJSON := new(bytes.Buffer)
+			require.NoError(t, json.Compact(expectedJSON, v.DagJSON))
+
+			// CBOR -> DAG-JSON
+			msg, err := dec.fromNet(bytes.NewReader(cborBytes))
+			require.NoError(t, err)
+			dagJSON, err := msg.MarshalJSON()
+			require.NoError(t, err)
+			require.Equal(t, expectedJSON.String(), string(dagJSON))
+			require.Equal(t, expectedJSON.String(), msg.String())
+
+			// DAG-JSON -> CBOR
+			msg, err = dec.fromDagJSON(bytes.NewReader(expectedJSON.Bytes()))
+			require.NoError(t, err)
+			buf := new(bytes.Buffer)
+			require.NoError(t, msg.ToNet(buf))
+			require.Equal(t, v.CBOR, hex.EncodeToString(buf.Bytes()))
+		})
+	}
+}
+
+func TestDebug(t *testing.T) {
+	voucher := &testutil.FakeDTType{Data: "debug voucher"}
+	request, err := message.NewRequest(1, false, true, voucher.Type(), voucher, vectorCid(t), vectorSelector())
+	require.NoError(t, err)
+	fakeDTDecoder, err := encoding.NewDecoder(&testutil.FakeDTType{})
+	require.NoError(t, err)
+	lookup := func(identifier datatransfer.TypeIdentifier) (encoding.Decoder, bool) {
+		if identifier != voucher.Type() {
+			return nil, false
+		}
+		return fakeDTDecoder, true
+	}
+
+	var rendered struct {
+		Message json.RawMessage
+		Voucher *testutil.FakeDTType
+	}
+	require.NoError(t, json.Unmarshal([]byte(message.Debug{Message: request, Vouchers: lookup}.String()), &rendered))
+	require.Equal(t, voucher, rendered.Voucher)
+	dagJSON, err := request.MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, string(dagJSON), string(rendered.Message))
+
+	// without a decoder for the type only the message is rendered
+	rendered.Voucher = nil
+	require.NoError(t, json.Unmarshal([]byte(message.Debug{Message: request}.String()), &rendered))
+	require.Nil(t, rendered.Voucher)
+
+	// voucher results are decoded the same way
+	response, err := message.NewResponse(1, true, false, voucher.Type(), voucher)
+	require.NoError(t, err)
+	var renderedResponse struct {
+		VoucherResult *testutil.FakeDTType
+	}
+	require.NoError(t, json.Unmarshal([]byte(message.Debug{Message: response, VoucherResults: lookup}.String()), &renderedResponse))
+	require.Equal(t, voucher, renderedResponse.VoucherResult)
+}
+
+func writeVectors(t *testing.T) {
+	vectors := canonicalVectors(t)
+	encoded, err := json.MarshalIndent(vectors, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.FromSlash(vectorsFile), append(encoded, '\n'), 0644))
+}
+
+// canonicalVectors encodes one of each kind of message, for every protocol
+// the message can be sent on
+func canonicalVectors(t *testing.T) []vector {
+	const id = datatransfer.TransferID(1234)
+	baseCid := vectorCid(t)
+	selector := vectorSelector()
+	voucher := &testutil.FakeDTType{Data: "voucher"}
+	voucherResult := &testutil.FakeDTType{Data: "voucher result"}
+	dagJSONVoucher := &testutil.FakeDagJSONType{FakeDTType: testutil.FakeDTType{Data: "voucher"}}
+	dagJSONVoucherResult := &testutil.FakeDagJSONType{FakeDTType: testutil.FakeDTType{Data: "voucher result"}}
+	bytesVoucher := fluent.MustBuildMap(basicnode.Prototype.Map, 1, func(ma fluent.MapAssembler) {
+		ma.AssembleEntry("Payload").AssignBytes([]byte("voucher bytes"))
+	})
+	initiator, err := peer.Decode("12D3KooWRBy97UB99e3J6hiPesre1MZeuNQvfan4gBziswrRJsNK")
+	require.NoError(t, err)
+	responder, err := peer.Decode("12D3KooWCZDc3uTYHtGRrn3pY9NVUNJz3ga6hwyyoTp2Ga2ciYaP")
+	require.NoError(t, err)
+
+	must := func(msg datatransfer.Message, err error) datatransfer.Message {
+		require.NoError(t, err)
+		return msg
+	}
+	pushRequest, err := message.NewRequest(id, false, false, voucher.Type(), voucher, baseCid, selector)
+	require.NoError(t, err)
+	newResponse, err := message.NewResponse(id, true, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+	restartResponse, err := message.RestartResponse(id, true, false, voucherResult.Type(), voucherResult)
+	require.NoError(t, err)
+	messages := []struct {
+		name string
+		msg  datatransfer.Message
+	}{
+		{"push request", must(message.NewRequest(id, false, false, voucher.Type(), voucher, baseCid, selector))},
+		{"pull request", must(message.NewRequest(id, false, true, voucher.Type(), voucher, baseCid, selector))},
+		{"request with bytes voucher", must(message.NewRequest(id, false, true, "BytesVoucher", bytesVoucher, baseCid, selector))},
+		{"request with DAG-JSON voucher", must(message.NewRequest(id, false, true, dagJSONVoucher.Type(), dagJSONVoucher, baseCid, selector))},
+		{"restart request", must(message.NewRequest(id, true, true, voucher.Type(), voucher, baseCid, selector))},
+		{"restart existing channel request", message.RestartExistingChannelRequest(datatransfer.ChannelID{Initiator: initiator, Responder: responder, ID: id})},
+		{"update request", message.UpdateRequest(id, true)},
+		{"voucher request", must(message.VoucherRequest(id, voucher.Type(), voucher))},
+		{"cancel request", message.CancelRequest(id)},
+		{"new response", must(message.NewResponse(id, true, false, voucherResult.Type(), voucherResult))},
+		{"reject response", must(message.RejectResponse(id, "request validation timed out", voucherResult.Type(), voucherResult))},
+		{"restart response", must(message.RestartResponse(id, true, false, voucherResult.Type(), voucherResult))},
+		{"voucher result response", must(message.VoucherResultResponse(id, false, true, voucherResult.Type(), voucherResult))},
+		{"response with DAG-JSON voucher result", must(message.VoucherResultResponse(id, false, true, dagJSONVoucherResult.Type(), dagJSONVoucherResult))},
+		{"update response", message.UpdateResponse(id, true)},
+		{"complete response", must(message.CompleteResponse(id, true, false, voucherResult.Type(), voucherResult))},
+		{"cancel response", message.CancelResponse(id)},
+		{"channel message request", must(message.ChannelMessageRequest(id, 5678, voucher.Type(), voucher))},
+		{"channel message ack request", message.ChannelMessageAckRequest(id, 5678)},
+		{"channel message response", must(message.ChannelMessageResponse(id, 5678, voucherResult.Type(), voucherResult))},
+		{"channel message ack response", message.ChannelMessageAckResponse(id, 5678)},
+		{"push request with total size", must(message.RequestWithTotalSize(pushRequest, 12, 3456))},
+		{"new response with total size", must(message.ResponseWithTotalSize(newResponse, 12, 3456))},
+		{"restart response with total size", must(message.ResponseWithTotalSize(restartResponse, 12, 3456))},
+	}
+
+	protocols := []protocol.ID{datatransfer.ProtocolDataTransfer1_2, datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0}
+	var vectors []vector
+	for _, m := range messages {
+		for _, p := range protocols {
+			msg, err := m.msg.MessageForProtocol(p)
+			if err != nil {
+				// not every message can be sent on older protocols
+				continue
+			}
+			buf := new(bytes.Buffer)
+			require.NoError(t, msg.ToNet(buf))
+			dagJSON, err := msg.MarshalJSON()
+			require.NoError(t, err)
+			vectors = append(vectors, vector{
+				Name:     m.name,
+				Protocol: p,
+				CBOR:     hex.EncodeToString(buf.Bytes()),
+				DagJSON:  dagJSON,
+			})
+		}
+	}
+	return vectors
+}
+
+func vectorCid(t *testing.T) cid.Cid {
+	c, err := cid.Decode("bafyreibdoxfay27gf4ye3t5a7aa5h4z2azw7hhhz36qrbf5qleldj76qfa")
+	require.NoError(t, err)
+	return c
+}
+
+func vectorSelector() ipld.Node {
+	return builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+}
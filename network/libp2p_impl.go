@@ -17,6 +17,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/message"
 	"github.com/filecoin-project/go-data-transfer/message/message1_0"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
 )
 
 var log = logging.Logger("data_transfer_network")
@@ -39,7 +40,7 @@ const defaultMaxAttemptDuration = 5 * time.Minute
 // The multiplier in the backoff time for each retry
 const defaultBackoffFactor = 5
 
-var defaultDataTransferProtocols = []protocol.ID{datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0}
+var defaultDataTransferProtocols = []protocol.ID{datatransfer.ProtocolDataTransfer1_2, datatransfer.ProtocolDataTransfer1_1, datatransfer.ProtocolDataTransfer1_0}
 
 // Option is an option for configuring the libp2p storage market network
 type Option func(*libp2pDataTransferNetwork)
@@ -199,9 +200,12 @@ func (dtnet *libp2pDataTransferNetwork) handleNewStream(s network.Stream) {
 	for {
 		var received datatransfer.Message
 		var err error
-		if s.Protocol() == datatransfer.ProtocolDataTransfer1_1 {
+		switch s.Protocol() {
+		case datatransfer.ProtocolDataTransfer1_2:
 			received, err = message.FromNet(s)
-		} else {
+		case datatransfer.ProtocolDataTransfer1_1:
+			received, err = message1_1.FromNet(s)
+		default:
 			received, err = message1_0.FromNet(s)
 		}
 
@@ -262,6 +266,7 @@ func (dtnet *libp2pDataTransferNetwork) msgToStream(ctx context.Context, s netwo
 	}
 
 	switch s.Protocol() {
+	case datatransfer.ProtocolDataTransfer1_2:
 	case datatransfer.ProtocolDataTransfer1_1:
 	case datatransfer.ProtocolDataTransfer1_0:
 	default:
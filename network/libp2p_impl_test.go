@@ -298,3 +298,72 @@ func TestSendMessageRetry(t *testing.T) {
 		})
 	}
 }
+
+// TestProtocolDowngrade verifies that capabilities are sent to peers that
+// speak 1.2, and that a peer only speaking an older protocol receives the
+// capabilities that protocol implies
+func TestProtocolDowngrade(t *testing.T) {
+	testCases := map[string]struct {
+		protocols    []protocol.ID
+		expectedCaps datatransfer.Capabilities
+	}{
+		"1.2": {
+			protocols:    []protocol.ID{datatransfer.ProtocolDataTransfer1_2},
+			expectedCaps: datatransfer.SupportedCapabilities,
+		},
+		"1.1": {
+			protocols:    []protocol.ID{datatransfer.ProtocolDataTransfer1_1},
+			expectedCaps: datatransfer.ProtocolCapabilities(datatransfer.ProtocolDataTransfer1_1),
+		},
+		"1.0": {
+			protocols:    []protocol.ID{datatransfer.ProtocolDataTransfer1_0},
+			expectedCaps: datatransfer.ProtocolCapabilities(datatransfer.ProtocolDataTransfer1_0),
+		},
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			mn := mocknet.New(ctx)
+
+			host1, err := mn.GenPeer()
+			require.NoError(t, err)
+			host2, err := mn.GenPeer()
+			require.NoError(t, err)
+			err = mn.LinkAll()
+			require.NoError(t, err)
+
+			dtnet1 := network.NewFromLibp2pHost(host1)
+			dtnet2 := network.NewFromLibp2pHost(host2, network.DataTransferProtocols(data.protocols))
+			r := &receiver{
+				messageReceived: make(chan struct{}),
+				connectedPeers:  make(chan peer.ID, 2),
+			}
+			dtnet1.SetDelegate(r)
+			dtnet2.SetDelegate(r)
+
+			err = dtnet1.ConnectTo(ctx, host2.ID())
+			require.NoError(t, err)
+
+			baseCid := testutil.GenerateCids(1)[0]
+			selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+			id := datatransfer.TransferID(rand.Int31())
+			voucher := testutil.NewFakeDTType()
+			request, err := message.NewRequest(id, false, true, voucher.Type(), voucher, baseCid, selector)
+			require.NoError(t, err)
+			require.NoError(t, dtnet1.SendMessage(ctx, host2.ID(), request))
+
+			select {
+			case <-ctx.Done():
+				t.Fatal("did not receive message sent")
+			case <-r.messageReceived:
+			}
+
+			receivedRequest := r.lastRequest
+			require.NotNil(t, receivedRequest)
+			require.Equal(t, request.TransferID(), receivedRequest.TransferID())
+			require.Equal(t, data.expectedCaps, receivedRequest.Capabilities())
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package selectorpolicy
+
+import (
+	"github.com/ipld/go-ipld-prime"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// Policy is a datatransfer.SelectorPolicy that limits recursion and the
+// explore types allowed in a selector
+type Policy struct {
+	maxDepth          int64
+	rejectUnbounded   bool
+	rewrite           bool
+	disallowedExplore map[string]struct{}
+}
+
+var _ datatransfer.SelectorPolicy = (*Policy)(nil)
+
+// Option configures a Policy
+type Option func(*Policy)
+
+// MaxRecursionDepth limits the depth of every recursive explore in a selector
+func MaxRecursionDepth(depth int64) Option {
+	return func(p *Policy) {
+		p.maxDepth = depth
+	}
+}
+
+// RejectUnboundedRecursion rejects recursive explores with no depth limit.
+// With RewriteToLimits and MaxRecursionDepth, they are limited to the max
+// depth instead.
+func RejectUnboundedRecursion() Option {
+	return func(p *Policy) {
+		p.rejectUnbounded = true
+	}
+}
+
+// RewriteToLimits narrows push request selectors that exceed the recursion
+// limits, rather than rejecting them. Pull request selectors are always
+// rejected, since the requestor runs the traversal on its own selector.
+func RewriteToLimits() Option {
+	return func(p *Policy) {
+		p.rewrite = true
+	}
+}
+
+// DisallowExploreTypes rejects selectors using any of the given explore
+// types, named by their selector keys, e.g. selector.SelectorKey_ExploreRecursive
+func DisallowExploreTypes(keys ...string) Option {
+	return func(p *Policy) {
+		for _, key := range keys {
+			p.disallowedExplore[key] = struct{}{}
+		}
+	}
+}
+
+// New returns a Policy with the given options. With no options, any well
+// formed selector is accepted.
+func New(options ...Option) *Policy {
+	p := &Policy{
+		disallowedExplore: make(map[string]struct{}),
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// ApplyPolicy checks the selector, returning it or a narrowed copy if it
+// complies with the policy, or an error if it does not
+func (p *Policy) ApplyPolicy(isPull bool, sel ipld.Node) (ipld.Node, error) {
+	w := walker{p, p.rewrite && !isPull}
+	out, err := w.selector(sel)
+	if err != nil {
+		return nil, xerrors.Errorf("selector rejected by policy: %w", err)
+	}
+	if _, err := selector.ParseSelector(out); err != nil {
+		return nil, xerrors.Errorf("invalid selector: %w", err)
+	}
+	return out, nil
+}
+
+type walker struct {
+	*Policy
+	rewrite bool
+}
+
+// selector walks a selector envelope, returning it with limits applied
+func (w walker) selector(n ipld.Node) (ipld.Node, error) {
+	if n.Kind() != ipld.Kind_Map || n.Length() != 1 {
+		return nil, xerrors.New("selector must be a map with a single entry")
+	}
+	key, body, err := n.MapIterator().Next()
+	if err != nil {
+		return nil, err
+	}
+	explore, err := key.AsString()
+	if err != nil {
+		return nil, err
+	}
+	if _, disallowed := w.disallowedExplore[explore]; disallowed {
+		return nil, xerrors.Errorf("explore type %q is not allowed", explore)
+	}
+
+	switch explore {
+	case selector.SelectorKey_Matcher, selector.SelectorKey_ExploreRecursiveEdge:
+		return n, nil
+	case selector.SelectorKey_ExploreAll, selector.SelectorKey_ExploreIndex, selector.SelectorKey_ExploreRange, selector.SelectorKey_ExploreConditional:
+		body, err = rebuildMap(body, func(k string, v ipld.Node) (ipld.Node, error) {
+			if k == selector.SelectorKey_Next {
+				return w.selector(v)
+			}
+			return v, nil
+		})
+	case selector.SelectorKey_ExploreFields:
+		body, err = rebuildMap(body, func(k string, v ipld.Node) (ipld.Node, error) {
+			if k == selector.SelectorKey_Fields {
+				return rebuildMap(v, func(_ string, field ipld.Node) (ipld.Node, error) {
+					return w.selector(field)
+				})
+			}
+			return v, nil
+		})
+	case selector.SelectorKey_ExploreUnion:
+		body, err = rebuildList(body, w.selector)
+	case selector.SelectorKey_ExploreRecursive:
+		body, err = rebuildMap(body, func(k string, v ipld.Node) (ipld.Node, error) {
+			switch k {
+			case selector.SelectorKey_Limit:
+				return w.limit(v)
+			case selector.SelectorKey_Sequence:
+				return w.selector(v)
+			}
+			return v, nil
+		})
+	default:
+		return nil, xerrors.Errorf("unknown explore type %q", explore)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rebuildMap(n, func(string, ipld.Node) (ipld.Node, error) {
+		return body, nil
+	})
+}
+
+// limit checks the recursion limit of a recursive explore
+func (w walker) limit(n ipld.Node) (ipld.Node, error) {
+	if n.Kind() != ipld.Kind_Map || n.Length() != 1 {
+		return nil, xerrors.New("recursion limit must be a map with a single entry")
+	}
+	key, value, err := n.MapIterator().Next()
+	if err != nil {
+		return nil, err
+	}
+	kind, err := key.AsString()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case selector.SelectorKey_LimitNone:
+		if !w.rejectUnbounded && w.maxDepth == 0 {
+			return n, nil
+		}
+		if w.rewrite && w.maxDepth > 0 {
+			return depthLimit(w.maxDepth)
+		}
+		return nil, xerrors.New("unbounded recursion is not allowed")
+	case selector.SelectorKey_LimitDepth:
+		depth, err := value.AsInt()
+		if err != nil {
+			return nil, err
+		}
+		if w.maxDepth == 0 || depth <= w.maxDepth {
+			return n, nil
+		}
+		if w.rewrite {
+			return depthLimit(w.maxDepth)
+		}
+		return nil, xerrors.Errorf("recursion depth %d exceeds limit of %d", depth, w.maxDepth)
+	default:
+		return nil, xerrors.Errorf("unknown recursion limit %q", kind)
+	}
+}
+
+func depthLimit(depth int64) (ipld.Node, error) {
+	nb := basicnode.Prototype.Map.NewBuilder()
+	ma, err := nb.BeginMap(1)
+	if err != nil {
+		return nil, err
+	}
+	if err := ma.AssembleKey().AssignString(selector.SelectorKey_LimitDepth); err != nil {
+		return nil, err
+	}
+	if err := ma.AssembleValue().AssignInt(depth); err != nil {
+		return nil, err
+	}
+	if err := ma.Finish(); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// rebuildMap copies a map node, replacing each value with the result of fn
+func rebuildMap(n ipld.Node, fn func(key string, value ipld.Node) (ipld.Node, error)) (ipld.Node, error) {
+	if n.Kind() != ipld.Kind_Map {
+		return nil, xerrors.Errorf("expected a map, got %s", n.Kind())
+	}
+	nb := basicnode.Prototype.Map.NewBuilder()
+	ma, err := nb.BeginMap(n.Length())
+	if err != nil {
+		return nil, err
+	}
+	for itr := n.MapIterator(); !itr.Done(); {
+		k, v, err := itr.Next()
+		if err != nil {
+			return nil, err
+		}
+		key, err := k.AsString()
+		if err != nil {
+			return nil, err
+		}
+		v, err = fn(key, v)
+		if err != nil {
+			return nil, err
+		}
+		if err := ma.AssembleKey().AssignString(key); err != nil {
+			return nil, err
+		}
+		if err := ma.AssembleValue().AssignNode(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := ma.Finish(); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// rebuildList copies a list node, replacing each value with the result of fn
+func rebuildList(n ipld.Node, fn func(value ipld.Node) (ipld.Node, error)) (ipld.Node, error) {
+	if n.Kind() != ipld.Kind_List {
+		return nil, xerrors.Errorf("expected a list, got %s", n.Kind())
+	}
+	nb := basicnode.Prototype.List.NewBuilder()
+	la, err := nb.BeginList(n.Length())
+	if err != nil {
+		return nil, err
+	}
+	for itr := n.ListIterator(); !itr.Done(); {
+		_, v, err := itr.Next()
+		if err != nil {
+			return nil, err
+		}
+		v, err = fn(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := la.AssembleValue().AssignNode(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := la.Finish(); err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
@@ -0,0 +1,122 @@
+package selectorpolicy_test
+
+import (
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/stretchr/testify/require"
+
+	"github.com/filecoin-project/go-data-transfer/selectorpolicy"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	recursive := func(limit selector.RecursionLimit) ipld.Node {
+		return ssb.ExploreRecursive(limit, ssb.ExploreAll(ssb.ExploreRecursiveEdge())).Node()
+	}
+	// recursion nested under fields and a union, to check the whole selector is walked
+	nested := func(limit selector.RecursionLimit) ipld.Node {
+		return ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+			efsb.Insert("R", ssb.ExploreUnion(
+				ssb.Matcher(),
+				ssb.ExploreRecursive(limit, ssb.ExploreAll(ssb.ExploreRecursiveEdge())),
+			))
+		}).Node()
+	}
+
+	testCases := map[string]struct {
+		options  []selectorpolicy.Option
+		isPull   bool
+		selector ipld.Node
+		expected ipld.Node
+		errors   bool
+	}{
+		"no options accepts anything": {
+			selector: recursive(selector.RecursionLimitNone()),
+			expected: recursive(selector.RecursionLimitNone()),
+		},
+		"depth within limit": {
+			options:  []selectorpolicy.Option{selectorpolicy.MaxRecursionDepth(10)},
+			selector: recursive(selector.RecursionLimitDepth(10)),
+			expected: recursive(selector.RecursionLimitDepth(10)),
+		},
+		"depth over limit": {
+			options:  []selectorpolicy.Option{selectorpolicy.MaxRecursionDepth(10)},
+			selector: recursive(selector.RecursionLimitDepth(11)),
+			errors:   true,
+		},
+		"unbounded with max depth": {
+			options:  []selectorpolicy.Option{selectorpolicy.MaxRecursionDepth(10)},
+			selector: recursive(selector.RecursionLimitNone()),
+			errors:   true,
+		},
+		"unbounded rejected": {
+			options:  []selectorpolicy.Option{selectorpolicy.RejectUnboundedRecursion()},
+			selector: recursive(selector.RecursionLimitNone()),
+			errors:   true,
+		},
+		"bounded allowed when rejecting unbounded": {
+			options:  []selectorpolicy.Option{selectorpolicy.RejectUnboundedRecursion()},
+			selector: recursive(selector.RecursionLimitDepth(1000)),
+			expected: recursive(selector.RecursionLimitDepth(1000)),
+		},
+		"depth over limit rewritten on push": {
+			options:  []selectorpolicy.Option{selectorpolicy.MaxRecursionDepth(10), selectorpolicy.RewriteToLimits()},
+			selector: recursive(selector.RecursionLimitDepth(11)),
+			expected: recursive(selector.RecursionLimitDepth(10)),
+		},
+		"unbounded rewritten on push": {
+			options: []selectorpolicy.Option{
+				selectorpolicy.MaxRecursionDepth(10),
+				selectorpolicy.RejectUnboundedRecursion(),
+				selectorpolicy.RewriteToLimits(),
+			},
+			selector: nested(selector.RecursionLimitNone()),
+			expected: nested(selector.RecursionLimitDepth(10)),
+		},
+		"unbounded rejected on pull even when rewriting": {
+			options:  []selectorpolicy.Option{selectorpolicy.MaxRecursionDepth(10), selectorpolicy.RewriteToLimits()},
+			isPull:   true,
+			selector: recursive(selector.RecursionLimitNone()),
+			errors:   true,
+		},
+		"nested depth over limit": {
+			options:  []selectorpolicy.Option{selectorpolicy.MaxRecursionDepth(10)},
+			selector: nested(selector.RecursionLimitDepth(11)),
+			errors:   true,
+		},
+		"disallowed explore type": {
+			options:  []selectorpolicy.Option{selectorpolicy.DisallowExploreTypes(selector.SelectorKey_ExploreRecursive)},
+			selector: nested(selector.RecursionLimitDepth(1)),
+			errors:   true,
+		},
+		"field named like a disallowed explore type": {
+			options: []selectorpolicy.Option{selectorpolicy.DisallowExploreTypes(selector.SelectorKey_ExploreRecursive)},
+			selector: ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+				efsb.Insert("R", ssb.Matcher())
+			}).Node(),
+			expected: ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+				efsb.Insert("R", ssb.Matcher())
+			}).Node(),
+		},
+		"malformed selector": {
+			selector: basicnode.NewString("apples"),
+			errors:   true,
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			policy := selectorpolicy.New(data.options...)
+			out, err := policy.ApplyPolicy(data.isPull, data.selector)
+			if data.errors {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, data.expected, out)
+		})
+	}
+}
@@ -58,6 +58,10 @@ const (
 
 	// ChannelNotFoundError means the searched for data transfer does not exist
 	ChannelNotFoundError
+
+	// Validating means the responder is validating a request asynchronously
+	// and has not yet accepted or rejected it
+	Validating
 )
 
 // Statuses are human readable names for data transfer states
@@ -80,4 +84,5 @@ var Statuses = map[Status]string{
 	ResponderFinalizing:                 "ResponderFinalizing",
 	ResponderFinalizingTransferFinished: "ResponderFinalizingTransferFinished",
 	ChannelNotFoundError:                "ChannelNotFoundError",
+	Validating:                          "Validating",
 }
@@ -0,0 +1,195 @@
+// Package channelstoretest is a conformance suite for channels.ChannelStore
+// implementations
+package channelstoretest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/channels"
+	"github.com/filecoin-project/go-data-transfer/cidlists"
+	"github.com/filecoin-project/go-data-transfer/encoding"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+)
+
+// Run runs the conformance tests every channels.ChannelStore implementation
+// must pass. newStore is called for each test and must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) channels.ChannelStore) {
+	peers := testutil.GeneratePeers(2)
+	chid := func(id uint64) datatransfer.ChannelID {
+		return datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: datatransfer.TransferID(id)}
+	}
+
+	t.Run("empty store", func(t *testing.T) {
+		store := newStore(t)
+		has, err := store.Has(chid(1))
+		require.NoError(t, err)
+		require.False(t, has)
+		_, err = store.Get(chid(1))
+		var notFound *channels.ErrNotFound
+		require.True(t, xerrors.As(err, &notFound), "Get of a missing channel should return *channels.ErrNotFound, got %v", err)
+		require.Equal(t, chid(1), notFound.ChannelID)
+		require.NoError(t, store.Delete(chid(1)))
+		require.Empty(t, listStore(t, store))
+	})
+
+	t.Run("put, get and delete", func(t *testing.T) {
+		store := newStore(t)
+		require.NoError(t, store.Put(chid(1), []byte("first")))
+		require.NoError(t, store.Put(chid(2), []byte("second")))
+
+		has, err := store.Has(chid(1))
+		require.NoError(t, err)
+		require.True(t, has)
+		record, err := store.Get(chid(1))
+		require.NoError(t, err)
+		require.Equal(t, []byte("first"), record)
+
+		require.NoError(t, store.Put(chid(1), []byte("replaced")))
+		record, err = store.Get(chid(1))
+		require.NoError(t, err)
+		require.Equal(t, []byte("replaced"), record)
+
+		require.NoError(t, store.Delete(chid(1)))
+		has, err = store.Has(chid(1))
+		require.NoError(t, err)
+		require.False(t, has)
+		record, err = store.Get(chid(2))
+		require.NoError(t, err)
+		require.Equal(t, []byte("second"), record)
+	})
+
+	t.Run("channel IDs are distinct", func(t *testing.T) {
+		store := newStore(t)
+		other := datatransfer.ChannelID{Initiator: peers[1], Responder: peers[0], ID: 1}
+		require.NoError(t, store.Put(chid(1), []byte("first")))
+		has, err := store.Has(other)
+		require.NoError(t, err)
+		require.False(t, has)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		store := newStore(t)
+		expected := make(map[datatransfer.ChannelID]string)
+		for i := uint64(0); i < 10; i++ {
+			record := fmt.Sprintf("record %d", i)
+			require.NoError(t, store.Put(chid(i), []byte(record)))
+			expected[chid(i)] = record
+		}
+		require.Equal(t, expected, listStore(t, store))
+
+		stop := xerrors.New("stop")
+		calls := 0
+		err := store.List(func(datatransfer.ChannelID, []byte) error {
+			calls++
+			return stop
+		})
+		require.True(t, xerrors.Is(err, stop), "List should return the error from fn, got %v", err)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("concurrent channels", func(t *testing.T) {
+		store := newStore(t)
+		var wg sync.WaitGroup
+		for i := uint64(0); i < 20; i++ {
+			wg.Add(1)
+			go func(id uint64) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if err := store.Put(chid(id), []byte(fmt.Sprint(j))); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		records := listStore(t, store)
+		require.Len(t, records, 20)
+		for _, record := range records {
+			require.Equal(t, "9", record)
+		}
+	})
+
+	t.Run("backs channels", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		store := newStore(t)
+		ds := dss.MutexWrap(datastore.NewMapDatastore())
+		decoder := func(datatransfer.TypeIdentifier) (encoding.Decoder, bool) {
+			decoder, _ := encoding.NewDecoder(&testutil.FakeDTType{})
+			return decoder, true
+		}
+		newChannels := func() *channels.Channels {
+			chans, err := channels.New(ds, cidlists.NewDatastoreCIDLists(ds), func(datatransfer.Event, datatransfer.ChannelState) {}, decoder, decoder, storeEnv{peers[0]}, peers[0], channels.WithChannelStore(store))
+			require.NoError(t, err)
+			require.NoError(t, chans.Start(ctx))
+			return chans
+		}
+
+		chans := newChannels()
+		selector := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+		cids := testutil.GenerateCids(2)
+		id, err := chans.CreateNew(peers[0], 1, cids[0], selector, &testutil.FakeDTType{Data: "voucher"}, peers[0], peers[0], peers[1])
+		require.NoError(t, err)
+		require.NoError(t, chans.Accept(id))
+		_, err = chans.DataReceived(id, cids[1], 100)
+		require.NoError(t, err)
+		chst, err := chans.GetByID(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, datatransfer.Ongoing, chst.Status())
+		require.Equal(t, uint64(100), chst.Received())
+		require.NoError(t, chans.Stop(ctx))
+
+		// the state is read back from the store
+		chans = newChannels()
+		chst, err = chans.GetByID(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, datatransfer.Ongoing, chst.Status())
+		require.Equal(t, uint64(100), chst.Received())
+		require.Equal(t, &testutil.FakeDTType{Data: "voucher"}, chst.Voucher())
+		all, err := chans.InProgress()
+		require.NoError(t, err)
+		require.Len(t, all, 1)
+
+		require.NoError(t, chans.Delete(id))
+		has, err := store.Has(id)
+		require.NoError(t, err)
+		require.False(t, has)
+		require.NoError(t, chans.Stop(ctx))
+	})
+}
+
+func listStore(t *testing.T, store channels.ChannelStore) map[datatransfer.ChannelID]string {
+	records := make(map[datatransfer.ChannelID]string)
+	err := store.List(func(chid datatransfer.ChannelID, record []byte) error {
+		_, ok := records[chid]
+		require.False(t, ok, "channel %s listed twice", chid)
+		records[chid] = string(record)
+		return nil
+	})
+	require.NoError(t, err)
+	return records
+}
+
+// storeEnv stands in for the network when running channels over a store
+type storeEnv struct {
+	self peer.ID
+}
+
+func (storeEnv) Protect(peer.ID, string)               {}
+func (storeEnv) Unprotect(peer.ID, string) bool        { return false }
+func (se storeEnv) ID() peer.ID                        { return se.self }
+func (storeEnv) CleanupChannel(datatransfer.ChannelID) {}
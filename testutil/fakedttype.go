@@ -1,6 +1,7 @@
 package testutil
 
 import (
+	"encoding/hex"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -71,3 +72,60 @@ func NewFakeDTType() *FakeDTType {
 }
 
 var _ datatransfer.Registerable = &FakeDTType{}
+
+// FakeDagJSONType is a fake type that is encoded as DAG-JSON
+type FakeDagJSONType struct {
+	FakeDTType
+}
+
+// Type satisfies registry.Entry
+func (FakeDagJSONType) Type() datatransfer.TypeIdentifier {
+	return "FakeDagJSONType"
+}
+
+// Codec declares the type is encoded as DAG-JSON
+func (*FakeDagJSONType) Codec() encoding.Codec {
+	return encoding.DagJSON
+}
+
+// NewFakeDagJSONType returns a fake type encoded as DAG-JSON with random data
+func NewFakeDagJSONType() *FakeDagJSONType {
+	return &FakeDagJSONType{FakeDTType{Data: hex.EncodeToString(RandomBytes(50))}}
+}
+
+var _ datatransfer.Registerable = &FakeDagJSONType{}
+
+// FakeDTTypeV1 is version 1 of a fake versioned type
+type FakeDTTypeV1 struct {
+	FakeDTType
+}
+
+// Type satisfies registry.Entry
+func (FakeDTTypeV1) Type() datatransfer.TypeIdentifier {
+	return datatransfer.VersionedTypeIdentifier("FakeVersionedType", 1)
+}
+
+// NewFakeDTTypeV1 returns version 1 of a fake versioned type with random data
+func NewFakeDTTypeV1() *FakeDTTypeV1 {
+	return &FakeDTTypeV1{FakeDTType{Data: string(RandomBytes(100))}}
+}
+
+// FakeDTTypeV2 is version 2 of a fake versioned type
+type FakeDTTypeV2 struct {
+	FakeDTType
+}
+
+// Type satisfies registry.Entry
+func (FakeDTTypeV2) Type() datatransfer.TypeIdentifier {
+	return datatransfer.VersionedTypeIdentifier("FakeVersionedType", 2)
+}
+
+// UpgradeFakeDTTypeV1 upgrades version 1 of the fake versioned type to
+// version 2
+func UpgradeFakeDTTypeV1(voucher datatransfer.Voucher) (datatransfer.Voucher, error) {
+	return &FakeDTTypeV2{voucher.(*FakeDTTypeV1).FakeDTType}, nil
+}
+
+var _ datatransfer.Registerable = &FakeDTTypeV1{}
+var _ datatransfer.Registerable = &FakeDTTypeV2{}
+var _ datatransfer.VoucherUpgrader = UpgradeFakeDTTypeV1
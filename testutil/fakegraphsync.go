@@ -24,7 +24,7 @@ import (
 func matchDtMessage(t *testing.T, extensions []graphsync.ExtensionData) datatransfer.Message {
 	var matchedExtension *graphsync.ExtensionData
 	for _, ext := range extensions {
-		if ext.Name == extension.ExtensionDataTransfer1_1 {
+		if ext.Name == extension.ExtensionDataTransfer1_2 {
 			matchedExtension = &ext
 			break
 		}
@@ -88,8 +88,7 @@ type CancelResponse struct {
 }
 
 type PersistenceOption struct {
-	ipld.Loader
-	ipld.Storer
+	ipld.LinkSystem
 }
 
 // FakeGraphSync implements a GraphExchange but does nothing
@@ -258,15 +257,15 @@ func (fgs *FakeGraphSync) Request(ctx context.Context, p peer.ID, root ipld.Link
 	return responses, errors
 }
 
-// RegisterPersistenceOption registers an alternate loader/storer combo that can be substituted for the default
-func (fgs *FakeGraphSync) RegisterPersistenceOption(name string, loader ipld.Loader, storer ipld.Storer) error {
+// RegisterPersistenceOption registers an alternate link system that can be substituted for the default
+func (fgs *FakeGraphSync) RegisterPersistenceOption(name string, lsys ipld.LinkSystem) error {
 	fgs.persistenceOptionsLk.Lock()
 	defer fgs.persistenceOptionsLk.Unlock()
 	_, ok := fgs.persistenceOptions[name]
 	if ok {
 		return errors.New("already registered")
 	}
-	fgs.persistenceOptions[name] = PersistenceOption{Loader: loader, Storer: storer}
+	fgs.persistenceOptions[name] = PersistenceOption{LinkSystem: lsys}
 	return nil
 }
 
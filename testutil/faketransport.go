@@ -26,6 +26,12 @@ type ResumedChannel struct {
 	Message   datatransfer.Message
 }
 
+// UsedStore records a call to use a store for a channel
+type UsedStore struct {
+	ChannelID  datatransfer.ChannelID
+	LinkSystem ipld.LinkSystem
+}
+
 // CustomizedTransfer is just a way to record calls made to transport configurer
 type CustomizedTransfer struct {
 	ChannelID datatransfer.ChannelID
@@ -44,6 +50,8 @@ type FakeTransport struct {
 	ResumeChannelErr    error
 	CleanedUpChannels   []datatransfer.ChannelID
 	CustomizedTransfers []CustomizedTransfer
+	UsedStores          []UsedStore
+	UseStoreErr         error
 	EventHandler        datatransfer.EventsHandler
 	SetEventHandlerErr  error
 }
@@ -97,6 +105,12 @@ func (ft *FakeTransport) CleanupChannel(chid datatransfer.ChannelID) {
 	ft.CleanedUpChannels = append(ft.CleanedUpChannels, chid)
 }
 
+// UseStore records the store to use for the given channel
+func (ft *FakeTransport) UseStore(chid datatransfer.ChannelID, lsys ipld.LinkSystem) error {
+	ft.UsedStores = append(ft.UsedStores, UsedStore{chid, lsys})
+	return ft.UseStoreErr
+}
+
 func (ft *FakeTransport) RecordCustomizedTransfer(chid datatransfer.ChannelID, voucher datatransfer.Voucher) {
 	ft.CustomizedTransfers = append(ft.CustomizedTransfers, CustomizedTransfer{chid, voucher})
 }
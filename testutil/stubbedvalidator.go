@@ -1,8 +1,11 @@
 package testutil
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
@@ -346,3 +349,136 @@ func (srv *StubbedRevalidator) VerifyExpectations(t *testing.T) {
 		require.True(t, srv.didComplete)
 	}
 }
+
+// StubbedTriggeredRevalidator is a triggered revalidator that returns
+// predictable results from its block and time based hooks, and counts the
+// calls to them
+type StubbedTriggeredRevalidator struct {
+	*StubbedRevalidator
+	trigger datatransfer.RevalidationTrigger
+
+	lk            sync.Mutex
+	handled       bool
+	triggerResult datatransfer.VoucherResult
+	triggerError  error
+	blockCalls    int
+	intervalCalls int
+}
+
+// NewStubbedTriggeredRevalidator returns a new instance of a stubbed
+// triggered revalidator with the given trigger, which handles every request
+// and continues it uninterrupted until stubbed otherwise
+func NewStubbedTriggeredRevalidator(trigger datatransfer.RevalidationTrigger) *StubbedTriggeredRevalidator {
+	return &StubbedTriggeredRevalidator{
+		StubbedRevalidator: NewStubbedRevalidator(),
+		trigger:            trigger,
+		handled:            true,
+	}
+}
+
+// RevalidationTrigger returns the trigger the revalidator was created with
+func (srv *StubbedTriggeredRevalidator) RevalidationTrigger() datatransfer.RevalidationTrigger {
+	return srv.trigger
+}
+
+// OnBlocksTransferred returns the stubbed trigger result
+func (srv *StubbedTriggeredRevalidator) OnBlocksTransferred(chid datatransfer.ChannelID, additionalBlocks uint64) (bool, datatransfer.VoucherResult, error) {
+	srv.lk.Lock()
+	defer srv.lk.Unlock()
+	srv.blockCalls++
+	return srv.handled, srv.triggerResult, srv.triggerError
+}
+
+// OnIntervalElapsed returns the stubbed trigger result
+func (srv *StubbedTriggeredRevalidator) OnIntervalElapsed(chid datatransfer.ChannelID, elapsed time.Duration) (bool, datatransfer.VoucherResult, error) {
+	srv.lk.Lock()
+	defer srv.lk.Unlock()
+	srv.intervalCalls++
+	return srv.handled, srv.triggerResult, srv.triggerError
+}
+
+// StubTriggerResult sets the result of OnBlocksTransferred and
+// OnIntervalElapsed
+func (srv *StubbedTriggeredRevalidator) StubTriggerResult(handled bool, voucherResult datatransfer.VoucherResult, err error) {
+	srv.lk.Lock()
+	defer srv.lk.Unlock()
+	srv.handled = handled
+	srv.triggerResult = voucherResult
+	srv.triggerError = err
+}
+
+// BlockCalls returns the number of calls to OnBlocksTransferred
+func (srv *StubbedTriggeredRevalidator) BlockCalls() int {
+	srv.lk.Lock()
+	defer srv.lk.Unlock()
+	return srv.blockCalls
+}
+
+// IntervalCalls returns the number of calls to OnIntervalElapsed
+func (srv *StubbedTriggeredRevalidator) IntervalCalls() int {
+	srv.lk.Lock()
+	defer srv.lk.Unlock()
+	return srv.intervalCalls
+}
+
+var _ datatransfer.TriggeredRevalidator = (*StubbedTriggeredRevalidator)(nil)
+
+// AsyncValidation records a call to either ValidatePushAsync or
+// ValidatePullAsync, with the callback that completes it
+type AsyncValidation struct {
+	ReceivedValidation
+	ChannelID datatransfer.ChannelID
+	Done      datatransfer.ValidationCallback
+}
+
+// StubbedAsyncValidator is an asynchronous validator that leaves completing
+// validations to the test
+type StubbedAsyncValidator struct {
+	validations chan AsyncValidation
+}
+
+// NewStubbedAsyncValidator returns a new instance of a stubbed asynchronous
+// validator
+func NewStubbedAsyncValidator() *StubbedAsyncValidator {
+	return &StubbedAsyncValidator{validations: make(chan AsyncValidation, 16)}
+}
+
+// ValidatePushAsync records a push validation
+func (sv *StubbedAsyncValidator) ValidatePushAsync(
+	chid datatransfer.ChannelID,
+	sender peer.ID,
+	voucher datatransfer.Voucher,
+	baseCid cid.Cid,
+	selector ipld.Node,
+	done datatransfer.ValidationCallback) {
+	sv.validations <- AsyncValidation{ReceivedValidation{false, sender, voucher, baseCid, selector}, chid, done}
+}
+
+// ValidatePullAsync records a pull validation
+func (sv *StubbedAsyncValidator) ValidatePullAsync(
+	chid datatransfer.ChannelID,
+	receiver peer.ID,
+	voucher datatransfer.Voucher,
+	baseCid cid.Cid,
+	selector ipld.Node,
+	done datatransfer.ValidationCallback) {
+	sv.validations <- AsyncValidation{ReceivedValidation{true, receiver, voucher, baseCid, selector}, chid, done}
+}
+
+// NextValidation waits for the next validation started
+func (sv *StubbedAsyncValidator) NextValidation(ctx context.Context, t *testing.T) AsyncValidation {
+	select {
+	case <-ctx.Done():
+		t.Fatal("no validation started")
+		return AsyncValidation{}
+	case validation := <-sv.validations:
+		return validation
+	}
+}
+
+// VerifyNoValidations verifies no validation was started
+func (sv *StubbedAsyncValidator) VerifyNoValidations(t *testing.T) {
+	require.Empty(t, sv.validations)
+}
+
+var _ datatransfer.AsyncRequestValidator = (*StubbedAsyncValidator)(nil)
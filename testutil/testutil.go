@@ -15,6 +15,7 @@ import (
 	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
 	"github.com/jbenet/go-random"
 	"github.com/libp2p/go-libp2p-core/peer"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
@@ -61,7 +62,14 @@ func GeneratePeers(n int) []peer.ID {
 	peerIds := make([]peer.ID, 0, n)
 	for i := 0; i < n; i++ {
 		peerSeq++
-		p := peer.ID(fmt.Sprint(peerSeq))
+		// an identity multihash, so the ID can be parsed back from its string
+		// form: channel stores key channels by the string form of their
+		// channel ID and parse it back when listing them
+		hash, err := mh.Sum([]byte(fmt.Sprint(peerSeq)), mh.IDENTITY, -1)
+		if err != nil {
+			panic(err)
+		}
+		p := peer.ID(hash)
 		peerIds = append(peerIds, p)
 	}
 	return peerIds
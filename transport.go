@@ -27,6 +27,16 @@ type EventsHandler interface {
 	// - err == ErrPause - pause this request
 	OnDataReceived(chid ChannelID, link ipld.Link, size uint64) error
 
+	// OnBlockReceived is called for each block received on the given channel
+	// ID, so it can be checked by the registered block validators. Transports
+	// that implement BlockCheckingTransport call it before the block is stored.
+	// return values are:
+	// - nil = store the block and proceed
+	// - err == ErrSkipBlock - do not store the block, but proceed
+	// - err == ErrPause - pause this request
+	// - error = cancel this request
+	OnBlockReceived(chid ChannelID, link ipld.Link, size uint64) error
+
 	// OnDataQueued is called when data is queued for sending for the given channel ID
 	// return values are:
 	// message = data transfer message along with data
@@ -116,3 +126,43 @@ type PauseableTransport interface {
 		chid ChannelID,
 	) error
 }
+
+// StoreConfigurableTransport is a transport that can be told to read and write
+// the blocks for a given channel from a specific store, rather than its default
+// store
+type StoreConfigurableTransport interface {
+	Transport
+	// UseStore sets the link system used to load and store blocks for the
+	// given channel
+	UseStore(ChannelID, ipld.LinkSystem) error
+}
+
+// BlockCheckingTransport is a transport that may be able to pass each block it
+// receives to OnBlockReceived before storing it, so block validators can stop
+// blocks from being stored
+type BlockCheckingTransport interface {
+	Transport
+	// ChecksBlocksBeforeStoring returns true if blocks received on every
+	// channel are passed to OnBlockReceived before they are stored
+	ChecksBlocksBeforeStoring() bool
+}
+
+// CidIterator calls fn with each CID in a list in turn, stopping at the first
+// error returned by fn
+type CidIterator func(fn func(cid.Cid) error) error
+
+// DoNotSendIterTransport is a transport that can open a channel with a list of
+// CIDs not to send that is read lazily, so the list never has to be held in
+// memory all at once
+type DoNotSendIterTransport interface {
+	Transport
+	// OpenChannelIter is the same as OpenChannel, except the cids the data
+	// sender should not send are read from the given iterator
+	OpenChannelIter(ctx context.Context,
+		dataSender peer.ID,
+		channelID ChannelID,
+		root ipld.Link,
+		stor ipld.Node,
+		doNotSendCids CidIterator,
+		msg Message) error
+}
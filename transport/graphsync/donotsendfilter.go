@@ -0,0 +1,395 @@
+package graphsync
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync"
+	"github.com/ipfs/go-graphsync/metadata"
+	ipld "github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/transport/graphsync/extension"
+)
+
+// missingBlockErrPrefix starts the error graphsync reports to a requester for
+// each block the responder said it did not send, followed by the block's link
+const missingBlockErrPrefix = "Remote Peer Is Missing Block: "
+
+// errSkippedByFilter is returned when loading a block that matches the do not
+// send filter of the request, so graphsync does not send it
+var errSkippedByFilter = xerrors.New("block skipped by do not send filter")
+
+// filteredRequest tracks a request sent with a do not send filter, so the
+// blocks the data sender skipped but this node does not have can be requested
+// again once it completes
+type filteredRequest struct {
+	dataSender peer.ID
+	root       ipld.Link
+	store      ipld.LinkSystem
+	filter     *extension.DoNotSendFilter
+
+	lk      sync.Mutex
+	skipped map[cid.Cid]struct{}
+	missing []ipld.Link
+}
+
+// recordSkipped records the blocks the response metadata says were not sent
+// that match the filter, so were skipped by it, and which of them are not in
+// the store. Blocks that were not sent but do not match the filter are
+// missing on the data sender, and still fail the request.
+func (fr *filteredRequest) recordSkipped(response graphsync.ResponseData) error {
+	data, ok := response.Extension(graphsync.ExtensionMetadata)
+	if !ok {
+		return nil
+	}
+	md, err := metadata.DecodeMetadata(data)
+	if err != nil {
+		return err
+	}
+	fr.lk.Lock()
+	defer fr.lk.Unlock()
+	for _, item := range md {
+		if item.BlockPresent || !fr.filter.Has(item.Link) {
+			continue
+		}
+		if _, ok := fr.skipped[item.Link]; ok {
+			continue
+		}
+		if fr.skipped == nil {
+			fr.skipped = make(map[cid.Cid]struct{})
+		}
+		fr.skipped[item.Link] = struct{}{}
+		lnk := cidlink.Link{Cid: item.Link}
+		r, err := fr.store.StorageReadOpener(ipld.LinkContext{Ctx: context.TODO()}, lnk)
+		if err != nil {
+			fr.missing = append(fr.missing, lnk)
+			continue
+		}
+		if closer, ok := r.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+	return nil
+}
+
+// skippedByFilter returns whether graphsync reported an error because the
+// data sender did not send a block it skipped as it matched the filter
+func (fr *filteredRequest) skippedByFilter(err error) bool {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, missingBlockErrPrefix) {
+		return false
+	}
+	c, decodeErr := cid.Decode(strings.TrimPrefix(msg, missingBlockErrPrefix))
+	if decodeErr != nil {
+		return false
+	}
+	fr.lk.Lock()
+	defer fr.lk.Unlock()
+	_, ok := fr.skipped[c]
+	return ok
+}
+
+// filteredResponse tracks a response to a request with a do not send filter.
+// If blocks were skipped, completing the channel is held back until the
+// receiver has requested the ones it does not have.
+type filteredResponse struct {
+	receiver peer.ID
+	root     cid.Cid
+	filter   *extension.DoNotSendFilter
+	option   string
+
+	lk      sync.Mutex
+	skipped uint64
+	held    *time.Timer
+}
+
+// skip returns whether a block should not be sent because it matches the
+// filter. Only raw leaves are skipped, as skipping any other block would also
+// leave out the blocks it links to.
+func (fr *filteredResponse) skip(lnk ipld.Link) bool {
+	cl, ok := lnk.(cidlink.Link)
+	if !ok || cl.Cid.Prefix().Codec != cid.Raw || !fr.filter.Has(cl.Cid) {
+		return false
+	}
+	fr.lk.Lock()
+	fr.skipped++
+	fr.lk.Unlock()
+	return true
+}
+
+// encodeDoNotSendFilter builds a do not send filter over every cid from the
+// iterator, reading them once to size the filter and again to fill it
+func encodeDoNotSendFilter(doNotSendCids datatransfer.CidIterator, falsePositiveRate float64) (*extension.DoNotSendFilter, graphsync.ExtensionData, error) {
+	var count uint64
+	err := doNotSendCids(func(cid.Cid) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, graphsync.ExtensionData{}, err
+	}
+	filter, err := extension.NewDoNotSendFilter(count, falsePositiveRate)
+	if err != nil {
+		return nil, graphsync.ExtensionData{}, err
+	}
+	err = doNotSendCids(func(c cid.Cid) error {
+		filter.Add(c)
+		return nil
+	})
+	if err != nil {
+		return nil, graphsync.ExtensionData{}, err
+	}
+	ext, err := filter.ToExtensionData()
+	if err != nil {
+		return nil, graphsync.ExtensionData{}, err
+	}
+	return filter, ext, nil
+}
+
+// channelStore returns the link system the blocks of a channel are stored in,
+// if the transport knows it. The caller must hold dataLock.
+func (t *Transport) channelStore(chid datatransfer.ChannelID) (ipld.LinkSystem, bool) {
+	if lsys, ok := t.stores[chid]; ok {
+		return lsys, true
+	}
+	if t.defaultStore != nil {
+		return *t.defaultStore, true
+	}
+	return ipld.LinkSystem{}, false
+}
+
+// useDoNotSendFilter sets up a response to honour the do not send filter of
+// the request, if it has one, returning the persistence option that skips the
+// blocks matching it. The filter is ignored if the transport does not know the
+// channel's store. The caller must hold dataLock.
+func (t *Transport) useDoNotSendFilter(receiver peer.ID, chid datatransfer.ChannelID, root cid.Cid, filter *extension.DoNotSendFilter) (string, error) {
+	t.removeFilteredResponse(chid)
+	if filter == nil {
+		return "", nil
+	}
+	store, ok := t.channelStore(chid)
+	if !ok {
+		log.Debugf("channel %s: ignoring do not send filter, as the channel store is not known", chid)
+		return "", nil
+	}
+	fr := &filteredResponse{
+		receiver: receiver,
+		root:     root,
+		filter:   filter,
+		option:   "data-transfer-filtered-" + chid.String(),
+	}
+	readOpener := store.StorageReadOpener
+	store.StorageReadOpener = func(lnkCtx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		if fr.skip(lnk) {
+			return nil, errSkippedByFilter
+		}
+		return readOpener(lnkCtx, lnk)
+	}
+	if err := t.gs.RegisterPersistenceOption(fr.option, store); err != nil {
+		return "", err
+	}
+	t.filteredResponses[chid] = fr
+	return fr.option, nil
+}
+
+// holdFilteredResponse returns true if the response on a channel skipped
+// blocks matching a do not send filter, in which case the channel is not
+// completed until the receiver has requested the skipped blocks it does not
+// have, or the resend timeout passes
+func (t *Transport) holdFilteredResponse(chid datatransfer.ChannelID, status graphsync.ResponseStatusCode) bool {
+	if status != graphsync.RequestCompletedFull && status != graphsync.RequestCompletedPartial {
+		return false
+	}
+	t.dataLock.RLock()
+	fr, ok := t.filteredResponses[chid]
+	t.dataLock.RUnlock()
+	if !ok {
+		return false
+	}
+	fr.lk.Lock()
+	defer fr.lk.Unlock()
+	if fr.skipped == 0 {
+		return false
+	}
+	fr.held = time.AfterFunc(t.filterResendTimeout, func() {
+		log.Warnf("channel %s: completing without the receiver requesting the blocks skipped by its do not send filter", chid)
+		t.releaseFilteredResponse(chid, nil)
+	})
+	return true
+}
+
+// releaseFilteredResponse completes a channel whose response was held back
+func (t *Transport) releaseFilteredResponse(chid datatransfer.ChannelID, completeErr error) {
+	t.dataLock.RLock()
+	fr, ok := t.filteredResponses[chid]
+	t.dataLock.RUnlock()
+	if !ok {
+		return
+	}
+	fr.lk.Lock()
+	held := fr.held
+	fr.held = nil
+	fr.lk.Unlock()
+	if held == nil {
+		return
+	}
+	held.Stop()
+
+	// Used by the tests to listen for when a response completes
+	if t.completedResponseListener != nil {
+		t.completedResponseListener(chid)
+	}
+
+	if err := t.events.OnChannelCompleted(chid, completeErr); err != nil {
+		log.Error(err)
+	}
+}
+
+// resendRequestReceived validates a request for a block skipped by the do not
+// send filter of a channel, which must come from the receiver on the channel
+// and ask for a block that matched the filter, or for the root of the channel
+func (t *Transport) resendRequestReceived(p peer.ID, request graphsync.RequestData, hookActions graphsync.IncomingRequestHookActions) {
+	resend, err := extension.GetFilterResend(request)
+	if err != nil {
+		hookActions.TerminateWithError(err)
+		return
+	}
+	if resend == nil {
+		return
+	}
+
+	t.dataLock.Lock()
+	defer t.dataLock.Unlock()
+	chid := resend.ChannelID
+	fr, ok := t.filteredResponses[chid]
+	if !ok || fr.receiver != p {
+		hookActions.TerminateWithError(xerrors.Errorf("channel %s did not skip blocks for peer %s", chid, p))
+		return
+	}
+	if root := request.Root(); root != fr.root && !fr.filter.Has(root) {
+		hookActions.TerminateWithError(xerrors.Errorf("channel %s did not skip block %s", chid, request.Root()))
+		return
+	}
+	gsKey := graphsyncKey{request.ID(), p}
+	t.graphsyncRequestMap[gsKey] = chid
+	t.resendRequests[gsKey] = resend.Last
+	if _, ok := t.stores[chid]; ok {
+		hookActions.UsePersistenceOption("data-transfer-" + chid.String())
+	}
+	hookActions.ValidateRequest()
+}
+
+// resendResponseCompleted completes the channel once the last request for
+// blocks skipped by its do not send filter has been answered
+func (t *Transport) resendResponseCompleted(chid datatransfer.ChannelID, gsKey graphsyncKey, status graphsync.ResponseStatusCode) {
+	t.dataLock.Lock()
+	last := t.resendRequests[gsKey]
+	delete(t.resendRequests, gsKey)
+	delete(t.graphsyncRequestMap, gsKey)
+	t.dataLock.Unlock()
+	if !last {
+		return
+	}
+	var completeErr error
+	if status != graphsync.RequestCompletedFull {
+		completeErr = xerrors.Errorf("graphsync response to peer %s resending skipped blocks did not complete: response status code %s", gsKey.p, gsResponseStatusCodeString(status))
+	}
+	t.releaseFilteredResponse(chid, completeErr)
+}
+
+// resendRequestSent maps an outgoing request for blocks skipped by a do not
+// send filter to its channel, so the blocks are stored and counted like any
+// other received on it
+func (t *Transport) resendRequestSent(request graphsync.RequestData, hookActions graphsync.OutgoingRequestHookActions) {
+	resend, _ := extension.GetFilterResend(request)
+	if resend == nil {
+		return
+	}
+	t.dataLock.Lock()
+	defer t.dataLock.Unlock()
+	gsKey := graphsyncKey{request.ID(), t.peerID}
+	t.graphsyncRequestMap[gsKey] = resend.ChannelID
+	t.resendRequests[gsKey] = resend.Last
+	if _, ok := t.stores[resend.ChannelID]; ok {
+		hookActions.UsePersistenceOption("data-transfer-" + resend.ChannelID.String())
+	}
+}
+
+// resendSkippedBlocks requests each block the data sender skipped because it
+// matched the do not send filter, but this node does not have, then asks for
+// the root of the channel again to tell the data sender it is done
+func (t *Transport) resendSkippedBlocks(ctx context.Context, chid datatransfer.ChannelID) error {
+	t.dataLock.Lock()
+	fr, ok := t.filteredRequests[chid]
+	delete(t.filteredRequests, chid)
+	t.dataLock.Unlock()
+	if !ok {
+		return nil
+	}
+	fr.lk.Lock()
+	skipped, missing := len(fr.skipped), fr.missing
+	fr.lk.Unlock()
+	if skipped == 0 {
+		return nil
+	}
+
+	log.Infof("channel %s: requesting %d of %d blocks skipped by the do not send filter", chid, len(missing), skipped)
+	matcher := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+	for i := 0; i <= len(missing); i++ {
+		root, last := fr.root, i == len(missing)
+		if !last {
+			root = missing[i]
+		}
+		ext, err := (&extension.FilterResend{ChannelID: chid, Last: last}).ToExtensionData()
+		if err != nil {
+			return err
+		}
+		responseChan, errChan := t.gs.Request(ctx, fr.dataSender, root, matcher, ext)
+		if err := t.consumeResponses(responseChan, errChan, nil); err != nil {
+			return xerrors.Errorf("requesting block %s skipped by the do not send filter: %w", root, err)
+		}
+	}
+	return nil
+}
+
+// removeFilteredResponse drops the do not send filter of a response on the
+// channel. The caller must hold dataLock.
+func (t *Transport) removeFilteredResponse(chid datatransfer.ChannelID) {
+	fr, ok := t.filteredResponses[chid]
+	if !ok {
+		return
+	}
+	fr.lk.Lock()
+	if fr.held != nil {
+		fr.held.Stop()
+		fr.held = nil
+	}
+	fr.lk.Unlock()
+	if err := t.gs.UnregisterPersistenceOption(fr.option); err != nil {
+		log.Error(err)
+	}
+	delete(t.filteredResponses, chid)
+}
+
+// cleanupFilter drops any do not send filter state for the channel. The caller
+// must hold dataLock.
+func (t *Transport) cleanupFilter(chid datatransfer.ChannelID) {
+	t.removeFilteredResponse(chid)
+	delete(t.filteredRequests, chid)
+	for gsKey := range t.resendRequests {
+		if t.graphsyncRequestMap[gsKey] == chid {
+			delete(t.resendRequests, gsKey)
+			delete(t.graphsyncRequestMap, gsKey)
+		}
+	}
+}
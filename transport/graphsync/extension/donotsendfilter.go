@@ -0,0 +1,187 @@
+package extension
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+//go:generate cbor-gen-for DoNotSendFilter FilterResend
+
+// ExtensionDoNotSendFilter is the identifier for the graphsync extension a
+// receiver can use to describe the blocks it already has when restarting a
+// channel, as a compact bloom filter rather than the full list sent in the
+// graphsync do-not-send-cids extension.
+//
+// Graphsync only lets a responder leave out blocks listed in the
+// do-not-send-cids extension, so a sender honouring the filter instead
+// declines to load raw leaf blocks that match it, which graphsync reports to
+// the receiver as missing. Only leaves are skipped, so no part of the DAG
+// below a skipped block is left out. As a bloom filter can match blocks that
+// were never received, the receiver requests any block reported missing that
+// it does not have again, in a request carrying ExtensionDoNotSendFilterResend.
+const ExtensionDoNotSendFilter = graphsync.ExtensionName("fil/data-transfer/do-not-send-filter")
+
+// ExtensionDoNotSendFilterResend is the identifier for the graphsync extension
+// on requests for blocks a sender skipped because they matched the do not
+// send filter of a channel
+const ExtensionDoNotSendFilterResend = graphsync.ExtensionName("fil/data-transfer/do-not-send-filter-resend")
+
+// MaxDoNotSendFilterHashes is the largest number of bits set for each CID in a
+// filter that will be decoded
+const MaxDoNotSendFilterHashes = 32
+
+// MaxDoNotSendFilterSize is the largest filter, in bytes, that will be built
+// or decoded. Filters for lists too long to fit at the requested rate of false
+// positives are built at this size, with a higher rate.
+const MaxDoNotSendFilterSize = 1 << 20
+
+// DoNotSendFilter is a bloom filter over the CIDs a receiver already has
+type DoNotSendFilter struct {
+	// Hashes is the number of bits set for each CID
+	Hashes uint64
+	// Bits is the filter itself
+	Bits []byte
+}
+
+// NewDoNotSendFilter returns an empty filter sized to hold the given number of
+// CIDs with roughly the given rate of false positives, which must be between
+// 0 and 1
+func NewDoNotSendFilter(count uint64, falsePositiveRate float64) (*DoNotSendFilter, error) {
+	if !(falsePositiveRate > 0 && falsePositiveRate < 1) {
+		return nil, xerrors.Errorf("false positive rate %f is not between 0 and 1", falsePositiveRate)
+	}
+	if count == 0 {
+		count = 1
+	}
+	bits := math.Ceil(-float64(count) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	if bits > MaxDoNotSendFilterSize*8 {
+		bits = MaxDoNotSendFilterSize * 8
+	}
+	hashes := math.Round(bits / float64(count) * math.Ln2)
+	if hashes < 1 {
+		hashes = 1
+	}
+	if hashes > MaxDoNotSendFilterHashes {
+		hashes = MaxDoNotSendFilterHashes
+	}
+	return &DoNotSendFilter{
+		Hashes: uint64(hashes),
+		Bits:   make([]byte, (uint64(bits)+7)/8),
+	}, nil
+}
+
+// Add adds a CID to the filter
+func (f *DoNotSendFilter) Add(c cid.Cid) {
+	f.each(c, func(bit uint64) bool {
+		f.Bits[bit/8] |= 1 << (bit % 8)
+		return true
+	})
+}
+
+// Has returns true if the CID may have been added to the filter, and false if
+// it definitely was not
+func (f *DoNotSendFilter) Has(c cid.Cid) bool {
+	if len(f.Bits) == 0 {
+		return false
+	}
+	has := true
+	f.each(c, func(bit uint64) bool {
+		has = f.Bits[bit/8]&(1<<(bit%8)) != 0
+		return has
+	})
+	return has
+}
+
+// each calls fn with each bit for the CID until it returns false. The bits are
+// derived from a SHA-256 of the CID, so every peer computes the same ones.
+func (f *DoNotSendFilter) each(c cid.Cid, fn func(bit uint64) bool) {
+	sum := sha256.Sum256(c.Bytes())
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16])
+	size := uint64(len(f.Bits)) * 8
+	for i := uint64(0); i < f.Hashes; i++ {
+		if !fn((h1 + i*h2) % size) {
+			return
+		}
+	}
+}
+
+// ToExtensionData encodes the filter as a graphsync extension
+func (f *DoNotSendFilter) ToExtensionData() (graphsync.ExtensionData, error) {
+	buf := new(bytes.Buffer)
+	if err := f.MarshalCBOR(buf); err != nil {
+		return graphsync.ExtensionData{}, err
+	}
+	return graphsync.ExtensionData{
+		Name: ExtensionDoNotSendFilter,
+		Data: buf.Bytes(),
+	}, nil
+}
+
+// GetDoNotSendFilter unmarshals the do not send filter extension.
+// Returns:
+//    * nil + nil if the extension is not found
+//    * nil + error if the extension fails to unmarshal, or is too large
+//    * unmarshaled DoNotSendFilter + nil if all goes well
+func GetDoNotSendFilter(extendedData GsExtended) (*DoNotSendFilter, error) {
+	data, ok := extendedData.Extension(ExtensionDoNotSendFilter)
+	if !ok {
+		return nil, nil
+	}
+	var f DoNotSendFilter
+	if err := f.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if f.Hashes == 0 || f.Hashes > MaxDoNotSendFilterHashes {
+		return nil, xerrors.Errorf("do not send filter sets %d bits for each cid, must be between 1 and %d", f.Hashes, MaxDoNotSendFilterHashes)
+	}
+	if len(f.Bits) == 0 || len(f.Bits) > MaxDoNotSendFilterSize {
+		return nil, xerrors.Errorf("do not send filter is %d bytes, must be between 1 and %d", len(f.Bits), MaxDoNotSendFilterSize)
+	}
+	return &f, nil
+}
+
+// FilterResend identifies the channel a request for skipped blocks belongs to
+type FilterResend struct {
+	ChannelID datatransfer.ChannelID
+	// Last is set on the last request for skipped blocks on the channel,
+	// after which the sender can complete it
+	Last bool
+}
+
+// ToExtensionData encodes the resend request as a graphsync extension
+func (r *FilterResend) ToExtensionData() (graphsync.ExtensionData, error) {
+	buf := new(bytes.Buffer)
+	if err := r.MarshalCBOR(buf); err != nil {
+		return graphsync.ExtensionData{}, err
+	}
+	return graphsync.ExtensionData{
+		Name: ExtensionDoNotSendFilterResend,
+		Data: buf.Bytes(),
+	}, nil
+}
+
+// GetFilterResend unmarshals the do not send filter resend extension.
+// Returns:
+//    * nil + nil if the extension is not found
+//    * nil + error if the extension fails to unmarshal
+//    * unmarshaled FilterResend + nil if all goes well
+func GetFilterResend(extendedData GsExtended) (*FilterResend, error) {
+	data, ok := extendedData.Extension(ExtensionDoNotSendFilterResend)
+	if !ok {
+		return nil, nil
+	}
+	var r FilterResend
+	if err := r.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,177 @@
+// Code generated by github.com/whyrusleeping/cbor-gen. DO NOT EDIT.
+
+package extension
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	xerrors "golang.org/x/xerrors"
+)
+
+var _ = xerrors.Errorf
+var _ = cid.Undef
+var _ = sort.Sort
+
+var lengthBufDoNotSendFilter = []byte{130}
+
+func (t *DoNotSendFilter) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufDoNotSendFilter); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Hashes (uint64) (uint64)
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Hashes)); err != nil {
+		return err
+	}
+
+	// t.Bits ([]uint8) (slice)
+	if len(t.Bits) > cbg.ByteArrayMaxLen {
+		return xerrors.Errorf("Byte array in field t.Bits was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(t.Bits))); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(t.Bits[:]); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *DoNotSendFilter) UnmarshalCBOR(r io.Reader) error {
+	*t = DoNotSendFilter{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 2 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.Hashes (uint64) (uint64)
+
+	{
+
+		maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+		if maj != cbg.MajUnsignedInt {
+			return fmt.Errorf("wrong type for uint64 field")
+		}
+		t.Hashes = uint64(extra)
+
+	}
+	// t.Bits ([]uint8) (slice)
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+
+	if extra > cbg.ByteArrayMaxLen {
+		return fmt.Errorf("t.Bits: byte array too large (%d)", extra)
+	}
+	if maj != cbg.MajByteString {
+		return fmt.Errorf("expected byte array")
+	}
+
+	if extra > 0 {
+		t.Bits = make([]uint8, extra)
+	}
+
+	if _, err := io.ReadFull(br, t.Bits[:]); err != nil {
+		return err
+	}
+	return nil
+}
+
+var lengthBufFilterResend = []byte{130}
+
+func (t *FilterResend) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufFilterResend); err != nil {
+		return err
+	}
+
+	// t.ChannelID (datatransfer.ChannelID) (struct)
+	if err := t.ChannelID.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.Last (bool) (bool)
+	if err := cbg.WriteBool(w, t.Last); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *FilterResend) UnmarshalCBOR(r io.Reader) error {
+	*t = FilterResend{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 2 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.ChannelID (datatransfer.ChannelID) (struct)
+
+	{
+
+		if err := t.ChannelID.UnmarshalCBOR(br); err != nil {
+			return xerrors.Errorf("unmarshaling t.ChannelID: %w", err)
+		}
+
+	}
+	// t.Last (bool) (bool)
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajOther {
+		return fmt.Errorf("booleans must be major type 7")
+	}
+	switch extra {
+	case 20:
+		t.Last = false
+	case 21:
+		t.Last = true
+	default:
+		return fmt.Errorf("booleans are either major type 7, value 20 or 21 (got %d)", extra)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package extension_test
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-graphsync"
+	"github.com/stretchr/testify/require"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+	"github.com/filecoin-project/go-data-transfer/transport/graphsync/extension"
+)
+
+type extended map[graphsync.ExtensionName][]byte
+
+func (e extended) Extension(name graphsync.ExtensionName) ([]byte, bool) {
+	data, ok := e[name]
+	return data, ok
+}
+
+func TestDoNotSendFilter(t *testing.T) {
+	added := testutil.GenerateCids(1000)
+	notAdded := testutil.GenerateCids(1000)
+
+	filter, err := extension.NewDoNotSendFilter(uint64(len(added)), 0.01)
+	require.NoError(t, err)
+	for _, c := range added {
+		filter.Add(c)
+	}
+
+	ext, err := filter.ToExtensionData()
+	require.NoError(t, err)
+	require.Equal(t, extension.ExtensionDoNotSendFilter, ext.Name)
+
+	decoded, err := extension.GetDoNotSendFilter(extended{ext.Name: ext.Data})
+	require.NoError(t, err)
+	require.Equal(t, filter, decoded)
+
+	// no false negatives
+	for _, c := range added {
+		require.True(t, decoded.Has(c))
+	}
+	// false positives close to the requested rate
+	falsePositives := 0
+	for _, c := range notAdded {
+		if decoded.Has(c) {
+			falsePositives++
+		}
+	}
+	require.Less(t, falsePositives, 50)
+
+	missing, err := extension.GetDoNotSendFilter(extended{})
+	require.NoError(t, err)
+	require.Nil(t, missing)
+
+	_, err = extension.GetDoNotSendFilter(extended{extension.ExtensionDoNotSendFilter: []byte("garbage")})
+	require.Error(t, err)
+
+	// rates of false positives outside (0,1) are rejected
+	for _, rate := range []float64{0, 1, -0.5, 2} {
+		_, err := extension.NewDoNotSendFilter(10, rate)
+		require.Error(t, err)
+	}
+
+	// filters too large for the list are capped
+	capped, err := extension.NewDoNotSendFilter(1<<40, 0.0001)
+	require.NoError(t, err)
+	require.Len(t, capped.Bits, extension.MaxDoNotSendFilterSize)
+	require.LessOrEqual(t, capped.Hashes, uint64(extension.MaxDoNotSendFilterHashes))
+
+	// oversized filters are not decoded
+	for _, oversized := range []*extension.DoNotSendFilter{
+		{Hashes: extension.MaxDoNotSendFilterHashes + 1, Bits: make([]byte, 8)},
+		{Hashes: 0, Bits: make([]byte, 8)},
+		{Hashes: 1, Bits: make([]byte, extension.MaxDoNotSendFilterSize+1)},
+		{Hashes: 1},
+	} {
+		ext, err := oversized.ToExtensionData()
+		require.NoError(t, err)
+		_, err = extension.GetDoNotSendFilter(extended{ext.Name: ext.Data})
+		require.Error(t, err)
+	}
+}
+
+func TestFilterResend(t *testing.T) {
+	peers := testutil.GeneratePeers(2)
+	resend := &extension.FilterResend{
+		ChannelID: datatransfer.ChannelID{Initiator: peers[0], Responder: peers[1], ID: 5},
+		Last:      true,
+	}
+	ext, err := resend.ToExtensionData()
+	require.NoError(t, err)
+	require.Equal(t, extension.ExtensionDoNotSendFilterResend, ext.Name)
+
+	decoded, err := extension.GetFilterResend(extended{ext.Name: ext.Data})
+	require.NoError(t, err)
+	require.Equal(t, resend, decoded)
+
+	missing, err := extension.GetFilterResend(extended{})
+	require.NoError(t, err)
+	require.Nil(t, missing)
+}
@@ -11,10 +11,13 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-data-transfer/message"
 	"github.com/filecoin-project/go-data-transfer/message/message1_0"
+	"github.com/filecoin-project/go-data-transfer/message/message1_1"
 )
 
 const (
-	// ExtensionDataTransfer1_1 is the identifier for the current data transfer extension to graphsync
+	// ExtensionDataTransfer1_2 is the identifier for the current data transfer extension to graphsync
+	ExtensionDataTransfer1_2 = graphsync.ExtensionName("fil/data-transfer/1.2")
+	// ExtensionDataTransfer1_1 is the identifier for the 1.1 data transfer extension to graphsync
 	ExtensionDataTransfer1_1 = graphsync.ExtensionName("fil/data-transfer/1.1")
 	// ExtensionDataTransfer1_0 is the identifier for the legacy data transfer extension to graphsync
 	ExtensionDataTransfer1_0 = graphsync.ExtensionName("fil/data-transfer")
@@ -22,6 +25,7 @@ const (
 
 // ProtocolMap maps graphsync extensions to their libp2p protocols
 var ProtocolMap = map[graphsync.ExtensionName]protocol.ID{
+	ExtensionDataTransfer1_2: datatransfer.ProtocolDataTransfer1_2,
 	ExtensionDataTransfer1_1: datatransfer.ProtocolDataTransfer1_1,
 	ExtensionDataTransfer1_0: datatransfer.ProtocolDataTransfer1_0,
 }
@@ -64,23 +68,26 @@ type GsExtended interface {
 //    * nil + nil if the extension is not found
 //    * nil + error if the extendedData fails to unmarshal
 //    * unmarshaled ExtensionDataTransferData + nil if all goes well
-func GetTransferData(extendedData GsExtended) (datatransfer.Message, error) {
-	extName := ExtensionDataTransfer1_1
-	data, ok := extendedData.Extension(extName)
-	if !ok {
-		extName = ExtensionDataTransfer1_0
-		data, ok = extendedData.Extension(extName)
-		if !ok {
-			return nil, nil
+func GetTransferData(extendedData GsExtended, supportedExtensions []graphsync.ExtensionName) (datatransfer.Message, error) {
+	// use the first version of the message the other peer sent that we
+	// support, with supported extensions listed newest first
+	for _, extName := range supportedExtensions {
+		data, ok := extendedData.Extension(extName)
+		if ok {
+			decode, ok := decoders[extName]
+			if !ok {
+				return nil, errors.New("unsupported protocol")
+			}
+			return decode(bytes.NewReader(data))
 		}
 	}
-	reader := bytes.NewReader(data)
-	return decoders[extName](reader)
+	return nil, nil
 }
 
 type decoder func(io.Reader) (datatransfer.Message, error)
 
 var decoders = map[graphsync.ExtensionName]decoder{
-	ExtensionDataTransfer1_1: message.FromNet,
+	ExtensionDataTransfer1_2: message.FromNet,
+	ExtensionDataTransfer1_1: message1_1.FromNet,
 	ExtensionDataTransfer1_0: message1_0.FromNet,
 }
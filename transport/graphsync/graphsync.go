@@ -1,16 +1,19 @@
 package graphsync
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
 	"sync"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-graphsync"
-	"github.com/ipfs/go-graphsync/cidset"
 	logging "github.com/ipfs/go-log/v2"
 	ipld "github.com/ipld/go-ipld-prime"
 	peer "github.com/libp2p/go-libp2p-core/peer"
+	cbg "github.com/whyrusleeping/cbor-gen"
 	"golang.org/x/xerrors"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
@@ -21,12 +24,21 @@ var log = logging.Logger("dt_graphsync")
 
 var errContextCancelled = errors.New("context cancelled")
 
+// unpauseRetryInterval is how long to wait before unpausing a response the
+// request hook paused again, while graphsync finishes the task that ran the hook
+const unpauseRetryInterval = 10 * time.Millisecond
+
 type graphsyncKey struct {
 	requestID graphsync.RequestID
 	p         peer.ID
 }
 
-var defaultSupportedExtensions = []graphsync.ExtensionName{extension.ExtensionDataTransfer1_1, extension.ExtensionDataTransfer1_0}
+type blockKey struct {
+	chid datatransfer.ChannelID
+	link ipld.Link
+}
+
+var defaultSupportedExtensions = []graphsync.ExtensionName{extension.ExtensionDataTransfer1_2, extension.ExtensionDataTransfer1_1, extension.ExtensionDataTransfer1_0}
 
 // Option is an option for setting up the graphsync transport
 type Option func(*Transport)
@@ -38,6 +50,65 @@ func SupportedExtensions(supportedExtensions []graphsync.ExtensionName) Option {
 	}
 }
 
+// DefaultStore gives the transport the link system graphsync was set up with.
+// Channels that do not have their own store then write to it through the
+// same checks as channels that do, so received blocks are passed to
+// OnBlockReceived before they are stored. Without it, blocks received on
+// those channels are stored by graphsync before the transport sees them, so
+// block validators cannot be registered with the data transfer manager.
+func DefaultStore(lsys ipld.LinkSystem) Option {
+	return func(t *Transport) {
+		t.defaultStore = &lsys
+	}
+}
+
+// DefaultMaxDoNotSendCids is the default largest number of cids sent in the
+// do-not-send-cids extension of a request: 0, so every cid is sent
+const DefaultMaxDoNotSendCids = 0
+
+// MaxDoNotSendCids sets the largest number of cids sent in the
+// do-not-send-cids extension of a request, or 0 to send them all. The data
+// sender decodes the whole list into memory, so a limit is the only way to
+// bound what it is asked to hold. Cids past the limit are left out, so the
+// blocks they refer to are sent again unless a do not send filter can be sent
+// for them (see DoNotSendFilterRate).
+func MaxDoNotSendCids(n uint64) Option {
+	return func(t *Transport) {
+		t.maxDoNotSendCids = n
+	}
+}
+
+// DefaultDoNotSendFilterRate is the rate of false positives of the do not send
+// filter sent along with a do-not-send-cids extension that could not hold
+// every cid
+const DefaultDoNotSendFilterRate = 0.001
+
+// DoNotSendFilterRate sets the rate of false positives of the do not send
+// filter sent when a channel is opened with more cids not to send than fit in
+// the do-not-send-cids extension. It must be between 0 and 1, or 0 to never
+// send a filter. A filter is only sent on channels whose store the transport
+// knows, either because the channel has its own or from DefaultStore, as
+// blocks the data sender skips are looked up there.
+func DoNotSendFilterRate(rate float64) Option {
+	return func(t *Transport) {
+		t.doNotSendFilterRate = rate
+	}
+}
+
+// DefaultFilterResendTimeout is how long a data sender that skipped blocks
+// matching a do not send filter waits for the receiver to request the ones it
+// does not have, before completing the channel
+const DefaultFilterResendTimeout = time.Minute
+
+// FilterResendTimeout sets how long a data sender that skipped blocks matching
+// a do not send filter waits for the receiver to request the ones it does not
+// have, before completing the channel
+func FilterResendTimeout(timeout time.Duration) Option {
+	return func(t *Transport) {
+		t.filterResendTimeout = timeout
+	}
+}
+
 // RegisterCompletedRequestListener is used by the tests
 func RegisterCompletedRequestListener(l func(channelID datatransfer.ChannelID)) Option {
 	return func(t *Transport) {
@@ -65,7 +136,17 @@ type Transport struct {
 	pending                   map[datatransfer.ChannelID]chan struct{}
 	requestorCancelledMap     map[datatransfer.ChannelID]struct{}
 	pendingExtensions         map[datatransfer.ChannelID][]graphsync.ExtensionData
-	stores                    map[datatransfer.ChannelID]struct{}
+	hookPausedResponses       map[datatransfer.ChannelID]struct{}
+	stores                    map[datatransfer.ChannelID]ipld.LinkSystem
+	defaultStore              *ipld.LinkSystem
+	maxDoNotSendCids          uint64
+	doNotSendFilterRate       float64
+	filterResendTimeout       time.Duration
+	filteredRequests          map[datatransfer.ChannelID]*filteredRequest
+	filteredResponses         map[datatransfer.ChannelID]*filteredResponse
+	resendRequests            map[graphsyncKey]bool
+	blockResultsLk            sync.Mutex
+	blockResults              map[blockKey]error
 	supportedExtensions       []graphsync.ExtensionName
 	unregisterFuncs           []graphsync.UnregisterHookFunc
 	completedRequestListener  func(channelID datatransfer.ChannelID)
@@ -81,10 +162,18 @@ func NewTransport(peerID peer.ID, gs graphsync.GraphExchange, options ...Option)
 		contextCancelMap:      make(map[datatransfer.ChannelID]func()),
 		requestorCancelledMap: make(map[datatransfer.ChannelID]struct{}),
 		pendingExtensions:     make(map[datatransfer.ChannelID][]graphsync.ExtensionData),
+		hookPausedResponses:   make(map[datatransfer.ChannelID]struct{}),
 		channelIDMap:          make(map[datatransfer.ChannelID]graphsyncKey),
 		pending:               make(map[datatransfer.ChannelID]chan struct{}),
-		stores:                make(map[datatransfer.ChannelID]struct{}),
+		stores:                make(map[datatransfer.ChannelID]ipld.LinkSystem),
+		blockResults:          make(map[blockKey]error),
 		supportedExtensions:   defaultSupportedExtensions,
+		maxDoNotSendCids:      DefaultMaxDoNotSendCids,
+		doNotSendFilterRate:   DefaultDoNotSendFilterRate,
+		filterResendTimeout:   DefaultFilterResendTimeout,
+		filteredRequests:      make(map[datatransfer.ChannelID]*filteredRequest),
+		filteredResponses:     make(map[datatransfer.ChannelID]*filteredResponse),
+		resendRequests:        make(map[graphsyncKey]bool),
 	}
 	for _, option := range options {
 		option(t)
@@ -104,6 +193,28 @@ func (t *Transport) OpenChannel(ctx context.Context,
 	stor ipld.Node,
 	doNotSendCids []cid.Cid,
 	msg datatransfer.Message) error {
+	return t.OpenChannelIter(ctx, dataSender, channelID, root, stor, func(fn func(cid.Cid) error) error {
+		for _, c := range doNotSendCids {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, msg)
+}
+
+// OpenChannelIter is the same as OpenChannel, except the cids not to send are
+// read from an iterator and encoded as they are read, so only the encoded
+// extension is held in memory. If MaxDoNotSendCids is set, reading stops once
+// the extension holds that many cids, and if there are more, they are all sent
+// in a do not send filter instead where one can be sent.
+func (t *Transport) OpenChannelIter(ctx context.Context,
+	dataSender peer.ID,
+	channelID datatransfer.ChannelID,
+	root ipld.Link,
+	stor ipld.Node,
+	doNotSendCids datatransfer.CidIterator,
+	msg datatransfer.Message) error {
 	if t.events == nil {
 		return datatransfer.ErrHandlerNotSet
 	}
@@ -112,9 +223,51 @@ func (t *Transport) OpenChannel(ctx context.Context,
 		return err
 	}
 
+	var filtered *filteredRequest
+	if doNotSendCids != nil {
+		bz, count, more, err := encodeDoNotSendCids(doNotSendCids, t.maxDoNotSendCids)
+		if err != nil {
+			return xerrors.Errorf("failed to encode cid set: %w", err)
+		}
+		if count != 0 {
+			doNotSendExt := graphsync.ExtensionData{Name: graphsync.ExtensionDoNotSendCIDs,
+				Data: bz}
+			exts = append(exts, doNotSendExt)
+		}
+		if more && t.doNotSendFilterRate != 0 {
+			t.dataLock.RLock()
+			store, hasStore := t.channelStore(channelID)
+			t.dataLock.RUnlock()
+			if hasStore {
+				filter, filterExt, err := encodeDoNotSendFilter(doNotSendCids, t.doNotSendFilterRate)
+				if err != nil {
+					return xerrors.Errorf("failed to encode do not send filter: %w", err)
+				}
+				exts = append(exts, filterExt)
+				filtered = &filteredRequest{dataSender: dataSender, root: root, store: store, filter: filter}
+			}
+		}
+	}
+
 	internalCtx, internalCancel := context.WithCancel(ctx)
 
 	t.dataLock.Lock()
+	// blocks received on the channel are checked as they are written, so
+	// write them through the default store if the channel has no store
+	if _, ok := t.stores[channelID]; !ok && t.defaultStore != nil {
+		err := t.gs.RegisterPersistenceOption("data-transfer-"+channelID.String(), t.checkedLinkSystem(channelID, *t.defaultStore))
+		if err != nil {
+			t.dataLock.Unlock()
+			internalCancel()
+			return err
+		}
+		t.stores[channelID] = *t.defaultStore
+	}
+	if filtered != nil {
+		t.filteredRequests[channelID] = filtered
+	} else {
+		delete(t.filteredRequests, channelID)
+	}
 	// if we have an existing request pending for the channelID, cancel it first.
 	if cancelF, ok := t.contextCancelMap[channelID]; ok {
 		cancelF()
@@ -123,37 +276,33 @@ func (t *Transport) OpenChannel(ctx context.Context,
 	t.contextCancelMap[channelID] = internalCancel
 	t.dataLock.Unlock()
 
-	if len(doNotSendCids) != 0 {
-		set := cid.NewSet()
-		for _, c := range doNotSendCids {
-			set.Add(c)
-		}
-		bz, err := cidset.EncodeCidSet(set)
-		if err != nil {
-			return xerrors.Errorf("failed to encode cid set: %w", err)
-		}
-		doNotSendExt := graphsync.ExtensionData{Name: graphsync.ExtensionDoNotSendCIDs,
-			Data: bz}
-		exts = append(exts, doNotSendExt)
-	}
 	responseChan, errChan := t.gs.Request(internalCtx, dataSender, root, stor, exts...)
 
 	go t.executeGsRequest(internalCtx, channelID, responseChan, errChan)
 	return nil
 }
 
-func (t *Transport) consumeResponses(responseChan <-chan graphsync.ResponseProgress, errChan <-chan error) error {
+// consumeResponses drains a graphsync request, returning the last error it
+// reported. If the request was sent with a do not send filter, blocks the
+// data sender skipped because they match the filter are not errors.
+func (t *Transport) consumeResponses(responseChan <-chan graphsync.ResponseProgress, errChan <-chan error, filtered *filteredRequest) error {
 	var lastError error
 	for range responseChan {
 	}
 	for err := range errChan {
+		if filtered != nil && filtered.skippedByFilter(err) {
+			continue
+		}
 		lastError = err
 	}
 	return lastError
 }
 
 func (t *Transport) executeGsRequest(internalCtx context.Context, channelID datatransfer.ChannelID, responseChan <-chan graphsync.ResponseProgress, errChan <-chan error) {
-	lastError := t.consumeResponses(responseChan, errChan)
+	t.dataLock.RLock()
+	filtered := t.filteredRequests[channelID]
+	t.dataLock.RUnlock()
+	lastError := t.consumeResponses(responseChan, errChan, filtered)
 
 	if _, ok := lastError.(graphsync.RequestContextCancelledErr); ok {
 		terr := xerrors.Errorf("graphsync request context cancelled")
@@ -177,6 +326,10 @@ func (t *Transport) executeGsRequest(internalCtx context.Context, channelID data
 		return
 	}
 
+	if lastError == nil && filtered != nil {
+		lastError = t.resendSkippedBlocks(internalCtx, channelID)
+	}
+
 	if lastError != nil {
 		log.Warnf("graphsync error: %s", lastError.Error())
 	}
@@ -266,14 +419,44 @@ func (t *Transport) ResumeChannel(ctx context.Context,
 		return t.gs.UnpauseRequest(gsKey.requestID, extensions...)
 	}
 	t.dataLock.Lock()
-	defer t.dataLock.Unlock()
-
 	if _, ok := t.requestorCancelledMap[chid]; ok {
-
 		t.pendingExtensions[chid] = append(t.pendingExtensions[chid], extensions...)
+		t.dataLock.Unlock()
 		return nil
 	}
-	return t.gs.UnpauseResponse(gsKey.p, gsKey.requestID, extensions...)
+	_, hookPaused := t.hookPausedResponses[chid]
+	delete(t.hookPausedResponses, chid)
+	if !hookPaused {
+		defer t.dataLock.Unlock()
+		return t.gs.UnpauseResponse(gsKey.p, gsKey.requestID, extensions...)
+	}
+	t.dataLock.Unlock()
+	return t.unpauseHookPausedResponse(ctx, chid, gsKey, extensions)
+}
+
+// unpauseHookPausedResponse unpauses a response the request hook paused.
+// Calls for the channel wait for the hook to finish before they get here, but
+// graphsync only marks the response paused when the task that ran the hook
+// finishes, just after the hook returns. Until then unpausing fails, so it is
+// tried again for as long as the channel is open.
+func (t *Transport) unpauseHookPausedResponse(ctx context.Context, chid datatransfer.ChannelID, gsKey graphsyncKey, extensions []graphsync.ExtensionData) error {
+	for {
+		err := t.gs.UnpauseResponse(gsKey.p, gsKey.requestID, extensions...)
+		if err == nil {
+			return nil
+		}
+		t.dataLock.RLock()
+		_, open := t.channelIDMap[chid]
+		t.dataLock.RUnlock()
+		if !open {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(unpauseRetryInterval):
+		}
+	}
 }
 
 // CloseChannel closes the given channel
@@ -307,10 +490,12 @@ func (t *Transport) CloseChannel(ctx context.Context, chid datatransfer.ChannelI
 // data for the channel
 func (t *Transport) CleanupChannel(chid datatransfer.ChannelID) {
 	t.dataLock.Lock()
-	gsKey, ok := t.channelIDMap[chid]
-	if ok {
-		t.cleanupChannel(chid, gsKey)
+	if gsKey, ok := t.channelIDMap[chid]; ok {
+		delete(t.graphsyncRequestMap, gsKey)
 	}
+	// the channel may have a store and checked blocks even if its request
+	// was never recorded
+	t.cleanupChannel(chid)
 	t.dataLock.Unlock()
 }
 
@@ -347,27 +532,80 @@ func (t *Transport) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-// UseStore tells the graphsync transport to use the given loader and storer for this channelID
-func (t *Transport) UseStore(channelID datatransfer.ChannelID, loader ipld.Loader, storer ipld.Storer) error {
+var _ datatransfer.StoreConfigurableTransport = (*Transport)(nil)
+var _ datatransfer.DoNotSendIterTransport = (*Transport)(nil)
+var _ datatransfer.BlockCheckingTransport = (*Transport)(nil)
+
+// ChecksBlocksBeforeStoring returns true if the transport was given
+// graphsync's store with DefaultStore. Without it, blocks received on
+// channels that do not have their own store are written by graphsync before
+// the transport sees them.
+func (t *Transport) ChecksBlocksBeforeStoring() bool {
+	return t.defaultStore != nil
+}
+
+// UseStore tells the graphsync transport to use the given link system for this channelID.
+// Blocks received on the channel are passed to OnBlockReceived before they
+// are written to it.
+func (t *Transport) UseStore(channelID datatransfer.ChannelID, lsys ipld.LinkSystem) error {
 	t.dataLock.Lock()
 	defer t.dataLock.Unlock()
 	_, ok := t.stores[channelID]
 	if ok {
 		return nil
 	}
-	err := t.gs.RegisterPersistenceOption("data-transfer-"+channelID.String(), loader, storer)
+	err := t.gs.RegisterPersistenceOption("data-transfer-"+channelID.String(), t.checkedLinkSystem(channelID, lsys))
 	if err != nil {
 		return err
 	}
-	t.stores[channelID] = struct{}{}
+	t.stores[channelID] = lsys
 	return nil
 }
 
+// checkedLinkSystem wraps a channel's link system so each block written to it
+// is first passed to OnBlockReceived, and only stored if it is not skipped or
+// rejected. The result is recorded by link for the incoming block hook, which
+// runs when graphsync's traversal reaches the block, possibly after other
+// blocks have been written.
+func (t *Transport) checkedLinkSystem(chid datatransfer.ChannelID, lsys ipld.LinkSystem) ipld.LinkSystem {
+	writeOpener := lsys.StorageWriteOpener
+	if writeOpener == nil {
+		return lsys
+	}
+	lsys.StorageWriteOpener = func(lnkCtx ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		var buf bytes.Buffer
+		return &buf, func(lnk ipld.Link) error {
+			var err error
+			if t.events != nil {
+				err = t.events.OnBlockReceived(chid, lnk, uint64(buf.Len()))
+			}
+			t.blockResultsLk.Lock()
+			t.blockResults[blockKey{chid, lnk}] = err
+			t.blockResultsLk.Unlock()
+			if err != nil && err != datatransfer.ErrPause {
+				return nil
+			}
+
+			w, committer, err := writeOpener(lnkCtx)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			return committer(lnk)
+		}, nil
+	}
+	return lsys
+}
+
 func (t *Transport) gsOutgoingRequestHook(p peer.ID, request graphsync.RequestData, hookActions graphsync.OutgoingRequestHookActions) {
-	message, _ := extension.GetTransferData(request)
+	message, _ := extension.GetTransferData(request, t.supportedExtensions)
 
-	// extension not found; probably not our request.
+	// extension not found; probably not our request, unless it asks for
+	// blocks skipped by a do not send filter
 	if message == nil {
+		t.resendRequestSent(request, hookActions)
 		return
 	}
 
@@ -388,11 +626,7 @@ func (t *Transport) gsOutgoingRequestHook(p peer.ID, request graphsync.RequestDa
 		t.graphsyncRequestMap[graphsyncKey{request.ID(), t.peerID}] = chid
 		t.channelIDMap[chid] = graphsyncKey{request.ID(), t.peerID}
 	}
-	pending, hasPending := t.pending[chid]
-	if hasPending {
-		close(pending)
-		delete(t.pending, chid)
-	}
+	t.releasePending(chid)
 	_, ok := t.stores[chid]
 	if ok {
 		hookActions.UsePersistenceOption("data-transfer-" + chid.String())
@@ -409,13 +643,28 @@ func (t *Transport) gsIncomingBlockHook(p peer.ID, response graphsync.ResponseDa
 		return
 	}
 
+	// the block was checked when it was written to the channel's store
+	key := blockKey{chid, block.Link()}
+	t.blockResultsLk.Lock()
+	blockErr := t.blockResults[key]
+	delete(t.blockResults, key)
+	t.blockResultsLk.Unlock()
+
+	if blockErr == datatransfer.ErrSkipBlock {
+		return
+	}
+	if blockErr != nil && blockErr != datatransfer.ErrPause {
+		hookActions.TerminateWithError(blockErr)
+		return
+	}
+
 	err := t.events.OnDataReceived(chid, block.Link(), block.BlockSize())
 	if err != nil && err != datatransfer.ErrPause {
 		hookActions.TerminateWithError(err)
 		return
 	}
 
-	if err == datatransfer.ErrPause {
+	if err == datatransfer.ErrPause || blockErr == datatransfer.ErrPause {
 		hookActions.PauseRequest()
 	}
 }
@@ -485,27 +734,52 @@ func (t *Transport) gsOutgoingBlockHook(p peer.ID, request graphsync.RequestData
 // if an incoming request does not match a previous push request, it returns an error.
 func (t *Transport) gsReqRecdHook(p peer.ID, request graphsync.RequestData, hookActions graphsync.IncomingRequestHookActions) {
 	// if this is a push request the sender is us.
-	msg, err := extension.GetTransferData(request)
+	msg, err := extension.GetTransferData(request, t.supportedExtensions)
 	if err != nil {
 		hookActions.TerminateWithError(err)
 		return
 	}
 
-	// extension not found; probably not our request.
+	// extension not found; probably not our request, unless it asks for
+	// blocks skipped by a do not send filter
 	if msg == nil {
+		t.resendRequestReceived(p, request, hookActions)
+		return
+	}
+
+	filter, err := extension.GetDoNotSendFilter(request)
+	if err != nil {
+		hookActions.TerminateWithError(err)
 		return
 	}
 
 	var chid datatransfer.ChannelID
-	var responseMessage datatransfer.Message
 	if msg.IsRequest() {
 		// when a DT request comes in on graphsync, it's a pull
 		chid = datatransfer.ChannelID{ID: msg.TransferID(), Initiator: p, Responder: t.peerID}
-		request := msg.(datatransfer.Request)
-		responseMessage, err = t.events.OnRequestReceived(chid, request)
 	} else {
 		// when a DT response comes in on graphsync, it's a push
 		chid = datatransfer.ChannelID{ID: msg.TransferID(), Initiator: t.peerID, Responder: p}
+	}
+
+	// calls for the channel made while the request is handled, such as
+	// resuming a request paused for validation, wait until it is recorded
+	t.dataLock.Lock()
+	if _, ok := t.pending[chid]; !ok {
+		t.pending[chid] = make(chan struct{})
+	}
+	t.dataLock.Unlock()
+	defer func() {
+		t.dataLock.Lock()
+		t.releasePending(chid)
+		t.dataLock.Unlock()
+	}()
+
+	var responseMessage datatransfer.Message
+	if msg.IsRequest() {
+		request := msg.(datatransfer.Request)
+		responseMessage, err = t.events.OnRequestReceived(chid, request)
+	} else {
 		response := msg.(datatransfer.Response)
 		err = t.events.OnResponseReceived(chid, response)
 	}
@@ -531,6 +805,9 @@ func (t *Transport) gsReqRecdHook(p peer.ID, request graphsync.RequestData, hook
 	}
 
 	t.dataLock.Lock()
+	if err == datatransfer.ErrPause {
+		t.hookPausedResponses[chid] = struct{}{}
+	}
 	gsKey := graphsyncKey{request.ID(), p}
 	if _, ok := t.requestorCancelledMap[chid]; ok {
 		delete(t.requestorCancelledMap, chid)
@@ -542,8 +819,15 @@ func (t *Transport) gsReqRecdHook(p peer.ID, request graphsync.RequestData, hook
 	}
 	t.graphsyncRequestMap[gsKey] = chid
 	t.channelIDMap[chid] = gsKey
-	_, ok := t.stores[chid]
-	if ok {
+	filterOption, err := t.useDoNotSendFilter(p, chid, request.Root(), filter)
+	if err != nil {
+		t.dataLock.Unlock()
+		hookActions.TerminateWithError(err)
+		return
+	}
+	if filterOption != "" {
+		hookActions.UsePersistenceOption(filterOption)
+	} else if _, ok := t.stores[chid]; ok {
 		hookActions.UsePersistenceOption("data-transfer-" + chid.String())
 	}
 	t.dataLock.Unlock()
@@ -553,18 +837,29 @@ func (t *Transport) gsReqRecdHook(p peer.ID, request graphsync.RequestData, hook
 // gsCompletedResponseListener is a graphsync.OnCompletedResponseListener. We use it learn when the data transfer is complete
 // for the side that is responding to a graphsync request
 func (t *Transport) gsCompletedResponseListener(p peer.ID, request graphsync.RequestData, status graphsync.ResponseStatusCode) {
+	gsKey := graphsyncKey{request.ID(), p}
 	t.dataLock.RLock()
-	chid, ok := t.graphsyncRequestMap[graphsyncKey{request.ID(), p}]
+	chid, ok := t.graphsyncRequestMap[gsKey]
+	_, isResend := t.resendRequests[gsKey]
 	t.dataLock.RUnlock()
 
 	if !ok {
 		return
 	}
 
+	if isResend {
+		t.resendResponseCompleted(chid, gsKey, status)
+		return
+	}
+
 	if status == graphsync.RequestCancelled {
 		return
 	}
 
+	if t.holdFilteredResponse(chid, status) {
+		return
+	}
+
 	var completeErr error
 	if status != graphsync.RequestCompletedFull {
 		statusStr := gsResponseStatusCodeString(status)
@@ -608,13 +903,29 @@ func gsResponseStatusCodeString(code graphsync.ResponseStatusCode) string {
 	return gsResponseStatusCodes[graphsync.RequestFailedUnknown]
 }
 
-func (t *Transport) cleanupChannel(chid datatransfer.ChannelID, gsKey graphsyncKey) {
+// releasePending wakes calls waiting for the channel to be recorded. The
+// caller must hold dataLock.
+func (t *Transport) releasePending(chid datatransfer.ChannelID) {
+	if pending, ok := t.pending[chid]; ok {
+		close(pending)
+		delete(t.pending, chid)
+	}
+}
+
+func (t *Transport) cleanupChannel(chid datatransfer.ChannelID) {
 	delete(t.channelIDMap, chid)
 	delete(t.contextCancelMap, chid)
 	delete(t.pending, chid)
-	delete(t.graphsyncRequestMap, gsKey)
 	delete(t.pendingExtensions, chid)
+	delete(t.hookPausedResponses, chid)
 	delete(t.requestorCancelledMap, chid)
+	t.blockResultsLk.Lock()
+	for key := range t.blockResults {
+		if key.chid == chid {
+			delete(t.blockResults, key)
+		}
+	}
+	t.blockResultsLk.Unlock()
 	_, ok := t.stores[chid]
 	if ok {
 		err := t.gs.UnregisterPersistenceOption("data-transfer-" + chid.String())
@@ -623,6 +934,7 @@ func (t *Transport) cleanupChannel(chid datatransfer.ChannelID, gsKey graphsyncK
 		}
 	}
 	delete(t.stores, chid)
+	t.cleanupFilter(chid)
 }
 
 func (t *Transport) gsRequestUpdatedHook(p peer.ID, request graphsync.RequestData, update graphsync.RequestData, hookActions graphsync.RequestUpdatedHookActions) {
@@ -656,14 +968,24 @@ func (t *Transport) gsRequestUpdatedHook(p peer.ID, request graphsync.RequestDat
 // gsIncomingResponseHook is a graphsync.OnIncomingResponseHook. We use it to pass on responses
 func (t *Transport) gsIncomingResponseHook(p peer.ID, response graphsync.ResponseData, hookActions graphsync.IncomingResponseHookActions) {
 
+	gsKey := graphsyncKey{response.RequestID(), t.peerID}
 	t.dataLock.RLock()
-	chid, ok := t.graphsyncRequestMap[graphsyncKey{response.RequestID(), t.peerID}]
+	chid, ok := t.graphsyncRequestMap[gsKey]
+	filtered := t.filteredRequests[chid]
+	isRequest := t.channelIDMap[chid] == gsKey
 	t.dataLock.RUnlock()
 
 	if !ok {
 		return
 	}
 
+	if filtered != nil && isRequest {
+		if err := filtered.recordSkipped(response); err != nil {
+			hookActions.TerminateWithError(err)
+			return
+		}
+	}
+
 	responseMessage, err := t.processExtension(chid, response, p)
 
 	if responseMessage != nil {
@@ -685,7 +1007,7 @@ func (t *Transport) gsIncomingResponseHook(p peer.ID, response graphsync.Respons
 func (t *Transport) processExtension(chid datatransfer.ChannelID, gsMsg extension.GsExtended, p peer.ID) (datatransfer.Message, error) {
 
 	// if this is a push request the sender is us.
-	msg, err := extension.GetTransferData(gsMsg)
+	msg, err := extension.GetTransferData(gsMsg, t.supportedExtensions)
 	if err != nil {
 		return nil, err
 	}
@@ -739,3 +1061,35 @@ func (t *Transport) gsNetworkSendErrorListener(p peer.ID, request graphsync.Requ
 		log.Errorf("failed to fire transport send error %s: %s", gserr, err)
 	}
 }
+
+// errDoNotSendFull stops reading cids once the do not send list is full
+var errDoNotSendFull = errors.New("do not send list is full")
+
+// encodeDoNotSendCids encodes the cids from the iterator as a DAG-CBOR list of
+// links, the format of the graphsync do-not-send-cids extension, returning the
+// encoded list and the number of cids in it. The cids are written as they are
+// read, up to max of them unless max is 0, and a gap is left at the start of
+// the buffer for the list header, which can only be written once the length is
+// known. It also returns whether there were more cids than fit.
+func encodeDoNotSendCids(doNotSendCids datatransfer.CidIterator, max uint64) ([]byte, uint64, bool, error) {
+	const maxHeaderLen = 9
+	buf := bytes.NewBuffer(make([]byte, maxHeaderLen))
+	var count uint64
+	err := doNotSendCids(func(c cid.Cid) error {
+		if max != 0 && count == max {
+			return errDoNotSendFull
+		}
+		count++
+		return cbg.WriteCid(buf, c)
+	})
+	if err != nil && err != errDoNotSendFull {
+		return nil, 0, false, err
+	}
+	var header bytes.Buffer
+	if err := cbg.WriteMajorTypeHeader(&header, cbg.MajArray, count); err != nil {
+		return nil, 0, false, err
+	}
+	bz := buf.Bytes()[maxHeaderLen-header.Len():]
+	copy(bz, header.Bytes())
+	return bz, count, err == errDoNotSendFull, nil
+}
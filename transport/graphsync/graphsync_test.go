@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-graphsync"
 	"github.com/ipfs/go-graphsync/cidset"
+	"github.com/ipfs/go-graphsync/metadata"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -24,11 +28,21 @@ import (
 )
 
 func TestManager(t *testing.T) {
+	// the sender only skips raw leaves matching a do not send filter
+	doNotSendCids := testutil.GenerateCids(30)
+	matchedCid := testutil.GenerateCids(1)[0]
+	matchedLeaf := cid.NewCidV1(cid.Raw, testutil.GenerateCids(1)[0].Hash())
+	unmatchedLeaf := cid.NewCidV1(cid.Raw, testutil.GenerateCids(1)[0].Hash())
+	readableStore := cidlink.DefaultLinkSystem()
+	readableStore.StorageReadOpener = func(ipld.LinkContext, ipld.Link) (io.Reader, error) {
+		return bytes.NewReader(nil), nil
+	}
 	testCases := map[string]struct {
 		requestConfig  gsRequestConfig
 		responseConfig gsResponseConfig
 		updatedConfig  gsRequestConfig
 		events         fakeEvents
+		options        []Option
 		action         func(gsData *harness)
 		check          func(t *testing.T, events *fakeEvents, gsData *harness)
 	}{
@@ -99,6 +113,104 @@ func TestManager(t *testing.T) {
 				require.Error(t, gsData.incomingBlockHookActions.TerminationError)
 			},
 		},
+		"gs incoming block skipped by block validator is not recorded": {
+			events: fakeEvents{
+				OnBlockReceivedError: datatransfer.ErrSkipBlock,
+			},
+			action: func(gsData *harness) {
+				gsData.useCheckedStore()
+				gsData.outgoingRequestHook()
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				gsData.writeBlock(t)
+				gsData.incomingBlockHook()
+				require.True(t, events.OnBlockReceivedCalled)
+				require.False(t, events.OnDataReceivedCalled)
+				require.NoError(t, gsData.incomingBlockHookActions.TerminationError)
+			},
+		},
+		"gs incoming block rejected by block validator will halt request": {
+			events: fakeEvents{
+				OnBlockReceivedError: errors.New("blocklisted"),
+			},
+			action: func(gsData *harness) {
+				gsData.useCheckedStore()
+				gsData.outgoingRequestHook()
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				gsData.writeBlock(t)
+				gsData.incomingBlockHook()
+				require.True(t, events.OnBlockReceivedCalled)
+				require.False(t, events.OnDataReceivedCalled)
+				require.EqualError(t, gsData.incomingBlockHookActions.TerminationError, "blocklisted")
+			},
+		},
+		"gs incoming block paused by block validator will pause request": {
+			events: fakeEvents{
+				OnBlockReceivedError: datatransfer.ErrPause,
+			},
+			action: func(gsData *harness) {
+				gsData.useCheckedStore()
+				gsData.outgoingRequestHook()
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				gsData.writeBlock(t)
+				gsData.incomingBlockHook()
+				require.True(t, events.OnBlockReceivedCalled)
+				require.True(t, events.OnDataReceivedCalled)
+				require.True(t, gsData.incomingBlockHookActions.Paused)
+				require.NoError(t, gsData.incomingBlockHookActions.TerminationError)
+			},
+		},
+		"UseStore checks blocks before they are written": {
+			events: fakeEvents{
+				OnBlockReceivedError: datatransfer.ErrSkipBlock,
+			},
+			action: func(gsData *harness) {
+				lsys := cidlink.DefaultLinkSystem()
+				lsys.StorageWriteOpener = func(ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+					return nil, nil, errors.New("should not write skipped block")
+				}
+				chid := datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self}
+				_ = gsData.transport.UseStore(chid, lsys)
+				gsData.outgoingRequestHook()
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				expectedChannel := "data-transfer-" + datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self}.String()
+				option := gsData.fgs.AssertHasPersistenceOption(t, expectedChannel)
+				w, committer, err := option.StorageWriteOpener(ipld.LinkContext{})
+				require.NoError(t, err)
+				_, err = w.Write([]byte("apples"))
+				require.NoError(t, err)
+				require.NoError(t, committer(gsData.block.Link()))
+				require.True(t, events.OnBlockReceivedCalled)
+
+				events.OnBlockReceivedCalled = false
+				gsData.incomingBlockHook()
+				require.False(t, events.OnBlockReceivedCalled)
+				require.False(t, events.OnDataReceivedCalled)
+				require.NoError(t, gsData.incomingBlockHookActions.TerminationError)
+			},
+		},
+		"cleaning up a channel whose request was never recorded drops its store and checked blocks": {
+			events: fakeEvents{
+				OnBlockReceivedError: datatransfer.ErrSkipBlock,
+			},
+			action: func(gsData *harness) {
+				gsData.useCheckedStore()
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				gsData.writeBlock(t)
+				chid := datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self}
+				gsData.transport.CleanupChannel(chid)
+				gsData.fgs.AssertDoesNotHavePersistenceOption(t, "data-transfer-"+chid.String())
+
+				// the block skipped before the cleanup is not skipped later
+				gsData.outgoingRequestHook()
+				gsData.incomingBlockHook()
+				require.True(t, events.OnDataReceivedCalled)
+			},
+		},
 		"outgoing gs request with recognized dt request can receive gs response": {
 			responseConfig: gsResponseConfig{
 				dtIsResponse: true,
@@ -237,7 +349,7 @@ func TestManager(t *testing.T) {
 				require.Equal(t, 1, events.OnRequestReceivedCallCount)
 				require.Equal(t, 0, events.OnResponseReceivedCallCount)
 				require.Equal(t, events.RequestReceivedChannelID, datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.self, Initiator: gsData.other})
-				dtRequestData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_1)
+				dtRequestData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_2)
 				assertDecodesToMessage(t, dtRequestData, events.RequestReceivedRequest)
 				require.True(t, gsData.incomingRequestHookActions.Validated)
 				assertHasOutgoingMessage(t, gsData.incomingRequestHookActions.SentExtensions, events.RequestReceivedResponse)
@@ -255,7 +367,7 @@ func TestManager(t *testing.T) {
 				require.Equal(t, 0, events.OnRequestReceivedCallCount)
 				require.Equal(t, 1, events.OnResponseReceivedCallCount)
 				require.Equal(t, events.ResponseReceivedChannelID, datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self})
-				dtResponseData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_1)
+				dtResponseData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_2)
 				assertDecodesToMessage(t, dtResponseData, events.ResponseReceivedResponse)
 				require.True(t, gsData.incomingRequestHookActions.Validated)
 				require.NoError(t, gsData.incomingRequestHookActions.TerminationError)
@@ -286,7 +398,7 @@ func TestManager(t *testing.T) {
 				require.Equal(t, 1, events.OnRequestReceivedCallCount)
 				require.Equal(t, 0, events.OnResponseReceivedCallCount)
 				require.Equal(t, events.RequestReceivedChannelID, datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.self, Initiator: gsData.other})
-				dtRequestData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_1)
+				dtRequestData, _ := gsData.request.Extension(extension.ExtensionDataTransfer1_2)
 				assertDecodesToMessage(t, dtRequestData, events.RequestReceivedRequest)
 				require.False(t, gsData.incomingRequestHookActions.Validated)
 				assertHasOutgoingMessage(t, gsData.incomingRequestHookActions.SentExtensions, events.RequestReceivedResponse)
@@ -653,8 +765,8 @@ func TestManager(t *testing.T) {
 				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
 
 				ext := requestReceived.Extensions
-				require.Len(t, ext, 3)
-				doNotSend := ext[2]
+				require.Len(t, ext, 4)
+				doNotSend := ext[3]
 
 				name := doNotSend.Name
 				require.Equal(t, graphsync.ExtensionDoNotSendCIDs, name)
@@ -664,6 +776,243 @@ func TestManager(t *testing.T) {
 				require.Equal(t, cs.Len(), 2)
 			},
 		},
+		"open channel iter streams doNotSendCids into the DoNotSend extension": {
+			action: func(gsData *harness) {
+				cids := testutil.GenerateCids(30)
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.OpenChannelIter(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: gsData.outgoing.BaseCid()},
+					stor,
+					func(fn func(cid.Cid) error) error {
+						for _, c := range cids {
+							if err := fn(c); err != nil {
+								return err
+							}
+						}
+						return nil
+					},
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+
+				ext := requestReceived.Extensions
+				require.Len(t, ext, 4)
+				doNotSend := ext[3]
+				require.Equal(t, graphsync.ExtensionDoNotSendCIDs, doNotSend.Name)
+				cs, err := cidset.DecodeCidSet(doNotSend.Data)
+				require.NoError(t, err)
+				require.Equal(t, 30, cs.Len())
+			},
+		},
+		"open channel iter stops reading doNotSendCids at the maximum": {
+			options: []Option{MaxDoNotSendCids(10)},
+			action: func(gsData *harness) {
+				cids := testutil.GenerateCids(30)
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.OpenChannelIter(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: gsData.outgoing.BaseCid()},
+					stor,
+					func(fn func(cid.Cid) error) error {
+						for _, c := range cids {
+							if err := fn(c); err != nil {
+								return err
+							}
+						}
+						return nil
+					},
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+
+				ext := requestReceived.Extensions
+				require.Len(t, ext, 4)
+				doNotSend := ext[3]
+				require.Equal(t, graphsync.ExtensionDoNotSendCIDs, doNotSend.Name)
+				cs, err := cidset.DecodeCidSet(doNotSend.Data)
+				require.NoError(t, err)
+				require.Equal(t, 10, cs.Len())
+			},
+		},
+		"open channel iter sends a do not send filter for cids that do not fit": {
+			options: []Option{MaxDoNotSendCids(10), DefaultStore(readableStore)},
+			action: func(gsData *harness) {
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.OpenChannelIter(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: gsData.outgoing.BaseCid()},
+					stor,
+					iterateCids(doNotSendCids),
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+
+				ext := requestReceived.Extensions
+				require.Len(t, ext, 5)
+				cs, err := cidset.DecodeCidSet(ext[3].Data)
+				require.NoError(t, err)
+				require.Equal(t, 10, cs.Len())
+				require.Equal(t, extension.ExtensionDoNotSendFilter, ext[4].Name)
+				filter, err := extension.GetDoNotSendFilter(extended{ext[4].Name: ext[4].Data})
+				require.NoError(t, err)
+				for _, c := range doNotSendCids {
+					require.True(t, filter.Has(c))
+				}
+			},
+		},
+		"requester ignores blocks skipped by its do not send filter": {
+			options:        []Option{MaxDoNotSendCids(10), DefaultStore(readableStore)},
+			responseConfig: gsResponseConfig{metadata: metadata.Metadata{{Link: doNotSendCids[20], BlockPresent: false}}},
+			action: func(gsData *harness) {
+				gsData.fgs.LeaveRequestsOpen()
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.OpenChannelIter(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: gsData.outgoing.BaseCid()},
+					stor,
+					iterateCids(doNotSendCids),
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+				gsData.outgoingRequestHook()
+				gsData.incomingResponseHOok()
+				close(requestReceived.ResponseChan)
+				requestReceived.ResponseErrChan <- fmt.Errorf("Remote Peer Is Missing Block: %s", doNotSendCids[20])
+				close(requestReceived.ResponseErrChan)
+
+				// the skipped block is in the store, so only the root is
+				// requested again, to tell the data sender the channel is done
+				resend := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+				require.Equal(t, cidlink.Link{Cid: gsData.outgoing.BaseCid()}, resend.Root)
+				close(resend.ResponseChan)
+				close(resend.ResponseErrChan)
+				require.Eventually(t, func() bool {
+					return events.OnChannelCompletedCalled == true
+				}, 2*time.Second, 100*time.Millisecond)
+				require.True(t, events.ChannelCompletedSuccess)
+			},
+		},
+		"requester fails on blocks missing on the data sender despite its do not send filter": {
+			options:        []Option{MaxDoNotSendCids(10), DefaultStore(readableStore)},
+			responseConfig: gsResponseConfig{metadata: metadata.Metadata{{Link: unmatchedLeaf, BlockPresent: false}}},
+			action: func(gsData *harness) {
+				gsData.fgs.LeaveRequestsOpen()
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.OpenChannelIter(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: gsData.outgoing.BaseCid()},
+					stor,
+					iterateCids(doNotSendCids),
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+				gsData.outgoingRequestHook()
+				gsData.incomingResponseHOok()
+				close(requestReceived.ResponseChan)
+				requestReceived.ResponseErrChan <- fmt.Errorf("Remote Peer Is Missing Block: %s", unmatchedLeaf)
+				close(requestReceived.ResponseErrChan)
+
+				require.Eventually(t, func() bool {
+					return events.OnChannelCompletedCalled == true
+				}, 2*time.Second, 100*time.Millisecond)
+				require.False(t, events.ChannelCompletedSuccess)
+			},
+		},
+		"open channel iter sends no do not send filter if the channel store is not known": {
+			options: []Option{MaxDoNotSendCids(10)},
+			action: func(gsData *harness) {
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.OpenChannelIter(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: gsData.outgoing.BaseCid()},
+					stor,
+					iterateCids(doNotSendCids),
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+				require.Len(t, requestReceived.Extensions, 4)
+			},
+		},
+		"incoming request with a do not send filter skips raw leaves matching it": {
+			options:       []Option{DefaultStore(readableStore)},
+			requestConfig: gsRequestConfig{doNotSendFilter: []cid.Cid{matchedCid, matchedLeaf}},
+			action: func(gsData *harness) {
+				gsData.incomingRequestHook()
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				chid := datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.self, Initiator: gsData.other}
+				require.True(t, gsData.incomingRequestHookActions.Validated)
+				require.Equal(t, "data-transfer-filtered-"+chid.String(), gsData.incomingRequestHookActions.PersistenceOption)
+				option := gsData.fgs.AssertHasPersistenceOption(t, gsData.incomingRequestHookActions.PersistenceOption)
+
+				_, err := option.StorageReadOpener(ipld.LinkContext{}, cidlink.Link{Cid: matchedLeaf})
+				require.Error(t, err)
+				_, err = option.StorageReadOpener(ipld.LinkContext{}, cidlink.Link{Cid: matchedCid})
+				require.NoError(t, err)
+				_, err = option.StorageReadOpener(ipld.LinkContext{}, cidlink.Link{Cid: unmatchedLeaf})
+				require.NoError(t, err)
+
+				gsData.transport.CleanupChannel(chid)
+				gsData.fgs.AssertDoesNotHavePersistenceOption(t, "data-transfer-filtered-"+chid.String())
+			},
+		},
+		"incoming request for a block not skipped by a do not send filter is rejected": {
+			options:       []Option{DefaultStore(readableStore)},
+			requestConfig: gsRequestConfig{doNotSendFilter: []cid.Cid{matchedLeaf}},
+			action: func(gsData *harness) {
+				gsData.incomingRequestHook()
+				chid := datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.self, Initiator: gsData.other}
+				resend, _ := (&extension.FilterResend{ChannelID: chid, Last: true}).ToExtensionData()
+				// the filter sent is a bloom filter, so pick a root it does
+				// not match by chance
+				filter, _ := extension.NewDoNotSendFilter(1, 0.01)
+				filter.Add(matchedLeaf)
+				var request graphsync.RequestData
+				for request == nil || filter.Has(request.Root()) {
+					request = testutil.NewFakeRequest(gsData.request.ID()+1, map[graphsync.ExtensionName][]byte{resend.Name: resend.Data})
+				}
+				gsData.fgs.IncomingRequestHook(gsData.other, request, gsData.incomingRequestHookActions)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				require.Error(t, gsData.incomingRequestHookActions.TerminationError)
+			},
+		},
+		"open channel iter with no cids does not add the DoNotSend extension": {
+			action: func(gsData *harness) {
+				stor, _ := gsData.outgoing.Selector()
+				_ = gsData.transport.OpenChannelIter(
+					gsData.ctx,
+					gsData.other,
+					datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self},
+					cidlink.Link{Cid: gsData.outgoing.BaseCid()},
+					stor,
+					func(fn func(cid.Cid) error) error { return nil },
+					gsData.outgoing)
+			},
+			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
+				requestReceived := gsData.fgs.AssertRequestReceived(gsData.ctx, t)
+				require.Len(t, requestReceived.Extensions, 3)
+			},
+		},
 		"open channel cancels an existing request with the same channel ID": {
 			action: func(gsData *harness) {
 				cids := testutil.GenerateCids(2)
@@ -874,13 +1223,14 @@ func TestManager(t *testing.T) {
 		},
 		"UseStore can change store used for outgoing requests": {
 			action: func(gsData *harness) {
-				loader := func(ipld.Link, ipld.LinkContext) (io.Reader, error) {
-					return nil, nil
-				}
-				storer := func(ipld.LinkContext) (io.Writer, ipld.StoreCommitter, error) {
-					return nil, nil, nil
-				}
-				_ = gsData.transport.UseStore(datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self}, loader, storer)
+				lsys := datatransfer.LinkSystemForLoaderStorer(
+					func(ipld.Link, ipld.LinkContext) (io.Reader, error) {
+						return nil, nil
+					},
+					func(ipld.LinkContext) (io.Writer, datatransfer.StoreCommitter, error) {
+						return nil, nil, nil
+					})
+				_ = gsData.transport.UseStore(datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.other, Initiator: gsData.self}, lsys)
 				gsData.outgoingRequestHook()
 			},
 			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
@@ -893,13 +1243,14 @@ func TestManager(t *testing.T) {
 		},
 		"UseStore can change store used for incoming requests": {
 			action: func(gsData *harness) {
-				loader := func(ipld.Link, ipld.LinkContext) (io.Reader, error) {
-					return nil, nil
-				}
-				storer := func(ipld.LinkContext) (io.Writer, ipld.StoreCommitter, error) {
-					return nil, nil, nil
-				}
-				_ = gsData.transport.UseStore(datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.self, Initiator: gsData.other}, loader, storer)
+				lsys := datatransfer.LinkSystemForLoaderStorer(
+					func(ipld.Link, ipld.LinkContext) (io.Reader, error) {
+						return nil, nil
+					},
+					func(ipld.LinkContext) (io.Writer, datatransfer.StoreCommitter, error) {
+						return nil, nil, nil
+					})
+				_ = gsData.transport.UseStore(datatransfer.ChannelID{ID: gsData.transferID, Responder: gsData.self, Initiator: gsData.other}, lsys)
 				gsData.incomingRequestHook()
 			},
 			check: func(t *testing.T, events *fakeEvents, gsData *harness) {
@@ -926,7 +1277,7 @@ func TestManager(t *testing.T) {
 			fgs := testutil.NewFakeGraphSync()
 			outgoing := testutil.NewDTRequest(t, transferID)
 			incoming := testutil.NewDTResponse(t, transferID)
-			transport := NewTransport(peers[0], fgs)
+			transport := NewTransport(peers[0], fgs, data.options...)
 			gsData := &harness{
 				ctx:                         ctx,
 				outgoing:                    outgoing,
@@ -956,6 +1307,42 @@ func TestManager(t *testing.T) {
 	}
 }
 
+func TestResumeWhileRequestHookRuns(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	peers := testutil.GeneratePeers(2)
+	transferID := datatransfer.TransferID(rand.Uint64())
+	requestID := graphsync.RequestID(rand.Int31())
+	requestConfig := gsRequestConfig{}
+	request := requestConfig.makeRequest(t, transferID, requestID)
+	fgs := testutil.NewFakeGraphSync()
+	transport := NewTransport(peers[0], fgs)
+	chid := datatransfer.ChannelID{ID: transferID, Initiator: peers[1], Responder: peers[0]}
+
+	// resume the request while the hook that pauses it is still running,
+	// as happens when a request is validated quickly
+	resumed := make(chan error, 1)
+	events := &fakeEvents{
+		OnRequestReceivedErrors: []error{datatransfer.ErrPause},
+		OnRequestReceivedHook: func() {
+			go func() {
+				resumed <- transport.ResumeChannel(ctx, testutil.NewDTResponse(t, transferID), chid)
+			}()
+			time.Sleep(50 * time.Millisecond)
+		},
+	}
+	require.NoError(t, transport.SetEventHandler(events))
+	fgs.IncomingRequestHook(peers[1], request, &testutil.FakeIncomingRequestHookActions{})
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("resume did not complete")
+	case err := <-resumed:
+		require.NoError(t, err)
+	}
+	fgs.AssertResumeResponseReceived(ctx, t)
+}
+
 type fakeEvents struct {
 	ChannelOpenedChannelID      datatransfer.ChannelID
 	RequestReceivedChannelID    datatransfer.ChannelID
@@ -963,9 +1350,12 @@ type fakeEvents struct {
 	OnChannelOpenedError        error
 	OnDataReceivedCalled        bool
 	OnDataReceivedError         error
+	OnBlockReceivedCalled       bool
+	OnBlockReceivedError        error
 	OnDataSentCalled            bool
 	OnRequestReceivedCallCount  int
 	OnRequestReceivedErrors     []error
+	OnRequestReceivedHook       func()
 	OnResponseReceivedCallCount int
 	OnResponseReceivedErrors    []error
 	OnChannelCompletedCalled    bool
@@ -1018,6 +1408,11 @@ func (fe *fakeEvents) OnDataReceived(chid datatransfer.ChannelID, link ipld.Link
 	return fe.OnDataReceivedError
 }
 
+func (fe *fakeEvents) OnBlockReceived(chid datatransfer.ChannelID, link ipld.Link, size uint64) error {
+	fe.OnBlockReceivedCalled = true
+	return fe.OnBlockReceivedError
+}
+
 func (fe *fakeEvents) OnDataSent(chid datatransfer.ChannelID, link ipld.Link, size uint64) error {
 	fe.OnDataSentCalled = true
 	return nil
@@ -1027,6 +1422,9 @@ func (fe *fakeEvents) OnRequestReceived(chid datatransfer.ChannelID, request dat
 	fe.OnRequestReceivedCallCount++
 	fe.RequestReceivedChannelID = chid
 	fe.RequestReceivedRequest = request
+	if fe.OnRequestReceivedHook != nil {
+		fe.OnRequestReceivedHook()
+	}
 	var err error
 	if len(fe.OnRequestReceivedErrors) > 0 {
 		err, fe.OnRequestReceivedErrors = fe.OnRequestReceivedErrors[0], fe.OnRequestReceivedErrors[1:]
@@ -1081,6 +1479,29 @@ func (ha *harness) incomingBlockHook() {
 func (ha *harness) outgoingBlockHook() {
 	ha.fgs.OutgoingBlockHook(ha.other, ha.request, ha.block, ha.outgoingBlockHookActions)
 }
+
+// useCheckedStore gives the outgoing channel a store, so blocks written to it
+// are checked before they are stored
+func (ha *harness) useCheckedStore() {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageWriteOpener = func(ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		return ioutil.Discard, func(ipld.Link) error { return nil }, nil
+	}
+	_ = ha.transport.UseStore(datatransfer.ChannelID{ID: ha.transferID, Responder: ha.other, Initiator: ha.self}, lsys)
+}
+
+// writeBlock writes the block to the outgoing channel's store, as graphsync
+// does before calling the incoming block hook
+func (ha *harness) writeBlock(t *testing.T) {
+	chid := datatransfer.ChannelID{ID: ha.transferID, Responder: ha.other, Initiator: ha.self}
+	option := ha.fgs.AssertHasPersistenceOption(t, "data-transfer-"+chid.String())
+	w, committer, err := option.StorageWriteOpener(ipld.LinkContext{})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("apples"))
+	require.NoError(t, err)
+	require.NoError(t, committer(ha.block.Link()))
+}
+
 func (ha *harness) incomingRequestHook() {
 	ha.fgs.IncomingRequestHook(ha.other, ha.request, ha.incomingRequestHookActions)
 }
@@ -1110,7 +1531,7 @@ func (dtc *dtConfig) extensions(t *testing.T, transferID datatransfer.TransferID
 	extensions := make(map[graphsync.ExtensionName][]byte)
 	if !dtc.dtExtensionMissing {
 		if dtc.dtExtensionMalformed {
-			extensions[extension.ExtensionDataTransfer1_1] = testutil.RandomBytes(100)
+			extensions[extension.ExtensionDataTransfer1_2] = testutil.RandomBytes(100)
 		} else {
 			var msg datatransfer.Message
 			if dtc.dtIsResponse {
@@ -1121,7 +1542,7 @@ func (dtc *dtConfig) extensions(t *testing.T, transferID datatransfer.TransferID
 			buf := new(bytes.Buffer)
 			err := msg.ToNet(buf)
 			require.NoError(t, err)
-			extensions[extension.ExtensionDataTransfer1_1] = buf.Bytes()
+			extensions[extension.ExtensionDataTransfer1_2] = buf.Bytes()
 		}
 	}
 	return extensions
@@ -1131,6 +1552,7 @@ type gsRequestConfig struct {
 	dtExtensionMissing   bool
 	dtIsResponse         bool
 	dtExtensionMalformed bool
+	doNotSendFilter      []cid.Cid
 }
 
 func (grc *gsRequestConfig) makeRequest(t *testing.T, transferID datatransfer.TransferID, requestID graphsync.RequestID) graphsync.RequestData {
@@ -1140,14 +1562,43 @@ func (grc *gsRequestConfig) makeRequest(t *testing.T, transferID datatransfer.Tr
 		dtExtensionMalformed: grc.dtExtensionMalformed,
 	}
 	extensions := dtConfig.extensions(t, transferID)
+	if grc.doNotSendFilter != nil {
+		filter, err := extension.NewDoNotSendFilter(uint64(len(grc.doNotSendFilter)), 0.01)
+		require.NoError(t, err)
+		for _, c := range grc.doNotSendFilter {
+			filter.Add(c)
+		}
+		ext, err := filter.ToExtensionData()
+		require.NoError(t, err)
+		extensions[ext.Name] = ext.Data
+	}
 	return testutil.NewFakeRequest(requestID, extensions)
 }
 
+type extended map[graphsync.ExtensionName][]byte
+
+func (e extended) Extension(name graphsync.ExtensionName) ([]byte, bool) {
+	data, ok := e[name]
+	return data, ok
+}
+
+func iterateCids(cids []cid.Cid) datatransfer.CidIterator {
+	return func(fn func(cid.Cid) error) error {
+		for _, c := range cids {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 type gsResponseConfig struct {
 	dtExtensionMissing   bool
 	dtIsResponse         bool
 	dtExtensionMalformed bool
 	status               graphsync.ResponseStatusCode
+	metadata             metadata.Metadata
 }
 
 func (grc *gsResponseConfig) makeResponse(t *testing.T, transferID datatransfer.TransferID, requestID graphsync.RequestID) graphsync.ResponseData {
@@ -1157,6 +1608,11 @@ func (grc *gsResponseConfig) makeResponse(t *testing.T, transferID datatransfer.
 		dtExtensionMalformed: grc.dtExtensionMalformed,
 	}
 	extensions := dtConfig.extensions(t, transferID)
+	if grc.metadata != nil {
+		md, err := metadata.EncodeMetadata(grc.metadata)
+		require.NoError(t, err)
+		extensions[graphsync.ExtensionMetadata] = md
+	}
 	return testutil.NewFakeResponse(requestID, extensions, grc.status)
 }
 
@@ -1172,7 +1628,7 @@ func assertHasOutgoingMessage(t *testing.T, extensions []graphsync.ExtensionData
 	err := expected.ToNet(buf)
 	require.NoError(t, err)
 	expectedExt := graphsync.ExtensionData{
-		Name: extension.ExtensionDataTransfer1_1,
+		Name: extension.ExtensionDataTransfer1_2,
 		Data: buf.Bytes(),
 	}
 	require.Contains(t, extensions, expectedExt)
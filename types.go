@@ -2,12 +2,15 @@ package datatransfer
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/libp2p/go-libp2p-core/peer"
 	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-data-transfer/encoding"
 )
@@ -21,6 +24,38 @@ type TypeIdentifier string
 // EmptyTypeIdentifier means there is no voucher present
 const EmptyTypeIdentifier = TypeIdentifier("")
 
+// VersionedTypeIdentifier returns the identifier for the given version of a
+// type, in the form <name>/v<version>
+func VersionedTypeIdentifier(name string, version uint64) TypeIdentifier {
+	return TypeIdentifier(fmt.Sprintf("%s/v%d", name, version))
+}
+
+// Name returns the type name of the identifier, without its version
+func (t TypeIdentifier) Name() string {
+	name, _ := t.split()
+	return name
+}
+
+// Version returns the version of the identifier. Identifiers without a
+// version are version 0.
+func (t TypeIdentifier) Version() uint64 {
+	_, version := t.split()
+	return version
+}
+
+func (t TypeIdentifier) split() (string, uint64) {
+	s := string(t)
+	idx := strings.LastIndex(s, "/v")
+	if idx < 0 {
+		return s, 0
+	}
+	version, err := strconv.ParseUint(s[idx+2:], 10, 64)
+	if err != nil {
+		return s, 0
+	}
+	return s[:idx], version
+}
+
 // Registerable is a type of object in a registry. It must be encodable and must
 // have a single method that uniquely identifies its type
 type Registerable interface {
@@ -39,6 +74,10 @@ type Voucher Registerable
 // voucher being rejected or accepted
 type VoucherResult Registerable
 
+// ChannelMessage is an application message sent to the other party of an open
+// channel, such as a control message of a retrieval market
+type ChannelMessage Registerable
+
 // TransferID is an identifier for a data transfer, shared between
 // request/responder and unique to the requester
 type TransferID uint64
@@ -55,6 +94,28 @@ func (c ChannelID) String() string {
 	return fmt.Sprintf("%s-%s-%d", c.Initiator, c.Responder, c.ID)
 }
 
+// ParseChannelID parses a channel ID in the form returned by String,
+// <initiator>-<responder>-<transfer id>
+func ParseChannelID(s string) (ChannelID, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return ChannelID{}, xerrors.Errorf("channel ID %q is not of the form <initiator>-<responder>-<transfer id>", s)
+	}
+	initiator, err := peer.Decode(parts[0])
+	if err != nil {
+		return ChannelID{}, xerrors.Errorf("parsing initiator: %w", err)
+	}
+	responder, err := peer.Decode(parts[1])
+	if err != nil {
+		return ChannelID{}, xerrors.Errorf("parsing responder: %w", err)
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return ChannelID{}, xerrors.Errorf("parsing transfer ID: %w", err)
+	}
+	return ChannelID{Initiator: initiator, Responder: responder, ID: TransferID(id)}, nil
+}
+
 // OtherParty returns the peer on the other side of the request, depending
 // on whether this peer is the initiator or responder
 func (c ChannelID) OtherParty(thisPeer peer.ID) peer.ID {
@@ -114,6 +175,19 @@ type ChannelState interface {
 	// Received returns the number of bytes received
 	Received() uint64
 
+	// TotalBlocks returns the number of blocks the sender expects to
+	// transfer, or 0 if it is unknown
+	TotalBlocks() uint64
+
+	// SentBlocks returns the number of distinct blocks sent
+	SentBlocks() uint64
+
+	// ReceivedBlocks returns the number of distinct blocks received
+	ReceivedBlocks() uint64
+
+	// QueuedBlocks returns the number of distinct blocks queued for sending
+	QueuedBlocks() uint64
+
 	// Message offers additional information about the current status
 	Message() string
 
@@ -132,6 +206,11 @@ type ChannelState interface {
 	// ReceivedCids returns the cids received so far on the channel
 	ReceivedCids() []cid.Cid
 
+	// ReceivedCidsIter calls fn with each cid received so far on the channel,
+	// in the order they were received, without reading them all into memory.
+	// It stops at the first error returned by fn.
+	ReceivedCidsIter(fn func(cid.Cid) error) error
+
 	// Queued returns the number of bytes read from the node and queued for sending
 	Queued() uint64
 
@@ -141,6 +220,35 @@ type ChannelState interface {
 	// It is unsafe for the caller to modify the return value, and changes
 	// may not be persisted. It should be treated as immutable.
 	Stages() *ChannelStages
+
+	// Progress returns an estimate of how far along the transfer is, and how
+	// long it has left to run, as of when the channel state was read
+	Progress() ChannelProgress
+}
+
+// ChannelProgress is an estimate of how far along the transfer on a channel
+// is, from the point of view of this node
+type ChannelProgress struct {
+	// Transferred is the number of bytes sent by this node if it is the
+	// sender, or received by it if it is the receiver
+	Transferred uint64
+	// Blocks is the number of distinct blocks sent by this node if it is the
+	// sender, or received by it if it is the receiver
+	Blocks uint64
+	// TotalSize is the number of bytes expected to be transferred, or 0 if it
+	// is unknown
+	TotalSize uint64
+	// TotalBlocks is the number of blocks expected to be transferred, or 0 if
+	// it is unknown
+	TotalBlocks uint64
+	// Throughput is a moving average of the transfer rate in bytes per second
+	Throughput float64
+	// PercentComplete is Transferred as a percentage of TotalSize, or 0 if the
+	// total size is unknown
+	PercentComplete float64
+	// EstimatedTimeRemaining is how long the rest of the transfer will take at
+	// the current throughput, or 0 if either is unknown
+	EstimatedTimeRemaining time.Duration
 }
 
 // ChannelStages captures a timeline of the progress of a data transfer channel,
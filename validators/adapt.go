@@ -0,0 +1,30 @@
+package validators
+
+import (
+	"context"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// Adapt returns a datatransfer.RequestValidatorV2 that validates requests
+// with the given datatransfer.RequestValidator, which receives only the peer,
+// voucher, base CID and selector of each request. Validators that also
+// implement datatransfer.RequestValidatorV2 are returned as they are.
+func Adapt(validator datatransfer.RequestValidator) datatransfer.RequestValidatorV2 {
+	if v2, ok := validator.(datatransfer.RequestValidatorV2); ok {
+		return v2
+	}
+	return &adapted{validator}
+}
+
+type adapted struct {
+	validator datatransfer.RequestValidator
+}
+
+func (a *adapted) ValidatePushRequest(_ context.Context, request datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	return a.validator.ValidatePush(request.Peer, request.Voucher, request.BaseCid, request.Selector)
+}
+
+func (a *adapted) ValidatePullRequest(_ context.Context, request datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	return a.validator.ValidatePull(request.Peer, request.Voucher, request.BaseCid, request.Selector)
+}
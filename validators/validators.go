@@ -0,0 +1,170 @@
+package validators
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+)
+
+// ErrNoDecision is returned by a validator in a FirstDecides chain to leave
+// the decision to the next validator in the chain
+var ErrNoDecision = errors.New("no decision")
+
+// ErrUndecided is returned by a FirstDecides chain when no validator in the
+// chain decides on the request
+var ErrUndecided = errors.New("no validator decided on the request")
+
+// ErrNoValidators is returned by an AllMustAccept chain with no validators,
+// as there is no validator to accept the request
+var ErrNoValidators = errors.New("no validators to accept the request")
+
+// Decision is the outcome of validating a request
+type Decision struct {
+	Result datatransfer.VoucherResult
+	Err    error
+}
+
+// Combinator combines the decisions of the validators in a chain. It is
+// called with the decisions made so far after each validator runs, and
+// returns the outcome of the chain and true once the outcome is decided.
+// Once every validator has run, it is called with complete set and the
+// outcome it returns is used.
+type Combinator func(decisions []Decision, complete bool) (Decision, bool)
+
+// Chain is a datatransfer.RequestValidator and
+// datatransfer.RequestValidatorV2 that runs validators in order and combines
+// their decisions
+type Chain struct {
+	combinator Combinator
+	validators []datatransfer.RequestValidatorV2
+}
+
+var _ datatransfer.RequestValidator = (*Chain)(nil)
+var _ datatransfer.RequestValidatorV2 = (*Chain)(nil)
+
+// NewChain returns a chain that combines the decisions of the given
+// validators with the given combinator
+func NewChain(combinator Combinator, validators ...datatransfer.RequestValidator) *Chain {
+	adapted := make([]datatransfer.RequestValidatorV2, 0, len(validators))
+	for _, validator := range validators {
+		adapted = append(adapted, Adapt(validator))
+	}
+	return &Chain{combinator, adapted}
+}
+
+// NewChainV2 is NewChain for datatransfer.RequestValidatorV2 validators
+func NewChainV2(combinator Combinator, validators ...datatransfer.RequestValidatorV2) *Chain {
+	return &Chain{combinator, validators}
+}
+
+// AllMustAccept returns a chain that accepts a request only if every
+// validator accepts it. Validators run until one rejects the request, and
+// its result and error are returned. If every validator accepts, the
+// request is paused if any validator paused it, and the last voucher result
+// given is returned. A chain with no validators rejects every request with
+// ErrNoValidators.
+func AllMustAccept(validators ...datatransfer.RequestValidator) *Chain {
+	return NewChain(CombineAllMustAccept, validators...)
+}
+
+// FirstDecides returns a chain in which the first validator that does not
+// return ErrNoDecision decides on the request. If no validator decides, the
+// request is rejected with ErrUndecided.
+func FirstDecides(validators ...datatransfer.RequestValidator) *Chain {
+	return NewChain(CombineFirstDecides, validators...)
+}
+
+// CombineAllMustAccept is the Combinator of AllMustAccept chains
+func CombineAllMustAccept(decisions []Decision, complete bool) (Decision, bool) {
+	if !complete {
+		last := decisions[len(decisions)-1]
+		return last, last.Err != nil && last.Err != datatransfer.ErrPause
+	}
+	if len(decisions) == 0 {
+		return Decision{Err: ErrNoValidators}, true
+	}
+	var outcome Decision
+	for _, decision := range decisions {
+		if decision.Result != nil {
+			outcome.Result = decision.Result
+		}
+		if decision.Err == datatransfer.ErrPause {
+			outcome.Err = datatransfer.ErrPause
+		}
+	}
+	return outcome, true
+}
+
+// CombineFirstDecides is the Combinator of FirstDecides chains
+func CombineFirstDecides(decisions []Decision, complete bool) (Decision, bool) {
+	if !complete {
+		last := decisions[len(decisions)-1]
+		return last, !xerrors.Is(last.Err, ErrNoDecision)
+	}
+	return Decision{Err: ErrUndecided}, true
+}
+
+// ValidatePush runs the validators in the chain on a push request
+func (c *Chain) ValidatePush(
+	sender peer.ID,
+	voucher datatransfer.Voucher,
+	baseCid cid.Cid,
+	selector ipld.Node) (datatransfer.VoucherResult, error) {
+	return c.ValidatePushRequest(context.Background(), datatransfer.ValidationRequest{
+		Peer:     sender,
+		Voucher:  voucher,
+		BaseCid:  baseCid,
+		Selector: selector,
+	})
+}
+
+// ValidatePull runs the validators in the chain on a pull request
+func (c *Chain) ValidatePull(
+	receiver peer.ID,
+	voucher datatransfer.Voucher,
+	baseCid cid.Cid,
+	selector ipld.Node) (datatransfer.VoucherResult, error) {
+	return c.ValidatePullRequest(context.Background(), datatransfer.ValidationRequest{
+		Peer:     receiver,
+		IsPull:   true,
+		Voucher:  voucher,
+		BaseCid:  baseCid,
+		Selector: selector,
+	})
+}
+
+// ValidatePushRequest runs the validators in the chain on a push request
+func (c *Chain) ValidatePushRequest(ctx context.Context, request datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	return c.validate(func(validator datatransfer.RequestValidatorV2) (datatransfer.VoucherResult, error) {
+		return validator.ValidatePushRequest(ctx, request)
+	})
+}
+
+// ValidatePullRequest runs the validators in the chain on a pull request
+func (c *Chain) ValidatePullRequest(ctx context.Context, request datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	return c.validate(func(validator datatransfer.RequestValidatorV2) (datatransfer.VoucherResult, error) {
+		return validator.ValidatePullRequest(ctx, request)
+	})
+}
+
+func (c *Chain) validate(run func(datatransfer.RequestValidatorV2) (datatransfer.VoucherResult, error)) (datatransfer.VoucherResult, error) {
+	decisions := make([]Decision, 0, len(c.validators))
+	for _, validator := range c.validators {
+		result, err := run(validator)
+		decisions = append(decisions, Decision{result, err})
+		if outcome, decided := c.combinator(decisions, false); decided {
+			return outcome.Result, outcome.Err
+		}
+	}
+	outcome, decided := c.combinator(decisions, true)
+	if !decided {
+		return nil, xerrors.New("validator chain did not decide on the request")
+	}
+	return outcome.Result, outcome.Err
+}
@@ -0,0 +1,200 @@
+package validators_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-data-transfer/testutil"
+	"github.com/filecoin-project/go-data-transfer/validators"
+)
+
+// fixedValidator makes the same decision on every request, counting the
+// requests it sees
+type fixedValidator struct {
+	result datatransfer.VoucherResult
+	err    error
+	calls  int
+}
+
+func (fv *fixedValidator) ValidatePush(peer.ID, datatransfer.Voucher, cid.Cid, ipld.Node) (datatransfer.VoucherResult, error) {
+	fv.calls++
+	return fv.result, fv.err
+}
+
+func (fv *fixedValidator) ValidatePull(peer.ID, datatransfer.Voucher, cid.Cid, ipld.Node) (datatransfer.VoucherResult, error) {
+	fv.calls++
+	return fv.result, fv.err
+}
+
+func TestChains(t *testing.T) {
+	errRejected := errors.New("rejected")
+	result1 := testutil.NewFakeDTType()
+	result2 := testutil.NewFakeDTType()
+
+	testCases := map[string]struct {
+		chain          func(...datatransfer.RequestValidator) *validators.Chain
+		validators     []*fixedValidator
+		expectedResult datatransfer.VoucherResult
+		expectedErr    error
+		expectedCalls  []int
+	}{
+		"all must accept, all accept": {
+			chain:          validators.AllMustAccept,
+			validators:     []*fixedValidator{{result: result1}, {}},
+			expectedResult: result1,
+			expectedCalls:  []int{1, 1},
+		},
+		"all must accept, last result is used": {
+			chain:          validators.AllMustAccept,
+			validators:     []*fixedValidator{{result: result1}, {result: result2}},
+			expectedResult: result2,
+			expectedCalls:  []int{1, 1},
+		},
+		"all must accept, one pauses": {
+			chain:          validators.AllMustAccept,
+			validators:     []*fixedValidator{{result: result1, err: datatransfer.ErrPause}, {}},
+			expectedResult: result1,
+			expectedErr:    datatransfer.ErrPause,
+			expectedCalls:  []int{1, 1},
+		},
+		"all must accept, first rejection ends the chain": {
+			chain:          validators.AllMustAccept,
+			validators:     []*fixedValidator{{result: result1}, {result: result2, err: errRejected}, {}},
+			expectedResult: result2,
+			expectedErr:    errRejected,
+			expectedCalls:  []int{1, 1, 0},
+		},
+		"all must accept, no validators": {
+			chain:       validators.AllMustAccept,
+			expectedErr: validators.ErrNoValidators,
+		},
+		"first decides, first decision is used": {
+			chain:          validators.FirstDecides,
+			validators:     []*fixedValidator{{err: validators.ErrNoDecision}, {result: result1, err: errRejected}, {}},
+			expectedResult: result1,
+			expectedErr:    errRejected,
+			expectedCalls:  []int{1, 1, 0},
+		},
+		"first decides, acceptance is a decision": {
+			chain:          validators.FirstDecides,
+			validators:     []*fixedValidator{{result: result1}, {err: errRejected}},
+			expectedResult: result1,
+			expectedCalls:  []int{1, 0},
+		},
+		"first decides, wrapped no decision": {
+			chain:          validators.FirstDecides,
+			validators:     []*fixedValidator{{err: xerrors.Errorf("unknown voucher: %w", validators.ErrNoDecision)}, {result: result1}},
+			expectedResult: result1,
+			expectedCalls:  []int{1, 1},
+		},
+		"first decides, no decision": {
+			chain:         validators.FirstDecides,
+			validators:    []*fixedValidator{{err: validators.ErrNoDecision}, {err: validators.ErrNoDecision}},
+			expectedErr:   validators.ErrUndecided,
+			expectedCalls: []int{1, 1},
+		},
+	}
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			for _, validate := range []string{"push", "pull"} {
+				chained := make([]datatransfer.RequestValidator, 0, len(data.validators))
+				for _, validator := range data.validators {
+					validator.calls = 0
+					chained = append(chained, validator)
+				}
+				chain := data.chain(chained...)
+				var result datatransfer.VoucherResult
+				var err error
+				if validate == "push" {
+					result, err = chain.ValidatePush(peer.ID("sender"), testutil.NewFakeDTType(), cid.Undef, nil)
+				} else {
+					result, err = chain.ValidatePull(peer.ID("receiver"), testutil.NewFakeDTType(), cid.Undef, nil)
+				}
+				require.Equal(t, data.expectedErr, err, validate)
+				require.Equal(t, data.expectedResult, result, validate)
+				for i, validator := range data.validators {
+					require.Equal(t, data.expectedCalls[i], validator.calls, validate)
+				}
+			}
+		})
+	}
+}
+
+func TestCustomCombinator(t *testing.T) {
+	// accept if any validator accepts, otherwise return the last rejection
+	anyAccepts := func(decisions []validators.Decision, complete bool) (validators.Decision, bool) {
+		last := decisions[len(decisions)-1]
+		if last.Err == nil || complete {
+			return last, true
+		}
+		return validators.Decision{}, false
+	}
+	errRejected := errors.New("rejected")
+
+	reject := &fixedValidator{err: errRejected}
+	accept := &fixedValidator{}
+	result, err := validators.NewChain(anyAccepts, reject, accept).ValidatePush(peer.ID("sender"), testutil.NewFakeDTType(), cid.Undef, nil)
+	require.NoError(t, err)
+	require.Nil(t, result)
+
+	_, err = validators.NewChain(anyAccepts, reject, reject).ValidatePush(peer.ID("sender"), testutil.NewFakeDTType(), cid.Undef, nil)
+	require.Equal(t, errRejected, err)
+}
+
+// contextValidator implements both validator interfaces, recording which one
+// is used
+type contextValidator struct {
+	fixedValidator
+	v2Calls int
+}
+
+func (cv *contextValidator) ValidatePushRequest(context.Context, datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	cv.v2Calls++
+	return nil, nil
+}
+
+func (cv *contextValidator) ValidatePullRequest(context.Context, datatransfer.ValidationRequest) (datatransfer.VoucherResult, error) {
+	cv.v2Calls++
+	return nil, nil
+}
+
+func TestAdapt(t *testing.T) {
+	ctx := context.Background()
+	request := datatransfer.ValidationRequest{
+		Peer:     peer.ID("sender"),
+		Voucher:  testutil.NewFakeDTType(),
+		BaseCid:  testutil.GenerateCids(1)[0],
+		Selector: testutil.AllSelector(),
+	}
+
+	result := testutil.NewFakeDTType()
+	errRejected := errors.New("rejected")
+	validator := &fixedValidator{result: result, err: errRejected}
+	adapted := validators.Adapt(validator)
+	validated, err := adapted.ValidatePushRequest(ctx, request)
+	require.Equal(t, errRejected, err)
+	require.Equal(t, result, validated)
+	_, err = adapted.ValidatePullRequest(ctx, request)
+	require.Equal(t, errRejected, err)
+	require.Equal(t, 2, validator.calls)
+
+	both := &contextValidator{}
+	_, err = validators.Adapt(both).ValidatePushRequest(ctx, request)
+	require.NoError(t, err)
+	require.Equal(t, 1, both.v2Calls)
+	require.Equal(t, 0, both.calls)
+
+	// v1 chains run v2 validators in them
+	_, err = validators.NewChainV2(validators.CombineAllMustAccept, both, adapted).ValidatePull(peer.ID("receiver"), testutil.NewFakeDTType(), cid.Undef, nil)
+	require.Equal(t, errRejected, err)
+	require.Equal(t, 2, both.v2Calls)
+	require.Equal(t, 3, validator.calls)
+}